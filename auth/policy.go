@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// Principal is who an authenticated request is made by; the zero Principal has no role and may do nothing.
+// API clients act for the user who registered them, with the role of that user, but only within their Scopes
+type Principal struct {
+	UserID   int
+	Role     string
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope tells whether the principal may make requests that need scope; users have every scope
+func (principal Principal) HasScope(scope string) bool {
+	if principal.ClientID == "" {
+		return true
+	}
+	for _, allowed := range principal.Scopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Access is what a principal wants to do with a resource
+type Access int
+
+const (
+	Read Access = iota
+	Write
+)
+
+// ForbiddenError refuses a request of a principal that is authenticated, but not allowed to make it
+type ForbiddenError struct {
+	Reason string
+}
+
+func (err *ForbiddenError) Error() string {
+	return "forbidden: " + err.Reason
+}
+
+func (err *ForbiddenError) Kind() db.ErrorKind { return db.KindForbidden }
+func (err *ForbiddenError) Code() string       { return "forbidden" }
+
+// Policy decides who may use which users and accounts, and everything that belongs to them. Admins may
+// do everything and support staff may read everything; customers may only use what they own, where
+// everything that moves money needs the account the money leaves to be theirs.
+// Resources that do not exist are reported with the error of db, so they are answered like before
+type Policy struct {
+	db db.DbInterface
+}
+
+func NewPolicy(database db.DbInterface) *Policy {
+	return &Policy{db: database}
+}
+
+// check applies the rules of the roles; owns decides for customers
+func (policy *Policy) check(principal Principal, access Access, owns func() error) error {
+	switch principal.Role {
+	case db.RoleAdmin:
+		return nil
+	case db.RoleSupport:
+		if access == Read {
+			return nil
+		}
+		return &ForbiddenError{Reason: "support staff can only read"}
+	case db.RoleCustomer:
+		return owns()
+	}
+	return &ForbiddenError{Reason: "no role"}
+}
+
+// Staff allows support staff and admins, e.g. to search all users
+func (policy *Policy) Staff(principal Principal) error {
+	if principal.Role == db.RoleSupport || principal.Role == db.RoleAdmin {
+		return nil
+	}
+	return &ForbiddenError{Reason: "only support staff and admins can do this"}
+}
+
+// Admin allows admins only, e.g. to change interest rates or overdraft limits
+func (policy *Policy) Admin(principal Principal) error {
+	if principal.Role == db.RoleAdmin {
+		return nil
+	}
+	return &ForbiddenError{Reason: "only admins can do this"}
+}
+
+// User allows customers to use only their own user; userId is a path value, as GetUser takes it
+func (policy *Policy) User(principal Principal, access Access, userId string) error {
+	return policy.check(principal, access, func() error {
+		if userId != fmt.Sprint(principal.UserID) {
+			return &ForbiddenError{Reason: fmt.Sprintf("user %d cannot access user %s", principal.UserID, userId)}
+		}
+		return nil
+	})
+}
+
+// Account allows customers to use only their own accounts
+func (policy *Policy) Account(principal Principal, access Access, accountId int) error {
+	return policy.check(principal, access, func() error {
+		return policy.ownsAccount(principal, accountId)
+	})
+}
+
+func (policy *Policy) ownsAccount(principal Principal, accountId int) error {
+	account, err := policy.db.GetAccount(accountId)
+	if err != nil {
+		return err
+	}
+	if account.UserID != principal.UserID {
+		return &ForbiddenError{Reason: fmt.Sprintf("user %d cannot access account %d", principal.UserID, accountId)}
+	}
+	return nil
+}
+
+// ownsAnyAccount allows customers who own one of the accounts; accounts that are not found, such as the
+// system accounts of the bank, belong to nobody
+func (policy *Policy) ownsAnyAccount(principal Principal, resource string, accountIds ...int) error {
+	for _, accountId := range accountIds {
+		err := policy.ownsAccount(principal, accountId)
+		var notFound *db.AccountNotFoundError
+		var forbidden *ForbiddenError
+		switch {
+		case err == nil:
+			return nil
+		case !errors.As(err, &notFound) && !errors.As(err, &forbidden):
+			return err
+		}
+	}
+	return &ForbiddenError{Reason: fmt.Sprintf("user %d cannot access %s", principal.UserID, resource)}
+}
+
+// Transaction allows customers to read the transactions into and out of their accounts; writing is
+// reversing, which takes money out of the account that received it
+func (policy *Policy) Transaction(principal Principal, access Access, transactionId int) error {
+	return policy.check(principal, access, func() error {
+		transaction, err := policy.db.GetTransaction(transactionId)
+		if err != nil {
+			return err
+		}
+		resource := fmt.Sprintf("transaction %d", transactionId)
+		if access == Write {
+			return policy.ownsAnyAccount(principal, resource, transaction.ToAccountID)
+		}
+		return policy.ownsAnyAccount(principal, resource, transaction.FromAccountID, transaction.ToAccountID)
+	})
+}
+
+// Hold allows the customers on both sides of a hold to read it; writing is capturing or voiding it, which
+// only the payee does, as the payer could otherwise void an authorization the payee relies on
+func (policy *Policy) Hold(principal Principal, access Access, holdId int) error {
+	return policy.check(principal, access, func() error {
+		hold, err := policy.db.GetHold(holdId)
+		if err != nil {
+			return err
+		}
+		resource := fmt.Sprintf("hold %d", holdId)
+		if access == Write {
+			return policy.ownsAnyAccount(principal, resource, hold.ToAccountID)
+		}
+		return policy.ownsAnyAccount(principal, resource, hold.FromAccountID, hold.ToAccountID)
+	})
+}
+
+// StandingOrder allows the customer who pays a standing order to use it
+func (policy *Policy) StandingOrder(principal Principal, access Access, orderId int) error {
+	return policy.check(principal, access, func() error {
+		order, err := policy.db.GetStandingOrder(orderId)
+		if err != nil {
+			return err
+		}
+		return policy.ownsAnyAccount(principal, fmt.Sprintf("standing order %d", orderId), order.FromAccountID)
+	})
+}
+
+// BatchTransfer allows customers to read the batches that moved money into or out of their accounts
+func (policy *Policy) BatchTransfer(principal Principal, access Access, batchId int) error {
+	return policy.check(principal, access, func() error {
+		batch, err := policy.db.GetBatchTransfer(batchId)
+		if err != nil {
+			return err
+		}
+		accountIds := []int{}
+		for _, transaction := range batch.Transactions {
+			accountIds = append(accountIds, transaction.FromAccountID, transaction.ToAccountID)
+		}
+		return policy.ownsAnyAccount(principal, fmt.Sprintf("batch transfer %d", batchId), accountIds...)
+	})
+}
+
+// PaymentFile allows the customer who pays every line of a payment file to use it
+func (policy *Policy) PaymentFile(principal Principal, access Access, fileId int) error {
+	return policy.check(principal, access, func() error {
+		file, err := policy.db.GetPaymentFile(fileId)
+		if err != nil {
+			return err
+		}
+		if len(file.Lines) == 0 {
+			return &ForbiddenError{Reason: fmt.Sprintf("user %d cannot access payment file %d", principal.UserID, fileId)}
+		}
+		for _, line := range file.Lines {
+			if err := policy.ownsAccount(principal, line.FromAccountID); err != nil {
+				return &ForbiddenError{Reason: fmt.Sprintf("user %d cannot access payment file %d", principal.UserID, fileId)}
+			}
+		}
+		return nil
+	})
+}
+
+// PaymentInstructions allows customers to upload payment files that only pay from their own accounts;
+// lines that cannot be read or pay from accounts that do not exist are left to the validation of the file
+func (policy *Policy) PaymentInstructions(principal Principal, instructions []db.PaymentInstruction) error {
+	return policy.check(principal, Write, func() error {
+		for _, instruction := range instructions {
+			if instruction.Error != "" {
+				continue
+			}
+			err := policy.ownsAccount(principal, instruction.FromAccountID)
+			var notFound *db.AccountNotFoundError
+			var forbidden *ForbiddenError
+			switch {
+			case errors.As(err, &forbidden):
+				return &ForbiddenError{Reason: fmt.Sprintf("line %d: %s", instruction.Line, forbidden.Reason)}
+			case err != nil && !errors.As(err, &notFound):
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// SignatureMaxSkew is how far the timestamp of a signed request may be from the clock of the server
+const SignatureMaxSkew = 5 * time.Minute
+
+// NewSigningSecret creates the secret an API client signs requests with; unlike API keys it is stored as
+// it is, as the server needs it to check the signatures
+func NewSigningSecret() (string, error) {
+	secret, _, err := NewRefreshToken()
+	return secret, err
+}
+
+// StringToSign is what a request is signed over: its method, its path with the query, the timestamp, the
+// nonce and the hex SHA-256 hash of the body, each on its own line
+func StringToSign(method string, uri string, timestamp string, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{method, uri, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+}
+
+// SignRequest is the hex HMAC-SHA256 of a string to sign with the signing secret of a client
+func SignRequest(secret string, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckSignature compares a signature in constant time, so the time does not tell how much of it is right
+func CheckSignature(secret string, stringToSign string, signature string) bool {
+	return hmac.Equal([]byte(strings.ToLower(signature)), []byte(SignRequest(secret, stringToSign)))
+}
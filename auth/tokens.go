@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessTokenTTL is how long an access token is valid; access tokens cannot be revoked, so it is short
+const AccessTokenTTL = 15 * time.Minute
+
+// RefreshTokenTTL is how long a refresh token can be used to get new access tokens
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// MinKeyLength is the shortest key access tokens can be signed with, in bytes
+const MinKeyLength = 32
+
+const tokenIssuer = "bank-api"
+
+// tokenHeader is the only JWT header that is issued and accepted
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the claims of an access token; the subject is the id of the user it was issued to. Tokens
+// of API clients also name the client and its scopes, separated by spaces, as in RFC 9068
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+}
+
+// UserID is the id of the user the token was issued to
+func (claims Claims) UserID() (int, error) {
+	return strconv.Atoi(claims.Subject)
+}
+
+// Scopes are the scopes of a token of an API client
+func (claims Claims) Scopes() []string {
+	return strings.Fields(claims.Scope)
+}
+
+// TokenSigner issues and verifies access tokens, which are JWTs signed with HMAC-SHA256
+type TokenSigner struct {
+	key []byte
+}
+
+func NewTokenSigner(key []byte) (*TokenSigner, error) {
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("the token key must be at least %d bytes long", MinKeyLength)
+	}
+	return &TokenSigner{key: key}, nil
+}
+
+func (signer *TokenSigner) sign(content string) string {
+	mac := hmac.New(sha256.New, signer.key)
+	mac.Write([]byte(content))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue creates an access token for a user that is valid for AccessTokenTTL from now
+func (signer *TokenSigner) Issue(userId int, now time.Time) (string, error) {
+	return signer.issue(Claims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.Itoa(userId),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+	})
+}
+
+// IssueClient creates an access token for an API client of a user, which only allows scopes
+func (signer *TokenSigner) IssueClient(userId int, clientId string, scopes []string, now time.Time) (string, error) {
+	return signer.issue(Claims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.Itoa(userId),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		ClientID:  clientId,
+		Scope:     strings.Join(scopes, " "),
+	})
+}
+
+func (signer *TokenSigner) issue(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	content := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return content + "." + signer.sign(content), nil
+}
+
+// Verify checks the signature and expiry of an access token and returns its claims
+func (signer *TokenSigner) Verify(token string, now time.Time) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("malformed token")
+	}
+	// the header is compared as a whole, so tokens with another algorithm, or none, are refused
+	if parts[0] != tokenHeader {
+		return claims, fmt.Errorf("unsupported token header")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signer.sign(parts[0]+"."+parts[1]))) {
+		return claims, fmt.Errorf("invalid signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("malformed token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("malformed token")
+	}
+	if claims.Issuer != tokenIssuer {
+		return claims, fmt.Errorf("unknown issuer %q", claims.Issuer)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, fmt.Errorf("token has expired")
+	}
+	if _, err := claims.UserID(); err != nil {
+		return claims, fmt.Errorf("invalid subject %q", claims.Subject)
+	}
+	return claims, nil
+}
+
+// NewRefreshToken creates a random refresh token; only its hash is stored
+func NewRefreshToken() (string, string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	return token, HashToken(token), nil
+}
+
+// NewClientCredentials creates the public client id of an API client, its API key and the hash of the
+// key, which is all that is stored of it
+func NewClientCredentials() (string, string, string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", "", err
+	}
+	token, _, err := NewRefreshToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key := apiKeyPrefix + token
+	return "client_" + hex.EncodeToString(random), key, HashToken(key), nil
+}
+
+// apiKeyPrefix makes API keys easy to recognize, e.g. by secret scanners
+const apiKeyPrefix = "bk_"
+
+// HashToken is the hash a refresh token or API key is stored and looked up by; they are random, so they need no salt
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Frozen accounts can still receive money but cannot send any; closed accounts can do neither
+const (
+	AccountActive = "active"
+	AccountFrozen = "frozen"
+	AccountClosed = "closed"
+)
+
+type AccountStatusError struct {
+	AccountID int
+	Status    string
+	Reason    string
+}
+
+func (err *AccountStatusError) Error() string {
+	return fmt.Sprintf("account %d is %s: %s", err.AccountID, err.Status, err.Reason)
+}
+
+// checkTransfer refuses transfers out of accounts that are not active and into closed accounts
+func checkTransfer(fromAccount Account, toAccount Account) error {
+	if fromAccount.Status != AccountActive {
+		return &AccountStatusError{AccountID: fromAccount.ID, Status: fromAccount.Status, Reason: "cannot send money"}
+	}
+	if toAccount.Status == AccountClosed {
+		return &AccountStatusError{AccountID: toAccount.ID, Status: toAccount.Status, Reason: "cannot receive money"}
+	}
+	return nil
+}
+
+// checkStatusChange allows freezing active accounts and unfreezing frozen ones; closing goes through CloseAccount
+func checkStatusChange(account Account, status string) error {
+	switch {
+	case account.Status == AccountActive && status == AccountFrozen:
+		return nil
+	case account.Status == AccountFrozen && status == AccountActive:
+		return nil
+	case status == AccountClosed:
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: "accounts are closed by sweeping their balance"}
+	default:
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: fmt.Sprintf("cannot become %s", status)}
+	}
+}
+
+// checkClose lists what keeps an account from being closed; activeHolds is the number of holds on it
+func checkClose(account Account, activeHolds int, sweepToAccountId *int) error {
+	if account.Status != AccountActive {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: "only active accounts can be closed"}
+	}
+	if activeHolds > 0 {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: fmt.Sprintf("cannot be closed with %d active holds", activeHolds)}
+	}
+	if account.Balance.IsNegative() {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: fmt.Sprintf("cannot be closed while it owes %s", NewMoney(-account.Balance.Amount, account.Balance.Currency))}
+	}
+	if account.Balance.IsPositive() && sweepToAccountId == nil {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: "an account to sweep the balance to is required"}
+	}
+	if sweepToAccountId != nil && *sweepToAccountId == account.ID {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: "cannot sweep the balance into the account itself"}
+	}
+	return nil
+}
+
+// SetAccountStatus freezes or unfreezes an account
+func (sqlite *SQLiteDb) SetAccountStatus(accountId int, status string) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if err := checkStatusChange(account, status); err != nil {
+		return account, err
+	}
+
+	if _, err := sqlite.client.Exec("UPDATE accounts SET status = ? WHERE id = ?", status, accountId); err != nil {
+		return account, err
+	}
+	account.Status = status
+
+	return account, nil
+}
+
+// CloseAccount moves the whole balance to the account sweepToAccountId through the transfer path,
+// cancels the standing orders of the account and closes it. Closed accounts cannot be reopened.
+func (sqlite *SQLiteDb) CloseAccount(accountId int, sweepToAccountId *int) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return Account{}, err
+	}
+
+	account, err := sqlite.closeAccount(tx, accountId, sweepToAccountId)
+	if err != nil {
+		_ = tx.Rollback()
+		return account, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (sqlite *SQLiteDb) closeAccount(tx *sql.Tx, accountId int, sweepToAccountId *int) (Account, error) {
+	account, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", accountId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return account, &AccountNotFoundError{AccountID: accountId}
+		}
+		return account, err
+	}
+
+	var activeHolds int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM holds WHERE from_account_id = ? AND status = ?", accountId, HoldActive).Scan(&activeHolds); err != nil {
+		return account, err
+	}
+	if err := checkClose(account, activeHolds, sweepToAccountId); err != nil {
+		return account, err
+	}
+
+	if sweepToAccountId != nil {
+		var sweepTo int
+		if err := tx.QueryRow("SELECT id FROM accounts WHERE id = ?", *sweepToAccountId).Scan(&sweepTo); err != nil {
+			if err == sql.ErrNoRows {
+				return account, &AccountNotFoundError{AccountID: *sweepToAccountId}
+			}
+			return account, err
+		}
+	}
+
+	if account.Balance.IsPositive() {
+		sweep, err := sqlite.transfer(tx, accountId, *sweepToAccountId, account.Balance)
+		if err != nil {
+			return account, err
+		}
+		if sweep.Succeeded == 0 {
+			return account, insufficientFunds(account, account.Balance)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE accounts SET status = ? WHERE id = ?", AccountClosed, accountId); err != nil {
+		return account, err
+	}
+
+	if err := cancelStandingOrders(tx, accountId); err != nil {
+		return account, err
+	}
+
+	account.Status = AccountClosed
+	account.Balance = NewMoney(0, account.Balance.Currency)
+	account.AvailableBalance = NewMoney(0, account.Balance.Currency)
+
+	return account, nil
+}
+
+// cancelStandingOrders cancels the active standing orders paying into or out of an account
+func cancelStandingOrders(tx *sql.Tx, accountId int) error {
+	_, err := tx.Exec("UPDATE standing_orders SET status = ?, next_run = NULL WHERE status = ? AND (from_account_id = ? OR to_account_id = ?)",
+		StandingOrderCancelled, StandingOrderActive, accountId, accountId)
+	return err
+}
@@ -0,0 +1,104 @@
+package db
+
+import "database/sql"
+
+// directions of an AccountTransaction
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// runningBalances works backwards from the current balance of account through its transactions, sorted
+// oldest first. posted holds what each transaction posted to the account; failed transactions posted nothing.
+func runningBalances(account Account, transactions []Transaction, posted map[int]int64) []AccountTransaction {
+	result := make([]AccountTransaction, len(transactions))
+	balance := account.Balance.Amount
+	for i := len(transactions) - 1; i >= 0; i-- {
+		direction := DirectionIncoming
+		if transactions[i].FromAccountID == account.ID {
+			direction = DirectionOutgoing
+		}
+
+		result[i] = AccountTransaction{Transaction: transactions[i], Direction: direction, RunningBalance: NewMoney(balance, account.Balance.Currency)}
+		balance -= posted[transactions[i].ID]
+	}
+	return result
+}
+
+// GetAccountTransactions returns the transactions into and out of an account, oldest first
+func (sqlite *SQLiteDb) GetAccountTransactions(accountId int) ([]AccountTransaction, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	// the balance and the postings have to be read at the same time for the running balance to add up
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := sqlite.accountTransactions(tx, accountId)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (sqlite *SQLiteDb) accountTransactions(tx *sql.Tx, accountId int) ([]AccountTransaction, error) {
+	account, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", accountId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, &AccountNotFoundError{AccountID: accountId}
+		}
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT "+transactionColumns+" FROM transactions WHERE from_account_id = ? OR to_account_id = ? ORDER BY id", accountId, accountId)
+	if err != nil {
+		return nil, err
+	}
+	transactions := []Transaction{}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT journal_entries.transaction_id, SUM(postings.amount)
+        FROM postings
+        INNER JOIN journal_entries ON journal_entries.id = postings.entry_id
+        WHERE postings.account_id = ? AND journal_entries.transaction_id IS NOT NULL
+        GROUP BY journal_entries.transaction_id`, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posted := map[int]int64{}
+	for rows.Next() {
+		var transactionId int
+		var amount int64
+		if err := rows.Scan(&transactionId, &amount); err != nil {
+			return nil, err
+		}
+		posted[transactionId] = amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runningBalances(account, transactions, posted), nil
+}
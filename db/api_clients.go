@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Scopes limit what an API client may do; the requests of users are not limited by scopes
+const (
+	ScopeUsersRead         = "users:read"
+	ScopeUsersWrite        = "users:write"
+	ScopeAccountsRead      = "accounts:read"
+	ScopeAccountsWrite     = "accounts:write"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeAuditRead         = "audit:read"
+	ScopeRatesWrite        = "rates:write"
+)
+
+// Scopes are all scopes an API client can be given
+var Scopes = []string{
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeAccountsRead, ScopeAccountsWrite,
+	ScopeTransactionsRead, ScopeTransactionsWrite,
+	ScopeAuditRead, ScopeRatesWrite,
+}
+
+const maxClientNameLength = 100
+
+type InvalidAPIClientError struct {
+	Field  string
+	Reason string
+}
+
+func (err *InvalidAPIClientError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Reason)
+}
+
+// APIClientNotFoundError is also returned for clients that were revoked
+type APIClientNotFoundError struct {
+	ClientID string
+}
+
+func (err *APIClientNotFoundError) Error() string {
+	return fmt.Sprintf("API client %s does not exist", err.ClientID)
+}
+
+// ValidateScopes checks that scopes are known and not empty; the same scope may not be given twice
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return &InvalidAPIClientError{Field: "scopes", Reason: "must not be empty"}
+	}
+	seen := map[string]bool{}
+	for _, scope := range scopes {
+		known := false
+		for _, valid := range Scopes {
+			known = known || scope == valid
+		}
+		if !known {
+			return &InvalidAPIClientError{Field: "scopes", Reason: fmt.Sprintf("unknown scope %q", scope)}
+		}
+		if seen[scope] {
+			return &InvalidAPIClientError{Field: "scopes", Reason: fmt.Sprintf("scope %q is given twice", scope)}
+		}
+		seen[scope] = true
+	}
+	return nil
+}
+
+func validateAPIClient(client APIClient) error {
+	name := strings.TrimSpace(client.Name)
+	if name == "" {
+		return &InvalidAPIClientError{Field: "name", Reason: "must not be empty"}
+	}
+	if len(name) > maxClientNameLength {
+		return &InvalidAPIClientError{Field: "name", Reason: fmt.Sprintf("must be at most %d characters", maxClientNameLength)}
+	}
+	return ValidateScopes(client.Scopes)
+}
+
+const apiClientColumns = "id, client_id, user_id, name, scopes, key_hash, signing_secret, created_at, revoked_at"
+
+// scopes are stored separated by spaces, like the scope parameter of OAuth2
+func scanAPIClient(row rowScanner) (APIClient, error) {
+	var client APIClient
+	var scopes string
+	var revokedAt sql.NullTime
+	if err := row.Scan(&client.ID, &client.ClientID, &client.UserID, &client.Name, &scopes, &client.KeyHash, &client.SigningSecret, &client.CreatedAt, &revokedAt); err != nil {
+		return client, err
+	}
+	client.Scopes = strings.Fields(scopes)
+	if revokedAt.Valid {
+		client.RevokedAt = &revokedAt.Time
+	}
+	return client, nil
+}
+
+// CreateAPIClient registers a client of an existing user; the client id, the hash of the key and the signing
+// secret are chosen by the caller
+func (sqlite *SQLiteDb) CreateAPIClient(client APIClient) (APIClient, error) {
+	if err := sqlite.init(); err != nil {
+		return client, err
+	}
+
+	client.Name = strings.TrimSpace(client.Name)
+	if err := validateAPIClient(client); err != nil {
+		return client, err
+	}
+	if _, err := sqlite.GetUser(fmt.Sprint(client.UserID)); err != nil {
+		return client, err
+	}
+
+	client.CreatedAt = time.Now().UTC()
+	result, err := sqlite.client.Exec("INSERT INTO api_clients (client_id, user_id, name, scopes, key_hash, signing_secret, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		client.ClientID, client.UserID, client.Name, strings.Join(client.Scopes, " "), client.KeyHash, client.SigningSecret, client.CreatedAt)
+	if err != nil {
+		return client, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return client, err
+	}
+
+	client.ID = int(id)
+	client.RevokedAt = nil
+	return client, nil
+}
+
+// GetAPIClient finds a client that was not revoked by its client id
+func (sqlite *SQLiteDb) GetAPIClient(clientId string) (APIClient, error) {
+	if err := sqlite.init(); err != nil {
+		return APIClient{}, err
+	}
+
+	client, err := scanAPIClient(sqlite.client.QueryRow("SELECT "+apiClientColumns+" FROM api_clients WHERE client_id = ? AND revoked_at IS NULL", clientId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, &APIClientNotFoundError{ClientID: clientId}
+	}
+	return client, err
+}
+
+// GetAPIClientByKey finds a client that was not revoked by the hash of its API key
+func (sqlite *SQLiteDb) GetAPIClientByKey(keyHash string) (APIClient, error) {
+	if err := sqlite.init(); err != nil {
+		return APIClient{}, err
+	}
+
+	client, err := scanAPIClient(sqlite.client.QueryRow("SELECT "+apiClientColumns+" FROM api_clients WHERE key_hash = ? AND revoked_at IS NULL", keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return client, &APIClientNotFoundError{ClientID: "with this key"}
+	}
+	return client, err
+}
+
+// GetAPIClients returns every client of a user, including the revoked ones, oldest first
+func (sqlite *SQLiteDb) GetAPIClients(userId int) ([]APIClient, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := sqlite.client.Query("SELECT "+apiClientColumns+" FROM api_clients WHERE user_id = ? ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []APIClient{}
+	for rows.Next() {
+		client, err := scanAPIClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+// RevokeAPIClient stops a client from authenticating; the access tokens it already got are refused too
+func (sqlite *SQLiteDb) RevokeAPIClient(clientId string) (APIClient, error) {
+	if err := sqlite.init(); err != nil {
+		return APIClient{}, err
+	}
+
+	client, err := sqlite.GetAPIClient(clientId)
+	if err != nil {
+		return client, err
+	}
+
+	revokedAt := time.Now().UTC()
+	if _, err := sqlite.client.Exec("UPDATE api_clients SET revoked_at = ? WHERE id = ?", revokedAt, client.ID); err != nil {
+		return client, err
+	}
+	client.RevokedAt = &revokedAt
+	return client, nil
+}
+
+// revokeAPIClients revokes every client of a user that was not revoked yet
+func revokeAPIClients(client execer, userId int, revokedAt time.Time) error {
+	_, err := client.Exec("UPDATE api_clients SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userId)
+	return err
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Outcomes of audit events: requests answered with an error status failed, even if they were refused
+// before anything was changed
+const (
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+)
+
+// DefaultAuditLimit and MaxAuditLimit bound how many events one page of the audit log holds
+const (
+	DefaultAuditLimit = 50
+	MaxAuditLimit     = 500
+)
+
+// auditCursorSort tells audit log cursors apart from the other cursors
+const auditCursorSort = "audit"
+
+// AuditFilter narrows down a search of the audit log; fields left empty do not filter
+type AuditFilter struct {
+	ActorUserID   *int
+	ActorClientID string
+	Target        string // e.g. "account:1"
+	Route         string // prefix of the route, e.g. "POST /account"
+	RequestID     string
+	Outcome       string
+	From          *time.Time // inclusive
+	To            *time.Time // exclusive
+	Limit         int
+	Cursor        string
+}
+
+// AuditPage is one page of the audit log, newest first; Next is the cursor of the following page, and is
+// empty on the last one
+type AuditPage struct {
+	Events []AuditEvent
+	Next   string
+}
+
+// ValidateAuditFilter checks the filter and fills in the default limit
+func ValidateAuditFilter(filter AuditFilter) (AuditFilter, error) {
+	if filter.Outcome != "" && filter.Outcome != AuditSucceeded && filter.Outcome != AuditFailed {
+		return filter, &InvalidFilterError{Reason: "outcome must be succeeded or failed"}
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultAuditLimit
+	}
+	if filter.Limit < 0 || filter.Limit > MaxAuditLimit {
+		return filter, &InvalidFilterError{Reason: "limit must be between 1 and 500"}
+	}
+
+	if filter.Cursor != "" {
+		if _, err := decodeCursor(filter.Cursor, auditCursorSort); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+func paginateAuditEvents(events []AuditEvent, filter AuditFilter) AuditPage {
+	page := AuditPage{Events: events}
+	if len(events) > filter.Limit {
+		page.Events = events[:filter.Limit]
+		page.Next = encodeCursor(auditCursorSort, page.Events[filter.Limit-1].ID)
+	}
+	return page
+}
+
+// CreateAuditEvent appends an event to the audit log
+func (sqlite *SQLiteDb) CreateAuditEvent(event AuditEvent) (AuditEvent, error) {
+	if err := sqlite.init(); err != nil {
+		return event, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return event, err
+	}
+
+	event, err = sqlite.createAuditEvent(tx, event)
+	if err != nil {
+		_ = tx.Rollback()
+		return event, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return event, err
+	}
+
+	return event, nil
+}
+
+func (sqlite *SQLiteDb) createAuditEvent(tx *sql.Tx, event AuditEvent) (AuditEvent, error) {
+	result, err := tx.Exec(`INSERT INTO audit_events (timestamp, actor_user_id, actor_client_id, route, request_id, source_ip, before_value, after_value, outcome, status_code, error_code)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Timestamp, event.ActorUserID, event.ActorClientID, event.Route, event.RequestID, event.SourceIP,
+		nullJSON(event.Before), nullJSON(event.After), event.Outcome, event.StatusCode, event.ErrorCode)
+	if err != nil {
+		return event, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return event, err
+	}
+	event.ID = int(id)
+
+	for _, target := range event.Targets {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO audit_targets (event_id, target) VALUES (?, ?)", event.ID, target); err != nil {
+			return event, err
+		}
+	}
+	return event, nil
+}
+
+// nullJSON stores missing JSON as NULL
+func nullJSON(value []byte) any {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
+
+const auditEventColumns = "id, timestamp, actor_user_id, actor_client_id, route, request_id, source_ip, before_value, after_value, outcome, status_code, error_code"
+
+func scanAuditEvent(row rowScanner) (AuditEvent, error) {
+	var event AuditEvent
+	var actorUserId sql.NullInt64
+	var before, after sql.NullString
+	if err := row.Scan(&event.ID, &event.Timestamp, &actorUserId, &event.ActorClientID, &event.Route, &event.RequestID, &event.SourceIP,
+		&before, &after, &event.Outcome, &event.StatusCode, &event.ErrorCode); err != nil {
+		return event, err
+	}
+	if actorUserId.Valid {
+		actor := int(actorUserId.Int64)
+		event.ActorUserID = &actor
+	}
+	if before.Valid {
+		event.Before = []byte(before.String)
+	}
+	if after.Valid {
+		event.After = []byte(after.String)
+	}
+	return event, nil
+}
+
+// SearchAuditEvents finds the events of the audit log, newest first
+func (sqlite *SQLiteDb) SearchAuditEvents(filter AuditFilter) (AuditPage, error) {
+	if err := sqlite.init(); err != nil {
+		return AuditPage{}, err
+	}
+
+	filter, err := ValidateAuditFilter(filter)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	conditions := []string{}
+	args := []any{}
+	if filter.ActorUserID != nil {
+		conditions = append(conditions, "actor_user_id = ?")
+		args = append(args, *filter.ActorUserID)
+	}
+	if filter.ActorClientID != "" {
+		conditions = append(conditions, "actor_client_id = ?")
+		args = append(args, filter.ActorClientID)
+	}
+	if filter.Target != "" {
+		conditions = append(conditions, "id IN (SELECT event_id FROM audit_targets WHERE target = ?)")
+		args = append(args, filter.Target)
+	}
+	if filter.Route != "" {
+		conditions = append(conditions, `route LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(filter.Route)+"%")
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, "request_id = ?")
+		args = append(args, filter.RequestID)
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.Cursor != "" {
+		lastId, _ := decodeCursor(filter.Cursor, auditCursorSort)
+		conditions = append(conditions, "id < ?")
+		args = append(args, lastId)
+	}
+
+	query := "SELECT " + auditEventColumns + " FROM audit_events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	rows, err := sqlite.client.Query(query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return AuditPage{}, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return AuditPage{}, err
+	}
+	rows.Close()
+
+	for i := range events {
+		if events[i].Targets, err = sqlite.getAuditTargets(events[i].ID); err != nil {
+			return AuditPage{}, err
+		}
+	}
+
+	return paginateAuditEvents(events, filter), nil
+}
+
+// the targets are returned in the order they were recorded in, so the first one is still the one of Before and After
+func (sqlite *SQLiteDb) getAuditTargets(eventId int) ([]string, error) {
+	rows, err := sqlite.client.Query("SELECT target FROM audit_targets WHERE event_id = ? ORDER BY rowid", eventId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []string{}
+	for rows.Next() {
+		var target string
+		if err := rows.Scan(&target); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
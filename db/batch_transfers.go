@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MaxBatchLegs is the most transfers one batch transfer may hold
+const MaxBatchLegs = 100
+
+type BatchTransferNotFoundError struct {
+	BatchID int
+}
+
+func (err *BatchTransferNotFoundError) Error() string {
+	return fmt.Sprintf("batch transfer %d does not exist", err.BatchID)
+}
+
+type InvalidBatchTransferError struct {
+	Reason string
+}
+
+func (err *InvalidBatchTransferError) Error() string {
+	return "invalid batch transfer: " + err.Reason
+}
+
+// BatchTransferError tells which leg (numbered from 1) stopped a batch transfer; nothing of the batch was executed
+type BatchTransferError struct {
+	Leg int
+	Err error
+}
+
+func (err *BatchTransferError) Error() string {
+	return fmt.Sprintf("leg %d: %s", err.Leg, err.Err)
+}
+
+func (err *BatchTransferError) Unwrap() error {
+	return err.Err
+}
+
+// ValidateBatchSize checks the number of legs of a batch transfer, so a batch that is too large can be
+// refused before its legs are looked at
+func ValidateBatchSize(legs int) error {
+	if legs == 0 {
+		return &InvalidBatchTransferError{Reason: "a batch transfer needs at least one leg"}
+	}
+	if legs > MaxBatchLegs {
+		return &InvalidBatchTransferError{Reason: fmt.Sprintf("a batch transfer holds at most %d legs", MaxBatchLegs)}
+	}
+	return nil
+}
+
+// validateBatchTransfer checks the legs of a batch transfer before any of them is executed
+func validateBatchTransfer(legs []TransferLeg) error {
+	if err := ValidateBatchSize(len(legs)); err != nil {
+		return err
+	}
+
+	for i, leg := range legs {
+		if !leg.Amount.IsPositive() {
+			return &BatchTransferError{Leg: i + 1, Err: &InvalidAmountError{Amount: leg.Amount.Decimal(), Reason: "must be positive"}}
+		}
+	}
+	return nil
+}
+
+// CreateBatchTransfer executes every leg in one database transaction, in order, so later legs can spend
+// what earlier legs paid in. If any leg cannot be executed, or its outgoing account cannot cover it,
+// nothing is stored, not even a failed transaction.
+func (sqlite *SQLiteDb) CreateBatchTransfer(legs []TransferLeg) (BatchTransfer, error) {
+	if err := sqlite.init(); err != nil {
+		return BatchTransfer{}, err
+	}
+
+	if err := validateBatchTransfer(legs); err != nil {
+		return BatchTransfer{}, err
+	}
+	for i, leg := range legs {
+		if err := sqlite.checkFailedTransactions(leg.FromAccountID); err != nil {
+			if _, ok := err.(*FailedTransactionsLimitError); ok {
+				return BatchTransfer{}, err
+			}
+			return BatchTransfer{}, &BatchTransferError{Leg: i + 1, Err: err}
+		}
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return BatchTransfer{}, err
+	}
+
+	batch, err := sqlite.batchTransfer(tx, legs)
+	if err != nil {
+		_ = tx.Rollback()
+		return BatchTransfer{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return BatchTransfer{}, err
+	}
+
+	return batch, nil
+}
+
+func (sqlite *SQLiteDb) batchTransfer(tx *sql.Tx, legs []TransferLeg) (BatchTransfer, error) {
+	batch := BatchTransfer{CreatedAt: time.Now().UTC(), Transactions: []Transaction{}}
+	result, err := tx.Exec("INSERT INTO batch_transfers (created_at) VALUES (?)", batch.CreatedAt)
+	if err != nil {
+		return batch, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return batch, err
+	}
+	batch.ID = int(id)
+
+	for i, leg := range legs {
+		transaction, err := sqlite.transfer(tx, leg.FromAccountID, leg.ToAccountID, leg.Amount)
+		if err != nil {
+			return batch, &BatchTransferError{Leg: i + 1, Err: err}
+		}
+		if transaction.Succeeded != 1 {
+			fromAccount, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", leg.FromAccountID))
+			if err != nil {
+				return batch, err
+			}
+			return batch, &BatchTransferError{Leg: i + 1, Err: insufficientFunds(fromAccount, leg.Amount)}
+		}
+
+		if _, err := tx.Exec("UPDATE transactions SET batch_id = ? WHERE id = ?", batch.ID, transaction.ID); err != nil {
+			return batch, err
+		}
+		transaction.BatchID = &batch.ID
+		batch.Transactions = append(batch.Transactions, transaction)
+	}
+
+	return batch, nil
+}
+
+func (sqlite *SQLiteDb) GetBatchTransfer(batchId int) (BatchTransfer, error) {
+	if err := sqlite.init(); err != nil {
+		return BatchTransfer{}, err
+	}
+
+	batch := BatchTransfer{Transactions: []Transaction{}}
+	err := sqlite.client.QueryRow("SELECT id, created_at FROM batch_transfers WHERE id = ?", batchId).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return batch, &BatchTransferNotFoundError{BatchID: batchId}
+		}
+		return batch, err
+	}
+
+	rows, err := sqlite.client.Query("SELECT "+transactionColumns+" FROM transactions WHERE batch_id = ? ORDER BY id", batchId)
+	if err != nil {
+		return batch, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return batch, err
+		}
+		batch.Transactions = append(batch.Transactions, transaction)
+	}
+	return batch, rows.Err()
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MinPasswordLength = 12
+	MaxPasswordLength = 128
+)
+
+// InvalidCredentialsError does not tell whether the email or the password was wrong
+type InvalidCredentialsError struct{}
+
+func (err *InvalidCredentialsError) Error() string {
+	return "invalid email or password"
+}
+
+// InvalidRefreshTokenError refuses a refresh token that is unknown, expired or was revoked
+type InvalidRefreshTokenError struct {
+	Reason string
+}
+
+func (err *InvalidRefreshTokenError) Error() string {
+	return "invalid refresh token: " + err.Reason
+}
+
+// ValidatePassword checks the password a user is created with; a user with a password logs in with
+// their email, so they need one
+func ValidatePassword(user User, password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return &InvalidUserError{Field: "password", Reason: fmt.Sprintf("must be at least %d characters", MinPasswordLength)}
+	}
+	if utf8.RuneCountInString(password) > MaxPasswordLength {
+		return &InvalidUserError{Field: "password", Reason: fmt.Sprintf("must be at most %d characters", MaxPasswordLength)}
+	}
+	if strings.TrimSpace(user.Email) == "" {
+		return &InvalidUserError{Field: "email", Reason: "is required to log in with a password"}
+	}
+	return nil
+}
+
+// GetCredentials finds the credentials of the user with an email; deleted users and users without a
+// password cannot log in
+func (sqlite *SQLiteDb) GetCredentials(email string) (Credentials, error) {
+	if err := sqlite.init(); err != nil {
+		return Credentials{}, err
+	}
+
+	var credentials Credentials
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return credentials, &InvalidCredentialsError{}
+	}
+
+	err = sqlite.client.QueryRow("SELECT id, email, password_hash FROM users WHERE email = ? AND deleted_at IS NULL AND password_hash != ''", email).
+		Scan(&credentials.UserID, &credentials.Email, &credentials.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return credentials, &InvalidCredentialsError{}
+	}
+	return credentials, err
+}
+
+const refreshTokenColumns = "id, user_id, token_hash, created_at, expires_at, revoked_at, replaced_by"
+
+func scanRefreshToken(row rowScanner) (RefreshToken, error) {
+	var token RefreshToken
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	if err := row.Scan(&token.ID, &token.UserID, &token.TokenHash, &token.CreatedAt, &token.ExpiresAt, &revokedAt, &replacedBy); err != nil {
+		return token, err
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if replacedBy.Valid {
+		replaced := int(replacedBy.Int64)
+		token.ReplacedBy = &replaced
+	}
+	return token, nil
+}
+
+func (sqlite *SQLiteDb) CreateRefreshToken(token RefreshToken) (RefreshToken, error) {
+	if err := sqlite.init(); err != nil {
+		return RefreshToken{}, err
+	}
+	return createRefreshToken(sqlite.client, token)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func createRefreshToken(client execer, token RefreshToken) (RefreshToken, error) {
+	result, err := client.Exec("INSERT INTO refresh_tokens (user_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		token.UserID, token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return token, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return token, err
+	}
+
+	token.ID = int(id)
+	token.RevokedAt = nil
+	token.ReplacedBy = nil
+	return token, nil
+}
+
+// RotateRefreshToken replaces the refresh token with tokenHash by next, which must be of the same user.
+// A token that was already replaced is being reused, likely because it was stolen, so all tokens of the
+// user are revoked and they have to log in again
+func (sqlite *SQLiteDb) RotateRefreshToken(tokenHash string, next RefreshToken) (RefreshToken, error) {
+	if err := sqlite.init(); err != nil {
+		return RefreshToken{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return next, err
+	}
+
+	next, err = sqlite.rotateRefreshToken(tx, tokenHash, next)
+	if err != nil {
+		var invalid *InvalidRefreshTokenError
+		// the revocation after a reuse has to be kept
+		if errors.As(err, &invalid) && invalid.Reason == reasonTokenReused {
+			if commitErr := tx.Commit(); commitErr != nil {
+				return next, commitErr
+			}
+			return next, err
+		}
+		_ = tx.Rollback()
+		return next, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return next, err
+	}
+
+	return next, nil
+}
+
+const reasonTokenReused = "was already used"
+
+func (sqlite *SQLiteDb) rotateRefreshToken(tx *sql.Tx, tokenHash string, next RefreshToken) (RefreshToken, error) {
+	token, err := scanRefreshToken(tx.QueryRow("SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = ?", tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return next, &InvalidRefreshTokenError{Reason: "does not exist"}
+	}
+	if err != nil {
+		return next, err
+	}
+
+	if token.RevokedAt != nil {
+		if token.ReplacedBy != nil {
+			if err := revokeRefreshTokens(tx, token.UserID, next.CreatedAt); err != nil {
+				return next, err
+			}
+			return next, &InvalidRefreshTokenError{Reason: reasonTokenReused}
+		}
+		return next, &InvalidRefreshTokenError{Reason: "was revoked"}
+	}
+	if !next.CreatedAt.Before(token.ExpiresAt) {
+		return next, &InvalidRefreshTokenError{Reason: "has expired"}
+	}
+
+	var deleted sql.NullTime
+	if err := tx.QueryRow("SELECT deleted_at FROM users WHERE id = ?", token.UserID).Scan(&deleted); err != nil {
+		return next, err
+	}
+	if deleted.Valid {
+		return next, &InvalidRefreshTokenError{Reason: "was revoked"}
+	}
+
+	next.UserID = token.UserID
+	next, err = createRefreshToken(tx, next)
+	if err != nil {
+		return next, err
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = ?, replaced_by = ? WHERE id = ?", next.CreatedAt, next.ID, token.ID); err != nil {
+		return next, err
+	}
+
+	return next, nil
+}
+
+// RevokeRefreshToken revokes a refresh token on logout; unknown and revoked tokens are ignored
+func (sqlite *SQLiteDb) RevokeRefreshToken(tokenHash string) error {
+	if err := sqlite.init(); err != nil {
+		return err
+	}
+
+	_, err := sqlite.client.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL", time.Now().UTC(), tokenHash)
+	return err
+}
+
+// revokeRefreshTokens revokes every refresh token of a user that is still valid
+func revokeRefreshTokens(client execer, userId int, revokedAt time.Time) error {
+	_, err := client.Exec("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", revokedAt, userId)
+	return err
+}
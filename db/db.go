@@ -3,7 +3,6 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -15,12 +14,99 @@ func (err *FailedTransactionsLimitError) Error() string {
 	return "Limit of failed transactions per day (3) has been reached"
 }
 
+type AccountNotFoundError struct {
+	AccountID int
+}
+
+func (err *AccountNotFoundError) Error() string {
+	return fmt.Sprintf("account %d does not exist", err.AccountID)
+}
+
+type TransactionNotFoundError struct {
+	TransactionID int
+}
+
+func (err *TransactionNotFoundError) Error() string {
+	return fmt.Sprintf("transaction %d does not exist", err.TransactionID)
+}
+
+type InsufficientFundsError struct {
+	AccountID int
+	Balance   Money
+	Amount    Money
+}
+
+func (err *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("account %d has %s, which does not cover %s", err.AccountID, err.Balance, err.Amount)
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const transactionColumns = "id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, timestamp, succeeded, failure_reason, reversal_of, batch_id"
+
+func scanTransaction(row rowScanner) (Transaction, error) {
+	var transaction Transaction
+	var reversalOf, batchId sql.NullInt64
+	err := row.Scan(&transaction.ID, &transaction.FromAccountID, &transaction.ToAccountID, &transaction.Amount.Amount, &transaction.Amount.Currency,
+		&transaction.ToAmount.Amount, &transaction.ToAmount.Currency, &transaction.ExchangeRate, &transaction.Timestamp, &transaction.Succeeded, &transaction.FailureReason, &reversalOf,
+		&batchId)
+	if err != nil {
+		return transaction, err
+	}
+
+	if reversalOf.Valid {
+		id := int(reversalOf.Int64)
+		transaction.ReversalOf = &id
+	}
+	if batchId.Valid {
+		id := int(batchId.Int64)
+		transaction.BatchID = &id
+	}
+
+	return transaction, nil
+}
+
+// accountColumns reads an account from the accounts table; the available balance is the balance
+// without the money reserved by active holds
+const accountColumns = "id, user_id, balance, currency, overdraft_limit, product, status, deleted_at, balance - (SELECT COALESCE(SUM(holds.amount), 0) FROM holds WHERE holds.from_account_id = accounts.id AND holds.status = 'active')"
+
+func scanAccount(row rowScanner) (Account, error) {
+	var account Account
+	var deletedAt sql.NullTime
+	err := row.Scan(&account.ID, &account.UserID, &account.Balance.Amount, &account.Balance.Currency, &account.OverdraftLimit.Amount, &account.Product, &account.Status, &deletedAt,
+		&account.AvailableBalance.Amount)
+	if err != nil {
+		return account, err
+	}
+	if deletedAt.Valid {
+		account.DeletedAt = &deletedAt.Time
+	}
+
+	account.AvailableBalance.Currency = account.Balance.Currency
+	account.OverdraftLimit.Currency = account.Balance.Currency
+
+	return account, nil
+}
+
+// defaultPath is the file of the database of the server
+const defaultPath = "./bank.db"
+
 type SQLiteDb struct {
-	client *sql.DB
+	client        *sql.DB
+	path          string
+	exchangeRates ExchangeRateProvider
 }
 
 func NewSQLiteDb() (SQLiteDb, error) {
-	db := SQLiteDb{}
+	return OpenSQLiteDb(defaultPath)
+}
+
+// OpenSQLiteDb opens the database in the file at path, creating and migrating it if needed
+func OpenSQLiteDb(path string) (SQLiteDb, error) {
+	db := SQLiteDb{path: path}
 	if err := db.init(); err != nil {
 		return db, err
 	}
@@ -28,180 +114,287 @@ func NewSQLiteDb() (SQLiteDb, error) {
 	return db, nil
 }
 
+// Close closes the database; it is opened again by the next call
+func (sqlite *SQLiteDb) Close() error {
+	if sqlite.client == nil {
+		return nil
+	}
+	err := sqlite.client.Close()
+	sqlite.client = nil
+	return err
+}
+
 func (sqlite *SQLiteDb) init() error {
 	if sqlite.client == nil {
+		if sqlite.path == "" {
+			sqlite.path = defaultPath
+		}
 		var err error
-		sqlite.client, err = sql.Open("sqlite3", "./bank.db")
+		sqlite.client, err = sql.Open("sqlite3", sqlite.path+"?_txlock=immediate")
 		if err != nil {
 			return err
 		}
-		sqlite.createTables()
+		if err := sqlite.migrate(); err != nil {
+			_ = sqlite.client.Close()
+			sqlite.client = nil
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (sqlite *SQLiteDb) createTables() {
-	createUsersTable := `CREATE TABLE IF NOT EXISTS users (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        name TEXT
-    );`
-
-	createAccountsTable := `CREATE TABLE IF NOT EXISTS accounts (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        user_id INTEGER,
-        balance REAL,
-        FOREIGN KEY (user_id) REFERENCES users(id)
-    );`
-
-	createTransactionsTable := `CREATE TABLE IF NOT EXISTS transactions (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        from_account_id INTEGER,
-        to_account_id INTEGER,
-        amount REAL,
-        succeeded INTEGER,
-        timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY (from_account_id) REFERENCES accounts(id)
-        FOREIGN KEY (to_account_id) REFERENCES accounts(id)
-    );`
-
-	_, err := sqlite.client.Exec(createUsersTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = sqlite.client.Exec(createAccountsTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	_, err = sqlite.client.Exec(createTransactionsTable)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-func (sqlite *SQLiteDb) CreateUser(userName string) (User, error) {
+// CreateUser validates and stores a new customer; the email address, if any, must not be used by another user.
+// The password hash, if any, is stored as given
+func (sqlite *SQLiteDb) CreateUser(user User) (User, error) {
 	if err := sqlite.init(); err != nil {
 		return User{}, err
 	}
 
-	var user User
-	result, err := sqlite.client.Exec("INSERT INTO users (name) VALUES (?)", userName)
+	user, err := ValidateUser(user)
 	if err != nil {
 		return user, err
 	}
 
+	result, err := sqlite.client.Exec("INSERT INTO users (name, email, phone, date_of_birth, address_line1, address_line2, city, postal_code, country, password_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		append(userValues(user), user.PasswordHash)...)
+	if err != nil {
+		return user, emailTaken(err, user.Email)
+	}
+
 	id, err := result.LastInsertId()
 	if err != nil {
 		return user, err
 	}
 
-	user.Name = userName
 	user.ID = int(id)
+	user.Role = RoleCustomer
+	user.DeletedAt = nil
 
 	return user, nil
 }
 
-func (sqlite *SQLiteDb) CreateAccount(userId int, balance float64) (Account, error) {
+func (sqlite *SQLiteDb) CreateAccount(userId int, balance Money, product string) (Account, error) {
 	if err := sqlite.init(); err != nil {
 		return Account{}, err
 	}
 
 	var account Account
-	result, err := sqlite.client.Exec("INSERT INTO accounts (user_id, balance) VALUES (?, ?)", userId, balance)
+	if _, err := CurrencyExponent(balance.Currency); err != nil {
+		return account, err
+	}
+	if _, err := sqlite.getAccountProduct(product); err != nil {
+		return account, err
+	}
+
+	tx, err := sqlite.client.Begin()
 	if err != nil {
 		return account, err
 	}
 
+	result, err := tx.Exec("INSERT INTO accounts (user_id, balance, currency, product) VALUES (?, 0, ?, ?)", userId, balance.Currency, product)
+	if err != nil {
+		_ = tx.Rollback()
+		return account, err
+	}
+
 	id, err := result.LastInsertId()
 	if err != nil {
+		_ = tx.Rollback()
+		return account, err
+	}
+
+	// the initial balance is a deposit, balanced against the bank's opening balance account
+	if !balance.IsZero() {
+		openingAccountId, err := systemAccount(tx, OpeningBalanceAccount, balance.Currency)
+		if err != nil {
+			_ = tx.Rollback()
+			return account, err
+		}
+
+		_, err = postEntry(tx, JournalEntry{
+			Description: "opening balance",
+			Postings: []Posting{
+				{AccountID: openingAccountId, Amount: NewMoney(-balance.Amount, balance.Currency)},
+				{AccountID: int(id), Amount: balance},
+			},
+		})
+		if err != nil {
+			_ = tx.Rollback()
+			return account, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return account, err
 	}
 
 	account.ID = int(id)
 	account.UserID = userId
 	account.Balance = balance
+	account.AvailableBalance = balance
+	account.OverdraftLimit = NewMoney(0, balance.Currency)
+	account.Product = product
+	account.Status = AccountActive
 
 	return account, nil
 }
 
-func (sqlite *SQLiteDb) CreateTransaction(fromAccountId int, toAccountId int, amount float64) (Transaction, error) {
+func (sqlite *SQLiteDb) CreateTransaction(fromAccountId int, toAccountId int, amount Money) (Transaction, error) {
 	if err := sqlite.init(); err != nil {
 		return Transaction{}, err
 	}
 
 	var transaction Transaction
-	user, err := sqlite.GetUserByAccountId(fromAccountId)
+	if !amount.IsPositive() {
+		return transaction, &InvalidAmountError{Amount: amount.Decimal(), Reason: "must be positive"}
+	}
+
+	if err := sqlite.checkFailedTransactions(fromAccountId); err != nil {
+		return transaction, err
+	}
+
+	tx, err := sqlite.client.Begin()
 	if err != nil {
 		return transaction, err
 	}
 
-	pastTransactions, err := sqlite.GetTransactions(fmt.Sprint(user.ID), false)
+	transaction, err = sqlite.transfer(tx, fromAccountId, toAccountId, amount)
+	if err != nil {
+		_ = tx.Rollback()
+		return transaction, err
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return transaction, err
 	}
 
+	return transaction, nil
+}
+
+// checkFailedTransactions denies new transactions of the owner of an account once 3 of their transactions failed in the past day.
+// Runs of standing orders and lines of payment files are not held to the limit, so their failures do not count towards it either
+func (sqlite *SQLiteDb) checkFailedTransactions(fromAccountId int) error {
+	user, err := sqlite.GetUserByAccountId(fromAccountId)
+	if err != nil {
+		return err
+	}
+
+	pastTransactions, err := sqlite.GetTransactions(fmt.Sprint(user.ID), false)
+	if err != nil {
+		return err
+	}
+
+	unlimited, err := sqlite.unlimitedTransactionIds(user.ID)
+	if err != nil {
+		return err
+	}
+
 	past24Hours := time.Now().Add(-24 * time.Hour)
 	failedTransactionsCnt := 0
 	for _, transaction := range pastTransactions {
-		if transaction.Timestamp.After(past24Hours) && transaction.Succeeded == 0 {
+		if transaction.Timestamp.After(past24Hours) && transaction.Succeeded == 0 && !unlimited[transaction.ID] {
 			failedTransactionsCnt += 1
 		}
 		if failedTransactionsCnt >= 3 {
-			return transaction, &FailedTransactionsLimitError{}
+			return &FailedTransactionsLimitError{}
 		}
 	}
 
-	tx, err := sqlite.client.Begin()
+	return nil
+}
+
+// unlimitedTransactionIds are the transactions out of the accounts of userId that ran for a standing order or a
+// payment file, which the failed transaction limit does not apply to
+func (sqlite *SQLiteDb) unlimitedTransactionIds(userId int) (map[int]bool, error) {
+	rows, err := sqlite.client.Query(`SELECT transaction_id FROM standing_order_executions
+        WHERE transaction_id IS NOT NULL AND standing_order_id IN
+            (SELECT id FROM standing_orders WHERE from_account_id IN (SELECT id FROM accounts WHERE user_id = ?))
+        UNION SELECT transaction_id FROM payment_lines
+        WHERE transaction_id IS NOT NULL AND from_account_id IN (SELECT id FROM accounts WHERE user_id = ?)`, userId, userId)
 	if err != nil {
-		return transaction, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	var fromBalance float64
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE id = ?", fromAccountId).Scan(&fromBalance)
+	ids := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// transfer records a transaction inside tx and, when the outgoing account can cover it,
+// moves the money by posting a journal entry
+func (sqlite *SQLiteDb) transfer(tx *sql.Tx, fromAccountId int, toAccountId int, amount Money) (Transaction, error) {
+	var transaction Transaction
+
+	fromAccount, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", fromAccountId))
 	if err != nil {
-		_ = tx.Rollback()
+		if err == sql.ErrNoRows {
+			return transaction, &AccountNotFoundError{AccountID: fromAccountId}
+		}
 		return transaction, err
 	}
 
-	var toBalance float64
-	err = tx.QueryRow("SELECT balance FROM accounts WHERE id = ?", toAccountId).Scan(&toBalance)
+	toAccount, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", toAccountId))
 	if err != nil {
-		_ = tx.Rollback()
+		if err == sql.ErrNoRows {
+			return transaction, &AccountNotFoundError{AccountID: toAccountId}
+		}
 		return transaction, err
 	}
 
-	transactionSucceeded := 1
-	if fromBalance < amount {
-		transactionSucceeded = 0
+	if err := checkTransfer(fromAccount, toAccount); err != nil {
+		return transaction, err
 	}
-	newFromBalance := fromBalance - amount
-	newToBalance := toBalance + amount
 
-	if transactionSucceeded == 1 {
-		_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE id = ?", newFromBalance, fromAccountId)
-		if err != nil {
-			_ = tx.Rollback()
-			return transaction, err
-		}
+	if amount.Currency != fromAccount.Balance.Currency {
+		return transaction, &CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: amount.Currency}
 	}
 
-	if transactionSucceeded == 1 {
-		_, err = tx.Exec("UPDATE accounts SET balance = ? WHERE id = ?", newToBalance, toAccountId)
-		if err != nil {
-			_ = tx.Rollback()
-			return transaction, err
-		}
+	rate, err := sqlite.lookupRate(fromAccount.Balance.Currency, toAccount.Balance.Currency)
+	if err != nil {
+		return transaction, err
 	}
 
-	result, err := tx.Exec("INSERT INTO transactions (from_account_id, to_account_id, amount, timestamp, succeeded) VALUES (?, ?, ?, ?, ?)", fromAccountId, toAccountId, amount, time.Now(), transactionSucceeded)
+	toAmount, err := rate.Convert(amount)
 	if err != nil {
-		_ = tx.Rollback()
 		return transaction, err
 	}
 
-	err = tx.Commit()
+	// money reserved by holds cannot be spent, and the balance may only go as far below zero as the overdraft limit
+	transactionSucceeded := 1
+	failureReason := spendFailure(fromAccount, amount)
+	if failureReason != "" {
+		transactionSucceeded = 0
+	}
+
+	transaction.FromAccountID = fromAccountId
+	transaction.ToAccountID = toAccountId
+	transaction.Amount = amount
+	transaction.ToAmount = toAmount
+	transaction.ExchangeRate = rate.Rate
+	transaction.Succeeded = transactionSucceeded
+	transaction.FailureReason = failureReason
+
+	return insertTransaction(tx, transaction, "transfer")
+}
+
+// insertTransaction stores transaction and, if it succeeded, posts the journal entry that moves its money
+func insertTransaction(tx *sql.Tx, transaction Transaction, description string) (Transaction, error) {
+	if transaction.Timestamp.IsZero() {
+		transaction.Timestamp = time.Now()
+	}
+
+	result, err := tx.Exec("INSERT INTO transactions (from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, timestamp, succeeded, failure_reason, reversal_of, batch_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		transaction.FromAccountID, transaction.ToAccountID, transaction.Amount.Amount, transaction.Amount.Currency, transaction.ToAmount.Amount, transaction.ToAmount.Currency,
+		transaction.ExchangeRate, transaction.Timestamp, transaction.Succeeded, transaction.FailureReason, transaction.ReversalOf, transaction.BatchID)
 	if err != nil {
 		return transaction, err
 	}
@@ -210,13 +403,19 @@ func (sqlite *SQLiteDb) CreateTransaction(fromAccountId int, toAccountId int, am
 	if err != nil {
 		return transaction, err
 	}
-
 	transaction.ID = int(id)
-	transaction.FromAccountID = fromAccountId
-	transaction.ToAccountID = toAccountId
-	transaction.Amount = amount
-	transaction.Timestamp = time.Now()
-	transaction.Succeeded = transactionSucceeded
+
+	if transaction.Succeeded == 1 {
+		postings, err := transferPostingsTx(tx, transaction)
+		if err != nil {
+			return transaction, err
+		}
+
+		_, err = postEntry(tx, JournalEntry{TransactionID: &transaction.ID, Description: description, Timestamp: transaction.Timestamp, Postings: postings})
+		if err != nil {
+			return transaction, err
+		}
+	}
 
 	return transaction, nil
 }
@@ -226,11 +425,10 @@ func (sqlite *SQLiteDb) GetUser(userId string) (User, error) {
 		return User{}, err
 	}
 
-	var user User
-	err := sqlite.client.QueryRow("SELECT id, name FROM users WHERE id = ?", userId).Scan(&user.ID, &user.Name)
+	user, err := scanUser(sqlite.client.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ? AND deleted_at IS NULL", userId))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return user, nil
+			return user, &UserNotFoundError{UserID: userId}
 		} else {
 			return user, err
 		}
@@ -243,31 +441,41 @@ func (sqlite *SQLiteDb) GetUserByAccountId(accountId int) (User, error) {
 		return User{}, err
 	}
 
-	var user User
-
 	query := `
-    SELECT users.id, users.name
+    SELECT ` + userColumns + `
     FROM users
     INNER JOIN accounts ON users.id = accounts.user_id
     WHERE accounts.id = ?
     `
 
-	err := sqlite.client.QueryRow(query, accountId).Scan(&user.ID, &user.Name)
+	user, err := scanUser(sqlite.client.QueryRow(query, accountId))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return user, &AccountNotFoundError{AccountID: accountId}
+		}
 		return user, err
 	}
 
 	return user, nil
 }
 
+// GetAccounts returns the accounts of a user that were not deleted
 func (sqlite *SQLiteDb) GetAccounts(userId string) ([]Account, error) {
 	if err := sqlite.init(); err != nil {
 		return nil, err
 	}
 
+	return sqlite.getAccounts(userId, false)
+}
+
+func (sqlite *SQLiteDb) getAccounts(userId string, includeDeleted bool) ([]Account, error) {
 	accounts := []Account{}
 
-	rows, err := sqlite.client.Query("SELECT id, user_id, balance FROM accounts WHERE user_id = ?", userId)
+	query := "SELECT " + accountColumns + " FROM accounts WHERE user_id = ?"
+	if !includeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	rows, err := sqlite.client.Query(query, userId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return accounts, nil
@@ -278,8 +486,8 @@ func (sqlite *SQLiteDb) GetAccounts(userId string) ([]Account, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var account Account
-		if err := rows.Scan(&account.ID, &account.UserID, &account.Balance); err != nil {
+		account, err := scanAccount(rows)
+		if err != nil {
 			return accounts, err
 		}
 
@@ -289,6 +497,38 @@ func (sqlite *SQLiteDb) GetAccounts(userId string) ([]Account, error) {
 	return accounts, nil
 }
 
+func (sqlite *SQLiteDb) GetAccount(accountId int) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	account, err := scanAccount(sqlite.client.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", accountId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return account, &AccountNotFoundError{AccountID: accountId}
+		}
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (sqlite *SQLiteDb) GetTransaction(transactionId int) (Transaction, error) {
+	if err := sqlite.init(); err != nil {
+		return Transaction{}, err
+	}
+
+	transaction, err := scanTransaction(sqlite.client.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = ?", transactionId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return transaction, &TransactionNotFoundError{TransactionID: transactionId}
+		}
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
 // incoming is true to get all transactions into the account
 // incoming is false to get all transactions out of the account (outgoing transactions)
 func (sqlite *SQLiteDb) GetTransactions(userId string, incoming bool) ([]Transaction, error) {
@@ -296,8 +536,9 @@ func (sqlite *SQLiteDb) GetTransactions(userId string, incoming bool) ([]Transac
 		return nil, err
 	}
 
+	// deleted accounts keep their transactions
 	transactions := []Transaction{}
-	accounts, err := sqlite.GetAccounts(userId)
+	accounts, err := sqlite.getAccounts(userId, true)
 	if err != nil {
 		return transactions, err
 	}
@@ -308,7 +549,7 @@ func (sqlite *SQLiteDb) GetTransactions(userId string, incoming bool) ([]Transac
 	}
 
 	for _, account := range accounts {
-		rows, err := sqlite.client.Query("SELECT id, from_account_id, to_account_id, amount, timestamp FROM transactions WHERE "+where_clause+" = ?", account.ID)
+		rows, err := sqlite.client.Query("SELECT "+transactionColumns+" FROM transactions WHERE "+where_clause+" = ?", account.ID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return transactions, nil
@@ -319,8 +560,8 @@ func (sqlite *SQLiteDb) GetTransactions(userId string, incoming bool) ([]Transac
 		defer rows.Close()
 
 		for rows.Next() {
-			var transaction Transaction
-			if err := rows.Scan(&transaction.ID, &transaction.FromAccountID, &transaction.ToAccountID, &transaction.Amount, &transaction.Timestamp); err != nil {
+			transaction, err := scanTransaction(rows)
+			if err != nil {
 				return nil, err
 			}
 
@@ -1,12 +1,81 @@
 package db
 
+import "time"
+
 type DbInterface interface {
-	CreateUser(userName string) (User, error)
-	CreateAccount(userId int, balance float64) (Account, error)
-	CreateTransaction(fromAccountId int, toAccountId int, amount float64) (Transaction, error)
+	CreateUser(user User) (User, error)
+	CreateAccount(userId int, balance Money, product string) (Account, error)
+	CreateTransaction(fromAccountId int, toAccountId int, amount Money) (Transaction, error)
+	ReverseTransaction(transactionId int, amount *Money) (Transaction, error)
+	CreateBatchTransfer(legs []TransferLeg) (BatchTransfer, error)
 
 	GetUser(userId string) (User, error)
 	GetUserByAccountId(accountID int) (User, error)
+	UpdateUser(user User) (User, error)
+	DeleteUser(userId int) (User, error)
+	SearchUsers(filter UserFilter) (UserPage, error)
+	GetAccount(accountId int) (Account, error)
 	GetAccounts(userId string) ([]Account, error)
+	SetOverdraftLimit(accountId int, limit Money) (Account, error)
+	SetAccountStatus(accountId int, status string) (Account, error)
+	CloseAccount(accountId int, sweepToAccountId *int) (Account, error)
+	UpdateAccount(accountId int, product string) (Account, error)
+	DeleteAccount(accountId int) (Account, error)
+	GetTransaction(transactionId int) (Transaction, error)
+	GetBatchTransfer(batchId int) (BatchTransfer, error)
 	GetTransactions(userId string, incoming bool) ([]Transaction, error)
+	GetTransactionPage(userId string, incoming bool, filter TransactionFilter) (TransactionPage, error)
+	GetAccountTransactions(accountId int) ([]AccountTransaction, error)
+	GetStatement(accountId int, from time.Time, to time.Time) (Statement, error)
+
+	GetAccountProducts() ([]AccountProduct, error)
+	SetAccountProduct(product AccountProduct) (AccountProduct, error)
+	GetAccruedInterest(accountId int) (AccruedInterest, error)
+	AccrueInterest(through time.Time) (int, error)
+	PostInterest(now time.Time) ([]Transaction, error)
+
+	GetPostings(accountId int) ([]Posting, error)
+	VerifyLedger() ([]LedgerDiscrepancy, error)
+
+	SetUserRole(userId int, role string) (User, error)
+	GetCredentials(email string) (Credentials, error)
+	CreateRefreshToken(token RefreshToken) (RefreshToken, error)
+	RotateRefreshToken(tokenHash string, next RefreshToken) (RefreshToken, error)
+	RevokeRefreshToken(tokenHash string) error
+
+	CreateAPIClient(client APIClient) (APIClient, error)
+	GetAPIClient(clientId string) (APIClient, error)
+	GetAPIClientByKey(keyHash string) (APIClient, error)
+	GetAPIClients(userId int) ([]APIClient, error)
+	RevokeAPIClient(clientId string) (APIClient, error)
+
+	CreateAuditEvent(event AuditEvent) (AuditEvent, error)
+	SearchAuditEvents(filter AuditFilter) (AuditPage, error)
+
+	ReserveIdempotencyKey(key IdempotencyKey, fingerprint string) (IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(key IdempotencyKey, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(key IdempotencyKey) error
+
+	CreateHold(hold Hold) (Hold, error)
+	GetHold(holdId int) (Hold, error)
+	CaptureHold(holdId int, amount *Money) (Hold, error)
+	VoidHold(holdId int) (Hold, error)
+	ExpireHolds(now time.Time) ([]Hold, error)
+
+	CreatePaymentFile(format string, instructions []PaymentInstruction) (PaymentFile, error)
+	GetPaymentFile(fileId int) (PaymentFile, error)
+	GetPendingPaymentFiles() ([]int, error)
+	ProcessPaymentFile(fileId int) (PaymentFile, error)
+
+	CreateStandingOrder(order StandingOrder) (StandingOrder, error)
+	GetStandingOrder(orderId int) (StandingOrder, error)
+	GetStandingOrders(userId string) ([]StandingOrder, error)
+	UpdateStandingOrder(order StandingOrder) (StandingOrder, error)
+	CancelStandingOrder(orderId int) (StandingOrder, error)
+	GetDueStandingOrders(now time.Time) ([]StandingOrder, error)
+	RunStandingOrder(orderId int, now time.Time) (StandingOrderExecution, error)
+	GetStandingOrderExecutions(orderId int) ([]StandingOrderExecution, error)
+
+	SetExchangeRate(rate ExchangeRate) (ExchangeRate, error)
+	GetExchangeRates() ([]ExchangeRate, error)
 }
@@ -0,0 +1,121 @@
+package db
+
+// ErrorKind groups the errors of this package by what went wrong, so that callers can answer
+// them without knowing every error type
+type ErrorKind string
+
+const (
+	// KindValidation is a request that is invalid on its own, or refers to something that has to exist
+	KindValidation ErrorKind = "validation"
+	KindNotFound   ErrorKind = "not_found"
+	// KindConflict is a request that the current state of what it changes does not allow
+	KindConflict          ErrorKind = "conflict"
+	KindInsufficientFunds ErrorKind = "insufficient_funds"
+	KindLimitReached      ErrorKind = "limit_reached"
+	// KindUnprocessable is a valid request that cannot be carried out, e.g. for a missing exchange rate
+	KindUnprocessable ErrorKind = "unprocessable"
+	// KindUnauthenticated is a request with credentials or a token that are not valid
+	KindUnauthenticated ErrorKind = "unauthenticated"
+	// KindForbidden is a request by someone who is not allowed to make it
+	KindForbidden ErrorKind = "forbidden"
+)
+
+// Error is implemented by the errors that are caused by a request rather than by the database;
+// Code is a stable, machine-readable name of the error, while the message may change.
+// Errors that wrap an Error, such as BatchTransferError, are found with errors.As
+type Error interface {
+	error
+	Kind() ErrorKind
+	Code() string
+}
+
+func (err *FailedTransactionsLimitError) Kind() ErrorKind { return KindLimitReached }
+func (err *FailedTransactionsLimitError) Code() string    { return "failed_transactions_limit" }
+
+func (err *InsufficientFundsError) Kind() ErrorKind { return KindInsufficientFunds }
+func (err *InsufficientFundsError) Code() string    { return "insufficient_funds" }
+
+func (err *UserNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *UserNotFoundError) Code() string    { return "user_not_found" }
+
+func (err *AccountNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *AccountNotFoundError) Code() string    { return "account_not_found" }
+
+func (err *TransactionNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *TransactionNotFoundError) Code() string    { return "transaction_not_found" }
+
+func (err *BatchTransferNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *BatchTransferNotFoundError) Code() string    { return "batch_transfer_not_found" }
+
+func (err *HoldNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *HoldNotFoundError) Code() string    { return "hold_not_found" }
+
+func (err *StandingOrderNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *StandingOrderNotFoundError) Code() string    { return "standing_order_not_found" }
+
+func (err *PaymentFileNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *PaymentFileNotFoundError) Code() string    { return "payment_file_not_found" }
+
+func (err *APIClientNotFoundError) Kind() ErrorKind { return KindNotFound }
+func (err *APIClientNotFoundError) Code() string    { return "api_client_not_found" }
+
+func (err *InvalidAmountError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidAmountError) Code() string    { return "invalid_amount" }
+
+func (err *UnknownCurrencyError) Kind() ErrorKind { return KindValidation }
+func (err *UnknownCurrencyError) Code() string    { return "unknown_currency" }
+
+func (err *CurrencyMismatchError) Kind() ErrorKind { return KindValidation }
+func (err *CurrencyMismatchError) Code() string    { return "currency_mismatch" }
+
+// products are only referred to by the accounts that are created or changed, so a missing one is invalid input
+func (err *ProductNotFoundError) Kind() ErrorKind { return KindValidation }
+func (err *ProductNotFoundError) Code() string    { return "product_not_found" }
+
+func (err *InvalidUserError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidUserError) Code() string    { return "invalid_user" }
+
+func (err *InvalidAPIClientError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidAPIClientError) Code() string    { return "invalid_api_client" }
+
+func (err *InvalidFilterError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidFilterError) Code() string    { return "invalid_filter" }
+
+func (err *InvalidStandingOrderError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidStandingOrderError) Code() string    { return "invalid_standing_order" }
+
+func (err *InvalidBatchTransferError) Kind() ErrorKind { return KindValidation }
+func (err *InvalidBatchTransferError) Code() string    { return "invalid_batch_transfer" }
+
+// a payment file with a report could be read, but some of its lines cannot be executed
+func (err *InvalidPaymentFileError) Kind() ErrorKind {
+	if err.Report.Lines != nil {
+		return KindUnprocessable
+	}
+	return KindValidation
+}
+func (err *InvalidPaymentFileError) Code() string { return "invalid_payment_file" }
+
+func (err *AccountStatusError) Kind() ErrorKind { return KindConflict }
+func (err *AccountStatusError) Code() string    { return "account_status_conflict" }
+
+func (err *HoldError) Kind() ErrorKind { return KindConflict }
+func (err *HoldError) Code() string    { return "hold_status_conflict" }
+
+func (err *ReversalError) Kind() ErrorKind { return KindConflict }
+func (err *ReversalError) Code() string    { return "reversal_not_allowed" }
+
+func (err *EmailTakenError) Kind() ErrorKind { return KindConflict }
+func (err *EmailTakenError) Code() string    { return "email_taken" }
+
+func (err *UserHasAccountsError) Kind() ErrorKind { return KindConflict }
+func (err *UserHasAccountsError) Code() string    { return "user_has_accounts" }
+
+func (err *ExchangeRateNotFoundError) Kind() ErrorKind { return KindUnprocessable }
+func (err *ExchangeRateNotFoundError) Code() string    { return "exchange_rate_not_found" }
+
+func (err *InvalidCredentialsError) Kind() ErrorKind { return KindUnauthenticated }
+func (err *InvalidCredentialsError) Code() string    { return "invalid_credentials" }
+
+func (err *InvalidRefreshTokenError) Kind() ErrorKind { return KindUnauthenticated }
+func (err *InvalidRefreshTokenError) Code() string    { return "invalid_refresh_token" }
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+type ExchangeRateNotFoundError struct {
+	From string
+	To   string
+}
+
+func (err *ExchangeRateNotFoundError) Error() string {
+	return fmt.Sprintf("no exchange rate from %s to %s", err.From, err.To)
+}
+
+type CurrencyMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (err *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("expected an amount in %s, got %s", err.Expected, err.Actual)
+}
+
+// ExchangeRateProvider looks up how many units of to are bought with one unit of from
+type ExchangeRateProvider interface {
+	ExchangeRate(from string, to string) (ExchangeRate, error)
+}
+
+// StaticExchangeRates is an in-memory provider, keyed by "FROM/TO"
+type StaticExchangeRates map[string]string
+
+func (rates StaticExchangeRates) ExchangeRate(from string, to string) (ExchangeRate, error) {
+	rate, ok := rates[from+"/"+to]
+	if !ok {
+		return ExchangeRate{}, &ExchangeRateNotFoundError{From: from, To: to}
+	}
+	return ExchangeRate{From: from, To: to, Rate: rate}, nil
+}
+
+func identityRate(currency string) ExchangeRate {
+	return ExchangeRate{From: currency, To: currency, Rate: "1"}
+}
+
+// ValidateExchangeRate checks that both currencies are known and that the rate is a positive decimal
+func ValidateExchangeRate(rate ExchangeRate) error {
+	if _, err := CurrencyExponent(rate.From); err != nil {
+		return err
+	}
+	if _, err := CurrencyExponent(rate.To); err != nil {
+		return err
+	}
+
+	value, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok || value.Sign() <= 0 {
+		return fmt.Errorf("invalid exchange rate %q", rate.Rate)
+	}
+	return nil
+}
+
+// Convert applies the rate to an amount in rate.From, rounding half away from zero
+// to the nearest minor unit of rate.To
+func (rate ExchangeRate) Convert(amount Money) (Money, error) {
+	if amount.Currency != rate.From {
+		return Money{}, &CurrencyMismatchError{Expected: rate.From, Actual: amount.Currency}
+	}
+	if err := ValidateExchangeRate(rate); err != nil {
+		return Money{}, err
+	}
+
+	fromExponent, _ := CurrencyExponent(rate.From)
+	toExponent, _ := CurrencyExponent(rate.To)
+	value, _ := new(big.Rat).SetString(rate.Rate)
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), value)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toExponent-fromExponent))), nil))
+	if toExponent >= fromExponent {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+
+	quotient := roundHalfAwayFromZero(converted)
+	if !quotient.IsInt64() {
+		return Money{}, &InvalidAmountError{Amount: amount.Decimal(), Reason: "out of range after conversion"}
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: rate.To}, nil
+}
+
+func roundHalfAwayFromZero(value *big.Rat) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(value.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(value.Sign())))
+	}
+	return quotient
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// SetExchangeRateProvider replaces the exchange_rates table as the source of rates for transfers
+func (sqlite *SQLiteDb) SetExchangeRateProvider(provider ExchangeRateProvider) {
+	sqlite.exchangeRates = provider
+}
+
+// ExchangeRate reads a rate from the exchange_rates table
+func (sqlite *SQLiteDb) ExchangeRate(from string, to string) (ExchangeRate, error) {
+	if err := sqlite.init(); err != nil {
+		return ExchangeRate{}, err
+	}
+
+	rate := ExchangeRate{From: from, To: to}
+	err := sqlite.client.QueryRow("SELECT rate, updated_at FROM exchange_rates WHERE from_currency = ? AND to_currency = ?", from, to).Scan(&rate.Rate, &rate.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return rate, &ExchangeRateNotFoundError{From: from, To: to}
+		}
+		return rate, err
+	}
+	return rate, nil
+}
+
+func (sqlite *SQLiteDb) SetExchangeRate(rate ExchangeRate) (ExchangeRate, error) {
+	if err := sqlite.init(); err != nil {
+		return ExchangeRate{}, err
+	}
+	if err := ValidateExchangeRate(rate); err != nil {
+		return rate, err
+	}
+
+	rate.UpdatedAt = time.Now()
+	_, err := sqlite.client.Exec(`INSERT INTO exchange_rates (from_currency, to_currency, rate, updated_at) VALUES (?, ?, ?, ?)
+        ON CONFLICT (from_currency, to_currency) DO UPDATE SET rate = excluded.rate, updated_at = excluded.updated_at`,
+		rate.From, rate.To, rate.Rate, rate.UpdatedAt)
+	if err != nil {
+		return rate, err
+	}
+	return rate, nil
+}
+
+func (sqlite *SQLiteDb) GetExchangeRates() ([]ExchangeRate, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	rates := []ExchangeRate{}
+	rows, err := sqlite.client.Query("SELECT from_currency, to_currency, rate, updated_at FROM exchange_rates ORDER BY from_currency, to_currency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rate ExchangeRate
+		if err := rows.Scan(&rate.From, &rate.To, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// lookupRate returns the rate used for a transfer between two account currencies
+func (sqlite *SQLiteDb) lookupRate(from string, to string) (ExchangeRate, error) {
+	if from == to {
+		return identityRate(from), nil
+	}
+	if sqlite.exchangeRates != nil {
+		return sqlite.exchangeRates.ExchangeRate(from, to)
+	}
+	return sqlite.ExchangeRate(from, to)
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+// DefaultHoldDuration is how long a hold reserves money when it is created without an expiry
+const DefaultHoldDuration = 7 * 24 * time.Hour
+
+type HoldNotFoundError struct {
+	HoldID int
+}
+
+func (err *HoldNotFoundError) Error() string {
+	return fmt.Sprintf("hold %d does not exist", err.HoldID)
+}
+
+type HoldError struct {
+	HoldID int
+	Reason string
+}
+
+func (err *HoldError) Error() string {
+	return fmt.Sprintf("cannot change hold %d: %s", err.HoldID, err.Reason)
+}
+
+// captureAmount checks that hold can still be captured at now and returns the amount to transfer;
+// a nil amount captures everything that is held
+func captureAmount(hold Hold, amount *Money, now time.Time) (Money, error) {
+	if hold.Status != HoldActive {
+		return Money{}, &HoldError{HoldID: hold.ID, Reason: "the hold is " + hold.Status}
+	}
+	if !now.Before(hold.ExpiresAt) {
+		return Money{}, &HoldError{HoldID: hold.ID, Reason: "the hold expired"}
+	}
+	if amount == nil {
+		return hold.Amount, nil
+	}
+
+	if amount.Currency != hold.Amount.Currency {
+		return Money{}, &CurrencyMismatchError{Expected: hold.Amount.Currency, Actual: amount.Currency}
+	}
+	if !amount.IsPositive() {
+		return Money{}, &InvalidAmountError{Amount: amount.Decimal(), Reason: "must be positive"}
+	}
+	if amount.Amount > hold.Amount.Amount {
+		return Money{}, &HoldError{HoldID: hold.ID, Reason: fmt.Sprintf("only %s is held", hold.Amount)}
+	}
+
+	return *amount, nil
+}
+
+// newHold checks that the outgoing account can cover hold and fills in its timestamps
+func newHold(hold Hold, fromAccount Account, toAccount Account, now time.Time) (Hold, error) {
+	if err := checkTransfer(fromAccount, toAccount); err != nil {
+		return hold, err
+	}
+	if !hold.Amount.IsPositive() {
+		return hold, &InvalidAmountError{Amount: hold.Amount.Decimal(), Reason: "must be positive"}
+	}
+	if hold.Amount.Currency != fromAccount.Balance.Currency {
+		return hold, &CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: hold.Amount.Currency}
+	}
+	if spendFailure(fromAccount, hold.Amount) != "" {
+		return hold, insufficientFunds(fromAccount, hold.Amount)
+	}
+
+	hold.Status = HoldActive
+	hold.CapturedAmount = nil
+	hold.TransactionID = nil
+	hold.CreatedAt = now
+	if hold.ExpiresAt.IsZero() {
+		hold.ExpiresAt = now.Add(DefaultHoldDuration)
+	}
+	hold.ExpiresAt = hold.ExpiresAt.UTC()
+
+	return hold, nil
+}
+
+const holdColumns = "id, from_account_id, to_account_id, amount, currency, status, captured_amount, transaction_id, created_at, expires_at"
+
+func scanHold(row rowScanner) (Hold, error) {
+	var hold Hold
+	var capturedAmount, transactionId sql.NullInt64
+	err := row.Scan(&hold.ID, &hold.FromAccountID, &hold.ToAccountID, &hold.Amount.Amount, &hold.Amount.Currency, &hold.Status,
+		&capturedAmount, &transactionId, &hold.CreatedAt, &hold.ExpiresAt)
+	if err != nil {
+		return hold, err
+	}
+
+	if capturedAmount.Valid {
+		captured := NewMoney(capturedAmount.Int64, hold.Amount.Currency)
+		hold.CapturedAmount = &captured
+	}
+	if transactionId.Valid {
+		id := int(transactionId.Int64)
+		hold.TransactionID = &id
+	}
+
+	return hold, nil
+}
+
+func getHold(tx *sql.Tx, holdId int) (Hold, error) {
+	hold, err := scanHold(tx.QueryRow("SELECT "+holdColumns+" FROM holds WHERE id = ?", holdId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return hold, &HoldNotFoundError{HoldID: holdId}
+		}
+		return hold, err
+	}
+	return hold, nil
+}
+
+// CreateHold reserves hold.Amount on the outgoing account, so it is no longer part of its available balance
+func (sqlite *SQLiteDb) CreateHold(hold Hold) (Hold, error) {
+	if err := sqlite.init(); err != nil {
+		return Hold{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return hold, err
+	}
+
+	hold, err = sqlite.createHold(tx, hold)
+	if err != nil {
+		_ = tx.Rollback()
+		return hold, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return hold, err
+	}
+
+	return hold, nil
+}
+
+func (sqlite *SQLiteDb) createHold(tx *sql.Tx, hold Hold) (Hold, error) {
+	fromAccount, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", hold.FromAccountID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return hold, &AccountNotFoundError{AccountID: hold.FromAccountID}
+		}
+		return hold, err
+	}
+
+	toAccount, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", hold.ToAccountID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return hold, &AccountNotFoundError{AccountID: hold.ToAccountID}
+		}
+		return hold, err
+	}
+
+	hold, err = newHold(hold, fromAccount, toAccount, time.Now().UTC())
+	if err != nil {
+		return hold, err
+	}
+
+	result, err := tx.Exec("INSERT INTO holds (from_account_id, to_account_id, amount, currency, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		hold.FromAccountID, hold.ToAccountID, hold.Amount.Amount, hold.Amount.Currency, hold.Status, hold.CreatedAt, hold.ExpiresAt)
+	if err != nil {
+		return hold, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return hold, err
+	}
+	hold.ID = int(id)
+
+	return hold, nil
+}
+
+func (sqlite *SQLiteDb) GetHold(holdId int) (Hold, error) {
+	if err := sqlite.init(); err != nil {
+		return Hold{}, err
+	}
+
+	hold, err := scanHold(sqlite.client.QueryRow("SELECT "+holdColumns+" FROM holds WHERE id = ?", holdId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return hold, &HoldNotFoundError{HoldID: holdId}
+		}
+		return hold, err
+	}
+
+	return hold, nil
+}
+
+// CaptureHold releases the hold and transfers amount (or the whole hold when nil) to the incoming account.
+// Whatever is not captured becomes available again.
+func (sqlite *SQLiteDb) CaptureHold(holdId int, amount *Money) (Hold, error) {
+	if err := sqlite.init(); err != nil {
+		return Hold{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return Hold{}, err
+	}
+
+	hold, err := sqlite.captureHold(tx, holdId, amount)
+	if err != nil {
+		_ = tx.Rollback()
+		return hold, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return hold, err
+	}
+
+	return hold, nil
+}
+
+func (sqlite *SQLiteDb) captureHold(tx *sql.Tx, holdId int, amount *Money) (Hold, error) {
+	hold, err := getHold(tx, holdId)
+	if err != nil {
+		return hold, err
+	}
+
+	captured, err := captureAmount(hold, amount, time.Now())
+	if err != nil {
+		return hold, err
+	}
+
+	// the hold is released first, so the transfer can spend the money it reserved
+	if _, err := tx.Exec("UPDATE holds SET status = ? WHERE id = ?", HoldCaptured, hold.ID); err != nil {
+		return hold, err
+	}
+
+	transaction, err := sqlite.transfer(tx, hold.FromAccountID, hold.ToAccountID, captured)
+	if err != nil {
+		return hold, err
+	}
+	if transaction.Succeeded == 0 {
+		account, _ := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", hold.FromAccountID))
+		return hold, insufficientFunds(account, captured)
+	}
+
+	if _, err := tx.Exec("UPDATE holds SET captured_amount = ?, transaction_id = ? WHERE id = ?", captured.Amount, transaction.ID, hold.ID); err != nil {
+		return hold, err
+	}
+
+	hold.Status = HoldCaptured
+	hold.CapturedAmount = &captured
+	hold.TransactionID = &transaction.ID
+
+	return hold, nil
+}
+
+// VoidHold releases an active hold without moving any money
+func (sqlite *SQLiteDb) VoidHold(holdId int) (Hold, error) {
+	if err := sqlite.init(); err != nil {
+		return Hold{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return Hold{}, err
+	}
+
+	hold, err := sqlite.voidHold(tx, holdId)
+	if err != nil {
+		_ = tx.Rollback()
+		return hold, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return hold, err
+	}
+
+	return hold, nil
+}
+
+func (sqlite *SQLiteDb) voidHold(tx *sql.Tx, holdId int) (Hold, error) {
+	hold, err := getHold(tx, holdId)
+	if err != nil {
+		return hold, err
+	}
+	if hold.Status != HoldActive {
+		return hold, &HoldError{HoldID: hold.ID, Reason: "the hold is " + hold.Status}
+	}
+
+	if _, err := tx.Exec("UPDATE holds SET status = ? WHERE id = ?", HoldVoided, hold.ID); err != nil {
+		return hold, err
+	}
+	hold.Status = HoldVoided
+
+	return hold, nil
+}
+
+// ExpireHolds releases every active hold that expired at or before now and returns them
+func (sqlite *SQLiteDb) ExpireHolds(now time.Time) ([]Hold, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	holds, err := expireHolds(tx, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+func expireHolds(tx *sql.Tx, now time.Time) ([]Hold, error) {
+	holds := []Hold{}
+	rows, err := tx.Query("SELECT "+holdColumns+" FROM holds WHERE status = ? AND expires_at <= ? ORDER BY id", HoldActive, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		hold.Status = HoldExpired
+		holds = append(holds, hold)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, hold := range holds {
+		if _, err := tx.Exec("UPDATE holds SET status = ? WHERE id = ?", HoldExpired, hold.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return holds, nil
+}
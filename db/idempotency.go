@@ -0,0 +1,78 @@
+package db
+
+import (
+	"time"
+)
+
+// IdempotencyKeyTTL is how long the outcome of a request is kept for replays
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// ReserveIdempotencyKey claims key for a new request. If the key was already used, the stored
+// record is returned instead and created is false.
+func (sqlite *SQLiteDb) ReserveIdempotencyKey(key IdempotencyKey, fingerprint string) (IdempotencyRecord, bool, error) {
+	if err := sqlite.init(); err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+
+	record := IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: time.Now()}
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return record, false, err
+	}
+
+	_, err = tx.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", record.CreatedAt.Add(-IdempotencyKeyTTL))
+	if err != nil {
+		_ = tx.Rollback()
+		return record, false, err
+	}
+
+	result, err := tx.Exec("INSERT INTO idempotency_keys (principal, route, key, fingerprint, status_code, created_at) VALUES (?, ?, ?, ?, 0, ?) ON CONFLICT (principal, route, key) DO NOTHING",
+		key.Principal, key.Route, key.Key, fingerprint, record.CreatedAt)
+	if err != nil {
+		_ = tx.Rollback()
+		return record, false, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return record, false, err
+	}
+
+	created := inserted == 1
+	if !created {
+		err = tx.QueryRow("SELECT fingerprint, status_code, content_type, body, created_at FROM idempotency_keys WHERE principal = ? AND route = ? AND key = ?", key.Principal, key.Route, key.Key).
+			Scan(&record.Fingerprint, &record.StatusCode, &record.ContentType, &record.Body, &record.CreatedAt)
+		if err != nil {
+			_ = tx.Rollback()
+			return record, false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return record, false, err
+	}
+
+	return record, created, nil
+}
+
+// CompleteIdempotencyKey stores the response to replay for later requests with the same key
+func (sqlite *SQLiteDb) CompleteIdempotencyKey(key IdempotencyKey, statusCode int, contentType string, body []byte) error {
+	if err := sqlite.init(); err != nil {
+		return err
+	}
+
+	_, err := sqlite.client.Exec("UPDATE idempotency_keys SET status_code = ?, content_type = ?, body = ? WHERE principal = ? AND route = ? AND key = ?",
+		statusCode, contentType, body, key.Principal, key.Route, key.Key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a reservation, so the request can be retried with the same key
+func (sqlite *SQLiteDb) ReleaseIdempotencyKey(key IdempotencyKey) error {
+	if err := sqlite.init(); err != nil {
+		return err
+	}
+
+	_, err := sqlite.client.Exec("DELETE FROM idempotency_keys WHERE principal = ? AND route = ? AND key = ?", key.Principal, key.Route, key.Key)
+	return err
+}
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// DefaultProduct is used for accounts created without a product
+const DefaultProduct = "checking"
+
+// DaysPerYear turns yearly interest rates into daily ones
+const DaysPerYear = 365
+
+type ProductNotFoundError struct {
+	Product string
+}
+
+func (err *ProductNotFoundError) Error() string {
+	return fmt.Sprintf("account product %q does not exist", err.Product)
+}
+
+// ValidateAccountProduct checks that the product has a name and a non-negative decimal interest rate
+func ValidateAccountProduct(product AccountProduct) error {
+	if product.Name == "" {
+		return fmt.Errorf("account products need a name")
+	}
+
+	rate, ok := new(big.Rat).SetString(product.InterestRate)
+	if !ok || rate.Sign() < 0 {
+		return fmt.Errorf("invalid interest rate %q", product.InterestRate)
+	}
+	return nil
+}
+
+// dailyInterest is the interest earned in one day by balance, in major units; negative balances earn nothing
+func dailyInterest(balance Money, rate string) (*big.Rat, error) {
+	exponent, err := CurrencyExponent(balance.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return nil, fmt.Errorf("invalid interest rate %q", rate)
+	}
+	if !balance.IsPositive() {
+		return new(big.Rat), nil
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)
+	interest := new(big.Rat).SetFrac(big.NewInt(balance.Amount), scale)
+	interest.Mul(interest, value)
+	return interest.Quo(interest, new(big.Rat).SetInt64(DaysPerYear)), nil
+}
+
+// accrualDays lists the days to accrue interest for, after accruedThrough up to and including through.
+// Accounts that never accrued start at through.
+func accrualDays(accruedThrough string, through time.Time) []string {
+	days := []string{}
+	day := through
+	if last, err := time.Parse(time.DateOnly, accruedThrough); err == nil {
+		day = last.AddDate(0, 0, 1)
+	}
+
+	for ; !day.After(through); day = day.AddDate(0, 0, 1) {
+		days = append(days, day.Format(time.DateOnly))
+	}
+	return days
+}
+
+// newAccrual returns the accrual of account for day, or false when it earns nothing
+func newAccrual(account Account, rate string, day string) (InterestAccrual, bool, error) {
+	interest, err := dailyInterest(account.Balance, rate)
+	if err != nil || interest.Sign() == 0 {
+		return InterestAccrual{}, false, err
+	}
+
+	return InterestAccrual{
+		AccountID:    account.ID,
+		Date:         day,
+		Balance:      account.Balance,
+		InterestRate: rate,
+		Amount:       formatDecimal(interest, 10),
+	}, true, nil
+}
+
+// interestPayout adds up accruals and rounds the sum to minor units of currency
+func interestPayout(accruals []InterestAccrual, currency string) (Money, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	total := sumAccruals(accruals)
+	total.Mul(total, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+	amount := roundHalfAwayFromZero(total)
+	if !amount.IsInt64() {
+		return Money{}, &InvalidAmountError{Amount: total.FloatString(exponent), Reason: "out of range"}
+	}
+	return NewMoney(amount.Int64(), currency), nil
+}
+
+func sumAccruals(accruals []InterestAccrual) *big.Rat {
+	total := new(big.Rat)
+	for _, accrual := range accruals {
+		if amount, ok := new(big.Rat).SetString(accrual.Amount); ok {
+			total.Add(total, amount)
+		}
+	}
+	return total
+}
+
+func accruedInterest(account Account, product AccountProduct, accruals []InterestAccrual) AccruedInterest {
+	return AccruedInterest{
+		AccountID:    account.ID,
+		Product:      product.Name,
+		InterestRate: product.InterestRate,
+		Currency:     account.Balance.Currency,
+		Amount:       formatDecimal(sumAccruals(accruals), 10),
+		Accruals:     accruals,
+	}
+}
+
+// interestTransaction pays interest from the bank's interest expense account
+func interestTransaction(expenseAccountId int, accountId int, amount Money) Transaction {
+	return Transaction{
+		FromAccountID: expenseAccountId,
+		ToAccountID:   accountId,
+		Amount:        amount,
+		ToAmount:      amount,
+		ExchangeRate:  "1",
+		Succeeded:     1,
+	}
+}
+
+// firstOfMonth is midnight UTC on the first day of the month of now; interest accrued before it is paid out
+func firstOfMonth(now time.Time) string {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+}
+
+func (sqlite *SQLiteDb) GetAccountProducts() ([]AccountProduct, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	products := []AccountProduct{}
+	rows, err := sqlite.client.Query("SELECT name, interest_rate FROM account_products ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var product AccountProduct
+		if err := rows.Scan(&product.Name, &product.InterestRate); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+func (sqlite *SQLiteDb) getAccountProduct(name string) (AccountProduct, error) {
+	product := AccountProduct{Name: name}
+	err := sqlite.client.QueryRow("SELECT interest_rate FROM account_products WHERE name = ?", name).Scan(&product.InterestRate)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return product, &ProductNotFoundError{Product: name}
+		}
+		return product, err
+	}
+	return product, nil
+}
+
+// SetAccountProduct creates a product or changes its interest rate; the new rate applies from the next accrual
+func (sqlite *SQLiteDb) SetAccountProduct(product AccountProduct) (AccountProduct, error) {
+	if err := sqlite.init(); err != nil {
+		return AccountProduct{}, err
+	}
+	if err := ValidateAccountProduct(product); err != nil {
+		return product, err
+	}
+
+	_, err := sqlite.client.Exec("INSERT INTO account_products (name, interest_rate) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET interest_rate = excluded.interest_rate",
+		product.Name, product.InterestRate)
+	if err != nil {
+		return product, err
+	}
+	return product, nil
+}
+
+const interestAccrualColumns = "id, account_id, date, balance, currency, interest_rate, amount, transaction_id"
+
+func scanInterestAccrual(row rowScanner) (InterestAccrual, error) {
+	var accrual InterestAccrual
+	var transactionId sql.NullInt64
+	err := row.Scan(&accrual.ID, &accrual.AccountID, &accrual.Date, &accrual.Balance.Amount, &accrual.Balance.Currency,
+		&accrual.InterestRate, &accrual.Amount, &transactionId)
+	if err != nil {
+		return accrual, err
+	}
+
+	if transactionId.Valid {
+		id := int(transactionId.Int64)
+		accrual.TransactionID = &id
+	}
+	return accrual, nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func queryInterestAccruals(client querier, query string, args ...any) ([]InterestAccrual, error) {
+	accruals := []InterestAccrual{}
+	rows, err := client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		accrual, err := scanInterestAccrual(rows)
+		if err != nil {
+			return nil, err
+		}
+		accruals = append(accruals, accrual)
+	}
+
+	return accruals, rows.Err()
+}
+
+// GetAccruedInterest returns the interest accrued by an account that was not paid out yet
+func (sqlite *SQLiteDb) GetAccruedInterest(accountId int) (AccruedInterest, error) {
+	if err := sqlite.init(); err != nil {
+		return AccruedInterest{}, err
+	}
+
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		return AccruedInterest{}, err
+	}
+
+	product, err := sqlite.getAccountProduct(account.Product)
+	if err != nil {
+		return AccruedInterest{}, err
+	}
+
+	accruals, err := queryInterestAccruals(sqlite.client, "SELECT "+interestAccrualColumns+" FROM interest_accruals WHERE account_id = ? AND transaction_id IS NULL ORDER BY date", accountId)
+	if err != nil {
+		return AccruedInterest{}, err
+	}
+
+	return accruedInterest(account, product, accruals), nil
+}
+
+// AccrueInterest records the daily interest of every customer account that is not closed, for each day up to
+// and including through that it was not accrued for yet, and returns how many accruals were recorded.
+// Days that were missed are accrued on the current balance.
+func (sqlite *SQLiteDb) AccrueInterest(through time.Time) (int, error) {
+	if err := sqlite.init(); err != nil {
+		return 0, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	accrued, err := sqlite.accrueInterest(tx, through)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return accrued, nil
+}
+
+func (sqlite *SQLiteDb) accrueInterest(tx *sql.Tx, through time.Time) (int, error) {
+	type accountRate struct {
+		account        Account
+		rate           string
+		accruedThrough sql.NullString
+	}
+
+	rows, err := tx.Query(`SELECT accounts.id, accounts.balance, accounts.currency, account_products.interest_rate, accounts.interest_accrued_through
+        FROM accounts
+        INNER JOIN account_products ON account_products.name = accounts.product
+        WHERE accounts.user_id != ? AND accounts.status != ?`, SystemUserID, AccountClosed)
+	if err != nil {
+		return 0, err
+	}
+	accounts := []accountRate{}
+	for rows.Next() {
+		var row accountRate
+		if err := rows.Scan(&row.account.ID, &row.account.Balance.Amount, &row.account.Balance.Currency, &row.rate, &row.accruedThrough); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		accounts = append(accounts, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	accrued := 0
+	day := through.UTC().Format(time.DateOnly)
+	for _, row := range accounts {
+		for _, date := range accrualDays(row.accruedThrough.String, through.UTC()) {
+			accrual, ok, err := newAccrual(row.account, row.rate, date)
+			if err != nil {
+				return accrued, err
+			}
+			if !ok {
+				continue
+			}
+
+			_, err = tx.Exec("INSERT INTO interest_accruals (account_id, date, balance, currency, interest_rate, amount) VALUES (?, ?, ?, ?, ?, ?)",
+				accrual.AccountID, accrual.Date, accrual.Balance.Amount, accrual.Balance.Currency, accrual.InterestRate, accrual.Amount)
+			if err != nil {
+				return accrued, err
+			}
+			accrued += 1
+		}
+
+		if row.accruedThrough.String < day {
+			if _, err := tx.Exec("UPDATE accounts SET interest_accrued_through = ? WHERE id = ?", day, row.account.ID); err != nil {
+				return accrued, err
+			}
+		}
+	}
+
+	return accrued, nil
+}
+
+// PostInterest pays out the interest accrued before the month of now, as one transaction per account
+// from the interest expense account of its currency
+func (sqlite *SQLiteDb) PostInterest(now time.Time) ([]Transaction, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := sqlite.postInterest(tx, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (sqlite *SQLiteDb) postInterest(tx *sql.Tx, now time.Time) ([]Transaction, error) {
+	monthStart := firstOfMonth(now)
+	accruals, err := queryInterestAccruals(tx, `SELECT `+interestAccrualColumns+` FROM interest_accruals
+        WHERE transaction_id IS NULL AND date < ? AND account_id IN (SELECT id FROM accounts WHERE status != ?)
+        ORDER BY account_id, date`, monthStart, AccountClosed)
+	if err != nil {
+		return nil, err
+	}
+
+	byAccount := map[int][]InterestAccrual{}
+	accountIds := []int{}
+	for _, accrual := range accruals {
+		if _, ok := byAccount[accrual.AccountID]; !ok {
+			accountIds = append(accountIds, accrual.AccountID)
+		}
+		byAccount[accrual.AccountID] = append(byAccount[accrual.AccountID], accrual)
+	}
+
+	transactions := []Transaction{}
+	for _, accountId := range accountIds {
+		currency := byAccount[accountId][0].Balance.Currency
+		amount, err := interestPayout(byAccount[accountId], currency)
+		if err != nil {
+			return nil, err
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+
+		expenseAccountId, err := systemAccount(tx, InterestExpenseAccount, currency)
+		if err != nil {
+			return nil, err
+		}
+
+		transaction, err := insertTransaction(tx, interestTransaction(expenseAccountId, accountId, amount), "interest")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec("UPDATE interest_accruals SET transaction_id = ? WHERE account_id = ? AND transaction_id IS NULL AND date < ?", transaction.ID, accountId, monthStart)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
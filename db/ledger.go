@@ -0,0 +1,262 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// names of the bank-owned accounts that balance the ledger, one account per name and currency
+const (
+	OpeningBalanceAccount  = "opening-balance"
+	ExchangeAccount        = "fx"
+	InterestExpenseAccount = "interest-expense"
+)
+
+// SystemUserID owns the bank's internal accounts
+const SystemUserID = -1
+
+type UnbalancedEntryError struct {
+	Currency string
+	Sum      Money
+}
+
+func (err *UnbalancedEntryError) Error() string {
+	return fmt.Sprintf("journal entry does not balance in %s, postings sum to %s", err.Currency, err.Sum)
+}
+
+func validateEntry(entry JournalEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("journal entry needs at least two postings")
+	}
+
+	sums := map[string]int64{}
+	for _, posting := range entry.Postings {
+		if _, err := CurrencyExponent(posting.Amount.Currency); err != nil {
+			return err
+		}
+		sums[posting.Amount.Currency] += posting.Amount.Amount
+	}
+
+	for currency, sum := range sums {
+		if sum != 0 {
+			return &UnbalancedEntryError{Currency: currency, Sum: NewMoney(sum, currency)}
+		}
+	}
+	return nil
+}
+
+// transferPostings debits the outgoing account and credits the incoming one; cross-currency
+// transfers go through the exchange account of each currency so every currency balances
+func transferPostings(transaction Transaction, exchangeAccount func(currency string) (int, error)) ([]Posting, error) {
+	if transaction.Amount.Currency == transaction.ToAmount.Currency {
+		return []Posting{
+			{AccountID: transaction.FromAccountID, Amount: NewMoney(-transaction.Amount.Amount, transaction.Amount.Currency)},
+			{AccountID: transaction.ToAccountID, Amount: transaction.ToAmount},
+		}, nil
+	}
+
+	fromExchangeId, err := exchangeAccount(transaction.Amount.Currency)
+	if err != nil {
+		return nil, err
+	}
+	toExchangeId, err := exchangeAccount(transaction.ToAmount.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Posting{
+		{AccountID: transaction.FromAccountID, Amount: NewMoney(-transaction.Amount.Amount, transaction.Amount.Currency)},
+		{AccountID: fromExchangeId, Amount: transaction.Amount},
+		{AccountID: toExchangeId, Amount: NewMoney(-transaction.ToAmount.Amount, transaction.ToAmount.Currency)},
+		{AccountID: transaction.ToAccountID, Amount: transaction.ToAmount},
+	}, nil
+}
+
+// systemAccount returns the bank-owned account with the given name and currency, creating it on first use
+func systemAccount(tx *sql.Tx, name string, currency string) (int, error) {
+	var accountId int
+	err := tx.QueryRow("SELECT account_id FROM system_accounts WHERE name = ? AND currency = ?", name, currency).Scan(&accountId)
+	if err == nil {
+		return accountId, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO accounts (user_id, balance, currency) VALUES (?, 0, ?)", SystemUserID, currency)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO system_accounts (name, currency, account_id) VALUES (?, ?, ?)", name, currency, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func transferPostingsTx(tx *sql.Tx, transaction Transaction) ([]Posting, error) {
+	return transferPostings(transaction, func(currency string) (int, error) {
+		return systemAccount(tx, ExchangeAccount, currency)
+	})
+}
+
+// postEntry writes a balanced journal entry and applies its postings to the account balances.
+// It is the only place where balances change, so every balance equals the sum of its postings.
+func postEntry(tx *sql.Tx, entry JournalEntry) (JournalEntry, error) {
+	if err := validateEntry(entry); err != nil {
+		return entry, err
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	result, err := tx.Exec("INSERT INTO journal_entries (transaction_id, description, timestamp) VALUES (?, ?, ?)", entry.TransactionID, entry.Description, entry.Timestamp)
+	if err != nil {
+		return entry, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return entry, err
+	}
+	entry.ID = int(id)
+
+	for i, posting := range entry.Postings {
+		result, err := tx.Exec("INSERT INTO postings (entry_id, account_id, amount, currency) VALUES (?, ?, ?, ?)", entry.ID, posting.AccountID, posting.Amount.Amount, posting.Amount.Currency)
+		if err != nil {
+			return entry, err
+		}
+
+		postingId, err := result.LastInsertId()
+		if err != nil {
+			return entry, err
+		}
+
+		update, err := tx.Exec("UPDATE accounts SET balance = balance + ? WHERE id = ? AND currency = ?", posting.Amount.Amount, posting.AccountID, posting.Amount.Currency)
+		if err != nil {
+			return entry, err
+		}
+		if updated, err := update.RowsAffected(); err != nil || updated != 1 {
+			return entry, fmt.Errorf("could not post %s to account %d", posting.Amount, posting.AccountID)
+		}
+
+		entry.Postings[i].ID = int(postingId)
+		entry.Postings[i].EntryID = entry.ID
+		entry.Postings[i].Description = entry.Description
+		entry.Postings[i].Timestamp = entry.Timestamp
+	}
+
+	return entry, nil
+}
+
+func (sqlite *SQLiteDb) GetPostings(accountId int) ([]Posting, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	if _, err := sqlite.GetAccount(accountId); err != nil {
+		return nil, err
+	}
+
+	query := `
+    SELECT postings.id, postings.entry_id, postings.account_id, postings.amount, postings.currency, journal_entries.description, journal_entries.timestamp
+    FROM postings
+    INNER JOIN journal_entries ON journal_entries.id = postings.entry_id
+    WHERE postings.account_id = ?
+    ORDER BY postings.id
+    `
+
+	postings := []Posting{}
+	rows, err := sqlite.client.Query(query, accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var posting Posting
+		if err := rows.Scan(&posting.ID, &posting.EntryID, &posting.AccountID, &posting.Amount.Amount, &posting.Amount.Currency, &posting.Description, &posting.Timestamp); err != nil {
+			return nil, err
+		}
+		postings = append(postings, posting)
+	}
+
+	return postings, rows.Err()
+}
+
+func (sqlite *SQLiteDb) VerifyLedger() ([]LedgerDiscrepancy, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	discrepancies := []LedgerDiscrepancy{}
+
+	accountQuery := `
+    SELECT accounts.id, accounts.balance, accounts.currency, COALESCE(SUM(postings.amount), 0)
+    FROM accounts
+    LEFT JOIN postings ON postings.account_id = accounts.id
+    GROUP BY accounts.id
+    HAVING accounts.balance != COALESCE(SUM(postings.amount), 0)
+    `
+	rows, err := sqlite.client.Query(accountQuery)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var accountId int
+		var balance, posted int64
+		var currency string
+		if err := rows.Scan(&accountId, &balance, &currency, &posted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		discrepancies = append(discrepancies, LedgerDiscrepancy{
+			AccountID: &accountId,
+			Expected:  NewMoney(posted, currency),
+			Actual:    NewMoney(balance, currency),
+			Currency:  currency,
+			Reason:    "account balance differs from the sum of its postings",
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entryQuery := `
+    SELECT entry_id, currency, SUM(amount)
+    FROM postings
+    GROUP BY entry_id, currency
+    HAVING SUM(amount) != 0
+    `
+	rows, err = sqlite.client.Query(entryQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryId int
+		var currency string
+		var sum int64
+		if err := rows.Scan(&entryId, &currency, &sum); err != nil {
+			return nil, err
+		}
+		discrepancies = append(discrepancies, LedgerDiscrepancy{
+			EntryID:  &entryId,
+			Expected: NewMoney(0, currency),
+			Actual:   NewMoney(sum, currency),
+			Currency: currency,
+			Reason:   "journal entry postings do not balance",
+		})
+	}
+
+	return discrepancies, rows.Err()
+}
@@ -0,0 +1,616 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order, each inside its own database transaction.
+// The number of applied migrations is stored in the user_version pragma of the database file,
+// so new schema changes must be appended to the end of the list and never edited afterwards.
+var migrations = []func(tx *sql.Tx) error{
+	createTables,
+	convertMoneyToMinorUnits,
+	addExchangeRates,
+	addLedger,
+	addIdempotencyKeys,
+	addReversals,
+	addStandingOrders,
+	addHolds,
+	addOverdraftLimits,
+	addAccountStatus,
+	addInterest,
+	addTransactionIndexes,
+	addPaymentFiles,
+	addBatchTransfers,
+	addSoftDelete,
+	addUserProfiles,
+	addUserSearchIndexes,
+	addCredentials,
+	addUserRoles,
+	addAPIClients,
+	addSigningSecrets,
+	addAuditLog,
+	scopeIdempotencyKeys,
+}
+
+func (sqlite *SQLiteDb) migrate() error {
+	var version int
+	if err := sqlite.client.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := sqlite.client.Begin()
+		if err != nil {
+			return err
+		}
+
+		if err := migrations[i](tx); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func execStatements(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createTables(tx *sql.Tx) error {
+	createUsersTable := `CREATE TABLE IF NOT EXISTS users (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT
+    );`
+
+	createAccountsTable := `CREATE TABLE IF NOT EXISTS accounts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER,
+        balance REAL,
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createTransactionsTable := `CREATE TABLE IF NOT EXISTS transactions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        from_account_id INTEGER,
+        to_account_id INTEGER,
+        amount REAL,
+        succeeded INTEGER,
+        timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (from_account_id) REFERENCES accounts(id)
+        FOREIGN KEY (to_account_id) REFERENCES accounts(id)
+    );`
+
+	return execStatements(tx, createUsersTable, createAccountsTable, createTransactionsTable)
+}
+
+// convertMoneyToMinorUnits rebuilds the accounts and transactions tables so that balances and amounts
+// are stored as integer minor units of DefaultCurrency instead of REAL values
+func convertMoneyToMinorUnits(tx *sql.Tx) error {
+	type accountRow struct {
+		id      int
+		userId  sql.NullInt64
+		balance sql.NullFloat64
+	}
+
+	rows, err := tx.Query("SELECT id, user_id, balance FROM accounts")
+	if err != nil {
+		return err
+	}
+	accounts := []accountRow{}
+	for rows.Next() {
+		var account accountRow
+		if err := rows.Scan(&account.id, &account.userId, &account.balance); err != nil {
+			rows.Close()
+			return err
+		}
+		accounts = append(accounts, account)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	type transactionRow struct {
+		id            int
+		fromAccountId sql.NullInt64
+		toAccountId   sql.NullInt64
+		amount        sql.NullFloat64
+		succeeded     sql.NullInt64
+		timestamp     any
+	}
+
+	rows, err = tx.Query("SELECT id, from_account_id, to_account_id, amount, succeeded, timestamp FROM transactions")
+	if err != nil {
+		return err
+	}
+	transactions := []transactionRow{}
+	for rows.Next() {
+		var transaction transactionRow
+		if err := rows.Scan(&transaction.id, &transaction.fromAccountId, &transaction.toAccountId, &transaction.amount, &transaction.succeeded, &transaction.timestamp); err != nil {
+			rows.Close()
+			return err
+		}
+		transactions = append(transactions, transaction)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	createAccountsTable := `CREATE TABLE accounts_minor (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER,
+        balance INTEGER NOT NULL DEFAULT 0,
+        currency TEXT NOT NULL DEFAULT 'EUR',
+        FOREIGN KEY (user_id) REFERENCES users(id)
+    );`
+
+	createTransactionsTable := `CREATE TABLE transactions_minor (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        from_account_id INTEGER,
+        to_account_id INTEGER,
+        amount INTEGER NOT NULL,
+        currency TEXT NOT NULL DEFAULT 'EUR',
+        succeeded INTEGER,
+        timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (from_account_id) REFERENCES accounts(id)
+        FOREIGN KEY (to_account_id) REFERENCES accounts(id)
+    );`
+
+	if err := execStatements(tx, createAccountsTable, createTransactionsTable); err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		balance, err := MoneyFromFloat(account.balance.Float64, DefaultCurrency)
+		if err != nil {
+			return fmt.Errorf("account %d: %w", account.id, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO accounts_minor (id, user_id, balance, currency) VALUES (?, ?, ?, ?)", account.id, account.userId, balance.Amount, balance.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, transaction := range transactions {
+		amount, err := MoneyFromFloat(transaction.amount.Float64, DefaultCurrency)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", transaction.id, err)
+		}
+
+		_, err = tx.Exec("INSERT INTO transactions_minor (id, from_account_id, to_account_id, amount, currency, succeeded, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			transaction.id, transaction.fromAccountId, transaction.toAccountId, amount.Amount, amount.Currency, transaction.succeeded, transaction.timestamp)
+		if err != nil {
+			return err
+		}
+	}
+
+	return execStatements(tx,
+		"DROP TABLE accounts",
+		"ALTER TABLE accounts_minor RENAME TO accounts",
+		"DROP TABLE transactions",
+		"ALTER TABLE transactions_minor RENAME TO transactions",
+	)
+}
+
+// addExchangeRates records both sides of cross-currency transfers; existing transfers were all in one currency
+func addExchangeRates(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE exchange_rates (
+            from_currency TEXT NOT NULL,
+            to_currency TEXT NOT NULL,
+            rate TEXT NOT NULL,
+            updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (from_currency, to_currency)
+        );`,
+		"ALTER TABLE transactions ADD COLUMN to_amount INTEGER",
+		"ALTER TABLE transactions ADD COLUMN to_currency TEXT",
+		"ALTER TABLE transactions ADD COLUMN exchange_rate TEXT",
+		"UPDATE transactions SET to_amount = amount, to_currency = currency, exchange_rate = '1'",
+	)
+}
+
+// addLedger creates the journal tables and posts one opening entry per account,
+// so that existing balances equal the sum of their postings
+func addLedger(tx *sql.Tx) error {
+	err := execStatements(tx,
+		`CREATE TABLE system_accounts (
+            name TEXT NOT NULL,
+            currency TEXT NOT NULL,
+            account_id INTEGER NOT NULL,
+            PRIMARY KEY (name, currency),
+            FOREIGN KEY (account_id) REFERENCES accounts(id)
+        );`,
+		`CREATE TABLE journal_entries (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            transaction_id INTEGER,
+            description TEXT,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+        );`,
+		`CREATE TABLE postings (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            entry_id INTEGER NOT NULL,
+            account_id INTEGER NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            FOREIGN KEY (entry_id) REFERENCES journal_entries(id)
+            FOREIGN KEY (account_id) REFERENCES accounts(id)
+        );`,
+		"CREATE INDEX postings_account_id ON postings (account_id)",
+		"CREATE INDEX postings_entry_id ON postings (entry_id)",
+		"CREATE INDEX journal_entries_transaction_id ON journal_entries (transaction_id)",
+	)
+	if err != nil {
+		return err
+	}
+
+	type accountBalance struct {
+		accountId int
+		balance   Money
+	}
+
+	rows, err := tx.Query("SELECT id, balance, currency FROM accounts WHERE balance != 0 ORDER BY id")
+	if err != nil {
+		return err
+	}
+	balances := []accountBalance{}
+	for rows.Next() {
+		var account accountBalance
+		if err := rows.Scan(&account.accountId, &account.balance.Amount, &account.balance.Currency); err != nil {
+			rows.Close()
+			return err
+		}
+		balances = append(balances, account)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// postEntry adds to the balances, so start from zero
+	if _, err := tx.Exec("UPDATE accounts SET balance = 0"); err != nil {
+		return err
+	}
+
+	for _, account := range balances {
+		accountId, balance := account.accountId, account.balance
+		openingAccountId, err := systemAccount(tx, OpeningBalanceAccount, balance.Currency)
+		if err != nil {
+			return err
+		}
+
+		_, err = postEntry(tx, JournalEntry{
+			Description: "opening balance",
+			Postings: []Posting{
+				{AccountID: openingAccountId, Amount: NewMoney(-balance.Amount, balance.Currency)},
+				{AccountID: accountId, Amount: balance},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("account %d: %w", accountId, err)
+		}
+	}
+
+	return nil
+}
+
+func addIdempotencyKeys(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE idempotency_keys (
+            key TEXT PRIMARY KEY,
+            fingerprint TEXT NOT NULL,
+            status_code INTEGER NOT NULL DEFAULT 0,
+            body BLOB,
+            created_at DATETIME NOT NULL
+        );`,
+		"CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at)",
+	)
+}
+
+func addReversals(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE transactions ADD COLUMN reversal_of INTEGER REFERENCES transactions(id)",
+		"CREATE INDEX transactions_reversal_of ON transactions (reversal_of)",
+	)
+}
+
+func addStandingOrders(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE standing_orders (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            from_account_id INTEGER NOT NULL,
+            to_account_id INTEGER NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            frequency TEXT NOT NULL,
+            start_date DATETIME NOT NULL,
+            end_date DATETIME,
+            max_executions INTEGER,
+            executions INTEGER NOT NULL DEFAULT 0,
+            next_run DATETIME,
+            status TEXT NOT NULL,
+            FOREIGN KEY (from_account_id) REFERENCES accounts(id)
+            FOREIGN KEY (to_account_id) REFERENCES accounts(id)
+        );`,
+		`CREATE TABLE standing_order_executions (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            standing_order_id INTEGER NOT NULL,
+            scheduled_for DATETIME NOT NULL,
+            executed_at DATETIME NOT NULL,
+            transaction_id INTEGER,
+            succeeded INTEGER NOT NULL,
+            error TEXT NOT NULL DEFAULT '',
+            FOREIGN KEY (standing_order_id) REFERENCES standing_orders(id)
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+        );`,
+		"CREATE INDEX standing_orders_next_run ON standing_orders (status, next_run)",
+		"CREATE INDEX standing_order_executions_standing_order_id ON standing_order_executions (standing_order_id)",
+	)
+}
+
+func addHolds(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE holds (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            from_account_id INTEGER NOT NULL,
+            to_account_id INTEGER NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            status TEXT NOT NULL,
+            captured_amount INTEGER,
+            transaction_id INTEGER,
+            created_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            FOREIGN KEY (from_account_id) REFERENCES accounts(id)
+            FOREIGN KEY (to_account_id) REFERENCES accounts(id)
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+        );`,
+		"CREATE INDEX holds_from_account_id ON holds (from_account_id, status)",
+		"CREATE INDEX holds_expires_at ON holds (status, expires_at)",
+	)
+}
+
+// addOverdraftLimits lets balances go negative; transfers failed before only when the balance was too small
+func addOverdraftLimits(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE accounts ADD COLUMN overdraft_limit INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE transactions ADD COLUMN failure_reason TEXT NOT NULL DEFAULT ''",
+		"UPDATE transactions SET failure_reason = 'insufficient_funds' WHERE succeeded = 0",
+	)
+}
+
+func addAccountStatus(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE accounts ADD COLUMN status TEXT NOT NULL DEFAULT 'active'",
+	)
+}
+
+// addInterest adds account products; existing accounts become checking accounts, which earn no interest
+func addInterest(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE account_products (
+            name TEXT PRIMARY KEY,
+            interest_rate TEXT NOT NULL
+        );`,
+		"INSERT INTO account_products (name, interest_rate) VALUES ('checking', '0'), ('savings', '0.02')",
+		"ALTER TABLE accounts ADD COLUMN product TEXT NOT NULL DEFAULT 'checking' REFERENCES account_products(name)",
+		"ALTER TABLE accounts ADD COLUMN interest_accrued_through TEXT",
+		`CREATE TABLE interest_accruals (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            account_id INTEGER NOT NULL,
+            date TEXT NOT NULL,
+            balance INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            interest_rate TEXT NOT NULL,
+            amount TEXT NOT NULL,
+            transaction_id INTEGER,
+            UNIQUE (account_id, date),
+            FOREIGN KEY (account_id) REFERENCES accounts(id)
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+        );`,
+		"CREATE INDEX interest_accruals_unpaid ON interest_accruals (transaction_id, date)",
+	)
+}
+
+// addTransactionIndexes speeds up reading the transaction history of an account
+func addTransactionIndexes(tx *sql.Tx) error {
+	return execStatements(tx,
+		"CREATE INDEX transactions_from_account_id ON transactions (from_account_id, timestamp)",
+		"CREATE INDEX transactions_to_account_id ON transactions (to_account_id, timestamp)",
+	)
+}
+
+func addPaymentFiles(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE payment_files (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            format TEXT NOT NULL,
+            status TEXT NOT NULL,
+            created_at DATETIME NOT NULL
+        );`,
+		`CREATE TABLE payment_lines (
+            payment_file_id INTEGER NOT NULL,
+            line INTEGER NOT NULL,
+            reference TEXT NOT NULL,
+            from_account_id INTEGER NOT NULL,
+            to_account_id INTEGER NOT NULL,
+            amount INTEGER NOT NULL,
+            currency TEXT NOT NULL,
+            status TEXT NOT NULL,
+            transaction_id INTEGER,
+            error TEXT NOT NULL DEFAULT '',
+            PRIMARY KEY (payment_file_id, line),
+            FOREIGN KEY (payment_file_id) REFERENCES payment_files(id)
+            FOREIGN KEY (from_account_id) REFERENCES accounts(id)
+            FOREIGN KEY (to_account_id) REFERENCES accounts(id)
+            FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+        );`,
+		"CREATE INDEX payment_files_status ON payment_files (status)",
+	)
+}
+
+func addBatchTransfers(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE batch_transfers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            created_at DATETIME NOT NULL
+        );`,
+		"ALTER TABLE transactions ADD COLUMN batch_id INTEGER REFERENCES batch_transfers(id)",
+		"CREATE INDEX transactions_batch_id ON transactions (batch_id)",
+	)
+}
+
+func addSoftDelete(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE users ADD COLUMN deleted_at DATETIME",
+		"ALTER TABLE accounts ADD COLUMN deleted_at DATETIME",
+	)
+}
+
+// emails are unique among the users that were not deleted
+func addUserProfiles(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN phone TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN date_of_birth TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN address_line1 TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN address_line2 TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN city TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN postal_code TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE users ADD COLUMN country TEXT NOT NULL DEFAULT ''",
+		"CREATE UNIQUE INDEX users_email ON users (email) WHERE email != '' AND deleted_at IS NULL",
+	)
+}
+
+// users_name serves name prefix searches, which ignore case; accounts_user_id serves searches by account
+// and the accounts of a user
+func addUserSearchIndexes(tx *sql.Tx) error {
+	return execStatements(tx,
+		"CREATE INDEX users_name ON users (name COLLATE NOCASE)",
+		"CREATE INDEX accounts_user_id ON accounts (user_id)",
+	)
+}
+
+// users without a password_hash cannot log in; refresh tokens are stored by the hash of the token
+func addCredentials(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''",
+		`CREATE TABLE refresh_tokens (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            user_id INTEGER NOT NULL,
+            token_hash TEXT NOT NULL UNIQUE,
+            created_at DATETIME NOT NULL,
+            expires_at DATETIME NOT NULL,
+            revoked_at DATETIME,
+            replaced_by INTEGER,
+            FOREIGN KEY (user_id) REFERENCES users(id)
+            FOREIGN KEY (replaced_by) REFERENCES refresh_tokens(id)
+        );`,
+		"CREATE INDEX refresh_tokens_user_id ON refresh_tokens (user_id)",
+	)
+}
+
+// existing users become customers; admins have to be chosen by hand, see the README
+func addUserRoles(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'customer'",
+	)
+}
+
+// clients are found by their client id, or by the hash of their API key
+func addAPIClients(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE api_clients (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            client_id TEXT NOT NULL UNIQUE,
+            user_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            scopes TEXT NOT NULL,
+            key_hash TEXT NOT NULL UNIQUE,
+            created_at DATETIME NOT NULL,
+            revoked_at DATETIME,
+            FOREIGN KEY (user_id) REFERENCES users(id)
+        );`,
+		"CREATE INDEX api_clients_user_id ON api_clients (user_id)",
+	)
+}
+
+// clients registered before have no signing secret, so they cannot make the requests that have to be signed
+func addSigningSecrets(tx *sql.Tx) error {
+	return execStatements(tx,
+		"ALTER TABLE api_clients ADD COLUMN signing_secret TEXT NOT NULL DEFAULT ''",
+	)
+}
+
+// the audit log is append-only: the triggers refuse to change or delete what was recorded. Events are
+// searched by their targets, actor and request id, and paged newest first
+func addAuditLog(tx *sql.Tx) error {
+	return execStatements(tx,
+		`CREATE TABLE audit_events (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            timestamp DATETIME NOT NULL,
+            actor_user_id INTEGER,
+            actor_client_id TEXT NOT NULL DEFAULT '',
+            route TEXT NOT NULL,
+            request_id TEXT NOT NULL,
+            source_ip TEXT NOT NULL,
+            before_value TEXT,
+            after_value TEXT,
+            outcome TEXT NOT NULL,
+            status_code INTEGER NOT NULL,
+            error_code TEXT NOT NULL DEFAULT ''
+        );`,
+		`CREATE TABLE audit_targets (
+            event_id INTEGER NOT NULL,
+            target TEXT NOT NULL,
+            PRIMARY KEY (target, event_id),
+            FOREIGN KEY (event_id) REFERENCES audit_events(id)
+        );`,
+		"CREATE INDEX audit_events_actor_user_id ON audit_events (actor_user_id)",
+		"CREATE INDEX audit_events_request_id ON audit_events (request_id)",
+		"CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END",
+		"CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END",
+		"CREATE TRIGGER audit_targets_no_update BEFORE UPDATE ON audit_targets BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END",
+		"CREATE TRIGGER audit_targets_no_delete BEFORE DELETE ON audit_targets BEGIN SELECT RAISE(ABORT, 'the audit log is append-only'); END",
+	)
+}
+
+// idempotency keys are scoped to who made the request and the route it was made to, so clients picking
+// the same key never collide. Stored responses are only kept for a day and cannot be matched to a
+// principal, so they are dropped rather than copied
+func scopeIdempotencyKeys(tx *sql.Tx) error {
+	return execStatements(tx,
+		"DROP TABLE idempotency_keys",
+		`CREATE TABLE idempotency_keys (
+            principal TEXT NOT NULL,
+            route TEXT NOT NULL,
+            key TEXT NOT NULL,
+            fingerprint TEXT NOT NULL,
+            status_code INTEGER NOT NULL DEFAULT 0,
+            content_type TEXT NOT NULL DEFAULT '',
+            body BLOB,
+            created_at DATETIME NOT NULL,
+            PRIMARY KEY (principal, route, key)
+        );`,
+		"CREATE INDEX idempotency_keys_created_at ON idempotency_keys (created_at)",
+	)
+}
@@ -0,0 +1,69 @@
+package db
+
+func (mock *MockDb) SetAccountStatus(accountId int, status string) (Account, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if err := checkStatusChange(account, status); err != nil {
+		return account, err
+	}
+
+	mock.setStatus(accountId, status)
+	return mock.GetAccount(accountId)
+}
+
+func (mock *MockDb) setStatus(accountId int, status string) {
+	for i := range mock.accounts {
+		if mock.accounts[i].ID == accountId {
+			mock.accounts[i].Status = status
+		}
+	}
+}
+
+func (mock *MockDb) CloseAccount(accountId int, sweepToAccountId *int) (Account, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+
+	activeHolds := 0
+	for _, hold := range mock.holds {
+		if hold.FromAccountID == accountId && hold.Status == HoldActive {
+			activeHolds += 1
+		}
+	}
+	if err := checkClose(account, activeHolds, sweepToAccountId); err != nil {
+		return account, err
+	}
+
+	if sweepToAccountId != nil {
+		if _, err := mock.GetAccount(*sweepToAccountId); err != nil {
+			return account, err
+		}
+	}
+
+	if account.Balance.IsPositive() {
+		sweep, err := mock.transfer(accountId, *sweepToAccountId, account.Balance)
+		if err != nil {
+			return account, err
+		}
+		if sweep.Succeeded == 0 {
+			return account, insufficientFunds(account, account.Balance)
+		}
+	}
+
+	mock.setStatus(accountId, AccountClosed)
+	mock.cancelStandingOrders(accountId)
+
+	return mock.GetAccount(accountId)
+}
+
+func (mock *MockDb) cancelStandingOrders(accountId int) {
+	for i, order := range mock.standingOrders {
+		if order.Status == StandingOrderActive && (order.FromAccountID == accountId || order.ToAccountID == accountId) {
+			mock.standingOrders[i].Status = StandingOrderCancelled
+			mock.standingOrders[i].NextRun = nil
+		}
+	}
+}
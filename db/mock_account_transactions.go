@@ -0,0 +1,29 @@
+package db
+
+func (mock *MockDb) GetAccountTransactions(accountId int) ([]AccountTransaction, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []Transaction{}
+	for _, transaction := range mock.transactions {
+		if transaction.FromAccountID == accountId || transaction.ToAccountID == accountId {
+			transactions = append(transactions, transaction)
+		}
+	}
+
+	posted := map[int]int64{}
+	for _, entry := range mock.entries {
+		if entry.TransactionID == nil {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountId {
+				posted[*entry.TransactionID] += posting.Amount.Amount
+			}
+		}
+	}
+
+	return runningBalances(account, transactions, posted), nil
+}
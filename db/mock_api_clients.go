@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+func (mock *MockDb) CreateAPIClient(client APIClient) (APIClient, error) {
+	client.Name = strings.TrimSpace(client.Name)
+	if err := validateAPIClient(client); err != nil {
+		return client, err
+	}
+	if _, err := mock.GetUser(fmt.Sprint(client.UserID)); err != nil {
+		return client, err
+	}
+
+	client.ID = len(mock.apiClients)
+	client.CreatedAt = mockTime()
+	client.RevokedAt = nil
+	mock.apiClients = append(mock.apiClients, client)
+	return client, nil
+}
+
+func (mock *MockDb) GetAPIClient(clientId string) (APIClient, error) {
+	for _, client := range mock.apiClients {
+		if client.ClientID == clientId && client.RevokedAt == nil {
+			return client, nil
+		}
+	}
+	return APIClient{}, &APIClientNotFoundError{ClientID: clientId}
+}
+
+func (mock *MockDb) GetAPIClientByKey(keyHash string) (APIClient, error) {
+	for _, client := range mock.apiClients {
+		if client.KeyHash == keyHash && client.RevokedAt == nil {
+			return client, nil
+		}
+	}
+	return APIClient{}, &APIClientNotFoundError{ClientID: "with this key"}
+}
+
+func (mock *MockDb) GetAPIClients(userId int) ([]APIClient, error) {
+	clients := []APIClient{}
+	for _, client := range mock.apiClients {
+		if client.UserID == userId {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+func (mock *MockDb) RevokeAPIClient(clientId string) (APIClient, error) {
+	client, err := mock.GetAPIClient(clientId)
+	if err != nil {
+		return client, err
+	}
+
+	revokedAt := mockTime()
+	mock.apiClients[client.ID].RevokedAt = &revokedAt
+	return mock.apiClients[client.ID], nil
+}
+
+func (mock *MockDb) revokeAPIClients(userId int, revokedAt time.Time) {
+	for i, client := range mock.apiClients {
+		if client.UserID == userId && client.RevokedAt == nil {
+			mock.apiClients[i].RevokedAt = &revokedAt
+		}
+	}
+}
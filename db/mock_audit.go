@@ -0,0 +1,65 @@
+package db
+
+import "strings"
+
+func (mock *MockDb) CreateAuditEvent(event AuditEvent) (AuditEvent, error) {
+	event.ID = len(mock.auditEvents)
+	mock.auditEvents = append(mock.auditEvents, event)
+	return event, nil
+}
+
+func (mock *MockDb) SearchAuditEvents(filter AuditFilter) (AuditPage, error) {
+	filter, err := ValidateAuditFilter(filter)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	lastId := len(mock.auditEvents)
+	if filter.Cursor != "" {
+		lastId, _ = decodeCursor(filter.Cursor, auditCursorSort)
+	}
+
+	events := []AuditEvent{}
+	for i := len(mock.auditEvents) - 1; i >= 0; i-- {
+		event := mock.auditEvents[i]
+		if event.ID >= lastId {
+			continue
+		}
+		if filter.ActorUserID != nil && (event.ActorUserID == nil || *event.ActorUserID != *filter.ActorUserID) {
+			continue
+		}
+		if filter.ActorClientID != "" && event.ActorClientID != filter.ActorClientID {
+			continue
+		}
+		if filter.Target != "" && !hasTarget(event, filter.Target) {
+			continue
+		}
+		if filter.Route != "" && !strings.HasPrefix(strings.ToLower(event.Route), strings.ToLower(filter.Route)) {
+			continue
+		}
+		if filter.RequestID != "" && event.RequestID != filter.RequestID {
+			continue
+		}
+		if filter.Outcome != "" && event.Outcome != filter.Outcome {
+			continue
+		}
+		if filter.From != nil && event.Timestamp.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !event.Timestamp.Before(*filter.To) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return paginateAuditEvents(events, filter), nil
+}
+
+func hasTarget(event AuditEvent, target string) bool {
+	for _, eventTarget := range event.Targets {
+		if eventTarget == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package db
+
+import "maps"
+
+func (mock *MockDb) CreateBatchTransfer(legs []TransferLeg) (BatchTransfer, error) {
+	if err := validateBatchTransfer(legs); err != nil {
+		return BatchTransfer{}, err
+	}
+	for i, leg := range legs {
+		if err := mock.checkFailedTransactions(leg.FromAccountID); err != nil {
+			if _, ok := err.(*FailedTransactionsLimitError); ok {
+				return BatchTransfer{}, err
+			}
+			return BatchTransfer{}, &BatchTransferError{Leg: i + 1, Err: err}
+		}
+	}
+
+	// the mock has no database transaction to roll back, so what the legs change is put back by hand
+	accounts := append([]Account{}, mock.accounts...)
+	transactions := len(mock.transactions)
+	entries := len(mock.entries)
+	systemIds := maps.Clone(mock.systemIds)
+	rollback := func() {
+		mock.accounts = accounts
+		mock.transactions = mock.transactions[:transactions]
+		mock.entries = mock.entries[:entries]
+		mock.systemIds = systemIds
+	}
+
+	batchId := len(mock.batchTransfers)
+	batch := BatchTransfer{ID: batchId, CreatedAt: mockTime(), Transactions: []Transaction{}}
+	for i, leg := range legs {
+		transaction, err := mock.transfer(leg.FromAccountID, leg.ToAccountID, leg.Amount)
+		if err != nil {
+			rollback()
+			return BatchTransfer{}, &BatchTransferError{Leg: i + 1, Err: err}
+		}
+		if transaction.Succeeded != 1 {
+			fromAccount, _ := mock.GetAccount(leg.FromAccountID)
+			rollback()
+			return BatchTransfer{}, &BatchTransferError{Leg: i + 1, Err: insufficientFunds(fromAccount, leg.Amount)}
+		}
+
+		mock.transactions[transaction.ID].BatchID = &batchId
+		transaction.BatchID = &batchId
+		batch.Transactions = append(batch.Transactions, transaction)
+	}
+
+	mock.batchTransfers = append(mock.batchTransfers, batch)
+	return batch, nil
+}
+
+func (mock *MockDb) GetBatchTransfer(batchId int) (BatchTransfer, error) {
+	if batchId < 0 || batchId >= len(mock.batchTransfers) {
+		return BatchTransfer{}, &BatchTransferNotFoundError{BatchID: batchId}
+	}
+
+	batch := mock.batchTransfers[batchId]
+	batch.Transactions = []Transaction{}
+	for _, transaction := range mock.transactions {
+		if transaction.BatchID != nil && *transaction.BatchID == batchId {
+			batch.Transactions = append(batch.Transactions, transaction)
+		}
+	}
+	return batch, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import "time"
+
+func (mock *MockDb) GetCredentials(email string) (Credentials, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return Credentials{}, &InvalidCredentialsError{}
+	}
+	for _, user := range mock.users {
+		if user.Email == email && user.DeletedAt == nil && user.PasswordHash != "" {
+			return Credentials{UserID: user.ID, Email: user.Email, PasswordHash: user.PasswordHash}, nil
+		}
+	}
+	return Credentials{}, &InvalidCredentialsError{}
+}
+
+func (mock *MockDb) CreateRefreshToken(token RefreshToken) (RefreshToken, error) {
+	token.ID = len(mock.refreshTokens)
+	token.RevokedAt = nil
+	token.ReplacedBy = nil
+	mock.refreshTokens = append(mock.refreshTokens, token)
+	return token, nil
+}
+
+func (mock *MockDb) RotateRefreshToken(tokenHash string, next RefreshToken) (RefreshToken, error) {
+	for _, token := range mock.refreshTokens {
+		if token.TokenHash != tokenHash {
+			continue
+		}
+
+		if token.RevokedAt != nil {
+			if token.ReplacedBy != nil {
+				mock.revokeRefreshTokens(token.UserID, next.CreatedAt)
+				return next, &InvalidRefreshTokenError{Reason: reasonTokenReused}
+			}
+			return next, &InvalidRefreshTokenError{Reason: "was revoked"}
+		}
+		if !next.CreatedAt.Before(token.ExpiresAt) {
+			return next, &InvalidRefreshTokenError{Reason: "has expired"}
+		}
+		if mock.users[token.UserID].DeletedAt != nil {
+			return next, &InvalidRefreshTokenError{Reason: "was revoked"}
+		}
+
+		next.UserID = token.UserID
+		next, _ = mock.CreateRefreshToken(next)
+		revokedAt := next.CreatedAt
+		mock.refreshTokens[token.ID].RevokedAt = &revokedAt
+		mock.refreshTokens[token.ID].ReplacedBy = &next.ID
+		return next, nil
+	}
+	return next, &InvalidRefreshTokenError{Reason: "does not exist"}
+}
+
+func (mock *MockDb) RevokeRefreshToken(tokenHash string) error {
+	for i, token := range mock.refreshTokens {
+		if token.TokenHash == tokenHash && token.RevokedAt == nil {
+			revokedAt := mockTime()
+			mock.refreshTokens[i].RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+func (mock *MockDb) revokeRefreshTokens(userId int, revokedAt time.Time) {
+	for i, token := range mock.refreshTokens {
+		if token.UserID == userId && token.RevokedAt == nil {
+			mock.refreshTokens[i].RevokedAt = &revokedAt
+		}
+	}
+}
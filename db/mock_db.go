@@ -6,9 +6,25 @@ import (
 )
 
 type MockDb struct {
-	users        []User
-	accounts     []Account
-	transactions []Transaction
+	users           []User
+	accounts        []Account
+	transactions    []Transaction
+	rates           []ExchangeRate
+	exchangeRates   ExchangeRateProvider
+	entries         []JournalEntry
+	systemIds       map[string]int
+	idempotencyKeys map[IdempotencyKey]IdempotencyRecord
+	standingOrders  []StandingOrder
+	executions      []StandingOrderExecution
+	holds           []Hold
+	paymentFiles    []PaymentFile
+	batchTransfers  []BatchTransfer
+	products        []AccountProduct
+	accruals        []InterestAccrual
+	accruedThrough  map[int]string
+	refreshTokens   []RefreshToken
+	apiClients      []APIClient
+	auditEvents     []AuditEvent
 }
 
 func NewMockDb() (MockDb, error) {
@@ -20,112 +36,211 @@ func NewMockDb() (MockDb, error) {
 	return db, nil
 }
 
+// mockTime is the timestamp of everything created in the mock; it is in the future,
+// as the backend will consider these to be transactions from today
+func mockTime() time.Time {
+	setTime, _ := time.Parse("2006-01-02 15:04:05 -0700", "2030-10-07 12:44:22 +0530")
+	return setTime
+}
+
 func (mock *MockDb) init() error {
 	mock.users = []User{
-		{ID: 0, Name: "Alice"},
-		{ID: 1, Name: "Bob"},
-		{ID: 2, Name: "Charlie"},
+		{ID: 0, Name: "Alice", Role: RoleAdmin},
+		{ID: 1, Name: "Bob", Role: RoleCustomer},
+		{ID: 2, Name: "Charlie", Role: RoleCustomer},
 	}
 
+	mock.products = []AccountProduct{
+		{Name: DefaultProduct, InterestRate: "0"},
+		{Name: "savings", InterestRate: "0.02"},
+	}
+	mock.accruedThrough = map[int]string{}
+
 	mock.accounts = []Account{
-		{ID: 0, UserID: 0, Balance: 400},
-		{ID: 1, UserID: 1, Balance: 900},
-		{ID: 2, UserID: 2, Balance: 200},
-		{ID: 3, UserID: 2, Balance: 300},
+		{ID: 0, UserID: 0, Balance: NewMoney(0, DefaultCurrency), OverdraftLimit: NewMoney(0, DefaultCurrency), Product: DefaultProduct, Status: AccountActive},
+		{ID: 1, UserID: 1, Balance: NewMoney(0, DefaultCurrency), OverdraftLimit: NewMoney(0, DefaultCurrency), Product: DefaultProduct, Status: AccountActive},
+		{ID: 2, UserID: 2, Balance: NewMoney(0, DefaultCurrency), OverdraftLimit: NewMoney(0, DefaultCurrency), Product: DefaultProduct, Status: AccountActive},
+		{ID: 3, UserID: 2, Balance: NewMoney(0, DefaultCurrency), OverdraftLimit: NewMoney(0, DefaultCurrency), Product: DefaultProduct, Status: AccountActive},
+	}
+
+	// balances are only changed through the ledger
+	mock.entries = []JournalEntry{}
+	mock.systemIds = map[string]int{}
+	for accountId, balance := range []int64{40000, 90000, 20000, 30000} {
+		if err := mock.postOpeningBalance(accountId, NewMoney(balance, DefaultCurrency)); err != nil {
+			return err
+		}
 	}
 
 	// use future dates, as the backend will consider these to be transactions from today
-	setTime, _ := time.Parse("2006-01-02 15:04:05 -0700", "2030-10-07 12:44:22 +0530")
+	setTime := mockTime()
 	mock.transactions = []Transaction{
-		{ID: 0, FromAccountID: 0, ToAccountID: 1, Amount: 600, Succeeded: 1, Timestamp: setTime},
-		{ID: 1, FromAccountID: 0, ToAccountID: 1, Amount: 500, Succeeded: 0, Timestamp: setTime},
-		{ID: 2, FromAccountID: 0, ToAccountID: 2, Amount: 500, Succeeded: 0, Timestamp: setTime},
-		{ID: 3, FromAccountID: 2, ToAccountID: 3, Amount: 300, Succeeded: 1, Timestamp: setTime},
+		{ID: 0, FromAccountID: 0, ToAccountID: 1, Amount: NewMoney(60000, DefaultCurrency), ToAmount: NewMoney(60000, DefaultCurrency), ExchangeRate: "1", Succeeded: 1, Timestamp: setTime},
+		{ID: 1, FromAccountID: 0, ToAccountID: 1, Amount: NewMoney(50000, DefaultCurrency), ToAmount: NewMoney(50000, DefaultCurrency), ExchangeRate: "1", Succeeded: 0, FailureReason: FailureInsufficientFunds, Timestamp: setTime},
+		{ID: 2, FromAccountID: 0, ToAccountID: 2, Amount: NewMoney(50000, DefaultCurrency), ToAmount: NewMoney(50000, DefaultCurrency), ExchangeRate: "1", Succeeded: 0, FailureReason: FailureInsufficientFunds, Timestamp: setTime},
+		{ID: 3, FromAccountID: 2, ToAccountID: 3, Amount: NewMoney(30000, DefaultCurrency), ToAmount: NewMoney(30000, DefaultCurrency), ExchangeRate: "1", Succeeded: 1, Timestamp: setTime},
 	}
 
 	return nil
 }
 
-func (mock *MockDb) CreateUser(userName string) (User, error) {
-	userId := len(mock.users)
-	user := User{ID: userId, Name: userName}
+func (mock *MockDb) CreateUser(user User) (User, error) {
+	user, err := ValidateUser(user)
+	if err != nil {
+		return user, err
+	}
+	if err := mock.checkEmail(user); err != nil {
+		return user, err
+	}
+
+	user.ID = len(mock.users)
+	user.Role = RoleCustomer
+	user.DeletedAt = nil
 	mock.users = append(mock.users, user)
 
 	return user, nil
 }
 
-func (mock *MockDb) CreateAccount(userId int, balance float64) (Account, error) {
+func (mock *MockDb) CreateAccount(userId int, balance Money, product string) (Account, error) {
+	if _, err := CurrencyExponent(balance.Currency); err != nil {
+		return Account{}, err
+	}
+	if _, err := mock.getAccountProduct(product); err != nil {
+		return Account{}, err
+	}
+
 	accountId := len(mock.accounts)
-	account := Account{ID: accountId, UserID: userId, Balance: balance}
+	account := Account{ID: accountId, UserID: userId, Balance: NewMoney(0, balance.Currency), OverdraftLimit: NewMoney(0, balance.Currency), Product: product, Status: AccountActive}
 	mock.accounts = append(mock.accounts, account)
 
-	return account, nil
+	if err := mock.postOpeningBalance(accountId, balance); err != nil {
+		return account, err
+	}
+
+	return mock.GetAccount(accountId)
 }
 
-func (mock *MockDb) CreateTransaction(fromAccountId int, toAccountId int, amount float64) (Transaction, error) {
+func (mock *MockDb) CreateTransaction(fromAccountId int, toAccountId int, amount Money) (Transaction, error) {
 	var transaction Transaction
+	if !amount.IsPositive() {
+		return transaction, &InvalidAmountError{Amount: amount.Decimal(), Reason: "must be positive"}
+	}
+
+	if err := mock.checkFailedTransactions(fromAccountId); err != nil {
+		return transaction, err
+	}
 
+	return mock.transfer(fromAccountId, toAccountId, amount)
+}
+
+// checkFailedTransactions denies new transactions of the owner of an account once 3 of their transactions failed in the past day.
+// Runs of standing orders and lines of payment files are not held to the limit, so their failures do not count towards it either
+func (mock *MockDb) checkFailedTransactions(fromAccountId int) error {
 	user, err := mock.GetUserByAccountId(fromAccountId)
 	if err != nil {
-		return transaction, err
+		return err
 	}
 
 	pastTransactions, err := mock.GetTransactions(fmt.Sprint(user.ID), false)
 	if err != nil {
-		return transaction, err
+		return err
+	}
+
+	unlimited := map[int]bool{}
+	for _, execution := range mock.executions {
+		if execution.TransactionID != nil {
+			unlimited[*execution.TransactionID] = true
+		}
+	}
+	for _, file := range mock.paymentFiles {
+		for _, line := range file.Lines {
+			if line.TransactionID != nil {
+				unlimited[*line.TransactionID] = true
+			}
+		}
 	}
 
 	past24Hours := time.Now().Add(-24 * time.Hour)
 	failedTransactionsCnt := 0
 	for _, transaction := range pastTransactions {
-		if transaction.Timestamp.After(past24Hours) && transaction.Succeeded == 0 {
+		if transaction.Timestamp.After(past24Hours) && transaction.Succeeded == 0 && !unlimited[transaction.ID] {
 			failedTransactionsCnt += 1
 		}
 		if failedTransactionsCnt >= 3 {
-			return transaction, &FailedTransactionsLimitError{}
+			return &FailedTransactionsLimitError{}
 		}
 	}
 
-	var fromBalance float64
-	for _, account := range mock.accounts {
-		if account.ID == fromAccountId {
-			fromBalance = account.Balance
-		}
+	return nil
+}
+
+// transfer mirrors SQLiteDb.transfer: it checks everything before changing any state
+func (mock *MockDb) transfer(fromAccountId int, toAccountId int, amount Money) (Transaction, error) {
+	var transaction Transaction
+
+	fromAccount, err := mock.GetAccount(fromAccountId)
+	if err != nil {
+		return transaction, err
 	}
 
-	var toBalance float64
-	for _, account := range mock.accounts {
-		if account.ID == toAccountId {
-			fromBalance = account.Balance
-		}
+	toAccount, err := mock.GetAccount(toAccountId)
+	if err != nil {
+		return transaction, err
 	}
 
-	transactionSucceeded := 1
-	if fromBalance < amount {
-		transactionSucceeded = 0
+	if err := checkTransfer(fromAccount, toAccount); err != nil {
+		return transaction, err
 	}
-	newFromBalance := fromBalance - amount
-	newToBalance := toBalance + amount
 
-	for i, account := range mock.accounts {
-		if account.ID == fromAccountId {
-			mock.accounts[i].Balance = newFromBalance
-		}
+	if amount.Currency != fromAccount.Balance.Currency {
+		return transaction, &CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: amount.Currency}
 	}
 
-	for i, account := range mock.accounts {
-		if account.ID == toAccountId {
-			mock.accounts[i].Balance = newToBalance
-		}
+	rate, err := mock.lookupRate(fromAccount.Balance.Currency, toAccount.Balance.Currency)
+	if err != nil {
+		return transaction, err
+	}
+
+	toAmount, err := rate.Convert(amount)
+	if err != nil {
+		return transaction, err
+	}
+
+	transactionSucceeded := 1
+	failureReason := spendFailure(fromAccount, amount)
+	if failureReason != "" {
+		transactionSucceeded = 0
 	}
 
-	transaction.ID = len(mock.transactions)
 	transaction.FromAccountID = fromAccountId
 	transaction.ToAccountID = toAccountId
 	transaction.Amount = amount
-	setTime, _ := time.Parse("2006-01-02 15:04:05 -0700", "2030-10-07 12:44:22 +0530")
-	transaction.Timestamp = setTime
+	transaction.ToAmount = toAmount
+	transaction.ExchangeRate = rate.Rate
 	transaction.Succeeded = transactionSucceeded
+	transaction.FailureReason = failureReason
+
+	return mock.insertTransaction(transaction, "transfer")
+}
+
+func (mock *MockDb) insertTransaction(transaction Transaction, description string) (Transaction, error) {
+	transaction.ID = len(mock.transactions)
+	transaction.Timestamp = mockTime()
+
+	if transaction.Succeeded == 1 {
+		postings, err := transferPostings(transaction, func(currency string) (int, error) {
+			return mock.systemAccount(ExchangeAccount, currency), nil
+		})
+		if err != nil {
+			return transaction, err
+		}
+
+		transactionId := transaction.ID
+		_, err = mock.postEntry(JournalEntry{TransactionID: &transactionId, Description: description, Timestamp: transaction.Timestamp, Postings: postings})
+		if err != nil {
+			return transaction, err
+		}
+	}
 
 	mock.transactions = append(mock.transactions, transaction)
 
@@ -134,11 +249,11 @@ func (mock *MockDb) CreateTransaction(fromAccountId int, toAccountId int, amount
 
 func (mock *MockDb) GetUser(userId string) (User, error) {
 	for _, user := range mock.users {
-		if fmt.Sprint(user.ID) == userId {
+		if fmt.Sprint(user.ID) == userId && user.DeletedAt == nil {
 			return user, nil
 		}
 	}
-	return User{}, fmt.Errorf("could not find user %s", userId)
+	return User{}, &UserNotFoundError{UserID: userId}
 }
 
 func (mock *MockDb) GetUserByAccountId(accountId int) (User, error) {
@@ -147,30 +262,47 @@ func (mock *MockDb) GetUserByAccountId(accountId int) (User, error) {
 			return mock.GetUser(fmt.Sprint(account.UserID))
 		}
 	}
-	return User{}, fmt.Errorf("could not find user with account %d", accountId)
+	return User{}, &AccountNotFoundError{AccountID: accountId}
+}
+
+func (mock *MockDb) GetAccount(accountId int) (Account, error) {
+	for _, account := range mock.accounts {
+		if account.ID == accountId {
+			return mock.withAvailableBalance(account), nil
+		}
+	}
+	return Account{}, &AccountNotFoundError{AccountID: accountId}
 }
 
 func (mock *MockDb) GetAccounts(userId string) ([]Account, error) {
 	accounts := []Account{}
 	for _, account := range mock.accounts {
-		if fmt.Sprintf("%d", account.UserID) == userId {
-			accounts = append(accounts, account)
+		if fmt.Sprintf("%d", account.UserID) == userId && account.DeletedAt == nil {
+			accounts = append(accounts, mock.withAvailableBalance(account))
 		}
 	}
 	return accounts, nil
 }
 
+func (mock *MockDb) GetTransaction(transactionId int) (Transaction, error) {
+	for _, transaction := range mock.transactions {
+		if transaction.ID == transactionId {
+			return transaction, nil
+		}
+	}
+	return Transaction{}, &TransactionNotFoundError{TransactionID: transactionId}
+}
+
 // incoming is true to get all transactions into the account
 // incoming is false to get all transactions out of the account (outgoing transactions)
 func (mock *MockDb) GetTransactions(userId string, incoming bool) ([]Transaction, error) {
 	transactions := []Transaction{}
 
-	accounts, err := mock.GetAccounts(userId)
-	if err != nil {
-		return transactions, err
-	}
-
-	for _, account := range accounts {
+	// deleted accounts keep their transactions
+	for _, account := range mock.accounts {
+		if fmt.Sprint(account.UserID) != userId {
+			continue
+		}
 		for _, transaction := range mock.transactions {
 
 			if (incoming && transaction.ToAccountID == account.ID) || (!incoming && transaction.FromAccountID == account.ID) {
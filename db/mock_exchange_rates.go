@@ -0,0 +1,47 @@
+package db
+
+func (mock *MockDb) SetExchangeRateProvider(provider ExchangeRateProvider) {
+	mock.exchangeRates = provider
+}
+
+func (mock *MockDb) ExchangeRate(from string, to string) (ExchangeRate, error) {
+	for _, rate := range mock.rates {
+		if rate.From == from && rate.To == to {
+			return rate, nil
+		}
+	}
+	return ExchangeRate{}, &ExchangeRateNotFoundError{From: from, To: to}
+}
+
+func (mock *MockDb) SetExchangeRate(rate ExchangeRate) (ExchangeRate, error) {
+	if err := ValidateExchangeRate(rate); err != nil {
+		return rate, err
+	}
+
+	rate.UpdatedAt = mockTime()
+	for i, existing := range mock.rates {
+		if existing.From == rate.From && existing.To == rate.To {
+			mock.rates[i] = rate
+			return rate, nil
+		}
+	}
+	mock.rates = append(mock.rates, rate)
+
+	return rate, nil
+}
+
+func (mock *MockDb) GetExchangeRates() ([]ExchangeRate, error) {
+	rates := []ExchangeRate{}
+	rates = append(rates, mock.rates...)
+	return rates, nil
+}
+
+func (mock *MockDb) lookupRate(from string, to string) (ExchangeRate, error) {
+	if from == to {
+		return identityRate(from), nil
+	}
+	if mock.exchangeRates != nil {
+		return mock.exchangeRates.ExchangeRate(from, to)
+	}
+	return mock.ExchangeRate(from, to)
+}
@@ -0,0 +1,100 @@
+package db
+
+import "time"
+
+// withAvailableBalance sets the available balance of account from the active holds on it
+func (mock *MockDb) withAvailableBalance(account Account) Account {
+	account.AvailableBalance = account.Balance
+	for _, hold := range mock.holds {
+		if hold.FromAccountID == account.ID && hold.Status == HoldActive {
+			account.AvailableBalance.Amount -= hold.Amount.Amount
+		}
+	}
+	return account
+}
+
+func (mock *MockDb) CreateHold(hold Hold) (Hold, error) {
+	fromAccount, err := mock.GetAccount(hold.FromAccountID)
+	if err != nil {
+		return hold, err
+	}
+	toAccount, err := mock.GetAccount(hold.ToAccountID)
+	if err != nil {
+		return hold, err
+	}
+
+	hold, err = newHold(hold, fromAccount, toAccount, mockTime())
+	if err != nil {
+		return hold, err
+	}
+
+	hold.ID = len(mock.holds)
+	mock.holds = append(mock.holds, hold)
+
+	return hold, nil
+}
+
+func (mock *MockDb) GetHold(holdId int) (Hold, error) {
+	for _, hold := range mock.holds {
+		if hold.ID == holdId {
+			return hold, nil
+		}
+	}
+	return Hold{}, &HoldNotFoundError{HoldID: holdId}
+}
+
+func (mock *MockDb) CaptureHold(holdId int, amount *Money) (Hold, error) {
+	hold, err := mock.GetHold(holdId)
+	if err != nil {
+		return hold, err
+	}
+
+	captured, err := captureAmount(hold, amount, mockTime())
+	if err != nil {
+		return hold, err
+	}
+
+	mock.holds[hold.ID].Status = HoldCaptured
+	transaction, err := mock.transfer(hold.FromAccountID, hold.ToAccountID, captured)
+	if err != nil || transaction.Succeeded == 0 {
+		mock.holds[hold.ID] = hold
+		if err == nil {
+			account, _ := mock.GetAccount(hold.FromAccountID)
+			err = insufficientFunds(account, captured)
+		}
+		return hold, err
+	}
+
+	hold.Status = HoldCaptured
+	hold.CapturedAmount = &captured
+	hold.TransactionID = &transaction.ID
+	mock.holds[hold.ID] = hold
+
+	return hold, nil
+}
+
+func (mock *MockDb) VoidHold(holdId int) (Hold, error) {
+	hold, err := mock.GetHold(holdId)
+	if err != nil {
+		return hold, err
+	}
+	if hold.Status != HoldActive {
+		return hold, &HoldError{HoldID: hold.ID, Reason: "the hold is " + hold.Status}
+	}
+
+	hold.Status = HoldVoided
+	mock.holds[hold.ID] = hold
+
+	return hold, nil
+}
+
+func (mock *MockDb) ExpireHolds(now time.Time) ([]Hold, error) {
+	expired := []Hold{}
+	for i, hold := range mock.holds {
+		if hold.Status == HoldActive && !hold.ExpiresAt.After(now) {
+			mock.holds[i].Status = HoldExpired
+			expired = append(expired, mock.holds[i])
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,35 @@
+package db
+
+func (mock *MockDb) ReserveIdempotencyKey(key IdempotencyKey, fingerprint string) (IdempotencyRecord, bool, error) {
+	if mock.idempotencyKeys == nil {
+		mock.idempotencyKeys = map[IdempotencyKey]IdempotencyRecord{}
+	}
+
+	if record, ok := mock.idempotencyKeys[key]; ok {
+		return record, false, nil
+	}
+
+	record := IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: mockTime()}
+	mock.idempotencyKeys[key] = record
+
+	return record, true, nil
+}
+
+func (mock *MockDb) CompleteIdempotencyKey(key IdempotencyKey, statusCode int, contentType string, body []byte) error {
+	record, ok := mock.idempotencyKeys[key]
+	if !ok {
+		return nil
+	}
+
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte{}, body...)
+	mock.idempotencyKeys[key] = record
+
+	return nil
+}
+
+func (mock *MockDb) ReleaseIdempotencyKey(key IdempotencyKey) error {
+	delete(mock.idempotencyKeys, key)
+	return nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import "time"
+
+func (mock *MockDb) GetAccountProducts() ([]AccountProduct, error) {
+	return append([]AccountProduct{}, mock.products...), nil
+}
+
+func (mock *MockDb) getAccountProduct(name string) (AccountProduct, error) {
+	for _, product := range mock.products {
+		if product.Name == name {
+			return product, nil
+		}
+	}
+	return AccountProduct{Name: name}, &ProductNotFoundError{Product: name}
+}
+
+func (mock *MockDb) SetAccountProduct(product AccountProduct) (AccountProduct, error) {
+	if err := ValidateAccountProduct(product); err != nil {
+		return product, err
+	}
+
+	for i := range mock.products {
+		if mock.products[i].Name == product.Name {
+			mock.products[i] = product
+			return product, nil
+		}
+	}
+	mock.products = append(mock.products, product)
+
+	return product, nil
+}
+
+func (mock *MockDb) GetAccruedInterest(accountId int) (AccruedInterest, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return AccruedInterest{}, err
+	}
+
+	product, err := mock.getAccountProduct(account.Product)
+	if err != nil {
+		return AccruedInterest{}, err
+	}
+
+	accruals := []InterestAccrual{}
+	for _, accrual := range mock.accruals {
+		if accrual.AccountID == accountId && accrual.TransactionID == nil {
+			accruals = append(accruals, accrual)
+		}
+	}
+
+	return accruedInterest(account, product, accruals), nil
+}
+
+func (mock *MockDb) AccrueInterest(through time.Time) (int, error) {
+	accrued := 0
+	day := through.UTC().Format(time.DateOnly)
+	for _, account := range mock.accounts {
+		if account.UserID == SystemUserID || account.Status == AccountClosed {
+			continue
+		}
+
+		product, err := mock.getAccountProduct(account.Product)
+		if err != nil {
+			return accrued, err
+		}
+
+		for _, date := range accrualDays(mock.accruedThrough[account.ID], through.UTC()) {
+			accrual, ok, err := newAccrual(account, product.InterestRate, date)
+			if err != nil {
+				return accrued, err
+			}
+			if !ok {
+				continue
+			}
+
+			accrual.ID = len(mock.accruals)
+			mock.accruals = append(mock.accruals, accrual)
+			accrued += 1
+		}
+
+		if mock.accruedThrough[account.ID] < day {
+			mock.accruedThrough[account.ID] = day
+		}
+	}
+
+	return accrued, nil
+}
+
+func (mock *MockDb) PostInterest(now time.Time) ([]Transaction, error) {
+	monthStart := firstOfMonth(now)
+	transactions := []Transaction{}
+
+	for _, account := range mock.accounts {
+		if account.Status == AccountClosed {
+			continue
+		}
+
+		due := []int{}
+		accruals := []InterestAccrual{}
+		for i, accrual := range mock.accruals {
+			if accrual.AccountID == account.ID && accrual.TransactionID == nil && accrual.Date < monthStart {
+				due = append(due, i)
+				accruals = append(accruals, accrual)
+			}
+		}
+
+		amount, err := interestPayout(accruals, account.Balance.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if !amount.IsPositive() {
+			continue
+		}
+
+		expenseAccountId := mock.systemAccount(InterestExpenseAccount, account.Balance.Currency)
+		transaction, err := mock.insertTransaction(interestTransaction(expenseAccountId, account.ID, amount), "interest")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, i := range due {
+			mock.accruals[i].TransactionID = &transaction.ID
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+)
+
+func (mock *MockDb) systemAccount(name string, currency string) int {
+	key := name + "/" + currency
+	if accountId, ok := mock.systemIds[key]; ok {
+		return accountId
+	}
+
+	accountId := len(mock.accounts)
+	mock.accounts = append(mock.accounts, Account{ID: accountId, UserID: SystemUserID, Balance: NewMoney(0, currency), OverdraftLimit: NewMoney(0, currency), Product: DefaultProduct, Status: AccountActive})
+	mock.systemIds[key] = accountId
+
+	return accountId
+}
+
+func (mock *MockDb) postOpeningBalance(accountId int, balance Money) error {
+	if balance.IsZero() {
+		return nil
+	}
+
+	openingAccountId := mock.systemAccount(OpeningBalanceAccount, balance.Currency)
+	_, err := mock.postEntry(JournalEntry{
+		Description: "opening balance",
+		Postings: []Posting{
+			{AccountID: openingAccountId, Amount: NewMoney(-balance.Amount, balance.Currency)},
+			{AccountID: accountId, Amount: balance},
+		},
+	})
+	return err
+}
+
+func (mock *MockDb) postEntry(entry JournalEntry) (JournalEntry, error) {
+	if err := validateEntry(entry); err != nil {
+		return entry, err
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = mockTime()
+	}
+
+	indexes := make([]int, len(entry.Postings))
+	for i, posting := range entry.Postings {
+		indexes[i] = -1
+		for j, account := range mock.accounts {
+			if account.ID == posting.AccountID && account.Balance.Currency == posting.Amount.Currency {
+				indexes[i] = j
+			}
+		}
+		if indexes[i] == -1 {
+			return entry, fmt.Errorf("could not post %s to account %d", posting.Amount, posting.AccountID)
+		}
+	}
+
+	postingId := 0
+	for _, existing := range mock.entries {
+		postingId += len(existing.Postings)
+	}
+
+	entry.ID = len(mock.entries)
+	for i, posting := range entry.Postings {
+		mock.accounts[indexes[i]].Balance.Amount += posting.Amount.Amount
+
+		entry.Postings[i].ID = postingId + i
+		entry.Postings[i].EntryID = entry.ID
+		entry.Postings[i].Description = entry.Description
+		entry.Postings[i].Timestamp = entry.Timestamp
+	}
+	mock.entries = append(mock.entries, entry)
+
+	return entry, nil
+}
+
+func (mock *MockDb) GetPostings(accountId int) ([]Posting, error) {
+	if _, err := mock.GetAccount(accountId); err != nil {
+		return nil, err
+	}
+
+	postings := []Posting{}
+	for _, entry := range mock.entries {
+		for _, posting := range entry.Postings {
+			if posting.AccountID == accountId {
+				postings = append(postings, posting)
+			}
+		}
+	}
+
+	return postings, nil
+}
+
+func (mock *MockDb) VerifyLedger() ([]LedgerDiscrepancy, error) {
+	discrepancies := []LedgerDiscrepancy{}
+
+	posted := map[int]int64{}
+	for _, entry := range mock.entries {
+		sums := map[string]int64{}
+		for _, posting := range entry.Postings {
+			posted[posting.AccountID] += posting.Amount.Amount
+			sums[posting.Amount.Currency] += posting.Amount.Amount
+		}
+
+		currencies := []string{}
+		for currency := range sums {
+			currencies = append(currencies, currency)
+		}
+		sort.Strings(currencies)
+
+		for _, currency := range currencies {
+			if sums[currency] != 0 {
+				entryId := entry.ID
+				discrepancies = append(discrepancies, LedgerDiscrepancy{
+					EntryID:  &entryId,
+					Expected: NewMoney(0, currency),
+					Actual:   NewMoney(sums[currency], currency),
+					Currency: currency,
+					Reason:   "journal entry postings do not balance",
+				})
+			}
+		}
+	}
+
+	for _, account := range mock.accounts {
+		if account.Balance.Amount != posted[account.ID] {
+			accountId := account.ID
+			discrepancies = append(discrepancies, LedgerDiscrepancy{
+				AccountID: &accountId,
+				Expected:  NewMoney(posted[account.ID], account.Balance.Currency),
+				Actual:    account.Balance,
+				Currency:  account.Balance.Currency,
+				Reason:    "account balance differs from the sum of its postings",
+			})
+		}
+	}
+
+	return discrepancies, nil
+}
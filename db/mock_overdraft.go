@@ -0,0 +1,19 @@
+package db
+
+func (mock *MockDb) SetOverdraftLimit(accountId int, limit Money) (Account, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if err := validateOverdraftLimit(account, limit); err != nil {
+		return account, err
+	}
+
+	for i := range mock.accounts {
+		if mock.accounts[i].ID == accountId {
+			mock.accounts[i].OverdraftLimit = limit
+		}
+	}
+
+	return mock.GetAccount(accountId)
+}
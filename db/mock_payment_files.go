@@ -0,0 +1,53 @@
+package db
+
+func (mock *MockDb) CreatePaymentFile(format string, instructions []PaymentInstruction) (PaymentFile, error) {
+	file, err := newPaymentFile(format, instructions, mock.GetAccount)
+	if err != nil {
+		return file, err
+	}
+
+	file.ID = len(mock.paymentFiles)
+	file.CreatedAt = mockTime()
+	mock.paymentFiles = append(mock.paymentFiles, file)
+
+	return file, nil
+}
+
+func (mock *MockDb) GetPaymentFile(fileId int) (PaymentFile, error) {
+	if fileId < 0 || fileId >= len(mock.paymentFiles) {
+		return PaymentFile{}, &PaymentFileNotFoundError{PaymentFileID: fileId}
+	}
+
+	file := mock.paymentFiles[fileId]
+	file.Lines = append([]PaymentLine{}, file.Lines...)
+	return summarize(file), nil
+}
+
+func (mock *MockDb) GetPendingPaymentFiles() ([]int, error) {
+	fileIds := []int{}
+	for _, file := range mock.paymentFiles {
+		if file.Status == PaymentFilePending {
+			fileIds = append(fileIds, file.ID)
+		}
+	}
+	return fileIds, nil
+}
+
+func (mock *MockDb) ProcessPaymentFile(fileId int) (PaymentFile, error) {
+	if _, err := mock.GetPaymentFile(fileId); err != nil {
+		return PaymentFile{}, err
+	}
+
+	file := &mock.paymentFiles[fileId]
+	for i, line := range file.Lines {
+		if line.Status != PaymentLinePending {
+			continue
+		}
+
+		transaction, err := mock.transfer(line.FromAccountID, line.ToAccountID, line.Amount)
+		file.Lines[i] = paymentResult(line, transaction, err)
+	}
+	*file = summarize(*file)
+
+	return mock.GetPaymentFile(fileId)
+}
@@ -0,0 +1,49 @@
+package db
+
+import "fmt"
+
+// checkEmail mirrors the unique index on the emails of users that were not deleted
+func (mock *MockDb) checkEmail(user User) error {
+	if user.Email == "" {
+		return nil
+	}
+	for _, other := range mock.users {
+		if other.ID != user.ID && other.DeletedAt == nil && other.Email == user.Email {
+			return &EmailTakenError{Email: user.Email}
+		}
+	}
+	return nil
+}
+
+func (mock *MockDb) UpdateUser(user User) (User, error) {
+	if _, err := mock.GetUser(fmt.Sprint(user.ID)); err != nil {
+		return user, err
+	}
+
+	user, err := ValidateUser(user)
+	if err != nil {
+		return user, err
+	}
+	if err := mock.checkEmail(user); err != nil {
+		return user, err
+	}
+
+	// like the UPDATE of SQLiteDb, only the profile changes
+	user.Role = mock.users[user.ID].Role
+	user.PasswordHash = mock.users[user.ID].PasswordHash
+	user.DeletedAt = nil
+	mock.users[user.ID] = user
+	return user, nil
+}
+
+func (mock *MockDb) SetUserRole(userId int, role string) (User, error) {
+	if err := ValidateRole(role); err != nil {
+		return User{}, err
+	}
+	if _, err := mock.GetUser(fmt.Sprint(userId)); err != nil {
+		return User{}, err
+	}
+
+	mock.users[userId].Role = role
+	return mock.users[userId], nil
+}
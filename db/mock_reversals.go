@@ -0,0 +1,37 @@
+package db
+
+func (mock *MockDb) ReverseTransaction(transactionId int, amount *Money) (Transaction, error) {
+	original, err := mock.GetTransaction(transactionId)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	reversals := []Transaction{}
+	for _, transaction := range mock.transactions {
+		if transaction.ReversalOf != nil && *transaction.ReversalOf == transactionId && transaction.Succeeded == 1 {
+			reversals = append(reversals, transaction)
+		}
+	}
+
+	fromAmount, toAmount, err := reversalAmounts(original, reversals, amount)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	account, err := mock.GetAccount(original.ToAccountID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	refunded, err := mock.GetAccount(original.FromAccountID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := checkTransfer(account, refunded); err != nil {
+		return Transaction{}, err
+	}
+	if spendFailure(account, toAmount) != "" {
+		return Transaction{}, insufficientFunds(account, toAmount)
+	}
+
+	return mock.insertTransaction(reversalTransaction(original, fromAmount, toAmount), "reversal")
+}
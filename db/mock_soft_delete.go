@@ -0,0 +1,70 @@
+package db
+
+import "fmt"
+
+func (mock *MockDb) DeleteUser(userId int) (User, error) {
+	user, err := mock.GetUser(fmt.Sprint(userId))
+	if err != nil {
+		return user, err
+	}
+
+	accounts, err := mock.GetAccounts(fmt.Sprint(userId))
+	if err != nil {
+		return user, err
+	}
+	if len(accounts) > 0 {
+		return user, &UserHasAccountsError{UserID: userId, Accounts: len(accounts)}
+	}
+
+	deletedAt := mockTime()
+	mock.users[userId].DeletedAt = &deletedAt
+	mock.revokeRefreshTokens(userId, deletedAt)
+	mock.revokeAPIClients(userId, deletedAt)
+	return mock.users[userId], nil
+}
+
+func (mock *MockDb) UpdateAccount(accountId int, product string) (Account, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if account.DeletedAt != nil {
+		return account, &AccountNotFoundError{AccountID: accountId}
+	}
+	if account.Status == AccountClosed {
+		return account, &AccountStatusError{AccountID: accountId, Status: account.Status, Reason: "cannot be changed"}
+	}
+	if _, err := mock.getAccountProduct(product); err != nil {
+		return account, err
+	}
+
+	mock.accounts[accountId].Product = product
+	return mock.GetAccount(accountId)
+}
+
+func (mock *MockDb) DeleteAccount(accountId int) (Account, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if account.DeletedAt != nil || account.UserID == SystemUserID {
+		return account, &AccountNotFoundError{AccountID: accountId}
+	}
+
+	activeHolds := 0
+	for _, hold := range mock.holds {
+		if hold.FromAccountID == accountId && hold.Status == HoldActive {
+			activeHolds += 1
+		}
+	}
+	if err := checkDelete(account, activeHolds); err != nil {
+		return account, err
+	}
+
+	deletedAt := mockTime()
+	mock.accounts[accountId].Status = AccountClosed
+	mock.accounts[accountId].DeletedAt = &deletedAt
+	mock.cancelStandingOrders(accountId)
+
+	return mock.GetAccount(accountId)
+}
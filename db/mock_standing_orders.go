@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+func (mock *MockDb) CreateStandingOrder(order StandingOrder) (StandingOrder, error) {
+	if err := ValidateStandingOrder(order); err != nil {
+		return order, err
+	}
+
+	fromAccount, err := mock.GetAccount(order.FromAccountID)
+	if err != nil {
+		return order, err
+	}
+	if _, err := mock.GetAccount(order.ToAccountID); err != nil {
+		return order, err
+	}
+	if order.Amount.Currency != fromAccount.Balance.Currency {
+		return order, &CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: order.Amount.Currency}
+	}
+
+	order = newStandingOrder(order)
+	order.ID = len(mock.standingOrders)
+	mock.standingOrders = append(mock.standingOrders, order)
+
+	return order, nil
+}
+
+func (mock *MockDb) GetStandingOrder(orderId int) (StandingOrder, error) {
+	for _, order := range mock.standingOrders {
+		if order.ID == orderId {
+			return order, nil
+		}
+	}
+	return StandingOrder{}, &StandingOrderNotFoundError{StandingOrderID: orderId}
+}
+
+func (mock *MockDb) GetStandingOrders(userId string) ([]StandingOrder, error) {
+	orders := []StandingOrder{}
+	for _, order := range mock.standingOrders {
+		user, err := mock.GetUserByAccountId(order.FromAccountID)
+		if err == nil && fmt.Sprint(user.ID) == userId {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (mock *MockDb) UpdateStandingOrder(order StandingOrder) (StandingOrder, error) {
+	existing, err := mock.GetStandingOrder(order.ID)
+	if err != nil {
+		return order, err
+	}
+
+	updated, err := updatedStandingOrder(existing, order)
+	if err != nil {
+		return existing, err
+	}
+
+	mock.standingOrders[updated.ID] = updated
+	return updated, nil
+}
+
+func (mock *MockDb) CancelStandingOrder(orderId int) (StandingOrder, error) {
+	order, err := mock.GetStandingOrder(orderId)
+	if err != nil {
+		return order, err
+	}
+	if order.Status != StandingOrderActive {
+		return order, &InvalidStandingOrderError{Reason: "only active orders can be cancelled"}
+	}
+
+	order.Status = StandingOrderCancelled
+	order.NextRun = nil
+	mock.standingOrders[order.ID] = order
+
+	return order, nil
+}
+
+func (mock *MockDb) GetDueStandingOrders(now time.Time) ([]StandingOrder, error) {
+	orders := []StandingOrder{}
+	for _, order := range mock.standingOrders {
+		if isDue(order, now) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+// RunStandingOrder mirrors SQLiteDb.RunStandingOrder; mock.transfer changes nothing when it fails
+func (mock *MockDb) RunStandingOrder(orderId int, now time.Time) (StandingOrderExecution, error) {
+	var execution StandingOrderExecution
+
+	order, err := mock.GetStandingOrder(orderId)
+	if err != nil {
+		return execution, err
+	}
+	if !isDue(order, now) {
+		return execution, &InvalidStandingOrderError{Reason: fmt.Sprintf("order %d is not due", orderId)}
+	}
+
+	execution.ID = len(mock.executions)
+	execution.StandingOrderID = order.ID
+	execution.ScheduledFor = *order.NextRun
+	execution.ExecutedAt = now.UTC()
+
+	transaction, err := mock.transfer(order.FromAccountID, order.ToAccountID, order.Amount)
+	if err != nil {
+		execution.Error = err.Error()
+	} else {
+		execution.TransactionID = &transaction.ID
+		execution.Succeeded = transaction.Succeeded
+		execution.Error = transaction.FailureReason
+	}
+	mock.executions = append(mock.executions, execution)
+
+	order.Executions += 1
+	mock.standingOrders[order.ID] = scheduleNextRun(order)
+
+	return execution, nil
+}
+
+func (mock *MockDb) GetStandingOrderExecutions(orderId int) ([]StandingOrderExecution, error) {
+	if _, err := mock.GetStandingOrder(orderId); err != nil {
+		return nil, err
+	}
+
+	executions := []StandingOrderExecution{}
+	for _, execution := range mock.executions {
+		if execution.StandingOrderID == orderId {
+			executions = append(executions, execution)
+		}
+	}
+	return executions, nil
+}
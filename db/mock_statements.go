@@ -0,0 +1,17 @@
+package db
+
+import "time"
+
+func (mock *MockDb) GetStatement(accountId int, from time.Time, to time.Time) (Statement, error) {
+	account, err := mock.GetAccount(accountId)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	transactions, err := mock.GetAccountTransactions(accountId)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	return newStatement(account, transactions, from, to)
+}
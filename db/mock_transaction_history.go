@@ -0,0 +1,46 @@
+package db
+
+import "sort"
+
+func (mock *MockDb) GetTransactionPage(userId string, incoming bool, filter TransactionFilter) (TransactionPage, error) {
+	filter, err := ValidateTransactionFilter(filter)
+	if err != nil {
+		return TransactionPage{Transactions: []Transaction{}}, err
+	}
+
+	transactions, err := mock.GetTransactions(userId, incoming)
+	if err != nil {
+		return TransactionPage{Transactions: []Transaction{}}, err
+	}
+
+	var last *Transaction
+	if filter.Cursor != "" {
+		lastId, _ := decodeCursor(filter.Cursor, filter.Sort)
+		if transaction, err := mock.GetTransaction(lastId); err == nil {
+			last = &transaction
+		}
+	}
+
+	matching := []Transaction{}
+	for _, transaction := range transactions {
+		ok, err := matchesFilter(transaction, incoming, filter)
+		if err != nil {
+			return TransactionPage{Transactions: []Transaction{}}, err
+		}
+		if filter.Cursor != "" && (last == nil || !transactionBefore(*last, transaction, incoming, filter.Sort)) {
+			ok = false
+		}
+		if ok {
+			matching = append(matching, transaction)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return transactionBefore(matching[i], matching[j], incoming, filter.Sort)
+	})
+	if len(matching) > filter.Limit+1 {
+		matching = matching[:filter.Limit+1]
+	}
+
+	return paginate(matching, filter), nil
+}
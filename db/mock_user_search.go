@@ -0,0 +1,43 @@
+package db
+
+import "strings"
+
+func (mock *MockDb) SearchUsers(filter UserFilter) (UserPage, error) {
+	filter, err := ValidateUserFilter(filter)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	lastId := -1
+	if filter.Cursor != "" {
+		lastId, _ = decodeCursor(filter.Cursor, userCursorSort)
+	}
+
+	users := []User{}
+	for _, user := range mock.users {
+		if user.DeletedAt != nil || user.ID <= lastId {
+			continue
+		}
+		if filter.Name != "" && !strings.HasPrefix(strings.ToLower(user.Name), strings.ToLower(filter.Name)) {
+			continue
+		}
+		if filter.Email != "" && user.Email != filter.Email {
+			continue
+		}
+		if filter.AccountID != nil && !mock.ownsAccount(user.ID, *filter.AccountID) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	return paginateUsers(users, filter), nil
+}
+
+func (mock *MockDb) ownsAccount(userId int, accountId int) bool {
+	for _, account := range mock.accounts {
+		if account.ID == accountId && account.UserID == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -1,25 +1,415 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// DeletedAt is set once a user or account is deleted; deleted rows are kept for the transaction history.
+// Only the name of a user is required, the other profile fields are left out when they are not set.
 type User struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Role        string     `json:"role"`
+	Email       string     `json:"email,omitempty"`
+	Phone       string     `json:"phone,omitempty"`
+	DateOfBirth string     `json:"date_of_birth,omitempty"`
+	Address     *Address   `json:"address,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	// PasswordHash is only set when a user is created; users without one cannot log in
+	PasswordHash string `json:"-"`
 }
 
+// Address is the postal address of a user; Country is an ISO 3166-1 alpha-2 code
+type Address struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"`
+}
+
+// Balance is the ledger balance of the account; AvailableBalance leaves out the money reserved by active holds.
+// Both may go below zero, down to -OverdraftLimit.
 type Account struct {
-	ID      int     `json:"id"`
-	UserID  int     `json:"user_id"`
-	Balance float64 `json:"balance"`
+	ID               int        `json:"id"`
+	UserID           int        `json:"user_id"`
+	Balance          Money      `json:"balance"`
+	AvailableBalance Money      `json:"available_balance"`
+	OverdraftLimit   Money      `json:"overdraft_limit"`
+	Product          string     `json:"product"`
+	Status           string     `json:"status"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+// MarshalJSON writes the currency of the account next to its amounts, which carry it themselves
+func (account Account) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID               int        `json:"id"`
+		UserID           int        `json:"user_id"`
+		Balance          Money      `json:"balance"`
+		AvailableBalance Money      `json:"available_balance"`
+		OverdraftLimit   Money      `json:"overdraft_limit"`
+		Currency         string     `json:"currency"`
+		Product          string     `json:"product"`
+		Status           string     `json:"status"`
+		DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	}{account.ID, account.UserID, account.Balance, account.AvailableBalance, account.OverdraftLimit, account.Balance.Currency,
+		account.Product, account.Status, account.DeletedAt})
 }
 
 type Transaction struct {
 	ID            int       `json:"id"`
 	FromAccountID int       `json:"from_account_id"`
 	ToAccountID   int       `json:"to_account_id"`
-	Amount        float64   `json:"amount"`
+	Amount        Money     `json:"amount"`
+	ToAmount      Money     `json:"to_amount"`
+	ExchangeRate  string    `json:"exchange_rate"`
 	Timestamp     time.Time `json:"timestamp"`
 	Succeeded     int       `json:"succeeded"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	ReversalOf    *int      `json:"reversal_of,omitempty"`
+	BatchID       *int      `json:"batch_id,omitempty"`
+}
+
+// transactionJSON is how a transaction is written, with the currencies of its amounts next to them
+type transactionJSON struct {
+	ID            int       `json:"id"`
+	FromAccountID int       `json:"from_account_id"`
+	ToAccountID   int       `json:"to_account_id"`
+	Amount        Money     `json:"amount"`
+	Currency      string    `json:"currency"`
+	ToAmount      Money     `json:"to_amount"`
+	ToCurrency    string    `json:"to_currency"`
+	ExchangeRate  string    `json:"exchange_rate"`
+	Timestamp     time.Time `json:"timestamp"`
+	Succeeded     int       `json:"succeeded"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	ReversalOf    *int      `json:"reversal_of,omitempty"`
+	BatchID       *int      `json:"batch_id,omitempty"`
+}
+
+func (transaction Transaction) toJSON() transactionJSON {
+	return transactionJSON{transaction.ID, transaction.FromAccountID, transaction.ToAccountID, transaction.Amount, transaction.Amount.Currency,
+		transaction.ToAmount, transaction.ToAmount.Currency, transaction.ExchangeRate, transaction.Timestamp, transaction.Succeeded,
+		transaction.FailureReason, transaction.ReversalOf, transaction.BatchID}
+}
+
+func (transaction Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(transaction.toJSON())
+}
+
+// AccountTransaction is a transaction seen from one of its accounts, with the balance of that account after it
+type AccountTransaction struct {
+	Transaction
+	Direction      string `json:"direction"`
+	RunningBalance Money  `json:"running_balance"`
+}
+
+// MarshalJSON is needed as the one of the embedded Transaction would leave out the direction and the running balance
+func (transaction AccountTransaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		transactionJSON
+		Direction      string `json:"direction"`
+		RunningBalance Money  `json:"running_balance"`
+	}{transaction.Transaction.toJSON(), transaction.Direction, transaction.RunningBalance})
+}
+
+// Statement lists the booked transactions of an account in a period, from (inclusive) to (exclusive)
+type Statement struct {
+	AccountID      int                  `json:"account_id"`
+	Currency       string               `json:"currency"`
+	Product        string               `json:"product"`
+	From           time.Time            `json:"from"`
+	To             time.Time            `json:"to"`
+	OpeningBalance Money                `json:"opening_balance"`
+	ClosingBalance Money                `json:"closing_balance"`
+	Transactions   []AccountTransaction `json:"transactions"`
+}
+
+type ExchangeRate struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Rate      string    `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JournalEntry groups postings that move money between accounts; the postings of an entry sum to zero in every currency
+type JournalEntry struct {
+	ID            int       `json:"id"`
+	TransactionID *int      `json:"transaction_id"`
+	Description   string    `json:"description"`
+	Timestamp     time.Time `json:"timestamp"`
+	Postings      []Posting `json:"postings"`
+}
+
+// Posting is one side of a journal entry; a positive amount credits the account, a negative amount debits it
+type Posting struct {
+	ID          int       `json:"id"`
+	EntryID     int       `json:"entry_id"`
+	AccountID   int       `json:"account_id"`
+	Amount      Money     `json:"amount"`
+	Description string    `json:"description"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (posting Posting) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID          int       `json:"id"`
+		EntryID     int       `json:"entry_id"`
+		AccountID   int       `json:"account_id"`
+		Amount      Money     `json:"amount"`
+		Currency    string    `json:"currency"`
+		Description string    `json:"description"`
+		Timestamp   time.Time `json:"timestamp"`
+	}{posting.ID, posting.EntryID, posting.AccountID, posting.Amount, posting.Amount.Currency, posting.Description, posting.Timestamp})
+}
+
+// LedgerDiscrepancy is reported when an account balance differs from the sum of its postings,
+// or when the postings of an entry do not balance
+type LedgerDiscrepancy struct {
+	AccountID *int   `json:"account_id,omitempty"`
+	EntryID   *int   `json:"entry_id,omitempty"`
+	Expected  Money  `json:"expected"`
+	Actual    Money  `json:"actual"`
+	Currency  string `json:"currency"`
+	Reason    string `json:"reason"`
+}
+
+// Credentials are what a user logs in with; the password is only stored as a hash
+type Credentials struct {
+	UserID       int
+	Email        string
+	PasswordHash string
+}
+
+// RefreshToken is stored by the hash of the token, which only the client knows; a token that was used
+// is revoked and points to the token that replaced it
+type RefreshToken struct {
+	ID         int
+	UserID     int
+	TokenHash  string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *int
+}
+
+// APIClient is a service that calls the API for the user who registered it, limited to its scopes. Its API
+// key is also its client secret for the client credentials grant, and is only stored as a hash; the
+// secret it signs requests with is needed to check the signatures, so it is stored as is
+type APIClient struct {
+	ID            int        `json:"id"`
+	ClientID      string     `json:"client_id"`
+	UserID        int        `json:"user_id"`
+	Name          string     `json:"name"`
+	Scopes        []string   `json:"scopes"`
+	KeyHash       string     `json:"-"`
+	SigningSecret string     `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AuditEvent records a request that changed something, or tried to. Targets name what it changed, such as
+// "account:1"; Before and After are the JSON of the first target before and after the request, and are left
+// out when it did not exist. The actor is missing for requests that need no access token, such as sign-ups
+type AuditEvent struct {
+	ID            int             `json:"id"`
+	Timestamp     time.Time       `json:"timestamp"`
+	ActorUserID   *int            `json:"actor_user_id"`
+	ActorClientID string          `json:"actor_client_id,omitempty"`
+	Route         string          `json:"route"`
+	RequestID     string          `json:"request_id"`
+	SourceIP      string          `json:"source_ip"`
+	Targets       []string        `json:"targets"`
+	Before        json.RawMessage `json:"before,omitempty"`
+	After         json.RawMessage `json:"after,omitempty"`
+	Outcome       string          `json:"outcome"`
+	StatusCode    int             `json:"status_code"`
+	ErrorCode     string          `json:"error_code,omitempty"`
+}
+
+// IdempotencyKey is the value of an Idempotency-Key header, scoped to who sent it and where, so the
+// same key used by another principal or on another route is a different key
+type IdempotencyKey struct {
+	Principal string
+	Route     string
+	Key       string
+}
+
+// IdempotencyRecord stores the outcome of a request made with an Idempotency-Key header
+type IdempotencyRecord struct {
+	Key         IdempotencyKey
+	Fingerprint string
+	// StatusCode is 0 while the original request is still being processed
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// StandingOrder is a transfer that repeats on a schedule, starting at StartDate, until EndDate
+// or until it ran MaxExecutions times
+type StandingOrder struct {
+	ID            int        `json:"id"`
+	FromAccountID int        `json:"from_account_id"`
+	ToAccountID   int        `json:"to_account_id"`
+	Amount        Money      `json:"amount"`
+	Frequency     string     `json:"frequency"`
+	StartDate     time.Time  `json:"start_date"`
+	EndDate       *time.Time `json:"end_date"`
+	MaxExecutions *int       `json:"max_executions"`
+	Executions    int        `json:"executions"`
+	NextRun       *time.Time `json:"next_run"`
+	Status        string     `json:"status"`
+}
+
+func (order StandingOrder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID            int        `json:"id"`
+		FromAccountID int        `json:"from_account_id"`
+		ToAccountID   int        `json:"to_account_id"`
+		Amount        Money      `json:"amount"`
+		Currency      string     `json:"currency"`
+		Frequency     string     `json:"frequency"`
+		StartDate     time.Time  `json:"start_date"`
+		EndDate       *time.Time `json:"end_date"`
+		MaxExecutions *int       `json:"max_executions"`
+		Executions    int        `json:"executions"`
+		NextRun       *time.Time `json:"next_run"`
+		Status        string     `json:"status"`
+	}{order.ID, order.FromAccountID, order.ToAccountID, order.Amount, order.Amount.Currency, order.Frequency, order.StartDate,
+		order.EndDate, order.MaxExecutions, order.Executions, order.NextRun, order.Status})
+}
+
+type StandingOrderExecution struct {
+	ID              int       `json:"id"`
+	StandingOrderID int       `json:"standing_order_id"`
+	ScheduledFor    time.Time `json:"scheduled_for"`
+	ExecutedAt      time.Time `json:"executed_at"`
+	TransactionID   *int      `json:"transaction_id"`
+	Succeeded       int       `json:"succeeded"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// TransferLeg is one transfer of a batch transfer
+type TransferLeg struct {
+	FromAccountID int
+	ToAccountID   int
+	Amount        Money
+}
+
+// BatchTransfer is a list of transfers that were executed together, all or none of them
+type BatchTransfer struct {
+	ID           int           `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// PaymentInstruction is one payment of an uploaded payment file, as read from the file; Error is set
+// when the line could not be read
+type PaymentInstruction struct {
+	Line          int
+	Reference     string
+	FromAccountID int
+	ToAccountID   int
+	Amount        string
+	Currency      string
+	Error         string
+}
+
+// PaymentLine is a validated payment of a payment file and the result of executing it
+type PaymentLine struct {
+	Line          int    `json:"line"`
+	Reference     string `json:"reference,omitempty"`
+	FromAccountID int    `json:"from_account_id"`
+	ToAccountID   int    `json:"to_account_id"`
+	Amount        Money  `json:"amount"`
+	Status        string `json:"status"`
+	TransactionID *int   `json:"transaction_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+func (line PaymentLine) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Line          int    `json:"line"`
+		Reference     string `json:"reference,omitempty"`
+		FromAccountID int    `json:"from_account_id"`
+		ToAccountID   int    `json:"to_account_id"`
+		Amount        Money  `json:"amount"`
+		Currency      string `json:"currency"`
+		Status        string `json:"status"`
+		TransactionID *int   `json:"transaction_id,omitempty"`
+		Error         string `json:"error,omitempty"`
+	}{line.Line, line.Reference, line.FromAccountID, line.ToAccountID, line.Amount, line.Amount.Currency, line.Status, line.TransactionID, line.Error})
+}
+
+// PaymentFile is a batch of payments uploaded at once, which are executed one by one
+type PaymentFile struct {
+	ID        int           `json:"id"`
+	Format    string        `json:"format"`
+	Status    string        `json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	Pending   int           `json:"pending"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Lines     []PaymentLine `json:"lines"`
+}
+
+// Hold reserves money of FromAccountID for a later transfer to ToAccountID, until it is captured,
+// voided or expires
+type Hold struct {
+	ID             int       `json:"id"`
+	FromAccountID  int       `json:"from_account_id"`
+	ToAccountID    int       `json:"to_account_id"`
+	Amount         Money     `json:"amount"`
+	Status         string    `json:"status"`
+	CapturedAmount *Money    `json:"captured_amount"`
+	TransactionID  *int      `json:"transaction_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func (hold Hold) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID             int       `json:"id"`
+		FromAccountID  int       `json:"from_account_id"`
+		ToAccountID    int       `json:"to_account_id"`
+		Amount         Money     `json:"amount"`
+		Currency       string    `json:"currency"`
+		Status         string    `json:"status"`
+		CapturedAmount *Money    `json:"captured_amount"`
+		TransactionID  *int      `json:"transaction_id"`
+		CreatedAt      time.Time `json:"created_at"`
+		ExpiresAt      time.Time `json:"expires_at"`
+	}{hold.ID, hold.FromAccountID, hold.ToAccountID, hold.Amount, hold.Amount.Currency, hold.Status, hold.CapturedAmount,
+		hold.TransactionID, hold.CreatedAt, hold.ExpiresAt})
+}
+
+// AccountProduct is a kind of account, e.g. checking or savings; InterestRate is a yearly rate, e.g. "0.02"
+type AccountProduct struct {
+	Name         string `json:"name"`
+	InterestRate string `json:"interest_rate"`
+}
+
+// InterestAccrual is the interest earned by an account on one day, in major units of its currency.
+// Accruals are paid out together at the start of the next month, by TransactionID.
+type InterestAccrual struct {
+	ID            int    `json:"id"`
+	AccountID     int    `json:"account_id"`
+	Date          string `json:"date"`
+	Balance       Money  `json:"balance"`
+	InterestRate  string `json:"interest_rate"`
+	Amount        string `json:"amount"`
+	TransactionID *int   `json:"transaction_id"`
+}
+
+// AccruedInterest is the interest an account earned that was not paid out yet
+type AccruedInterest struct {
+	AccountID    int               `json:"account_id"`
+	Product      string            `json:"product"`
+	InterestRate string            `json:"interest_rate"`
+	Currency     string            `json:"currency"`
+	Amount       string            `json:"accrued_interest"`
+	Accruals     []InterestAccrual `json:"accruals"`
 }
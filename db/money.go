@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for accounts and amounts that do not name a currency
+const DefaultCurrency = "EUR"
+
+// number of decimal places of the minor unit of each supported ISO 4217 currency
+var currencyExponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"CZK": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HUF": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MDL": 2,
+	"NOK": 2,
+	"PLN": 2,
+	"RON": 2,
+	"SEK": 2,
+	"TND": 3,
+	"UAH": 2,
+	"USD": 2,
+}
+
+type UnknownCurrencyError struct {
+	Currency string
+}
+
+func (err *UnknownCurrencyError) Error() string {
+	return fmt.Sprintf("unknown currency %q", err.Currency)
+}
+
+type InvalidAmountError struct {
+	Amount string
+	Reason string
+}
+
+func (err *InvalidAmountError) Error() string {
+	return fmt.Sprintf("invalid amount %s: %s", err.Amount, err.Reason)
+}
+
+// Money is an exact amount, stored as an integer number of minor units (e.g. cents) of its currency
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func CurrencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, &UnknownCurrencyError{Currency: currency}
+	}
+	return exponent, nil
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney reads a plain decimal string such as "-12.30" into minor units of currency,
+// rejecting values with more decimal places than the currency allows
+func ParseMoney(value string, currency string) (Money, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	digits := strings.TrimPrefix(value, "-")
+	negative := len(digits) != len(value)
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if whole == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, &InvalidAmountError{Amount: value, Reason: "not a decimal number"}
+	}
+
+	// trailing zeros do not add precision
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, &InvalidAmountError{Amount: value, Reason: fmt.Sprintf("%s allows at most %d decimal places", currency, exponent)}
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, &InvalidAmountError{Amount: value, Reason: "out of range"}
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MoneyFromFloat converts a legacy floating point amount, failing if it does not
+// round to a whole number of minor units (drift from float arithmetic is tolerated)
+func MoneyFromFloat(value float64, currency string) (Money, error) {
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	scaled := value * math.Pow10(exponent)
+	rounded := math.Round(scaled)
+	if math.Abs(scaled-rounded) > 1e-6 || math.Abs(rounded) >= math.MaxInt64 {
+		formatted := strconv.FormatFloat(value, 'f', -1, 64)
+		return Money{}, &InvalidAmountError{Amount: formatted, Reason: fmt.Sprintf("cannot be represented in %s minor units", currency)}
+	}
+
+	return Money{Amount: int64(rounded), Currency: currency}, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Decimal formats the amount with exactly as many decimal places as the currency has, e.g. "12.30"
+func (m Money) Decimal() string {
+	exponent, err := CurrencyExponent(m.Currency)
+	if err != nil {
+		exponent = 0
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// MarshalJSON writes the amount as an exact JSON number in major units, e.g. 12.3
+func (m Money) MarshalJSON() ([]byte, error) {
+	decimal := m.Decimal()
+	if strings.Contains(decimal, ".") {
+		decimal = strings.TrimRight(strings.TrimRight(decimal, "0"), ".")
+	}
+	return []byte(decimal), nil
+}
+
+func isDigits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
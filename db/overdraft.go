@@ -0,0 +1,58 @@
+package db
+
+// reasons why a transfer did not succeed, stored on the failed transaction
+const (
+	FailureInsufficientFunds      = "insufficient_funds"
+	FailureOverdraftLimitExceeded = "overdraft_limit_exceeded"
+)
+
+// spendFailure returns why account cannot spend amount, or an empty string when it can.
+// The available balance may go below zero down to the overdraft limit of the account.
+func spendFailure(account Account, amount Money) string {
+	if account.AvailableBalance.Amount-amount.Amount >= -account.OverdraftLimit.Amount {
+		return ""
+	}
+	if account.OverdraftLimit.IsZero() {
+		return FailureInsufficientFunds
+	}
+	return FailureOverdraftLimitExceeded
+}
+
+// insufficientFunds reports how much account can spend, including its overdraft
+func insufficientFunds(account Account, amount Money) error {
+	spendable := NewMoney(account.AvailableBalance.Amount+account.OverdraftLimit.Amount, account.Balance.Currency)
+	return &InsufficientFundsError{AccountID: account.ID, Balance: spendable, Amount: amount}
+}
+
+// validateOverdraftLimit checks that limit is a non-negative amount in the currency of account
+func validateOverdraftLimit(account Account, limit Money) error {
+	if limit.Currency != account.Balance.Currency {
+		return &CurrencyMismatchError{Expected: account.Balance.Currency, Actual: limit.Currency}
+	}
+	if limit.IsNegative() {
+		return &InvalidAmountError{Amount: limit.Decimal(), Reason: "must not be negative"}
+	}
+	return nil
+}
+
+// SetOverdraftLimit changes how far below zero the account may go. Lowering the limit below
+// what the account already owes is allowed; the account then cannot spend until it is paid back.
+func (sqlite *SQLiteDb) SetOverdraftLimit(accountId int, limit Money) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if err := validateOverdraftLimit(account, limit); err != nil {
+		return account, err
+	}
+
+	if _, err := sqlite.client.Exec("UPDATE accounts SET overdraft_limit = ? WHERE id = ?", limit.Amount, accountId); err != nil {
+		return account, err
+	}
+
+	return sqlite.GetAccount(accountId)
+}
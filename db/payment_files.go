@@ -0,0 +1,358 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	PaymentFileFormatPain001 = "pain.001"
+	PaymentFileFormatCSV     = "csv"
+)
+
+const (
+	PaymentFilePending   = "pending"
+	PaymentFileCompleted = "completed"
+	PaymentFileRejected  = "rejected"
+)
+
+// a line is rejected when it is invalid, and failed when its transfer was attempted but did not go through
+const (
+	PaymentLinePending   = "pending"
+	PaymentLineSucceeded = "succeeded"
+	PaymentLineFailed    = "failed"
+	PaymentLineRejected  = "rejected"
+)
+
+// MaxPaymentLines is the most payments one file may hold
+const MaxPaymentLines = 10000
+
+type PaymentFileNotFoundError struct {
+	PaymentFileID int
+}
+
+func (err *PaymentFileNotFoundError) Error() string {
+	return fmt.Sprintf("payment file %d does not exist", err.PaymentFileID)
+}
+
+// InvalidPaymentFileError rejects a whole payment file; Report lists the error of every rejected line
+type InvalidPaymentFileError struct {
+	Reason string
+	Report PaymentFile
+}
+
+func (err *InvalidPaymentFileError) Error() string {
+	return "invalid payment file: " + err.Reason
+}
+
+// newPaymentLine validates an instruction against its accounts; lines that could not be executed are rejected
+func newPaymentLine(instruction PaymentInstruction, getAccount func(accountId int) (Account, error)) PaymentLine {
+	line := PaymentLine{
+		Line:          instruction.Line,
+		Reference:     instruction.Reference,
+		FromAccountID: instruction.FromAccountID,
+		ToAccountID:   instruction.ToAccountID,
+		Amount:        Money{Currency: instruction.Currency},
+		Status:        PaymentLinePending,
+	}
+	reject := func(reason string) PaymentLine {
+		line.Status = PaymentLineRejected
+		line.Error = reason
+		return line
+	}
+
+	if instruction.Error != "" {
+		return reject(instruction.Error)
+	}
+	if instruction.FromAccountID == instruction.ToAccountID {
+		return reject("cannot transfer to the same account")
+	}
+
+	fromAccount, err := getAccount(instruction.FromAccountID)
+	if err != nil {
+		return reject(err.Error())
+	}
+	toAccount, err := getAccount(instruction.ToAccountID)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if err := checkTransfer(fromAccount, toAccount); err != nil {
+		return reject(err.Error())
+	}
+
+	if line.Amount.Currency == "" {
+		line.Amount.Currency = fromAccount.Balance.Currency
+	}
+	if line.Amount.Currency != fromAccount.Balance.Currency {
+		return reject((&CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: line.Amount.Currency}).Error())
+	}
+	amount, err := ParseMoney(instruction.Amount, line.Amount.Currency)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if !amount.IsPositive() {
+		return reject((&InvalidAmountError{Amount: amount.Decimal(), Reason: "must be positive"}).Error())
+	}
+	line.Amount = amount
+
+	return line
+}
+
+// newPaymentFile validates every instruction up front; a file with a rejected line is rejected as a whole
+func newPaymentFile(format string, instructions []PaymentInstruction, getAccount func(accountId int) (Account, error)) (PaymentFile, error) {
+	file := PaymentFile{Format: format, Status: PaymentFilePending, Lines: []PaymentLine{}}
+	if len(instructions) == 0 {
+		return file, &InvalidPaymentFileError{Reason: "the file holds no payments"}
+	}
+	if len(instructions) > MaxPaymentLines {
+		return file, &InvalidPaymentFileError{Reason: fmt.Sprintf("the file holds more than %d payments", MaxPaymentLines)}
+	}
+
+	rejected := 0
+	for _, instruction := range instructions {
+		line := newPaymentLine(instruction, getAccount)
+		if line.Status == PaymentLineRejected {
+			rejected += 1
+		}
+		file.Lines = append(file.Lines, line)
+	}
+
+	if rejected > 0 {
+		file.Status = PaymentFileRejected
+		return file, &InvalidPaymentFileError{Reason: fmt.Sprintf("%d of %d lines are invalid", rejected, len(instructions)), Report: summarize(file)}
+	}
+	return summarize(file), nil
+}
+
+// summarize counts the lines of a file by status, and completes the file when no line is pending anymore
+func summarize(file PaymentFile) PaymentFile {
+	file.Pending, file.Succeeded, file.Failed = 0, 0, 0
+	for _, line := range file.Lines {
+		switch line.Status {
+		case PaymentLinePending:
+			file.Pending += 1
+		case PaymentLineSucceeded:
+			file.Succeeded += 1
+		case PaymentLineFailed, PaymentLineRejected:
+			file.Failed += 1
+		}
+	}
+	if file.Status == PaymentFilePending && file.Pending == 0 {
+		file.Status = PaymentFileCompleted
+	}
+	return file
+}
+
+// paymentResult records the outcome of the transfer of a line, which failed if it returned an error
+// or created a failed transaction
+func paymentResult(line PaymentLine, transaction Transaction, err error) PaymentLine {
+	if err != nil {
+		line.Status = PaymentLineFailed
+		line.Error = err.Error()
+		return line
+	}
+
+	line.TransactionID = &transaction.ID
+	line.Status = PaymentLineSucceeded
+	if transaction.Succeeded != 1 {
+		line.Status = PaymentLineFailed
+		line.Error = transaction.FailureReason
+	}
+	return line
+}
+
+const paymentLineColumns = "line, reference, from_account_id, to_account_id, amount, currency, status, transaction_id, error"
+
+func scanPaymentLine(row rowScanner) (PaymentLine, error) {
+	var line PaymentLine
+	var transactionId sql.NullInt64
+	err := row.Scan(&line.Line, &line.Reference, &line.FromAccountID, &line.ToAccountID, &line.Amount.Amount, &line.Amount.Currency,
+		&line.Status, &transactionId, &line.Error)
+	if err != nil {
+		return line, err
+	}
+
+	if transactionId.Valid {
+		id := int(transactionId.Int64)
+		line.TransactionID = &id
+	}
+	return line, nil
+}
+
+// CreatePaymentFile validates and stores a payment file; its payments are executed by ProcessPaymentFile
+func (sqlite *SQLiteDb) CreatePaymentFile(format string, instructions []PaymentInstruction) (PaymentFile, error) {
+	if err := sqlite.init(); err != nil {
+		return PaymentFile{}, err
+	}
+
+	file, err := newPaymentFile(format, instructions, sqlite.GetAccount)
+	if err != nil {
+		return file, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return file, err
+	}
+
+	file, err = sqlite.insertPaymentFile(tx, file)
+	if err != nil {
+		_ = tx.Rollback()
+		return file, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return file, err
+	}
+
+	return file, nil
+}
+
+func (sqlite *SQLiteDb) insertPaymentFile(tx *sql.Tx, file PaymentFile) (PaymentFile, error) {
+	file.CreatedAt = time.Now().UTC()
+	result, err := tx.Exec("INSERT INTO payment_files (format, status, created_at) VALUES (?, ?, ?)", file.Format, file.Status, file.CreatedAt)
+	if err != nil {
+		return file, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return file, err
+	}
+	file.ID = int(id)
+
+	for _, line := range file.Lines {
+		_, err := tx.Exec("INSERT INTO payment_lines (payment_file_id, line, reference, from_account_id, to_account_id, amount, currency, status, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			file.ID, line.Line, line.Reference, line.FromAccountID, line.ToAccountID, line.Amount.Amount, line.Amount.Currency, line.Status, line.Error)
+		if err != nil {
+			return file, err
+		}
+	}
+
+	return file, nil
+}
+
+func (sqlite *SQLiteDb) GetPaymentFile(fileId int) (PaymentFile, error) {
+	if err := sqlite.init(); err != nil {
+		return PaymentFile{}, err
+	}
+
+	var file PaymentFile
+	err := sqlite.client.QueryRow("SELECT id, format, status, created_at FROM payment_files WHERE id = ?", fileId).Scan(&file.ID, &file.Format, &file.Status, &file.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return file, &PaymentFileNotFoundError{PaymentFileID: fileId}
+		}
+		return file, err
+	}
+
+	rows, err := sqlite.client.Query("SELECT "+paymentLineColumns+" FROM payment_lines WHERE payment_file_id = ? ORDER BY line", fileId)
+	if err != nil {
+		return file, err
+	}
+	defer rows.Close()
+
+	file.Lines = []PaymentLine{}
+	for rows.Next() {
+		line, err := scanPaymentLine(rows)
+		if err != nil {
+			return file, err
+		}
+		file.Lines = append(file.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return file, err
+	}
+
+	return summarize(file), nil
+}
+
+// GetPendingPaymentFiles returns the ids of the payment files that still have payments to execute
+func (sqlite *SQLiteDb) GetPendingPaymentFiles() ([]int, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	rows, err := sqlite.client.Query("SELECT id FROM payment_files WHERE status = ? ORDER BY id", PaymentFilePending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fileIds := []int{}
+	for rows.Next() {
+		var fileId int
+		if err := rows.Scan(&fileId); err != nil {
+			return nil, err
+		}
+		fileIds = append(fileIds, fileId)
+	}
+	return fileIds, rows.Err()
+}
+
+// ProcessPaymentFile executes the pending payments of a file in order, each in its own database transaction,
+// so that an interrupted file continues where it stopped. Payments are not blocked by the failed transactions limit.
+func (sqlite *SQLiteDb) ProcessPaymentFile(fileId int) (PaymentFile, error) {
+	file, err := sqlite.GetPaymentFile(fileId)
+	if err != nil {
+		return file, err
+	}
+
+	for _, line := range file.Lines {
+		if line.Status != PaymentLinePending {
+			continue
+		}
+
+		tx, err := sqlite.client.Begin()
+		if err != nil {
+			return file, err
+		}
+
+		if err := sqlite.runPaymentLine(tx, fileId, line); err != nil {
+			_ = tx.Rollback()
+			return file, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return file, err
+		}
+	}
+
+	if _, err := sqlite.client.Exec("UPDATE payment_files SET status = ? WHERE id = ? AND NOT EXISTS (SELECT 1 FROM payment_lines WHERE payment_file_id = ? AND status = ?)",
+		PaymentFileCompleted, fileId, fileId, PaymentLinePending); err != nil {
+		return file, err
+	}
+
+	return sqlite.GetPaymentFile(fileId)
+}
+
+func (sqlite *SQLiteDb) runPaymentLine(tx *sql.Tx, fileId int, line PaymentLine) error {
+	// claiming the line first makes a concurrent run of the same file skip it instead of paying it twice
+	result, err := tx.Exec("UPDATE payment_lines SET status = 'processing' WHERE payment_file_id = ? AND line = ? AND status = ?", fileId, line.Line, PaymentLinePending)
+	if err != nil {
+		return err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	// a failed transfer is undone up to the savepoint, and only the failure is kept
+	if _, err := tx.Exec("SAVEPOINT payment_transfer"); err != nil {
+		return err
+	}
+	transaction, err := sqlite.transfer(tx, line.FromAccountID, line.ToAccountID, line.Amount)
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO payment_transfer"); rollbackErr != nil {
+			return rollbackErr
+		}
+	}
+	if _, err := tx.Exec("RELEASE payment_transfer"); err != nil {
+		return err
+	}
+
+	line = paymentResult(line, transaction, err)
+	_, err = tx.Exec("UPDATE payment_lines SET status = ?, transaction_id = ?, error = ? WHERE payment_file_id = ? AND line = ?",
+		line.Status, line.TransactionID, line.Error, fileId, line.Line)
+	return err
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// MaxNameLength is the most characters the name of a user may have
+const MaxNameLength = 100
+
+var (
+	phonePattern      = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	countryPattern    = regexp.MustCompile(`^[A-Z]{2}$`)
+	postalCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+)
+
+// InvalidUserError names the profile field that did not pass validation
+type InvalidUserError struct {
+	Field  string
+	Reason string
+}
+
+func (err *InvalidUserError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Reason)
+}
+
+type EmailTakenError struct {
+	Email string
+}
+
+func (err *EmailTakenError) Error() string {
+	return fmt.Sprintf("email %s is already used by another user", err.Email)
+}
+
+// collapseSpaces trims text and replaces every run of whitespace in it by one space
+func collapseSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// normalizeEmail lower-cases an email address, which has to be a plain address without a display name
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return email, &InvalidUserError{Field: "email", Reason: fmt.Sprintf("%q is not an email address", email)}
+	}
+	if len(email) > 254 || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return email, &InvalidUserError{Field: "email", Reason: fmt.Sprintf("%q is not an email address", email)}
+	}
+	return email, nil
+}
+
+// normalizePhone writes a phone number in E.164 format: separators are dropped and an international
+// prefix of 00 becomes +, e.g. "0049 (30) 123-456" becomes "+4930123456"
+func normalizePhone(phone string) (string, error) {
+	phone = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -().\t", r) {
+			return -1
+		}
+		return r
+	}, phone)
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !phonePattern.MatchString(phone) {
+		return phone, &InvalidUserError{Field: "phone", Reason: "must be an international number with country code, e.g. +4930123456"}
+	}
+	return phone, nil
+}
+
+func validateDateOfBirth(date string, now time.Time) (string, error) {
+	date = strings.TrimSpace(date)
+	birth, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return date, &InvalidUserError{Field: "date_of_birth", Reason: "must be a date like 1990-12-31"}
+	}
+	if birth.After(now) {
+		return date, &InvalidUserError{Field: "date_of_birth", Reason: "must not be in the future"}
+	}
+	if birth.Before(now.AddDate(-150, 0, 0)) {
+		return date, &InvalidUserError{Field: "date_of_birth", Reason: "must be in the last 150 years"}
+	}
+	return date, nil
+}
+
+// normalizeAddress requires the first line, the city and the ISO 3166-1 alpha-2 country of an address;
+// the postal code is optional, as not every country uses them
+func normalizeAddress(address Address) (Address, error) {
+	address.Line1 = collapseSpaces(address.Line1)
+	address.Line2 = collapseSpaces(address.Line2)
+	address.City = collapseSpaces(address.City)
+	address.PostalCode = strings.ToUpper(collapseSpaces(address.PostalCode))
+	address.Country = strings.ToUpper(strings.TrimSpace(address.Country))
+
+	if address.Line1 == "" {
+		return address, &InvalidUserError{Field: "address", Reason: "line1 must not be empty"}
+	}
+	if address.City == "" {
+		return address, &InvalidUserError{Field: "address", Reason: "city must not be empty"}
+	}
+	if address.PostalCode != "" && !postalCodePattern.MatchString(address.PostalCode) {
+		return address, &InvalidUserError{Field: "address", Reason: fmt.Sprintf("%q is not a postal code", address.PostalCode)}
+	}
+	if !countryPattern.MatchString(address.Country) {
+		return address, &InvalidUserError{Field: "address", Reason: "country must be an ISO 3166-1 alpha-2 code, e.g. DE"}
+	}
+	return address, nil
+}
+
+// ValidateUser checks the profile of a user and normalizes it; only the name is required
+func ValidateUser(user User) (User, error) {
+	user.Name = collapseSpaces(user.Name)
+	if user.Name == "" {
+		return user, &InvalidUserError{Field: "name", Reason: "must not be empty"}
+	}
+	if utf8.RuneCountInString(user.Name) > MaxNameLength {
+		return user, &InvalidUserError{Field: "name", Reason: fmt.Sprintf("must be at most %d characters", MaxNameLength)}
+	}
+
+	var err error
+	if strings.TrimSpace(user.Email) != "" {
+		if user.Email, err = normalizeEmail(user.Email); err != nil {
+			return user, err
+		}
+	} else {
+		user.Email = ""
+	}
+	if strings.TrimSpace(user.Phone) != "" {
+		if user.Phone, err = normalizePhone(user.Phone); err != nil {
+			return user, err
+		}
+	} else {
+		user.Phone = ""
+	}
+	if strings.TrimSpace(user.DateOfBirth) != "" {
+		if user.DateOfBirth, err = validateDateOfBirth(user.DateOfBirth, time.Now().UTC()); err != nil {
+			return user, err
+		}
+	} else {
+		user.DateOfBirth = ""
+	}
+	if user.Address != nil {
+		address, err := normalizeAddress(*user.Address)
+		if err != nil {
+			return user, err
+		}
+		user.Address = &address
+	}
+
+	return user, nil
+}
+
+// userColumns reads a user from the users table, also when it is joined with other tables
+const userColumns = "users.id, users.name, users.role, users.email, users.phone, users.date_of_birth, users.address_line1, users.address_line2, users.city, users.postal_code, users.country, users.deleted_at"
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var address Address
+	var deletedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Name, &user.Role, &user.Email, &user.Phone, &user.DateOfBirth, &address.Line1, &address.Line2, &address.City, &address.PostalCode, &address.Country, &deletedAt)
+	if err != nil {
+		return user, err
+	}
+
+	if address != (Address{}) {
+		user.Address = &address
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return user, nil
+}
+
+// userValues are the profile columns of a user, in the order of userColumns
+func userValues(user User) []any {
+	address := Address{}
+	if user.Address != nil {
+		address = *user.Address
+	}
+	return []any{user.Name, user.Email, user.Phone, user.DateOfBirth, address.Line1, address.Line2, address.City, address.PostalCode, address.Country}
+}
+
+// emailTaken turns the violation of the unique index on emails into an EmailTakenError
+func emailTaken(err error, email string) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return &EmailTakenError{Email: email}
+	}
+	return err
+}
+
+// UpdateUser replaces the profile of a user
+func (sqlite *SQLiteDb) UpdateUser(user User) (User, error) {
+	if err := sqlite.init(); err != nil {
+		return User{}, err
+	}
+
+	user, err := ValidateUser(user)
+	if err != nil {
+		return user, err
+	}
+
+	result, err := sqlite.client.Exec(`UPDATE users SET name = ?, email = ?, phone = ?, date_of_birth = ?, address_line1 = ?, address_line2 = ?, city = ?, postal_code = ?, country = ?
+        WHERE id = ? AND deleted_at IS NULL`, append(userValues(user), user.ID)...)
+	if err != nil {
+		return user, emailTaken(err, user.Email)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		if err != nil {
+			return user, err
+		}
+		return user, &UserNotFoundError{UserID: fmt.Sprint(user.ID)}
+	}
+
+	return sqlite.GetUser(fmt.Sprint(user.ID))
+}
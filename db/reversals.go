@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type ReversalError struct {
+	TransactionID int
+	Reason        string
+}
+
+func (err *ReversalError) Error() string {
+	return fmt.Sprintf("cannot reverse transaction %d: %s", err.TransactionID, err.Reason)
+}
+
+// reversalAmounts works out how much a reversal returns to the outgoing account of original (in its currency)
+// and takes back from the incoming account (in the currency of that account). A nil amount reverses whatever
+// is left; partial reversals of cross-currency transactions use the rate of the original transaction.
+func reversalAmounts(original Transaction, reversals []Transaction, amount *Money) (Money, Money, error) {
+	if original.Succeeded != 1 {
+		return Money{}, Money{}, &ReversalError{TransactionID: original.ID, Reason: "the transaction did not succeed"}
+	}
+	if original.ReversalOf != nil {
+		return Money{}, Money{}, &ReversalError{TransactionID: original.ID, Reason: "the transaction is itself a reversal"}
+	}
+
+	remainingFrom := original.Amount
+	remainingTo := original.ToAmount
+	for _, reversal := range reversals {
+		remainingFrom.Amount -= reversal.ToAmount.Amount
+		remainingTo.Amount -= reversal.Amount.Amount
+	}
+	if !remainingFrom.IsPositive() {
+		return Money{}, Money{}, &ReversalError{TransactionID: original.ID, Reason: "the transaction was already fully reversed"}
+	}
+
+	if amount == nil || *amount == remainingFrom {
+		return remainingFrom, remainingTo, nil
+	}
+
+	if amount.Currency != original.Amount.Currency {
+		return Money{}, Money{}, &CurrencyMismatchError{Expected: original.Amount.Currency, Actual: amount.Currency}
+	}
+	if !amount.IsPositive() {
+		return Money{}, Money{}, &InvalidAmountError{Amount: amount.Decimal(), Reason: "must be positive"}
+	}
+	if amount.Amount > remainingFrom.Amount {
+		return Money{}, Money{}, &ReversalError{TransactionID: original.ID, Reason: fmt.Sprintf("only %s is left to reverse", remainingFrom)}
+	}
+
+	rate := ExchangeRate{From: original.Amount.Currency, To: original.ToAmount.Currency, Rate: original.ExchangeRate}
+	toAmount, err := rate.Convert(*amount)
+	if err != nil {
+		return Money{}, Money{}, err
+	}
+	// rounding must not take back more than the incoming account received
+	if toAmount.Amount > remainingTo.Amount {
+		toAmount = remainingTo
+	}
+
+	return *amount, toAmount, nil
+}
+
+// inverseRate expresses the rate of a reversal, which converts in the opposite direction of the original
+func inverseRate(rate string) string {
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() == 0 {
+		return rate
+	}
+
+	return formatDecimal(new(big.Rat).Inv(value), 10)
+}
+
+// formatDecimal writes value rounded to places decimal places, without trailing zeros
+func formatDecimal(value *big.Rat, places int) string {
+	decimal := value.FloatString(places)
+	if strings.Contains(decimal, ".") {
+		decimal = strings.TrimRight(strings.TrimRight(decimal, "0"), ".")
+	}
+	return decimal
+}
+
+func reversalTransaction(original Transaction, fromAmount Money, toAmount Money) Transaction {
+	reversalOf := original.ID
+	return Transaction{
+		FromAccountID: original.ToAccountID,
+		ToAccountID:   original.FromAccountID,
+		Amount:        toAmount,
+		ToAmount:      fromAmount,
+		ExchangeRate:  inverseRate(original.ExchangeRate),
+		Succeeded:     1,
+		ReversalOf:    &reversalOf,
+	}
+}
+
+// ReverseTransaction moves money of a succeeded transaction back, creating a compensating transaction linked to it.
+// A nil amount reverses everything that was not reversed yet.
+func (sqlite *SQLiteDb) ReverseTransaction(transactionId int, amount *Money) (Transaction, error) {
+	if err := sqlite.init(); err != nil {
+		return Transaction{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	reversal, err := sqlite.reverse(tx, transactionId, amount)
+	if err != nil {
+		_ = tx.Rollback()
+		return reversal, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return reversal, err
+	}
+
+	return reversal, nil
+}
+
+func (sqlite *SQLiteDb) reverse(tx *sql.Tx, transactionId int, amount *Money) (Transaction, error) {
+	original, err := scanTransaction(tx.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = ?", transactionId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Transaction{}, &TransactionNotFoundError{TransactionID: transactionId}
+		}
+		return Transaction{}, err
+	}
+
+	rows, err := tx.Query("SELECT "+transactionColumns+" FROM transactions WHERE reversal_of = ? AND succeeded = 1", transactionId)
+	if err != nil {
+		return Transaction{}, err
+	}
+	reversals := []Transaction{}
+	for rows.Next() {
+		reversal, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			return Transaction{}, err
+		}
+		reversals = append(reversals, reversal)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Transaction{}, err
+	}
+
+	fromAmount, toAmount, err := reversalAmounts(original, reversals, amount)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	account, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", original.ToAccountID))
+	if err != nil {
+		return Transaction{}, err
+	}
+	refunded, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ?", original.FromAccountID))
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := checkTransfer(account, refunded); err != nil {
+		return Transaction{}, err
+	}
+	if spendFailure(account, toAmount) != "" {
+		return Transaction{}, insufficientFunds(account, toAmount)
+	}
+
+	return insertTransaction(tx, reversalTransaction(original, fromAmount, toAmount), "reversal")
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"fmt"
+)
+
+// Customers can only use their own users and accounts; support staff can read everything but change nothing,
+// and admins can do everything
+const (
+	RoleCustomer = "customer"
+	RoleSupport  = "support"
+	RoleAdmin    = "admin"
+)
+
+// ValidateRole checks that role is one of the roles above
+func ValidateRole(role string) error {
+	switch role {
+	case RoleCustomer, RoleSupport, RoleAdmin:
+		return nil
+	}
+	return &InvalidUserError{Field: "role", Reason: fmt.Sprintf("must be %s, %s or %s", RoleCustomer, RoleSupport, RoleAdmin)}
+}
+
+// SetUserRole gives a user another role; users are created as customers, and only change role through this
+func (sqlite *SQLiteDb) SetUserRole(userId int, role string) (User, error) {
+	if err := sqlite.init(); err != nil {
+		return User{}, err
+	}
+
+	if err := ValidateRole(role); err != nil {
+		return User{}, err
+	}
+
+	result, err := sqlite.client.Exec("UPDATE users SET role = ? WHERE id = ? AND deleted_at IS NULL", role, userId)
+	if err != nil {
+		return User{}, err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		if err != nil {
+			return User{}, err
+		}
+		return User{}, &UserNotFoundError{UserID: fmt.Sprint(userId)}
+	}
+
+	return sqlite.GetUser(fmt.Sprint(userId))
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type UserNotFoundError struct {
+	UserID string
+}
+
+func (err *UserNotFoundError) Error() string {
+	return fmt.Sprintf("user %s does not exist", err.UserID)
+}
+
+// UserHasAccountsError refuses deleting a user whose accounts were not all deleted yet
+type UserHasAccountsError struct {
+	UserID   int
+	Accounts int
+}
+
+func (err *UserHasAccountsError) Error() string {
+	return fmt.Sprintf("user %d still has %d accounts, which have to be deleted first", err.UserID, err.Accounts)
+}
+
+// checkDelete refuses deleting accounts that hold or owe money, or have money reserved by holds
+func checkDelete(account Account, activeHolds int) error {
+	if activeHolds > 0 {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: fmt.Sprintf("cannot be deleted with %d active holds", activeHolds)}
+	}
+	if !account.Balance.IsZero() {
+		return &AccountStatusError{AccountID: account.ID, Status: account.Status, Reason: fmt.Sprintf("cannot be deleted with a balance of %s", account.Balance)}
+	}
+	return nil
+}
+
+// DeleteUser hides a user from GetUser; only users without accounts, or whose accounts were all deleted, can be deleted
+func (sqlite *SQLiteDb) DeleteUser(userId int) (User, error) {
+	if err := sqlite.init(); err != nil {
+		return User{}, err
+	}
+
+	user, err := sqlite.GetUser(fmt.Sprint(userId))
+	if err != nil {
+		return user, err
+	}
+
+	var accounts int
+	if err := sqlite.client.QueryRow("SELECT COUNT(*) FROM accounts WHERE user_id = ? AND deleted_at IS NULL", userId).Scan(&accounts); err != nil {
+		return user, err
+	}
+	if accounts > 0 {
+		return user, &UserHasAccountsError{UserID: userId, Accounts: accounts}
+	}
+
+	deletedAt := time.Now().UTC()
+	if _, err := sqlite.client.Exec("UPDATE users SET deleted_at = ? WHERE id = ?", deletedAt, userId); err != nil {
+		return user, err
+	}
+	// access tokens cannot be revoked, but without refresh tokens they end within minutes
+	if err := revokeRefreshTokens(sqlite.client, userId, deletedAt); err != nil {
+		return user, err
+	}
+	if err := revokeAPIClients(sqlite.client, userId, deletedAt); err != nil {
+		return user, err
+	}
+	user.DeletedAt = &deletedAt
+
+	return user, nil
+}
+
+// UpdateAccount moves an account to another product; interest is accrued at the rate of the new product from the next accrual
+func (sqlite *SQLiteDb) UpdateAccount(accountId int, product string) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		return account, err
+	}
+	if account.DeletedAt != nil {
+		return account, &AccountNotFoundError{AccountID: accountId}
+	}
+	if account.Status == AccountClosed {
+		return account, &AccountStatusError{AccountID: accountId, Status: account.Status, Reason: "cannot be changed"}
+	}
+	if _, err := sqlite.getAccountProduct(product); err != nil {
+		return account, err
+	}
+
+	if _, err := sqlite.client.Exec("UPDATE accounts SET product = ? WHERE id = ?", product, accountId); err != nil {
+		return account, err
+	}
+
+	return sqlite.GetAccount(accountId)
+}
+
+// DeleteAccount closes an account without a balance, cancels its standing orders and hides it from GetAccounts;
+// the account and its transactions are kept for the transaction history
+func (sqlite *SQLiteDb) DeleteAccount(accountId int) (Account, error) {
+	if err := sqlite.init(); err != nil {
+		return Account{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return Account{}, err
+	}
+
+	account, err := sqlite.deleteAccount(tx, accountId)
+	if err != nil {
+		_ = tx.Rollback()
+		return account, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return account, err
+	}
+
+	return account, nil
+}
+
+func (sqlite *SQLiteDb) deleteAccount(tx *sql.Tx, accountId int) (Account, error) {
+	account, err := scanAccount(tx.QueryRow("SELECT "+accountColumns+" FROM accounts WHERE id = ? AND deleted_at IS NULL AND user_id != ?", accountId, SystemUserID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return account, &AccountNotFoundError{AccountID: accountId}
+		}
+		return account, err
+	}
+
+	var activeHolds int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM holds WHERE from_account_id = ? AND status = ?", accountId, HoldActive).Scan(&activeHolds); err != nil {
+		return account, err
+	}
+	if err := checkDelete(account, activeHolds); err != nil {
+		return account, err
+	}
+
+	deletedAt := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE accounts SET status = ?, deleted_at = ? WHERE id = ?", AccountClosed, deletedAt, accountId); err != nil {
+		return account, err
+	}
+	if err := cancelStandingOrders(tx, accountId); err != nil {
+		return account, err
+	}
+
+	account.Status = AccountClosed
+	account.DeletedAt = &deletedAt
+
+	return account, nil
+}
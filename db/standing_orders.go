@@ -0,0 +1,420 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+const (
+	StandingOrderActive    = "active"
+	StandingOrderCompleted = "completed"
+	StandingOrderCancelled = "cancelled"
+)
+
+type StandingOrderNotFoundError struct {
+	StandingOrderID int
+}
+
+func (err *StandingOrderNotFoundError) Error() string {
+	return fmt.Sprintf("standing order %d does not exist", err.StandingOrderID)
+}
+
+type InvalidStandingOrderError struct {
+	Reason string
+}
+
+func (err *InvalidStandingOrderError) Error() string {
+	return "invalid standing order: " + err.Reason
+}
+
+// ValidateStandingOrder checks the parts of an order that do not depend on stored data
+func ValidateStandingOrder(order StandingOrder) error {
+	switch order.Frequency {
+	case FrequencyOnce, FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	default:
+		return &InvalidStandingOrderError{Reason: fmt.Sprintf("unknown frequency %q", order.Frequency)}
+	}
+
+	if !order.Amount.IsPositive() {
+		return &InvalidAmountError{Amount: order.Amount.Decimal(), Reason: "must be positive"}
+	}
+	if order.StartDate.IsZero() {
+		return &InvalidStandingOrderError{Reason: "start_date is required"}
+	}
+	if order.EndDate != nil && order.EndDate.Before(order.StartDate) {
+		return &InvalidStandingOrderError{Reason: "end_date is before start_date"}
+	}
+	if order.MaxExecutions != nil && *order.MaxExecutions < 1 {
+		return &InvalidStandingOrderError{Reason: "max_executions must be at least 1"}
+	}
+	if order.FromAccountID == order.ToAccountID {
+		return &InvalidStandingOrderError{Reason: "cannot transfer to the same account"}
+	}
+
+	return nil
+}
+
+// occurrence returns the date of run n (starting at 0) of order. Monthly orders keep the day of
+// the month of StartDate, using the last day of shorter months.
+func occurrence(order StandingOrder, n int) time.Time {
+	start := order.StartDate
+	switch order.Frequency {
+	case FrequencyDaily:
+		return start.AddDate(0, 0, n)
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*n)
+	case FrequencyMonthly:
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+		return firstOfMonth.AddDate(0, 0, min(start.Day(), lastDay)-1)
+	default:
+		return start
+	}
+}
+
+// scheduleNextRun sets NextRun and Status from the number of runs made so far
+func scheduleNextRun(order StandingOrder) StandingOrder {
+	if order.Status == StandingOrderCancelled {
+		order.NextRun = nil
+		return order
+	}
+
+	next := occurrence(order, order.Executions)
+	finished := (order.Frequency == FrequencyOnce && order.Executions > 0) ||
+		(order.MaxExecutions != nil && order.Executions >= *order.MaxExecutions) ||
+		(order.EndDate != nil && next.After(*order.EndDate))
+
+	if finished {
+		order.NextRun = nil
+		order.Status = StandingOrderCompleted
+	} else {
+		order.NextRun = &next
+		order.Status = StandingOrderActive
+	}
+	return order
+}
+
+// newStandingOrder sets up an order before its first run. Dates are kept in UTC, as SQLite compares them as text.
+func newStandingOrder(order StandingOrder) StandingOrder {
+	order.StartDate = order.StartDate.UTC()
+	if order.EndDate != nil {
+		endDate := order.EndDate.UTC()
+		order.EndDate = &endDate
+	}
+	order.Executions = 0
+	order.Status = StandingOrderActive
+	return scheduleNextRun(order)
+}
+
+func isDue(order StandingOrder, now time.Time) bool {
+	return order.Status == StandingOrderActive && order.NextRun != nil && !order.NextRun.After(now)
+}
+
+const standingOrderColumns = "id, from_account_id, to_account_id, amount, currency, frequency, start_date, end_date, max_executions, executions, next_run, status"
+
+func scanStandingOrder(row rowScanner) (StandingOrder, error) {
+	var order StandingOrder
+	var endDate, nextRun sql.NullTime
+	var maxExecutions sql.NullInt64
+	err := row.Scan(&order.ID, &order.FromAccountID, &order.ToAccountID, &order.Amount.Amount, &order.Amount.Currency, &order.Frequency,
+		&order.StartDate, &endDate, &maxExecutions, &order.Executions, &nextRun, &order.Status)
+	if err != nil {
+		return order, err
+	}
+
+	if endDate.Valid {
+		order.EndDate = &endDate.Time
+	}
+	if maxExecutions.Valid {
+		count := int(maxExecutions.Int64)
+		order.MaxExecutions = &count
+	}
+	if nextRun.Valid {
+		order.NextRun = &nextRun.Time
+	}
+
+	return order, nil
+}
+
+func (sqlite *SQLiteDb) CreateStandingOrder(order StandingOrder) (StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return StandingOrder{}, err
+	}
+	if err := ValidateStandingOrder(order); err != nil {
+		return order, err
+	}
+
+	for _, accountId := range []int{order.FromAccountID, order.ToAccountID} {
+		if _, err := sqlite.GetAccount(accountId); err != nil {
+			return order, err
+		}
+	}
+	fromAccount, _ := sqlite.GetAccount(order.FromAccountID)
+	if order.Amount.Currency != fromAccount.Balance.Currency {
+		return order, &CurrencyMismatchError{Expected: fromAccount.Balance.Currency, Actual: order.Amount.Currency}
+	}
+
+	order = newStandingOrder(order)
+	result, err := sqlite.client.Exec("INSERT INTO standing_orders (from_account_id, to_account_id, amount, currency, frequency, start_date, end_date, max_executions, executions, next_run, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		order.FromAccountID, order.ToAccountID, order.Amount.Amount, order.Amount.Currency, order.Frequency, order.StartDate, order.EndDate, order.MaxExecutions, order.Executions, order.NextRun, order.Status)
+	if err != nil {
+		return order, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return order, err
+	}
+	order.ID = int(id)
+
+	return order, nil
+}
+
+func (sqlite *SQLiteDb) GetStandingOrder(orderId int) (StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return StandingOrder{}, err
+	}
+
+	order, err := scanStandingOrder(sqlite.client.QueryRow("SELECT "+standingOrderColumns+" FROM standing_orders WHERE id = ?", orderId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return order, &StandingOrderNotFoundError{StandingOrderID: orderId}
+		}
+		return order, err
+	}
+
+	return order, nil
+}
+
+// GetStandingOrders returns the orders paying out of accounts of the user
+func (sqlite *SQLiteDb) GetStandingOrders(userId string) ([]StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	return sqlite.queryStandingOrders(`SELECT `+standingOrderColumns+` FROM standing_orders
+        WHERE from_account_id IN (SELECT id FROM accounts WHERE user_id = ?)
+        ORDER BY id`, userId)
+}
+
+func (sqlite *SQLiteDb) GetDueStandingOrders(now time.Time) ([]StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	return sqlite.queryStandingOrders("SELECT "+standingOrderColumns+" FROM standing_orders WHERE status = ? AND next_run <= ? ORDER BY next_run, id", StandingOrderActive, now.UTC())
+}
+
+func (sqlite *SQLiteDb) queryStandingOrders(query string, args ...any) ([]StandingOrder, error) {
+	orders := []StandingOrder{}
+	rows, err := sqlite.client.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		order, err := scanStandingOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, rows.Err()
+}
+
+// UpdateStandingOrder changes the amount, end date and maximum number of runs of an active order
+func (sqlite *SQLiteDb) UpdateStandingOrder(order StandingOrder) (StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return StandingOrder{}, err
+	}
+
+	existing, err := sqlite.GetStandingOrder(order.ID)
+	if err != nil {
+		return order, err
+	}
+
+	updated, err := updatedStandingOrder(existing, order)
+	if err != nil {
+		return existing, err
+	}
+
+	_, err = sqlite.client.Exec("UPDATE standing_orders SET amount = ?, end_date = ?, max_executions = ?, next_run = ?, status = ? WHERE id = ?",
+		updated.Amount.Amount, updated.EndDate, updated.MaxExecutions, updated.NextRun, updated.Status, updated.ID)
+	if err != nil {
+		return existing, err
+	}
+
+	return updated, nil
+}
+
+func updatedStandingOrder(existing StandingOrder, order StandingOrder) (StandingOrder, error) {
+	if existing.Status != StandingOrderActive {
+		return existing, &InvalidStandingOrderError{Reason: "only active orders can be changed"}
+	}
+
+	updated := existing
+	updated.Amount = order.Amount
+	updated.EndDate = order.EndDate
+	if updated.EndDate != nil {
+		endDate := updated.EndDate.UTC()
+		updated.EndDate = &endDate
+	}
+	updated.MaxExecutions = order.MaxExecutions
+	if err := ValidateStandingOrder(updated); err != nil {
+		return existing, err
+	}
+	if updated.Amount.Currency != existing.Amount.Currency {
+		return existing, &CurrencyMismatchError{Expected: existing.Amount.Currency, Actual: updated.Amount.Currency}
+	}
+
+	return scheduleNextRun(updated), nil
+}
+
+func (sqlite *SQLiteDb) CancelStandingOrder(orderId int) (StandingOrder, error) {
+	if err := sqlite.init(); err != nil {
+		return StandingOrder{}, err
+	}
+
+	order, err := sqlite.GetStandingOrder(orderId)
+	if err != nil {
+		return order, err
+	}
+	if order.Status != StandingOrderActive {
+		return order, &InvalidStandingOrderError{Reason: "only active orders can be cancelled"}
+	}
+
+	order.Status = StandingOrderCancelled
+	order.NextRun = nil
+	_, err = sqlite.client.Exec("UPDATE standing_orders SET status = ?, next_run = NULL WHERE id = ?", order.Status, order.ID)
+	if err != nil {
+		return order, err
+	}
+
+	return order, nil
+}
+
+// RunStandingOrder makes the next due run of an order through the transfer path. A transfer that fails,
+// e.g. because of an insufficient balance, is recorded on the execution, and the order moves on to its next run.
+func (sqlite *SQLiteDb) RunStandingOrder(orderId int, now time.Time) (StandingOrderExecution, error) {
+	if err := sqlite.init(); err != nil {
+		return StandingOrderExecution{}, err
+	}
+
+	tx, err := sqlite.client.Begin()
+	if err != nil {
+		return StandingOrderExecution{}, err
+	}
+
+	execution, err := sqlite.runStandingOrder(tx, orderId, now)
+	if err != nil {
+		_ = tx.Rollback()
+		return execution, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return execution, err
+	}
+
+	return execution, nil
+}
+
+func (sqlite *SQLiteDb) runStandingOrder(tx *sql.Tx, orderId int, now time.Time) (StandingOrderExecution, error) {
+	var execution StandingOrderExecution
+
+	order, err := scanStandingOrder(tx.QueryRow("SELECT "+standingOrderColumns+" FROM standing_orders WHERE id = ?", orderId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return execution, &StandingOrderNotFoundError{StandingOrderID: orderId}
+		}
+		return execution, err
+	}
+	if !isDue(order, now) {
+		return execution, &InvalidStandingOrderError{Reason: fmt.Sprintf("order %d is not due", orderId)}
+	}
+
+	execution.StandingOrderID = order.ID
+	execution.ScheduledFor = *order.NextRun
+	execution.ExecutedAt = now.UTC()
+
+	// a failed transfer is undone up to the savepoint, and only the failure is kept
+	if _, err := tx.Exec("SAVEPOINT standing_order_transfer"); err != nil {
+		return execution, err
+	}
+	transaction, err := sqlite.transfer(tx, order.FromAccountID, order.ToAccountID, order.Amount)
+	if err != nil {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO standing_order_transfer"); rollbackErr != nil {
+			return execution, rollbackErr
+		}
+		execution.Error = err.Error()
+	} else {
+		execution.TransactionID = &transaction.ID
+		execution.Succeeded = transaction.Succeeded
+		execution.Error = transaction.FailureReason
+	}
+	if _, err := tx.Exec("RELEASE standing_order_transfer"); err != nil {
+		return execution, err
+	}
+
+	result, err := tx.Exec("INSERT INTO standing_order_executions (standing_order_id, scheduled_for, executed_at, transaction_id, succeeded, error) VALUES (?, ?, ?, ?, ?, ?)",
+		execution.StandingOrderID, execution.ScheduledFor, execution.ExecutedAt, execution.TransactionID, execution.Succeeded, execution.Error)
+	if err != nil {
+		return execution, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return execution, err
+	}
+	execution.ID = int(id)
+
+	order.Executions += 1
+	order = scheduleNextRun(order)
+	_, err = tx.Exec("UPDATE standing_orders SET executions = ?, next_run = ?, status = ? WHERE id = ?", order.Executions, order.NextRun, order.Status, order.ID)
+	if err != nil {
+		return execution, err
+	}
+
+	return execution, nil
+}
+
+func (sqlite *SQLiteDb) GetStandingOrderExecutions(orderId int) ([]StandingOrderExecution, error) {
+	if err := sqlite.init(); err != nil {
+		return nil, err
+	}
+
+	if _, err := sqlite.GetStandingOrder(orderId); err != nil {
+		return nil, err
+	}
+
+	executions := []StandingOrderExecution{}
+	rows, err := sqlite.client.Query("SELECT id, standing_order_id, scheduled_for, executed_at, transaction_id, succeeded, error FROM standing_order_executions WHERE standing_order_id = ? ORDER BY id", orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var execution StandingOrderExecution
+		var transactionId sql.NullInt64
+		if err := rows.Scan(&execution.ID, &execution.StandingOrderID, &execution.ScheduledFor, &execution.ExecutedAt, &transactionId, &execution.Succeeded, &execution.Error); err != nil {
+			return nil, err
+		}
+		if transactionId.Valid {
+			id := int(transactionId.Int64)
+			execution.TransactionID = &id
+		}
+		executions = append(executions, execution)
+	}
+
+	return executions, rows.Err()
+}
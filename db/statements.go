@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// BalanceChange is what a transaction added to the balance of the account it is seen from;
+// it is negative for outgoing transactions and zero for failed ones
+func (transaction AccountTransaction) BalanceChange() Money {
+	if transaction.Direction == DirectionOutgoing {
+		if transaction.Succeeded != 1 {
+			return NewMoney(0, transaction.Amount.Currency)
+		}
+		return NewMoney(-transaction.Amount.Amount, transaction.Amount.Currency)
+	}
+
+	if transaction.Succeeded != 1 {
+		return NewMoney(0, transaction.ToAmount.Currency)
+	}
+	return transaction.ToAmount
+}
+
+// CounterpartyID is the account on the other side of the transaction
+func (transaction AccountTransaction) CounterpartyID() int {
+	return counterparty(transaction.Transaction, transaction.Direction == DirectionIncoming)
+}
+
+// balanceBefore is the balance of account just before at, worked out from its transactions, oldest first
+func balanceBefore(account Account, transactions []AccountTransaction, at time.Time) Money {
+	for i := len(transactions) - 1; i >= 0; i-- {
+		if transactions[i].Timestamp.Before(at) {
+			return transactions[i].RunningBalance
+		}
+	}
+
+	if len(transactions) > 0 {
+		first := transactions[0]
+		return NewMoney(first.RunningBalance.Amount-first.BalanceChange().Amount, account.Balance.Currency)
+	}
+	return account.Balance
+}
+
+// newStatement lists the succeeded transactions of account from (inclusive) to (exclusive),
+// with the balances at the start and at the end of the period
+func newStatement(account Account, transactions []AccountTransaction, from time.Time, to time.Time) (Statement, error) {
+	if !from.Before(to) {
+		return Statement{}, &InvalidFilterError{Reason: "from must be before to"}
+	}
+
+	statement := Statement{
+		AccountID:      account.ID,
+		Currency:       account.Balance.Currency,
+		Product:        account.Product,
+		From:           from,
+		To:             to,
+		OpeningBalance: balanceBefore(account, transactions, from),
+		ClosingBalance: balanceBefore(account, transactions, to),
+		Transactions:   []AccountTransaction{},
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Succeeded == 1 && !transaction.Timestamp.Before(from) && transaction.Timestamp.Before(to) {
+			statement.Transactions = append(statement.Transactions, transaction)
+		}
+	}
+
+	return statement, nil
+}
+
+// Reference identifies a statement, e.g. "3-20301001"
+func (statement Statement) Reference() string {
+	return fmt.Sprintf("%d-%s", statement.AccountID, statement.From.UTC().Format("20060102"))
+}
+
+// GetStatement returns the statement of an account for the period from (inclusive) to (exclusive)
+func (sqlite *SQLiteDb) GetStatement(accountId int, from time.Time, to time.Time) (Statement, error) {
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	transactions, err := sqlite.GetAccountTransactions(accountId)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	return newStatement(account, transactions, from, to)
+}
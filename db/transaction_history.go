@@ -0,0 +1,387 @@
+package db
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sort orders of transaction history; a leading "-" sorts in descending order
+const (
+	SortByTimestamp     = "timestamp"
+	SortByTimestampDesc = "-timestamp"
+	SortByAmount        = "amount"
+	SortByAmountDesc    = "-amount"
+)
+
+// DefaultTransactionLimit and MaxTransactionLimit bound how many transactions one page holds
+const (
+	DefaultTransactionLimit = 100
+	MaxTransactionLimit     = 1000
+)
+
+// TransactionFilter narrows down the transaction history of a user; fields left empty do not filter.
+// Amounts are decimals in the currency of the user's account, which is the source amount of outgoing
+// transactions and the destination amount of incoming ones.
+type TransactionFilter struct {
+	From         *time.Time // inclusive
+	To           *time.Time // exclusive
+	MinAmount    string
+	MaxAmount    string
+	Counterparty *int // the account on the other side of the transaction
+	Succeeded    *bool
+	Sort         string
+	Limit        int
+	Cursor       string
+}
+
+// TransactionPage is one page of transaction history; Next is the cursor of the following page,
+// and is empty on the last one
+type TransactionPage struct {
+	Transactions []Transaction
+	Next         string
+}
+
+type InvalidFilterError struct {
+	Reason string
+}
+
+func (err *InvalidFilterError) Error() string {
+	return "invalid filter: " + err.Reason
+}
+
+// ValidateTransactionFilter checks the filter and fills in the default sort order and limit
+func ValidateTransactionFilter(filter TransactionFilter) (TransactionFilter, error) {
+	switch filter.Sort {
+	case "":
+		filter.Sort = SortByTimestamp
+	case SortByTimestamp, SortByTimestampDesc, SortByAmount, SortByAmountDesc:
+	default:
+		return filter, &InvalidFilterError{Reason: fmt.Sprintf("unknown sort order %q", filter.Sort)}
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultTransactionLimit
+	}
+	if filter.Limit < 0 || filter.Limit > MaxTransactionLimit {
+		return filter, &InvalidFilterError{Reason: fmt.Sprintf("limit must be between 1 and %d", MaxTransactionLimit)}
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, &InvalidFilterError{Reason: "from must be before to"}
+	}
+
+	minAmount, err := parseAmountBound(filter.MinAmount)
+	if err != nil {
+		return filter, err
+	}
+	maxAmount, err := parseAmountBound(filter.MaxAmount)
+	if err != nil {
+		return filter, err
+	}
+	if minAmount != nil && maxAmount != nil && minAmount.Cmp(maxAmount) > 0 {
+		return filter, &InvalidFilterError{Reason: "min_amount must not be larger than max_amount"}
+	}
+
+	if filter.Cursor != "" {
+		if _, err := decodeCursor(filter.Cursor, filter.Sort); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+func parseAmountBound(value string) (*big.Rat, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	// big.Rat also accepts fractions such as 1/3, which are no amounts
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || strings.Contains(value, "/") {
+		return nil, &InvalidFilterError{Reason: fmt.Sprintf("invalid amount %q", value)}
+	}
+	return amount, nil
+}
+
+// amountBound converts a decimal bound into minor units of currency; lower bounds are rounded up and
+// upper bounds down, so that only amounts inside the range match
+func amountBound(value string, currency string, lower bool) (int64, error) {
+	amount, err := parseAmountBound(value)
+	if err != nil {
+		return 0, err
+	}
+	exponent, err := CurrencyExponent(currency)
+	if err != nil {
+		return 0, err
+	}
+
+	amount.Mul(amount, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+	bound, remainder := new(big.Int).QuoRem(amount.Num(), amount.Denom(), new(big.Int))
+	if remainder.Sign() != 0 && (remainder.Sign() > 0) == lower {
+		if lower {
+			bound.Add(bound, big.NewInt(1))
+		} else {
+			bound.Sub(bound, big.NewInt(1))
+		}
+	}
+	if !bound.IsInt64() {
+		return 0, &InvalidFilterError{Reason: fmt.Sprintf("amount %q is out of range", value)}
+	}
+	return bound.Int64(), nil
+}
+
+// encodeCursor returns an opaque cursor pointing after the transaction with the given id
+func encodeCursor(sort string, transactionId int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sort + ":" + strconv.Itoa(transactionId)))
+}
+
+// decodeCursor returns the id of the last transaction of the previous page; cursors only work with
+// the sort order they were created for
+func decodeCursor(cursor string, sort string) (int, error) {
+	invalid := &InvalidFilterError{Reason: "invalid cursor"}
+
+	value, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalid
+	}
+	cursorSort, id, ok := strings.Cut(string(value), ":")
+	if !ok {
+		return 0, invalid
+	}
+	transactionId, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, invalid
+	}
+	if cursorSort != sort {
+		return 0, &InvalidFilterError{Reason: "the cursor belongs to another sort order"}
+	}
+	return transactionId, nil
+}
+
+// userAmount is the amount of a transaction in the currency of the user's account
+func userAmount(transaction Transaction, incoming bool) Money {
+	if incoming {
+		return transaction.ToAmount
+	}
+	return transaction.Amount
+}
+
+// counterparty is the account on the other side of a transaction
+func counterparty(transaction Transaction, incoming bool) int {
+	if incoming {
+		return transaction.FromAccountID
+	}
+	return transaction.ToAccountID
+}
+
+// matchesFilter mirrors the WHERE clause of SQLiteDb.GetTransactionPage, without the cursor
+func matchesFilter(transaction Transaction, incoming bool, filter TransactionFilter) (bool, error) {
+	if filter.From != nil && transaction.Timestamp.Before(*filter.From) {
+		return false, nil
+	}
+	if filter.To != nil && !transaction.Timestamp.Before(*filter.To) {
+		return false, nil
+	}
+	if filter.Counterparty != nil && counterparty(transaction, incoming) != *filter.Counterparty {
+		return false, nil
+	}
+	if filter.Succeeded != nil && (transaction.Succeeded == 1) != *filter.Succeeded {
+		return false, nil
+	}
+
+	amount := userAmount(transaction, incoming)
+	if filter.MinAmount != "" {
+		bound, err := amountBound(filter.MinAmount, amount.Currency, true)
+		if err != nil || amount.Amount < bound {
+			return false, err
+		}
+	}
+	if filter.MaxAmount != "" {
+		bound, err := amountBound(filter.MaxAmount, amount.Currency, false)
+		if err != nil || amount.Amount > bound {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// transactionBefore orders transactions by the sort key of filter, and by id when keys are equal
+func transactionBefore(a Transaction, b Transaction, incoming bool, sort string) bool {
+	var cmp int
+	switch sort {
+	case SortByAmount, SortByAmountDesc:
+		cmp = compareInt64(userAmount(a, incoming).Amount, userAmount(b, incoming).Amount)
+	default:
+		cmp = a.Timestamp.Compare(b.Timestamp)
+	}
+	if cmp == 0 {
+		cmp = compareInt64(int64(a.ID), int64(b.ID))
+	}
+
+	if strings.HasPrefix(sort, "-") {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func compareInt64(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// GetTransactionPage returns one page of the transactions into (incoming) or out of the accounts of a user
+func (sqlite *SQLiteDb) GetTransactionPage(userId string, incoming bool, filter TransactionFilter) (TransactionPage, error) {
+	page := TransactionPage{Transactions: []Transaction{}}
+	if err := sqlite.init(); err != nil {
+		return page, err
+	}
+
+	filter, err := ValidateTransactionFilter(filter)
+	if err != nil {
+		return page, err
+	}
+
+	accountColumn, counterpartyColumn, amountColumn, currencyColumn := "from_account_id", "to_account_id", "amount", "currency"
+	if incoming {
+		accountColumn, counterpartyColumn, amountColumn, currencyColumn = "to_account_id", "from_account_id", "to_amount", "to_currency"
+	}
+
+	// timestamps are stored with the offset they were written with, julianday compares them as instants
+	sortColumn := "julianday(timestamp)"
+	if filter.Sort == SortByAmount || filter.Sort == SortByAmountDesc {
+		sortColumn = amountColumn
+	}
+	direction, comparison := "ASC", ">"
+	if strings.HasPrefix(filter.Sort, "-") {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{accountColumn + " IN (SELECT id FROM accounts WHERE user_id = ?)"}
+	args := []any{userId}
+
+	if filter.From != nil {
+		conditions = append(conditions, "julianday(timestamp) >= julianday(?)")
+		args = append(args, filter.From.UTC().Format(time.RFC3339Nano))
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "julianday(timestamp) < julianday(?)")
+		args = append(args, filter.To.UTC().Format(time.RFC3339Nano))
+	}
+	if filter.Counterparty != nil {
+		conditions = append(conditions, counterpartyColumn+" = ?")
+		args = append(args, *filter.Counterparty)
+	}
+	if filter.Succeeded != nil {
+		succeeded := 0
+		if *filter.Succeeded {
+			succeeded = 1
+		}
+		conditions = append(conditions, "succeeded = ?")
+		args = append(args, succeeded)
+	}
+
+	// amount bounds depend on the currency, so there is one condition per currency the user has accounts in
+	if filter.MinAmount != "" || filter.MaxAmount != "" {
+		currencies, err := sqlite.userCurrencies(userId)
+		if err != nil {
+			return page, err
+		}
+
+		amountConditions := []string{}
+		for _, currency := range currencies {
+			condition := currencyColumn + " = ?"
+			currencyArgs := []any{currency}
+			if filter.MinAmount != "" {
+				bound, err := amountBound(filter.MinAmount, currency, true)
+				if err != nil {
+					return page, err
+				}
+				condition += " AND " + amountColumn + " >= ?"
+				currencyArgs = append(currencyArgs, bound)
+			}
+			if filter.MaxAmount != "" {
+				bound, err := amountBound(filter.MaxAmount, currency, false)
+				if err != nil {
+					return page, err
+				}
+				condition += " AND " + amountColumn + " <= ?"
+				currencyArgs = append(currencyArgs, bound)
+			}
+			amountConditions = append(amountConditions, "("+condition+")")
+			args = append(args, currencyArgs...)
+		}
+		if len(amountConditions) == 0 {
+			return page, nil
+		}
+		conditions = append(conditions, "("+strings.Join(amountConditions, " OR ")+")")
+	}
+
+	if filter.Cursor != "" {
+		lastId, _ := decodeCursor(filter.Cursor, filter.Sort)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (SELECT %s, id FROM transactions WHERE id = ?)", sortColumn, comparison, sortColumn))
+		args = append(args, lastId)
+	}
+
+	// one more row than the limit tells whether there is a next page
+	query := fmt.Sprintf("SELECT %s FROM transactions WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		transactionColumns, strings.Join(conditions, " AND "), sortColumn, direction, direction)
+	args = append(args, filter.Limit+1)
+
+	rows, err := sqlite.client.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Transactions = append(page.Transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	return paginate(page.Transactions, filter), nil
+}
+
+func (sqlite *SQLiteDb) userCurrencies(userId string) ([]string, error) {
+	rows, err := sqlite.client.Query("SELECT DISTINCT currency FROM accounts WHERE user_id = ? ORDER BY currency", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currencies := []string{}
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, rows.Err()
+}
+
+// paginate cuts sorted transactions, read one past the limit, down to a page
+func paginate(transactions []Transaction, filter TransactionFilter) TransactionPage {
+	page := TransactionPage{Transactions: transactions}
+	if len(transactions) > filter.Limit {
+		page.Transactions = transactions[:filter.Limit]
+		page.Next = encodeCursor(filter.Sort, page.Transactions[filter.Limit-1].ID)
+	}
+	return page
+}
@@ -0,0 +1,116 @@
+package db
+
+import "strings"
+
+// DefaultUserLimit and MaxUserLimit bound how many users one page of search results holds
+const (
+	DefaultUserLimit = 50
+	MaxUserLimit     = 500
+)
+
+// userCursorSort tells user search cursors apart from transaction history cursors
+const userCursorSort = "users"
+
+// UserFilter narrows down a user search; fields left empty do not filter. Deleted users are never found.
+type UserFilter struct {
+	Name      string // prefix of the name, in any case
+	Email     string
+	AccountID *int // an account of the user, also a deleted one
+	Limit     int
+	Cursor    string
+}
+
+// UserPage is one page of users, ordered by id; Next is the cursor of the following page, and is empty on the last one
+type UserPage struct {
+	Users []User
+	Next  string
+}
+
+// ValidateUserFilter normalizes the filter like profiles are normalized and fills in the default limit
+func ValidateUserFilter(filter UserFilter) (UserFilter, error) {
+	filter.Name = collapseSpaces(filter.Name)
+	filter.Email = strings.ToLower(strings.TrimSpace(filter.Email))
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultUserLimit
+	}
+	if filter.Limit < 0 || filter.Limit > MaxUserLimit {
+		return filter, &InvalidFilterError{Reason: "limit must be between 1 and 500"}
+	}
+
+	if filter.Cursor != "" {
+		if _, err := decodeCursor(filter.Cursor, userCursorSort); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with \ as escape character
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+func paginateUsers(users []User, filter UserFilter) UserPage {
+	page := UserPage{Users: users}
+	if len(users) > filter.Limit {
+		page.Users = users[:filter.Limit]
+		page.Next = encodeCursor(userCursorSort, page.Users[filter.Limit-1].ID)
+	}
+	return page
+}
+
+// SearchUsers finds users by name prefix, email or account; the name prefix uses the users_name index,
+// which ignores case like LIKE does
+func (sqlite *SQLiteDb) SearchUsers(filter UserFilter) (UserPage, error) {
+	if err := sqlite.init(); err != nil {
+		return UserPage{}, err
+	}
+
+	filter, err := ValidateUserFilter(filter)
+	if err != nil {
+		return UserPage{}, err
+	}
+
+	conditions := []string{"users.deleted_at IS NULL"}
+	args := []any{}
+	if filter.Name != "" {
+		conditions = append(conditions, `users.name LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(filter.Name)+"%")
+	}
+	if filter.Email != "" {
+		// the users_email index only holds emails that are set
+		conditions = append(conditions, "users.email = ?", "users.email != ''")
+		args = append(args, filter.Email)
+	}
+	if filter.AccountID != nil {
+		conditions = append(conditions, "users.id IN (SELECT user_id FROM accounts WHERE id = ?)")
+		args = append(args, *filter.AccountID)
+	}
+	if filter.Cursor != "" {
+		lastId, _ := decodeCursor(filter.Cursor, userCursorSort)
+		conditions = append(conditions, "users.id > ?")
+		args = append(args, lastId)
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE " + strings.Join(conditions, " AND ") + " ORDER BY users.id LIMIT ?"
+	rows, err := sqlite.client.Query(query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return UserPage{}, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return UserPage{}, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return UserPage{}, err
+	}
+
+	return paginateUsers(users, filter), nil
+}
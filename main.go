@@ -4,22 +4,86 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/CobilasEugen/bank-api/router"
+	"github.com/CobilasEugen/bank-api/scheduler"
 )
 
 func main() {
 	app := router.NewApp()
 
+	http.HandleFunc("POST /auth/login", app.Login())
+	http.HandleFunc("POST /auth/refresh", app.Refresh())
+	http.HandleFunc("POST /auth/logout", app.Logout())
+	http.HandleFunc("GET /auth/me", app.GetCurrentUser())
+	http.HandleFunc("POST /oauth/token", app.IssueClientToken())
+
+	http.HandleFunc("POST /clients", app.CreateAPIClient())
+	http.HandleFunc("GET /user/{userId}/clients", app.GetAPIClients())
+	http.HandleFunc("DELETE /clients/{clientId}", app.RevokeAPIClient())
+
+	http.HandleFunc("GET /audit-events", app.GetAuditEvents())
+
 	http.HandleFunc("POST /user", app.CreateUser())
 	http.HandleFunc("POST /account", app.CreateAccount())
 	http.HandleFunc("POST /transaction", app.CreateTransaction())
+	http.HandleFunc("POST /transaction/{transactionId}/reverse", app.ReverseTransaction())
+	http.HandleFunc("POST /batch-transfers", app.CreateBatchTransfer())
 
 	http.HandleFunc("GET /user/{userId}", app.GetUser())
+	http.HandleFunc("PATCH /user/{userId}", app.UpdateUser())
+	http.HandleFunc("DELETE /user/{userId}", app.DeleteUser())
+	http.HandleFunc("PUT /user/{userId}/role", app.SetUserRole())
+	http.HandleFunc("GET /users", app.SearchUsers())
 	http.HandleFunc("GET /account/{userId}", app.GetAccounts())
 	http.HandleFunc("GET /transaction/in/{userId}", app.GetInTransactions())
 	http.HandleFunc("GET /transaction/out/{userId}", app.GetOutTransactions())
 
+	http.HandleFunc("GET /accounts/{accountId}", app.GetAccount())
+	http.HandleFunc("PATCH /accounts/{accountId}", app.UpdateAccount())
+	http.HandleFunc("DELETE /accounts/{accountId}", app.DeleteAccount())
+	http.HandleFunc("GET /accounts/{accountId}/transactions", app.GetAccountTransactions())
+	http.HandleFunc("GET /accounts/{accountId}/statement", app.GetStatement())
+	http.HandleFunc("GET /transactions/{transactionId}", app.GetTransaction())
+	http.HandleFunc("GET /batch-transfers/{batchId}", app.GetBatchTransfer())
+	http.HandleFunc("PUT /accounts/{accountId}/overdraft-limit", app.SetOverdraftLimit())
+	http.HandleFunc("POST /accounts/{accountId}/freeze", app.FreezeAccount())
+	http.HandleFunc("POST /accounts/{accountId}/unfreeze", app.UnfreezeAccount())
+	http.HandleFunc("POST /accounts/{accountId}/close", app.CloseAccount())
+	http.HandleFunc("GET /accounts/{accountId}/interest", app.GetAccruedInterest())
+	http.HandleFunc("GET /accounts/{accountId}/postings", app.GetPostings())
+	http.HandleFunc("GET /ledger/verify", app.VerifyLedger())
+
+	http.HandleFunc("POST /holds", app.CreateHold())
+	http.HandleFunc("GET /holds/{holdId}", app.GetHold())
+	http.HandleFunc("POST /holds/{holdId}/capture", app.CaptureHold())
+	http.HandleFunc("POST /holds/{holdId}/void", app.VoidHold())
+
+	http.HandleFunc("POST /standing-orders", app.CreateStandingOrder())
+	http.HandleFunc("GET /standing-orders/{orderId}", app.GetStandingOrder())
+	http.HandleFunc("GET /user/{userId}/standing-orders", app.GetStandingOrders())
+	http.HandleFunc("PATCH /standing-orders/{orderId}", app.UpdateStandingOrder())
+	http.HandleFunc("DELETE /standing-orders/{orderId}", app.CancelStandingOrder())
+	http.HandleFunc("GET /standing-orders/{orderId}/executions", app.GetStandingOrderExecutions())
+
+	http.HandleFunc("POST /payment-files", app.CreatePaymentFile())
+	http.HandleFunc("GET /payment-files/{fileId}", app.GetPaymentFile())
+
+	http.HandleFunc("GET /products", app.GetAccountProducts())
+	http.HandleFunc("PUT /products/{product}", app.SetAccountProduct())
+
+	http.HandleFunc("GET /exchange-rates", app.GetExchangeRates())
+	http.HandleFunc("PUT /exchange-rates/{from}/{to}", app.SetExchangeRate())
+
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("standing orders", scheduler.StandingOrders(app.Db))
+	tasks.Add("hold expiry", scheduler.ExpireHolds(app.Db))
+	tasks.Add("interest", scheduler.Interest(app.Db))
+	tasks.Add("payment files", scheduler.PaymentFiles(app.Db))
+	stopTasks := tasks.Start()
+	defer stopTasks()
+
 	servePort := 8080
 	log.Printf("Server started at http://localhost:%d", servePort)
 
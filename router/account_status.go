@@ -0,0 +1,97 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// the balance of the closed account is moved to sweep_to_account_id, which can be left out when there is none
+type closeAccountRequest struct {
+	SweepToAccountID *int `json:"sweep_to_account_id"`
+}
+
+func (app *App) setAccountStatus(status string) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		// accounts may have been frozen by the bank, so only admins make them active again
+		if status == db.AccountActive {
+			err = app.Policy.Admin(principal(r))
+		} else {
+			err = app.Policy.Account(principal(r), auth.Write, accountId)
+		}
+		if err != nil {
+			dbError(w, err, "Could not change account status")
+			return
+		}
+
+		account, err := app.Db.SetAccountStatus(accountId, status)
+		if err != nil {
+			dbError(w, err, "Could not change account status")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("account %d is now %s", account.ID, account.Status)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "account"), db.ScopeAccountsWrite), "ip")
+}
+
+func (app *App) FreezeAccount() http.HandlerFunc {
+	return app.setAccountStatus(db.AccountFrozen)
+}
+
+func (app *App) UnfreezeAccount() http.HandlerFunc {
+	return app.setAccountStatus(db.AccountActive)
+}
+
+func (app *App) CloseAccount() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Write, accountId); err != nil {
+			dbError(w, err, "Could not close account")
+			return
+		}
+
+		var request closeAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode account data")
+			return
+		}
+
+		account, err := app.Db.CloseAccount(accountId, request.SweepToAccountID)
+		if err != nil {
+			dbError(w, err, "Could not close account")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("closed account %d", account.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "account"), db.ScopeAccountsWrite), "ip")
+}
@@ -0,0 +1,210 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// codes of the token endpoint are the error codes of RFC 6749, section 5.2
+const (
+	codeInvalidClient        = "invalid_client"
+	codeInvalidScope         = "invalid_scope"
+	codeUnsupportedGrantType = "unsupported_grant_type"
+)
+
+type createAPIClientRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// createAPIClientResponse is the only response with the API key, which is not stored, and the signing secret
+type createAPIClientResponse struct {
+	db.APIClient
+	APIKey        string `json:"api_key"`
+	SigningSecret string `json:"signing_secret"`
+}
+
+// clientTokenResponse follows RFC 6749, section 5.1; clients get no refresh token, they ask for a new access token instead
+type clientTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// CreateAPIClient registers an API client of the user who makes the request; it acts for them, with their role
+func (app *App) CreateAPIClient() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// otherwise a client could give itself scopes it does not have
+		if principal(r).ClientID != "" {
+			dbError(w, &auth.ForbiddenError{Reason: "API clients cannot register API clients"}, "Could not register API client")
+			return
+		}
+
+		var request createAPIClientRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode API client data")
+			return
+		}
+
+		clientId, key, keyHash, err := auth.NewClientCredentials()
+		if err != nil {
+			internalError(w, err, "Could not register API client")
+			return
+		}
+
+		signingSecret, err := auth.NewSigningSecret()
+		if err != nil {
+			internalError(w, err, "Could not register API client")
+			return
+		}
+
+		client := db.APIClient{ClientID: clientId, UserID: principal(r).UserID, Name: request.Name, Scopes: request.Scopes, KeyHash: keyHash, SigningSecret: signingSecret}
+		client, err = app.Db.CreateAPIClient(client)
+		if err != nil {
+			dbError(w, err, "Could not register API client")
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(createAPIClientResponse{APIClient: client, APIKey: key, SigningSecret: signingSecret}); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode API client data")
+			return
+		}
+
+		log.Printf("user %d registered API client %s", client.UserID, client.ClientID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "api_client"), db.ScopeUsersWrite), "ip")
+}
+
+func (app *App) GetAPIClients() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userId, err := pathId(r, "userId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid user id")
+			return
+		}
+
+		if err := app.Policy.User(principal(r), auth.Read, fmt.Sprint(userId)); err != nil {
+			dbError(w, err, "Could not get API clients")
+			return
+		}
+
+		clients, err := app.Db.GetAPIClients(userId)
+		if err != nil {
+			dbError(w, err, "Could not get API clients")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(clients); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode API client data")
+			return
+		}
+	}
+
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeUsersRead), "ip"), "user")
+}
+
+// RevokeAPIClient stops a client from authenticating, with its API key or with the access tokens it already got
+func (app *App) RevokeAPIClient() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		clientId := r.PathValue("clientId")
+		client, err := app.Db.GetAPIClient(clientId)
+		if err != nil {
+			dbError(w, err, "Could not revoke API client")
+			return
+		}
+
+		if err := app.Policy.User(principal(r), auth.Write, fmt.Sprint(client.UserID)); err != nil {
+			dbError(w, err, "Could not revoke API client")
+			return
+		}
+
+		client, err = app.Db.RevokeAPIClient(clientId)
+		if err != nil {
+			dbError(w, err, "Could not revoke API client")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(client); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode API client data")
+			return
+		}
+
+		log.Printf("revoked API client %s", client.ClientID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "api_client"), db.ScopeUsersWrite), "ip")
+}
+
+// IssueClientToken is the token endpoint of the OAuth2 client credentials grant, RFC 6749, section 4.4. The
+// form-encoded request names the client with HTTP Basic authentication, or with client_id and client_secret,
+// and may ask for fewer scopes than the client has
+func (app *App) IssueClientToken() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode token request")
+			return
+		}
+		if grantType := r.PostForm.Get("grant_type"); grantType != "client_credentials" {
+			writeError(w, http.StatusBadRequest, codeUnsupportedGrantType, fmt.Sprintf("Unsupported grant type %q: only client_credentials is supported", grantType))
+			return
+		}
+
+		clientId, secret, basic := r.BasicAuth()
+		if !basic {
+			clientId, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		client, err := app.Db.GetAPIClient(clientId)
+		var notFound *db.APIClientNotFoundError
+		if err != nil && !errors.As(err, &notFound) {
+			internalError(w, err, "Could not issue access token")
+			return
+		}
+		if err != nil || subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.KeyHash)) != 1 {
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="bank-api"`)
+			}
+			writeError(w, http.StatusUnauthorized, codeInvalidClient, "Invalid client id or client secret")
+			return
+		}
+
+		scopes := client.Scopes
+		if requested := r.PostForm.Get("scope"); requested != "" {
+			granted := auth.Principal{UserID: client.UserID, ClientID: client.ClientID, Scopes: client.Scopes}
+			scopes = strings.Fields(requested)
+			for _, scope := range scopes {
+				if !granted.HasScope(scope) {
+					writeError(w, http.StatusBadRequest, codeInvalidScope, fmt.Sprintf("The API client does not have the scope %s", scope))
+					return
+				}
+			}
+		}
+
+		token, err := app.Tokens.IssueClient(client.UserID, client.ClientID, scopes, time.Now().UTC())
+		if err != nil {
+			internalError(w, err, "Could not issue access token")
+			return
+		}
+
+		// tokens must not be kept by caches, see RFC 6749, section 5.1
+		w.Header().Set("Cache-Control", "no-store")
+		response := clientTokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(auth.AccessTokenTTL.Seconds()), Scope: strings.Join(scopes, " ")}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode tokens")
+		}
+	}
+
+	// client secrets are random, so like refresh tokens they cannot be guessed and need no login limit
+	return app.RateLimit(handler, "ip")
+}
@@ -1,9 +1,13 @@
 package router
 
 import (
+	"context"
+	"crypto/rand"
+	"github.com/CobilasEugen/bank-api/auth"
 	"github.com/CobilasEugen/bank-api/db"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 )
 
@@ -11,16 +15,64 @@ type AppInterface interface {
 	CreateUser() http.HandlerFunc
 	CreateAccount() http.HandlerFunc
 	CreateTransaction() http.HandlerFunc
+	ReverseTransaction() http.HandlerFunc
+	CreateBatchTransfer() http.HandlerFunc
+	GetBatchTransfer() http.HandlerFunc
 	GetUser() http.HandlerFunc
+	UpdateUser() http.HandlerFunc
+	DeleteUser() http.HandlerFunc
+	SearchUsers() http.HandlerFunc
 	GetAccounts() http.HandlerFunc
+	GetAccount() http.HandlerFunc
+	UpdateAccount() http.HandlerFunc
+	DeleteAccount() http.HandlerFunc
+	GetAccountTransactions() http.HandlerFunc
+	GetStatement() http.HandlerFunc
+	SetOverdraftLimit() http.HandlerFunc
+	FreezeAccount() http.HandlerFunc
+	UnfreezeAccount() http.HandlerFunc
+	CloseAccount() http.HandlerFunc
+	GetAccountProducts() http.HandlerFunc
+	SetAccountProduct() http.HandlerFunc
+	GetAccruedInterest() http.HandlerFunc
 	GetInTransactions() http.HandlerFunc
 	GetOutTransactions() http.HandlerFunc
+	GetTransaction() http.HandlerFunc
+	GetPostings() http.HandlerFunc
+	VerifyLedger() http.HandlerFunc
+	CreateHold() http.HandlerFunc
+	GetHold() http.HandlerFunc
+	CaptureHold() http.HandlerFunc
+	VoidHold() http.HandlerFunc
+	CreateStandingOrder() http.HandlerFunc
+	GetStandingOrder() http.HandlerFunc
+	GetStandingOrders() http.HandlerFunc
+	UpdateStandingOrder() http.HandlerFunc
+	CancelStandingOrder() http.HandlerFunc
+	GetStandingOrderExecutions() http.HandlerFunc
+	CreatePaymentFile() http.HandlerFunc
+	GetPaymentFile() http.HandlerFunc
+	GetExchangeRates() http.HandlerFunc
+	SetExchangeRate() http.HandlerFunc
+	Login() http.HandlerFunc
+	Refresh() http.HandlerFunc
+	Logout() http.HandlerFunc
+	GetCurrentUser() http.HandlerFunc
+	SetUserRole() http.HandlerFunc
+	CreateAPIClient() http.HandlerFunc
+	GetAPIClients() http.HandlerFunc
+	RevokeAPIClient() http.HandlerFunc
+	IssueClientToken() http.HandlerFunc
+	GetAuditEvents() http.HandlerFunc
 }
 
 type App struct {
 	Db         db.DbInterface
 	AppHandler AppInterface
 	Limiters   map[string]*Limiter
+	Tokens     *auth.TokenSigner
+	Policy     *auth.Policy
+	Nonces     *NonceStore
 }
 
 func NewApp() App {
@@ -30,26 +82,83 @@ func NewApp() App {
 		log.Fatal("[ERROR] " + err.Error())
 	}
 	app.Db = &db
+	app.Policy = auth.NewPolicy(app.Db)
+
+	tokens, err := auth.NewTokenSigner(tokenKey())
+	if err != nil {
+		log.Fatal("[ERROR] TOKEN_SECRET: " + err.Error())
+	}
+	app.Tokens = tokens
 
 	userLimiter := NewLimiter(5, func(r *http.Request) string { return r.PathValue("userId") })
-	ipLimiter := NewLimiter(166, func(r *http.Request) string { // 10.000 requests per minute = 166 requests per second
-		fullAddress := r.RemoteAddr
-		lastIndex := strings.LastIndex(fullAddress, ":")
-		return fullAddress[:lastIndex] // only look at IP, remove port
-	})
+	ipLimiter := NewLimiter(166, remoteIp) // 10.000 requests per minute = 166 requests per second
+	loginLimiter := NewLimiter(5, remoteIp)
+	clientLimiter := NewLimiter(166, LimitedClient)
 
 	app.Limiters = map[string]*Limiter{
-		"ip":   ipLimiter,
-		"user": userLimiter,
+		"ip":     ipLimiter,
+		"user":   userLimiter,
+		"login":  loginLimiter,
+		"client": clientLimiter,
 	}
+	// a nonce can be replayed until its timestamp is too old, which is at most twice the allowed skew
+	app.Nonces = NewNonceStore(100000, 2*auth.SignatureMaxSkew)
 
 	return app
 }
 
+func remoteIp(r *http.Request) string {
+	fullAddress := r.RemoteAddr
+	lastIndex := strings.LastIndex(fullAddress, ":")
+	return fullAddress[:lastIndex] // only look at IP, remove port
+}
+
+// tokenKey is the key access tokens are signed with, from TOKEN_SECRET; without it a random key is used,
+// so access tokens do not survive a restart
+func tokenKey() []byte {
+	if secret := os.Getenv("TOKEN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Println("[WARNING] TOKEN_SECRET is not set, access tokens are signed with a random key")
+	key := make([]byte, auth.MinKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("[ERROR] " + err.Error())
+	}
+	return key
+}
+
+// RateLimit limits handler with the limiter called name; every handler goes through it, so it also
+// gives every response its request id. Requests of API clients are limited by the "client" limiter
+// instead of the "ip" limiter, so services behind the same address do not share a limit
 func (app *App) RateLimit(handler http.HandlerFunc, name string) http.HandlerFunc {
+	limited := RateLimit(handler, app.limiter(name))
+	if name != "ip" {
+		return withRequestID(limited)
+	}
+
+	clientLimited := RateLimit(handler, app.limiter("client"))
+	return withRequestID(func(w http.ResponseWriter, r *http.Request) {
+		if clientId := app.requestClient(r); clientId != "" {
+			clientLimited(w, r.WithContext(context.WithValue(r.Context(), clientIdKey{}, clientId)))
+			return
+		}
+		limited(w, r)
+	})
+}
+
+func (app *App) limiter(name string) *Limiter {
 	limiter, ok := app.Limiters[name]
 	if !ok {
 		log.Fatalf("limiter %s does not exist", name)
 	}
-	return RateLimit(handler, limiter)
+	return limiter
+}
+
+type clientIdKey struct{}
+
+// LimitedClient is the id of the "client" limiter: the API client that RateLimit found for the request
+func LimitedClient(r *http.Request) string {
+	clientId, _ := r.Context().Value(clientIdKey{}).(string)
+	return clientId
 }
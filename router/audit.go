@@ -0,0 +1,302 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// auditKind tells Audited how to find the entity a route changes. An entity that already exists is named
+// by pathValues; one that is created is named by the responseId field of the response
+type auditKind struct {
+	pathValues []string
+	responseId string
+	load       func(database db.DbInterface, id string) (any, error)
+}
+
+// byId loads entities with integer ids, like db.DbInterface.GetAccount
+func byId[T any](get func(database db.DbInterface, id int) (T, error)) func(database db.DbInterface, id string) (any, error) {
+	return func(database db.DbInterface, id string) (any, error) {
+		entityId, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		return get(database, entityId)
+	}
+}
+
+var auditKinds = map[string]auditKind{
+	"user":           {[]string{"userId"}, "id", func(database db.DbInterface, id string) (any, error) { return database.GetUser(id) }},
+	"account":        {[]string{"accountId"}, "id", byId(db.DbInterface.GetAccount)},
+	"transaction":    {[]string{"transactionId"}, "id", byId(db.DbInterface.GetTransaction)},
+	"batch_transfer": {nil, "id", byId(db.DbInterface.GetBatchTransfer)},
+	"hold":           {[]string{"holdId"}, "id", byId(db.DbInterface.GetHold)},
+	"standing_order": {[]string{"orderId"}, "id", byId(db.DbInterface.GetStandingOrder)},
+	"payment_file":   {nil, "id", byId(db.DbInterface.GetPaymentFile)},
+	"product": {[]string{"product"}, "name", func(database db.DbInterface, id string) (any, error) {
+		products, err := database.GetAccountProducts()
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range products {
+			if product.Name == id {
+				return product, nil
+			}
+		}
+		return nil, nil
+	}},
+	"exchange_rate": {[]string{"from", "to"}, "", func(database db.DbInterface, id string) (any, error) {
+		rates, err := database.GetExchangeRates()
+		if err != nil {
+			return nil, err
+		}
+		for _, rate := range rates {
+			if rate.From+"/"+rate.To == id {
+				return rate, nil
+			}
+		}
+		return nil, nil
+	}},
+	"api_client": {[]string{"clientId"}, "client_id", func(database db.DbInterface, id string) (any, error) { return database.GetAPIClient(id) }},
+}
+
+// pathEntityId is the id of the entity named by the path of the request, or "" if the route creates it
+func (kind auditKind) pathEntityId(r *http.Request) string {
+	values := []string{}
+	for _, name := range kind.pathValues {
+		values = append(values, r.PathValue(name))
+	}
+	return strings.Join(values, "/")
+}
+
+// responseEntityId is the id of the entity in a response, or "" if it has none
+func (kind auditKind) responseEntityId(body []byte) string {
+	if kind.responseId == "" {
+		return ""
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	switch id := fields[kind.responseId].(type) {
+	case float64:
+		return strconv.FormatInt(int64(id), 10)
+	case string:
+		return id
+	}
+	return ""
+}
+
+// snapshot is the JSON of an entity as it is stored, for the before and after values of an event. Entities
+// that do not exist, like a user after it was deleted, have no snapshot
+func (app *App) snapshot(kind auditKind, id string) (any, json.RawMessage) {
+	if id == "" {
+		return nil, nil
+	}
+	entity, err := kind.load(app.Db, id)
+	if err != nil {
+		var dbErr db.Error
+		if !errors.As(err, &dbErr) || dbErr.Kind() != db.KindNotFound {
+			log.Println("[ERROR] audit: " + err.Error())
+		}
+		return nil, nil
+	}
+	if entity == nil {
+		return nil, nil
+	}
+	value, err := json.Marshal(entity)
+	if err != nil {
+		log.Println("[ERROR] audit: " + err.Error())
+		return nil, nil
+	}
+	return entity, value
+}
+
+// relatedTargets are the entities affected by a change besides the entity itself, so searching the audit
+// log for an account also finds the transfers from and to it
+func relatedTargets(entity any) []string {
+	switch entity := entity.(type) {
+	case db.Account:
+		return []string{fmt.Sprintf("user:%d", entity.UserID)}
+	case db.Transaction:
+		return []string{fmt.Sprintf("account:%d", entity.FromAccountID), fmt.Sprintf("account:%d", entity.ToAccountID)}
+	case db.Hold:
+		return []string{fmt.Sprintf("account:%d", entity.FromAccountID), fmt.Sprintf("account:%d", entity.ToAccountID)}
+	case db.StandingOrder:
+		return []string{fmt.Sprintf("account:%d", entity.FromAccountID), fmt.Sprintf("account:%d", entity.ToAccountID)}
+	case db.BatchTransfer:
+		targets := []string{}
+		for _, transaction := range entity.Transactions {
+			targets = append(targets, fmt.Sprintf("transaction:%d", transaction.ID))
+			targets = append(targets, relatedTargets(transaction)...)
+		}
+		return targets
+	case db.APIClient:
+		return []string{fmt.Sprintf("user:%d", entity.UserID)}
+	}
+	return nil
+}
+
+// errorCode is the code of the error envelope of a response, or "" if it has none
+func errorCode(body []byte) string {
+	var envelope struct {
+		Error errorBody `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return ""
+	}
+	return envelope.Error.Code
+}
+
+// Audited records every request to handler in the audit log: who made it, from where, which entity of kind
+// it changed with its value before and after, and whether it succeeded. The values are loaded from the
+// database rather than taken from the request or the response, so secrets that are only shown once, like
+// API keys, never end up in the log. The event is written after the handler committed its change, so an
+// event that cannot be written is logged as an error rather than turning a change that was made into a
+// failed request. It needs the principal, so it goes inside Authenticate
+func (app *App) Audited(handler http.HandlerFunc, kindName string) http.HandlerFunc {
+	kind, ok := auditKinds[kindName]
+	if !ok {
+		log.Fatalf("audit kind %s does not exist", kindName)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathId := kind.pathEntityId(r)
+		_, before := app.snapshot(kind, pathId)
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		handler(recorder, r)
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+
+		event := db.AuditEvent{
+			Timestamp:  time.Now().UTC(),
+			Route:      r.Method + " " + r.URL.Path,
+			RequestID:  w.Header().Get(requestIDHeader),
+			SourceIP:   remoteIp(r),
+			Targets:    []string{},
+			Before:     before,
+			Outcome:    db.AuditSucceeded,
+			StatusCode: recorder.statusCode,
+		}
+		if principal := principal(r); principal.Role != "" {
+			event.ActorUserID = &principal.UserID
+			event.ActorClientID = principal.ClientID
+		}
+
+		if recorder.statusCode >= http.StatusBadRequest {
+			event.Outcome = db.AuditFailed
+			event.ErrorCode = errorCode(recorder.body.Bytes())
+		}
+
+		// the entity the route names comes first, so it is the one the values belong to
+		responseId := ""
+		if event.Outcome == db.AuditSucceeded {
+			responseId = kind.responseEntityId(recorder.body.Bytes())
+		}
+		id := pathId
+		if id == "" {
+			id = responseId
+		}
+		if id != "" {
+			event.Targets = append(event.Targets, kindName+":"+id)
+		}
+		if responseId != "" && responseId != id {
+			event.Targets = append(event.Targets, kindName+":"+responseId)
+		}
+
+		if event.Outcome == db.AuditSucceeded {
+			var after any
+			after, event.After = app.snapshot(kind, id)
+			if after == nil && responseId != id {
+				after, event.After = app.snapshot(kind, responseId)
+			}
+			event.Targets = append(event.Targets, relatedTargets(after)...)
+		}
+
+		if _, err := app.Db.CreateAuditEvent(event); err != nil {
+			log.Printf("[ERROR] request %s: could not write audit event for %s (%s, status %d): %s",
+				event.RequestID, event.Route, strings.Join(event.Targets, " "), event.StatusCode, err)
+		}
+	}
+}
+
+// parseAuditFilter reads the query parameters of the audit log endpoint
+func parseAuditFilter(r *http.Request) (db.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := db.AuditFilter{
+		ActorClientID: query.Get("actor_client_id"),
+		Target:        query.Get("target"),
+		Route:         query.Get("route"),
+		RequestID:     query.Get("request_id"),
+		Outcome:       query.Get("outcome"),
+		Cursor:        query.Get("cursor"),
+	}
+
+	if value := query.Get("actor_user_id"); value != "" {
+		userId, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid user id %q", value)}
+		}
+		filter.ActorUserID = &userId
+	}
+
+	for name, field := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			date, err := parseDate(value)
+			if err != nil {
+				return filter, &db.InvalidFilterError{Reason: err.Error()}
+			}
+			*field = &date
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid limit %q", value)}
+		}
+		filter.Limit = limit
+	}
+
+	return db.ValidateAuditFilter(filter)
+}
+
+func (app *App) GetAuditEvents() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := app.Policy.Admin(principal(r)); err != nil {
+			dbError(w, err, "Could not search audit log")
+			return
+		}
+
+		filter, err := parseAuditFilter(r)
+		if err != nil {
+			dbError(w, err, "Could not read filter")
+			return
+		}
+
+		page, err := app.Db.SearchAuditEvents(filter)
+		if err != nil {
+			dbError(w, err, "Could not search audit log")
+			return
+		}
+
+		setNextLink(w, r, page.Next)
+		if err := json.NewEncoder(w).Encode(page.Events); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode audit events")
+			return
+		}
+
+		log.Printf("found %d audit events", len(page.Events))
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAuditRead), "ip")
+}
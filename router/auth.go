@@ -0,0 +1,313 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+const (
+	codeUnauthenticated   = "unauthenticated"
+	codeInvalidToken      = "invalid_token"
+	codeInvalidAPIKey     = "invalid_api_key"
+	codeInsufficientScope = "insufficient_scope"
+)
+
+type principalKey struct{}
+
+// principal returns who made a request that went through Authenticate; other requests have the zero
+// auth.Principal, which is allowed nothing
+func principal(r *http.Request) auth.Principal {
+	principal, _ := r.Context().Value(principalKey{}).(auth.Principal)
+	return principal
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenResponse follows RFC 6749, section 5.1; expires_in is in seconds
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// apiKeyHeader carries the API key of an API client that does not use the client credentials grant
+const apiKeyHeader = "X-API-Key"
+
+// authError refuses the credentials of a request; header is the WWW-Authenticate challenge of RFC 6750
+type authError struct {
+	code    string
+	message string
+	header  string
+}
+
+func (err *authError) Error() string {
+	return err.message
+}
+
+func invalidToken(reason string) *authError {
+	return &authError{code: codeInvalidToken, message: "Invalid access token: " + reason, header: `Bearer realm="bank-api", error="invalid_token"`}
+}
+
+// Authenticate only lets requests with a valid access token in the Authorization header, or the API key of
+// an API client, through to handler, which finds who made them with principal; API clients also need
+// scope. Whether the request may be made is for handler to check with app.Policy
+func (app *App) Authenticate(handler http.HandlerFunc, scope string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := app.authenticate(r)
+		if err != nil {
+			var refused *authError
+			if !errors.As(err, &refused) {
+				internalError(w, err, "Could not check access token")
+				return
+			}
+			w.Header().Set("WWW-Authenticate", refused.header)
+			writeError(w, http.StatusUnauthorized, refused.code, refused.message)
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="bank-api", error="insufficient_scope", scope="%s"`, scope))
+			writeError(w, http.StatusForbidden, codeInsufficientScope, fmt.Sprintf("The API client needs the scope %s", scope))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// authenticate finds the principal of a request from its API key or its access token; credentials that
+// are refused are an *authError
+func (app *App) authenticate(r *http.Request) (auth.Principal, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		client, err := app.Db.GetAPIClientByKey(auth.HashToken(key))
+		if err != nil {
+			var notFound *db.APIClientNotFoundError
+			if errors.As(err, &notFound) {
+				return auth.Principal{}, &authError{code: codeInvalidAPIKey, message: "Invalid API key", header: `Bearer realm="bank-api"`}
+			}
+			return auth.Principal{}, err
+		}
+		return app.principalOf(client.UserID, client.ClientID, client.Scopes)
+	}
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return auth.Principal{}, &authError{code: codeUnauthenticated, message: "Authorization header with a bearer token is required", header: `Bearer realm="bank-api"`}
+	}
+
+	claims, err := app.Tokens.Verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return auth.Principal{}, invalidToken(err.Error())
+	}
+
+	userId, _ := claims.UserID()
+	if claims.ClientID != "" {
+		// like users, clients are checked on every request, so the tokens of revoked clients are refused
+		client, err := app.Db.GetAPIClient(claims.ClientID)
+		if err != nil {
+			var notFound *db.APIClientNotFoundError
+			if errors.As(err, &notFound) {
+				return auth.Principal{}, invalidToken("the API client was revoked")
+			}
+			return auth.Principal{}, err
+		}
+		if client.UserID != userId {
+			return auth.Principal{}, invalidToken("the API client belongs to another user")
+		}
+	}
+	return app.principalOf(userId, claims.ClientID, claims.Scopes())
+}
+
+// principalOf is the principal of a user, or of an API client of the user if clientId is set. Access tokens
+// cannot be revoked, so the tokens of deleted users are refused here; the role is read here too, so a new
+// role applies to the tokens that were already issued
+func (app *App) principalOf(userId int, clientId string, scopes []string) (auth.Principal, error) {
+	user, err := app.Db.GetUser(fmt.Sprint(userId))
+	if err != nil {
+		var notFound *db.UserNotFoundError
+		if errors.As(err, &notFound) {
+			return auth.Principal{}, invalidToken("the user no longer exists")
+		}
+		return auth.Principal{}, err
+	}
+	return auth.Principal{UserID: user.ID, Role: user.Role, ClientID: clientId, Scopes: scopes}, nil
+}
+
+// requestClient is the client id of a request made by an API client, as far as the "client" limiter needs
+// it: the key or the signature of the token is checked, so no one can choose the bucket of another client.
+// Everything else is left to Authenticate
+func (app *App) requestClient(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		client, err := app.Db.GetAPIClientByKey(auth.HashToken(key))
+		if err != nil {
+			return ""
+		}
+		return client.ClientID
+	}
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	claims, err := app.Tokens.Verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return ""
+	}
+	return claims.ClientID
+}
+
+// writeTokens answers with a new access token and the refresh token that was stored for it
+func (app *App) writeTokens(w http.ResponseWriter, userId int, refreshToken string, now time.Time) {
+	accessToken, err := app.Tokens.Issue(userId, now)
+	if err != nil {
+		internalError(w, err, "Could not issue access token")
+		return
+	}
+
+	// tokens must not be kept by caches, see RFC 6749, section 5.1
+	w.Header().Set("Cache-Control", "no-store")
+	response := tokenResponse{AccessToken: accessToken, TokenType: "Bearer", ExpiresIn: int(auth.AccessTokenTTL.Seconds()), RefreshToken: refreshToken}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode tokens")
+	}
+}
+
+// newRefreshToken creates a refresh token for a user; the client gets the token, while only its hash is stored
+func newRefreshToken(userId int, now time.Time) (string, db.RefreshToken, error) {
+	token, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return "", db.RefreshToken{}, err
+	}
+	return token, db.RefreshToken{UserID: userId, TokenHash: hash, CreatedAt: now, ExpiresAt: now.Add(auth.RefreshTokenTTL)}, nil
+}
+
+func (app *App) Login() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request loginRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode login data")
+			return
+		}
+
+		credentials, err := app.Db.GetCredentials(request.Email)
+		if err != nil {
+			// unknown users take as long as wrong passwords, so the time does not tell which emails exist
+			auth.CheckNoPassword(request.Password)
+			dbError(w, err, "Could not log in")
+			return
+		}
+		if !auth.CheckPassword(credentials.PasswordHash, request.Password) {
+			log.Printf("failed login for user %d", credentials.UserID)
+			dbError(w, &db.InvalidCredentialsError{}, "Could not log in")
+			return
+		}
+
+		now := time.Now().UTC()
+		refreshToken, stored, err := newRefreshToken(credentials.UserID, now)
+		if err != nil {
+			internalError(w, err, "Could not issue refresh token")
+			return
+		}
+		if _, err := app.Db.CreateRefreshToken(stored); err != nil {
+			internalError(w, err, "Could not issue refresh token")
+			return
+		}
+
+		app.writeTokens(w, credentials.UserID, refreshToken, now)
+		log.Printf("user %d logged in", credentials.UserID)
+	}
+
+	return app.RateLimit(app.RateLimit(handler, "ip"), "login")
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token; the old one cannot be used again
+func (app *App) Refresh() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode refresh token")
+			return
+		}
+		if request.RefreshToken == "" {
+			dbError(w, &db.InvalidRefreshTokenError{Reason: "is missing"}, "Could not refresh tokens")
+			return
+		}
+
+		now := time.Now().UTC()
+		refreshToken, next, err := newRefreshToken(0, now)
+		if err != nil {
+			internalError(w, err, "Could not issue refresh token")
+			return
+		}
+		next, err = app.Db.RotateRefreshToken(auth.HashToken(request.RefreshToken), next)
+		if err != nil {
+			dbError(w, err, "Could not refresh tokens")
+			return
+		}
+
+		app.writeTokens(w, next.UserID, refreshToken, now)
+	}
+
+	// refresh tokens are random, so unlike passwords they cannot be guessed and need no login limit
+	return app.RateLimit(handler, "ip")
+}
+
+// Logout revokes a refresh token; the access tokens issued with it stay valid until they expire
+func (app *App) Logout() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode refresh token")
+			return
+		}
+		if request.RefreshToken == "" {
+			dbError(w, &db.InvalidRefreshTokenError{Reason: "is missing"}, "Could not log out")
+			return
+		}
+
+		if err := app.Db.RevokeRefreshToken(auth.HashToken(request.RefreshToken)); err != nil {
+			internalError(w, err, "Could not log out")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	return app.RateLimit(handler, "ip")
+}
+
+// GetCurrentUser returns the user the access token was issued to
+func (app *App) GetCurrentUser() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.Db.GetUser(fmt.Sprint(principal(r).UserID))
+		if err != nil {
+			dbError(w, err, "Could not get user")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
+			return
+		}
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeUsersRead), "ip")
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+type createBatchTransferRequest struct {
+	Legs []createTransactionRequest `json:"legs"`
+}
+
+func (app *App) CreateBatchTransfer() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request createBatchTransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode batch transfer data")
+			return
+		}
+
+		// the size is checked before the legs are, as every leg costs lookups of its accounts
+		if err := db.ValidateBatchSize(len(request.Legs)); err != nil {
+			dbError(w, err, "Could not execute batch transfer")
+			return
+		}
+
+		legs := []db.TransferLeg{}
+		for i, leg := range request.Legs {
+			if err := app.Policy.Account(principal(r), auth.Write, leg.FromAccountID); err != nil {
+				dbError(w, &db.BatchTransferError{Leg: i + 1, Err: err}, "Could not execute batch transfer")
+				return
+			}
+			if leg.Currency == "" {
+				fromAccount, err := app.Db.GetAccount(leg.FromAccountID)
+				if err != nil {
+					dbError(w, &db.BatchTransferError{Leg: i + 1, Err: err}, "Could not execute batch transfer")
+					return
+				}
+				leg.Currency = fromAccount.Balance.Currency
+			}
+
+			amount, err := db.ParseMoney(leg.Amount.String(), leg.Currency)
+			if err != nil {
+				dbError(w, &db.BatchTransferError{Leg: i + 1, Err: err}, "Could not read amount")
+				return
+			}
+			legs = append(legs, db.TransferLeg{FromAccountID: leg.FromAccountID, ToAccountID: leg.ToAccountID, Amount: amount})
+		}
+
+		batch, err := app.Db.CreateBatchTransfer(legs)
+		if err != nil {
+			dbError(w, err, "Could not execute batch transfer")
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/batch-transfers/%d", batch.ID))
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(batch); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode batch transfer data")
+			return
+		}
+
+		log.Printf("created batch transfer %d with %d transactions", batch.ID, len(batch.Transactions))
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "batch_transfer"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) GetBatchTransfer() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		batchId, err := pathId(r, "batchId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid batch transfer id")
+			return
+		}
+
+		if err := app.Policy.BatchTransfer(principal(r), auth.Read, batchId); err != nil {
+			dbError(w, err, "Could not read batch transfer")
+			return
+		}
+
+		batch, err := app.Db.GetBatchTransfer(batchId)
+		if err != nil {
+			dbError(w, err, "Could not read batch transfer")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(batch); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode batch transfer data")
+			return
+		}
+
+		log.Printf("read batch transfer %d", batchId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
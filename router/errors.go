@@ -0,0 +1,116 @@
+package router
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// codes of the errors found by the handlers themselves; errors of db bring their own code
+const (
+	codeInvalidBody       = "invalid_body"
+	codeInvalidID         = "invalid_id"
+	codeInvalidParameter  = "invalid_parameter"
+	codeNotAcceptable     = "not_acceptable"
+	codeBodyTooLarge      = "body_too_large"
+	codeRateLimited       = "rate_limited"
+	codeIdempotencyKey    = "invalid_idempotency_key"
+	codeIdempotencyReused = "idempotency_key_reused"
+	codeIdempotencyInUse  = "idempotency_key_in_use"
+	codeInternal          = "internal_error"
+)
+
+// kindStatus is the HTTP status of every kind of db.Error
+var kindStatus = map[db.ErrorKind]int{
+	db.KindValidation:        http.StatusBadRequest,
+	db.KindNotFound:          http.StatusNotFound,
+	db.KindConflict:          http.StatusConflict,
+	db.KindInsufficientFunds: http.StatusConflict,
+	db.KindLimitReached:      http.StatusTooManyRequests,
+	db.KindUnprocessable:     http.StatusUnprocessableEntity,
+	db.KindUnauthenticated:   http.StatusUnauthorized,
+	db.KindForbidden:         http.StatusForbidden,
+}
+
+// requestIDHeader carries the id of a request; a client can choose it, otherwise one is generated
+const requestIDHeader = "X-Request-Id"
+
+// requestIDPattern is what a request id chosen by the client has to look like to be used
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// errorBody is the JSON body of every failed request, inside an "error" object; details are only
+// given by some errors, such as the rejected lines of a payment file
+type errorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+	Details   any    `json:"details,omitempty"`
+}
+
+// requestID returns the id of the request that w answers, generating one when it has none yet
+func requestID(w http.ResponseWriter) string {
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		return id
+	}
+
+	random := make([]byte, 16)
+	_, _ = rand.Read(random)
+	id := hex.EncodeToString(random)
+	w.Header().Set(requestIDHeader, id)
+	return id
+}
+
+// withRequestID gives the response an X-Request-Id header before handler runs, reusing the one of the request
+func withRequestID(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if w.Header().Get(requestIDHeader) == "" {
+			if id := r.Header.Get(requestIDHeader); requestIDPattern.MatchString(id) {
+				w.Header().Set(requestIDHeader, id)
+			} else {
+				requestID(w)
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// writeError answers with the JSON error envelope
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeErrorDetails(w, status, code, message, nil)
+}
+
+func writeErrorDetails(w http.ResponseWriter, status int, code string, message string, details any) {
+	body := struct {
+		Error errorBody `json:"error"`
+	}{errorBody{Code: code, Message: message, RequestID: requestID(w), Details: details}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("[ERROR] " + err.Error())
+	}
+}
+
+// internalError logs err with the request id and answers with message, which must not reveal anything of err
+func internalError(w http.ResponseWriter, err error, message string) {
+	log.Printf("[ERROR] request %s: %s", requestID(w), err)
+	writeError(w, http.StatusInternalServerError, codeInternal, message)
+}
+
+// dbError writes the response for an error of db.DbInterface: a db.Error gets the status of its kind
+// and its own message, anything else is an internal error answered with message
+func dbError(w http.ResponseWriter, err error, message string) {
+	var dbErr db.Error
+	if !errors.As(err, &dbErr) {
+		internalError(w, err, message)
+		return
+	}
+	writeError(w, kindStatus[dbErr.Kind()], dbErr.Code(), err.Error())
+}
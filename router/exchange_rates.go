@@ -0,0 +1,68 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+type setExchangeRateRequest struct {
+	Rate json.Number `json:"rate"`
+}
+
+func (app *App) GetExchangeRates() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		rates, err := app.Db.GetExchangeRates()
+		if err != nil {
+			internalError(w, err, "Could not read exchange rates")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(rates); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode exchange rate data")
+			return
+		}
+
+		log.Printf("read %d exchange rates", len(rates))
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
+
+func (app *App) SetExchangeRate() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := app.Policy.Admin(principal(r)); err != nil {
+			dbError(w, err, "Could not set exchange rate")
+			return
+		}
+
+		var request setExchangeRateRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode exchange rate data")
+			return
+		}
+
+		rate := db.ExchangeRate{From: r.PathValue("from"), To: r.PathValue("to"), Rate: request.Rate.String()}
+		if err := db.ValidateExchangeRate(rate); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid exchange rate: "+err.Error())
+			return
+		}
+
+		rate, err := app.Db.SetExchangeRate(rate)
+		if err != nil {
+			internalError(w, err, "Could not save exchange rate")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(rate); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode exchange rate data")
+			return
+		}
+
+		log.Printf("set exchange rate %s/%s to %s", rate.From, rate.To, rate.Rate)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "exchange_rate"), db.ScopeRatesWrite), "ip")
+}
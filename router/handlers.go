@@ -1,178 +1,383 @@
 package router
 
 import (
+	"github.com/CobilasEugen/bank-api/auth"
 	"github.com/CobilasEugen/bank-api/db"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 )
 
+// pathId reads a numeric id from the request path
+func pathId(r *http.Request, name string) (int, error) {
+	return strconv.Atoi(r.PathValue(name))
+}
+
+// the password is optional, but users without one cannot log in
+type createUserRequest struct {
+	db.User
+	Password string `json:"password"`
+}
+
 func (app *App) CreateUser() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		var user db.User
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-			http.Error(w, "Could not decode user data", http.StatusBadRequest)
+		var request createUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode user data")
 			return
 		}
 
-		user, err := app.Db.CreateUser(user.Name)
+		user := request.User
+		if request.Password != "" {
+			if err := db.ValidatePassword(user, request.Password); err != nil {
+				dbError(w, err, "Could not create user")
+				return
+			}
+			hash, err := auth.HashPassword(request.Password)
+			if err != nil {
+				internalError(w, err, "Could not create user")
+				return
+			}
+			user.PasswordHash = hash
+		}
+
+		user, err := app.Db.CreateUser(user)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not create user", http.StatusInternalServerError)
+			dbError(w, err, "Could not create user")
 			return
 		}
 
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-			http.Error(w, "Could not decode user data", http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
 			return
 		}
 
 		log.Printf("created new user: %d", user.ID)
 	}
 
-	return app.RateLimit(handler, "ip")
+	return app.RateLimit(app.Audited(handler, "user"), "ip")
+}
+
+// amounts are decoded as json.Number so they can be parsed exactly into db.Money
+type createAccountRequest struct {
+	UserID   int         `json:"user_id"`
+	Balance  json.Number `json:"balance"`
+	Currency string      `json:"currency"`
+	Product  string      `json:"product"`
+}
+
+// the amount is in the currency of the outgoing account, and is converted when the incoming account uses another one
+type createTransactionRequest struct {
+	FromAccountID int         `json:"from_account_id"`
+	ToAccountID   int         `json:"to_account_id"`
+	Amount        json.Number `json:"amount"`
+	Currency      string      `json:"currency"`
 }
 
 func (app *App) CreateAccount() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		var account db.Account
-		if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
-			http.Error(w, "Could not decode account data", http.StatusBadRequest)
+		var request createAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode account data")
+			return
+		}
+
+		if err := app.Policy.User(principal(r), auth.Write, fmt.Sprint(request.UserID)); err != nil {
+			dbError(w, err, "Could not create account")
 			return
 		}
 
-		account, err := app.Db.CreateAccount(account.UserID, account.Balance)
+		if request.Balance == "" {
+			request.Balance = "0"
+		}
+		if request.Currency == "" {
+			request.Currency = db.DefaultCurrency
+		}
+		if request.Product == "" {
+			request.Product = db.DefaultProduct
+		}
+		balance, err := db.ParseMoney(request.Balance.String(), request.Currency)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not create account", http.StatusInternalServerError)
+			dbError(w, err, "Could not read balance")
+			return
+		}
+
+		// an opening balance is money paid in by the bank, so only admins open funded accounts
+		if !balance.IsZero() {
+			if err := app.Policy.Admin(principal(r)); err != nil {
+				dbError(w, err, "Could not create account")
+				return
+			}
+		}
+
+		account, err := app.Db.CreateAccount(request.UserID, balance, request.Product)
+		if err != nil {
+			dbError(w, err, "Could not create account")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(account); err != nil {
-			http.Error(w, "Could not encode account data", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
 			return
 		}
 
 		log.Printf("created new account: %d", account.ID)
 	}
 
-	return app.RateLimit(handler, "ip")
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "account"), db.ScopeAccountsWrite), "ip")
 }
 
 func (app *App) CreateTransaction() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		var transaction db.Transaction
-		if err := json.NewDecoder(r.Body).Decode(&transaction); err != nil {
-			http.Error(w, "Could not decode transaction data", http.StatusBadRequest)
+		var request createTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode transaction data")
 			return
 		}
 
-		transaction, err := app.Db.CreateTransaction(transaction.FromAccountID, transaction.ToAccountID, transaction.Amount)
-		if err != nil {
-			if _, ok := err.(*db.FailedTransactionsLimitError); ok {
-				http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
-			} else {
-				log.Println("[ERROR] " + err.Error())
-				http.Error(w, "Could not execute transaction", http.StatusInternalServerError)
+		if err := app.Policy.Account(principal(r), auth.Write, request.FromAccountID); err != nil {
+			dbError(w, err, "Could not create transaction")
+			return
+		}
+
+		if request.Currency == "" {
+			fromAccount, err := app.Db.GetAccount(request.FromAccountID)
+			if err != nil {
+				dbError(w, err, "Could not execute transaction")
+				return
 			}
+			request.Currency = fromAccount.Balance.Currency
+		}
+
+		amount, err := db.ParseMoney(request.Amount.String(), request.Currency)
+		if err != nil {
+			dbError(w, err, "Could not read amount")
+			return
+		}
+
+		transaction, err := app.Db.CreateTransaction(request.FromAccountID, request.ToAccountID, amount)
+		if err != nil {
+			dbError(w, err, "Could not execute transaction")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(transaction); err != nil {
-			http.Error(w, "Could not encode transaction data", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
 			return
 		}
 
 		log.Printf("created new transaction: %d", transaction.ID)
 	}
 
-	return app.RateLimit(handler, "ip")
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "transaction"), db.ScopeTransactionsWrite), "ip")
 }
 
 func (app *App) GetUser() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		userId := r.PathValue("userId")
 
+		if err := app.Policy.User(principal(r), auth.Read, userId); err != nil {
+			dbError(w, err, "Could not read user data")
+			return
+		}
+
 		user, err := app.Db.GetUser(userId)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not read user data", http.StatusInternalServerError)
+			dbError(w, err, "Could not read user data")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(user); err != nil {
-			http.Error(w, "Could not encode user data", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
 			return
 		}
 
 		log.Printf("read user %d", user.ID)
 	}
 
-	return app.RateLimit(app.RateLimit(handler, "ip"), "user")
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeUsersRead), "ip"), "user")
 }
 
 func (app *App) GetAccounts() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		userId := r.PathValue("userId")
 
+		if err := app.Policy.User(principal(r), auth.Read, userId); err != nil {
+			dbError(w, err, "Could not read account data")
+			return
+		}
+
 		accounts, err := app.Db.GetAccounts(userId)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not read account data", http.StatusInternalServerError)
+			internalError(w, err, "Could not read account data")
 			return
 		}
 
 		if err := json.NewEncoder(w).Encode(accounts); err != nil {
-			http.Error(w, "Could not encode account data", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
 			return
 		}
 
 		log.Printf("read accounts of user %s", userId)
 	}
 
-	return app.RateLimit(app.RateLimit(handler, "ip"), "user")
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip"), "user")
+}
+
+func (app *App) GetAccount() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Read, accountId); err != nil {
+			dbError(w, err, "Could not read account data")
+			return
+		}
+
+		account, err := app.Db.GetAccount(accountId)
+		if err != nil {
+			dbError(w, err, "Could not read account data")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("read account %d", accountId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
+
+func (app *App) GetAccountTransactions() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Read, accountId); err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		transactions, err := app.Db.GetAccountTransactions(accountId)
+		if err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(transactions); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
+			return
+		}
+
+		log.Printf("read transactions of account %d", accountId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
+
+func (app *App) GetTransaction() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		transactionId, err := pathId(r, "transactionId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid transaction id")
+			return
+		}
+
+		if err := app.Policy.Transaction(principal(r), auth.Read, transactionId); err != nil {
+			dbError(w, err, "Could not get transaction")
+			return
+		}
+
+		transaction, err := app.Db.GetTransaction(transactionId)
+		if err != nil {
+			dbError(w, err, "Could not get transaction")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(transaction); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
+			return
+		}
+
+		log.Printf("read transaction %d", transactionId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
 }
 
 func (app *App) GetInTransactions() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		userId := r.PathValue("userId")
 
-		transactions, err := app.Db.GetTransactions(userId, true)
+		if err := app.Policy.User(principal(r), auth.Read, userId); err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		filter, err := parseTransactionFilter(r)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not get transactions", http.StatusInternalServerError)
+			dbError(w, err, "Could not read filter")
 			return
 		}
 
-		if err := json.NewEncoder(w).Encode(transactions); err != nil {
-			http.Error(w, "Could not encode transaction data", http.StatusInternalServerError)
+		page, err := app.Db.GetTransactionPage(userId, true, filter)
+		if err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		setNextLink(w, r, page.Next)
+		if err := json.NewEncoder(w).Encode(page.Transactions); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
 			return
 		}
 
 		log.Printf("read incoming transactions for user %s", userId)
 	}
 
-	return app.RateLimit(app.RateLimit(handler, "ip"), "user")
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip"), "user")
 }
 
 func (app *App) GetOutTransactions() http.HandlerFunc {
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		userId := r.PathValue("userId")
 
-		transactions, err := app.Db.GetTransactions(userId, false)
+		if err := app.Policy.User(principal(r), auth.Read, userId); err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		filter, err := parseTransactionFilter(r)
 		if err != nil {
-			log.Println("[ERROR] " + err.Error())
-			http.Error(w, "Could not get transactions", http.StatusInternalServerError)
+			dbError(w, err, "Could not read filter")
 			return
 		}
 
-		if err := json.NewEncoder(w).Encode(transactions); err != nil {
-			http.Error(w, "Could not encode transaction data", http.StatusInternalServerError)
+		page, err := app.Db.GetTransactionPage(userId, false, filter)
+		if err != nil {
+			dbError(w, err, "Could not get transactions")
+			return
+		}
+
+		setNextLink(w, r, page.Next)
+		if err := json.NewEncoder(w).Encode(page.Transactions); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
 			return
 		}
 
 		log.Printf("read outgoing transactions for user %s", userId)
 	}
 
-	return app.RateLimit(app.RateLimit(handler, "ip"), "user")
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip"), "user")
 }
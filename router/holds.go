@@ -0,0 +1,197 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// the amount is in the currency of the outgoing account; without expires_at the hold lasts db.DefaultHoldDuration
+type createHoldRequest struct {
+	FromAccountID int         `json:"from_account_id"`
+	ToAccountID   int         `json:"to_account_id"`
+	Amount        json.Number `json:"amount"`
+	Currency      string      `json:"currency"`
+	ExpiresAt     string      `json:"expires_at"`
+}
+
+// an empty body, or one without an amount, captures the whole hold
+type captureHoldRequest struct {
+	Amount json.Number `json:"amount"`
+}
+
+func (app *App) CreateHold() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request createHoldRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode hold data")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Write, request.FromAccountID); err != nil {
+			dbError(w, err, "Could not create hold")
+			return
+		}
+
+		if request.Currency == "" {
+			fromAccount, err := app.Db.GetAccount(request.FromAccountID)
+			if err != nil {
+				dbError(w, err, "Could not create hold")
+				return
+			}
+			request.Currency = fromAccount.Balance.Currency
+		}
+
+		amount, err := db.ParseMoney(request.Amount.String(), request.Currency)
+		if err != nil {
+			dbError(w, err, "Could not read amount")
+			return
+		}
+
+		hold := db.Hold{FromAccountID: request.FromAccountID, ToAccountID: request.ToAccountID, Amount: amount}
+		if request.ExpiresAt != "" {
+			hold.ExpiresAt, err = time.Parse(time.RFC3339, request.ExpiresAt)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid expires_at: "+err.Error())
+				return
+			}
+			if !hold.ExpiresAt.After(time.Now()) {
+				writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid expires_at: must be in the future")
+				return
+			}
+		}
+
+		hold, err = app.Db.CreateHold(hold)
+		if err != nil {
+			dbError(w, err, "Could not create hold")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(hold); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode hold data")
+			return
+		}
+
+		log.Printf("created new hold: %d", hold.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "hold"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) GetHold() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		holdId, err := pathId(r, "holdId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid hold id")
+			return
+		}
+
+		if err := app.Policy.Hold(principal(r), auth.Read, holdId); err != nil {
+			dbError(w, err, "Could not read hold")
+			return
+		}
+
+		hold, err := app.Db.GetHold(holdId)
+		if err != nil {
+			dbError(w, err, "Could not read hold data")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(hold); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode hold data")
+			return
+		}
+
+		log.Printf("read hold %d", hold.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
+
+func (app *App) CaptureHold() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		holdId, err := pathId(r, "holdId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid hold id")
+			return
+		}
+
+		if err := app.Policy.Hold(principal(r), auth.Write, holdId); err != nil {
+			dbError(w, err, "Could not capture hold")
+			return
+		}
+
+		var request captureHoldRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode capture data")
+			return
+		}
+
+		var amount *db.Money
+		if request.Amount != "" {
+			hold, err := app.Db.GetHold(holdId)
+			if err != nil {
+				dbError(w, err, "Could not capture hold")
+				return
+			}
+
+			parsed, err := db.ParseMoney(request.Amount.String(), hold.Amount.Currency)
+			if err != nil {
+				dbError(w, err, "Could not read amount")
+				return
+			}
+			amount = &parsed
+		}
+
+		hold, err := app.Db.CaptureHold(holdId, amount)
+		if err != nil {
+			dbError(w, err, "Could not capture hold")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(hold); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode hold data")
+			return
+		}
+
+		log.Printf("captured hold %d with transaction %d", hold.ID, *hold.TransactionID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "hold"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) VoidHold() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		holdId, err := pathId(r, "holdId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid hold id")
+			return
+		}
+
+		if err := app.Policy.Hold(principal(r), auth.Write, holdId); err != nil {
+			dbError(w, err, "Could not void hold")
+			return
+		}
+
+		hold, err := app.Db.VoidHold(holdId)
+		if err != nil {
+			dbError(w, err, "Could not void hold")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(hold); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode hold data")
+			return
+		}
+
+		log.Printf("voided hold %d", hold.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "hold"), db.ScopeTransactionsWrite), "ip")
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder passes a response through to the client while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(statusCode int) {
+	recorder.statusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	if recorder.statusCode == 0 {
+		recorder.statusCode = http.StatusOK
+	}
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+// requestFingerprint identifies a request by its body; JSON bodies are re-encoded first, so formatting
+// and key order do not matter
+func requestFingerprint(body []byte) string {
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// idempotencyKey scopes key to the principal that sent it and the route it was sent to, so a key reused
+// by someone else, or on another route, is a different request that never gets the response of the first
+func idempotencyKey(r *http.Request, key string) db.IdempotencyKey {
+	scoped := db.IdempotencyKey{Route: r.Method + " " + r.URL.Path, Key: key}
+	if principal := principal(r); principal.ClientID != "" {
+		scoped.Principal = "client:" + principal.ClientID
+	} else if principal.Role != "" {
+		scoped.Principal = fmt.Sprintf("user:%d", principal.UserID)
+	}
+	return scoped
+}
+
+// Idempotent makes retries of handler with the same Idempotency-Key header replay the original response.
+// Reusing a key for a different request is rejected, and requests without the header are not affected.
+func (app *App) Idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Idempotency-Key")
+		if header == "" {
+			handler(w, r)
+			return
+		}
+		if len(header) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, codeIdempotencyKey, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := idempotencyKey(r, header)
+		record, created, err := app.Db.ReserveIdempotencyKey(key, requestFingerprint(body))
+		if err != nil {
+			internalError(w, err, "Could not check Idempotency-Key")
+			return
+		}
+
+		if !created {
+			if record.Fingerprint != requestFingerprint(body) {
+				writeError(w, http.StatusUnprocessableEntity, codeIdempotencyReused, "Idempotency-Key was already used for a different request")
+				return
+			}
+			if record.StatusCode == 0 {
+				writeError(w, http.StatusConflict, codeIdempotencyInUse, "A request with this Idempotency-Key is still being processed")
+				return
+			}
+
+			if record.ContentType != "" {
+				w.Header().Set("Content-Type", record.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			_, _ = w.Write(record.Body)
+			log.Printf("replayed response for idempotency key %s", header)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+		handler(recorder, r)
+		if recorder.statusCode == 0 {
+			recorder.statusCode = http.StatusOK
+		}
+
+		// server errors and rate limiting are not final, so the key can be used again
+		if recorder.statusCode >= http.StatusInternalServerError || recorder.statusCode == http.StatusTooManyRequests {
+			err = app.Db.ReleaseIdempotencyKey(key)
+		} else {
+			err = app.Db.CompleteIdempotencyKey(key, recorder.statusCode, w.Header().Get("Content-Type"), recorder.body.Bytes())
+		}
+		if err != nil {
+			log.Println("[ERROR] " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// the interest rate is yearly, e.g. "0.02" for 2%
+type setAccountProductRequest struct {
+	InterestRate json.Number `json:"interest_rate"`
+}
+
+func (app *App) GetAccountProducts() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		products, err := app.Db.GetAccountProducts()
+		if err != nil {
+			internalError(w, err, "Could not read account products")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(products); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account product data")
+			return
+		}
+
+		log.Printf("read %d account products", len(products))
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
+
+func (app *App) SetAccountProduct() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := app.Policy.Admin(principal(r)); err != nil {
+			dbError(w, err, "Could not set account product")
+			return
+		}
+
+		var request setAccountProductRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode account product data")
+			return
+		}
+
+		product := db.AccountProduct{Name: r.PathValue("product"), InterestRate: request.InterestRate.String()}
+		if err := db.ValidateAccountProduct(product); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid account product: "+err.Error())
+			return
+		}
+
+		product, err := app.Db.SetAccountProduct(product)
+		if err != nil {
+			internalError(w, err, "Could not save account product")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(product); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account product data")
+			return
+		}
+
+		log.Printf("set interest rate of %s accounts to %s", product.Name, product.InterestRate)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "product"), db.ScopeRatesWrite), "ip")
+}
+
+func (app *App) GetAccruedInterest() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Read, accountId); err != nil {
+			dbError(w, err, "Could not read accrued interest")
+			return
+		}
+
+		interest, err := app.Db.GetAccruedInterest(accountId)
+		if err != nil {
+			dbError(w, err, "Could not read accrued interest")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(interest); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode interest data")
+			return
+		}
+
+		log.Printf("read accrued interest of account %d", accountId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
@@ -0,0 +1,64 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+func (app *App) GetPostings() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Read, accountId); err != nil {
+			dbError(w, err, "Could not read postings")
+			return
+		}
+
+		postings, err := app.Db.GetPostings(accountId)
+		if err != nil {
+			dbError(w, err, "Could not read postings")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(postings); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode posting data")
+			return
+		}
+
+		log.Printf("read postings of account %d", accountId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
+
+func (app *App) VerifyLedger() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := app.Policy.Staff(principal(r)); err != nil {
+			dbError(w, err, "Could not verify ledger")
+			return
+		}
+
+		discrepancies, err := app.Db.VerifyLedger()
+		if err != nil {
+			internalError(w, err, "Could not verify ledger")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(discrepancies); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode ledger data")
+			return
+		}
+
+		log.Printf("verified ledger, found %d discrepancies", len(discrepancies))
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
@@ -0,0 +1,62 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// the limit is in the currency of the account
+type setOverdraftLimitRequest struct {
+	Limit json.Number `json:"limit"`
+}
+
+func (app *App) SetOverdraftLimit() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Admin(principal(r)); err != nil {
+			dbError(w, err, "Could not set overdraft limit")
+			return
+		}
+
+		var request setOverdraftLimitRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode overdraft limit data")
+			return
+		}
+
+		account, err := app.Db.GetAccount(accountId)
+		if err != nil {
+			dbError(w, err, "Could not set overdraft limit")
+			return
+		}
+
+		limit, err := db.ParseMoney(request.Limit.String(), account.Balance.Currency)
+		if err != nil {
+			dbError(w, err, "Could not read limit")
+			return
+		}
+
+		account, err = app.Db.SetOverdraftLimit(accountId, limit)
+		if err != nil {
+			dbError(w, err, "Could not set overdraft limit")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("set overdraft limit of account %d to %s", account.ID, account.OverdraftLimit)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "account"), db.ScopeAccountsWrite), "ip")
+}
@@ -0,0 +1,274 @@
+package router
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// maxPaymentFileSize is the largest payment file that is read, in bytes
+const maxPaymentFileSize = 10 << 20
+
+// syncPaymentLines is the most payments a file may hold to be executed while the upload waits;
+// larger files are executed by the background job and their report is polled
+const syncPaymentLines = 100
+
+type painAccount struct {
+	ID   string `xml:"Id>Othr>Id"`
+	IBAN string `xml:"Id>IBAN"`
+}
+
+type painTransfer struct {
+	EndToEndID string `xml:"PmtId>EndToEndId"`
+	Amount     struct {
+		Currency string `xml:"Ccy,attr"`
+		Value    string `xml:",chardata"`
+	} `xml:"Amt>InstdAmt"`
+	CreditorAccount painAccount `xml:"CdtrAcct"`
+}
+
+type painPayment struct {
+	DebtorAccount painAccount    `xml:"DbtrAcct"`
+	Transfers     []painTransfer `xml:"CdtTrfTxInf"`
+}
+
+// painDocument is the part of an ISO 20022 pain.001 customer credit transfer initiation that is used;
+// any version of the message is accepted
+type painDocument struct {
+	NumberOfTransactions string        `xml:"CstmrCdtTrfInitn>GrpHdr>NbOfTxs"`
+	Payments             []painPayment `xml:"CstmrCdtTrfInitn>PmtInf"`
+}
+
+// painAccountID reads an account of this bank, which is identified by its id as other identification
+func painAccountID(account painAccount) (int, error) {
+	if account.ID == "" {
+		if account.IBAN != "" {
+			return 0, fmt.Errorf("IBAN %s is not an account of this bank, accounts are identified by Othr/Id", account.IBAN)
+		}
+		return 0, fmt.Errorf("missing account id")
+	}
+
+	accountId, err := strconv.Atoi(strings.TrimSpace(account.ID))
+	if err != nil {
+		return 0, fmt.Errorf("invalid account id %q", account.ID)
+	}
+	return accountId, nil
+}
+
+// parsePain001 reads the credit transfers of a pain.001 file; lines are numbered in the order of the transfers
+func parsePain001(data []byte) ([]db.PaymentInstruction, error) {
+	var document painDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("could not read pain.001 XML: %s", err)
+	}
+
+	instructions := []db.PaymentInstruction{}
+	for _, payment := range document.Payments {
+		fromAccountId, fromErr := painAccountID(payment.DebtorAccount)
+		for _, transfer := range payment.Transfers {
+			instruction := db.PaymentInstruction{
+				Line:          len(instructions) + 1,
+				Reference:     strings.TrimSpace(transfer.EndToEndID),
+				FromAccountID: fromAccountId,
+				Amount:        strings.TrimSpace(transfer.Amount.Value),
+				Currency:      transfer.Amount.Currency,
+			}
+
+			toAccountId, toErr := painAccountID(transfer.CreditorAccount)
+			instruction.ToAccountID = toAccountId
+			if fromErr != nil {
+				instruction.Error = "debtor account: " + fromErr.Error()
+			} else if toErr != nil {
+				instruction.Error = "creditor account: " + toErr.Error()
+			}
+			instructions = append(instructions, instruction)
+		}
+	}
+
+	if document.NumberOfTransactions != "" && document.NumberOfTransactions != fmt.Sprint(len(instructions)) {
+		return nil, fmt.Errorf("the group header announces %s transactions, but the file holds %d", document.NumberOfTransactions, len(instructions))
+	}
+	return instructions, nil
+}
+
+// parsePaymentCSV reads a CSV file with a header row naming the from_account_id, to_account_id and amount
+// columns, and optionally currency and reference; lines are numbered as in the file, the header being line 1
+func parsePaymentCSV(data []byte) ([]db.PaymentInstruction, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV: %s", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("the file is empty")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"from_account_id", "to_account_id", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the header has no %s column", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	instructions := []db.PaymentInstruction{}
+	for i, record := range records[1:] {
+		instruction := db.PaymentInstruction{
+			Line:      i + 2,
+			Reference: field(record, "reference"),
+			Amount:    field(record, "amount"),
+			Currency:  field(record, "currency"),
+		}
+
+		fromAccountId, fromErr := strconv.Atoi(field(record, "from_account_id"))
+		toAccountId, toErr := strconv.Atoi(field(record, "to_account_id"))
+		instruction.FromAccountID = fromAccountId
+		instruction.ToAccountID = toAccountId
+		if fromErr != nil {
+			instruction.Error = fmt.Sprintf("invalid from_account_id %q", field(record, "from_account_id"))
+		} else if toErr != nil {
+			instruction.Error = fmt.Sprintf("invalid to_account_id %q", field(record, "to_account_id"))
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+// paymentFileFormat tells pain.001 XML and CSV apart by the Content-Type header, or else by the content
+func paymentFileFormat(r *http.Request, data []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/xml", "text/xml":
+		return db.PaymentFileFormatPain001
+	case "text/csv":
+		return db.PaymentFileFormatCSV
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return db.PaymentFileFormatPain001
+	}
+	return db.PaymentFileFormatCSV
+}
+
+// paymentFileError writes the response for errors of the payment file methods of db.DbInterface
+func paymentFileError(w http.ResponseWriter, err error, message string) {
+	invalid, ok := err.(*db.InvalidPaymentFileError)
+	if !ok || invalid.Report.Lines == nil {
+		dbError(w, err, message)
+		return
+	}
+
+	// the details tell which lines have to be fixed, as the file was not stored
+	lines := []db.PaymentLine{}
+	for _, line := range invalid.Report.Lines {
+		if line.Status == db.PaymentLineRejected {
+			lines = append(lines, line)
+		}
+	}
+	writeErrorDetails(w, http.StatusUnprocessableEntity, invalid.Code(), err.Error(), map[string]any{"lines": lines})
+}
+
+func (app *App) CreatePaymentFile() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPaymentFileSize))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, "Could not read payment file")
+			return
+		}
+
+		format := paymentFileFormat(r, data)
+		var instructions []db.PaymentInstruction
+		if format == db.PaymentFileFormatPain001 {
+			instructions, err = parsePain001(data)
+		} else {
+			instructions, err = parsePaymentCSV(data)
+		}
+		if err != nil {
+			dbError(w, &db.InvalidPaymentFileError{Reason: err.Error()}, "Could not read payment file")
+			return
+		}
+
+		if err := app.Policy.PaymentInstructions(principal(r), instructions); err != nil {
+			dbError(w, err, "Could not create payment file")
+			return
+		}
+
+		file, err := app.Db.CreatePaymentFile(format, instructions)
+		if err != nil {
+			paymentFileError(w, err, "Could not create payment file")
+			return
+		}
+		log.Printf("received payment file %d with %d payments", file.ID, len(file.Lines))
+
+		w.Header().Set("Location", fmt.Sprintf("/payment-files/%d", file.ID))
+		status := http.StatusAccepted
+		if len(file.Lines) <= syncPaymentLines {
+			file, err = app.Db.ProcessPaymentFile(file.ID)
+			if err != nil {
+				paymentFileError(w, err, "Could not execute payment file")
+				return
+			}
+			status = http.StatusCreated
+		}
+
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(file); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode payment file data")
+			return
+		}
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "payment_file"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) GetPaymentFile() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		fileId, err := pathId(r, "fileId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid payment file id")
+			return
+		}
+
+		if err := app.Policy.PaymentFile(principal(r), auth.Read, fileId); err != nil {
+			dbError(w, err, "Could not read payment file")
+			return
+		}
+
+		file, err := app.Db.GetPaymentFile(fileId)
+		if err != nil {
+			paymentFileError(w, err, "Could not read payment file")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(file); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode payment file data")
+			return
+		}
+
+		log.Printf("read payment file %d", fileId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
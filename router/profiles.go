@@ -0,0 +1,85 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// only the fields that are given are changed; an empty string clears a field, and an empty address clears the address
+type updateUserRequest struct {
+	Name        *string     `json:"name"`
+	Email       *string     `json:"email"`
+	Phone       *string     `json:"phone"`
+	DateOfBirth *string     `json:"date_of_birth"`
+	Address     *db.Address `json:"address"`
+}
+
+// apply changes the fields of user that are given in the request
+func (request updateUserRequest) apply(user db.User) db.User {
+	if request.Name != nil {
+		user.Name = *request.Name
+	}
+	if request.Email != nil {
+		user.Email = *request.Email
+	}
+	if request.Phone != nil {
+		user.Phone = *request.Phone
+	}
+	if request.DateOfBirth != nil {
+		user.DateOfBirth = *request.DateOfBirth
+	}
+	if request.Address != nil {
+		user.Address = request.Address
+		if *request.Address == (db.Address{}) {
+			user.Address = nil
+		}
+	}
+	return user
+}
+
+func (app *App) UpdateUser() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userId, err := pathId(r, "userId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid user id")
+			return
+		}
+
+		if err := app.Policy.User(principal(r), auth.Write, fmt.Sprint(userId)); err != nil {
+			dbError(w, err, "Could not update user")
+			return
+		}
+
+		var request updateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode user data")
+			return
+		}
+
+		user, err := app.Db.GetUser(fmt.Sprint(userId))
+		if err != nil {
+			dbError(w, err, "Could not update user")
+			return
+		}
+
+		user, err = app.Db.UpdateUser(request.apply(user))
+		if err != nil {
+			dbError(w, err, "Could not update user")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
+			return
+		}
+
+		log.Printf("updated user %d", user.ID)
+	}
+
+	return app.RateLimit(app.RateLimit(app.Authenticate(app.Audited(handler, "user"), db.ScopeUsersWrite), "ip"), "user")
+}
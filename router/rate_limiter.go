@@ -21,25 +21,31 @@ func NewLimiter(rps int, getId func(*http.Request) string) *Limiter {
 	}
 }
 
-func RateLimit(handler http.HandlerFunc, limiter *Limiter) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := limiter.getId(r)
+// bucket returns the tokens of id, filling a new bucket the first time id is seen
+func (limiter *Limiter) bucket(id string) chan struct{} {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
 
-		limiter.mutex.Lock()
-		defer limiter.mutex.Unlock()
+	// check if id has been seen before
+	tokens, ok := limiter.tokens[id]
+	if !ok {
+		tokens = make(chan struct{}, limiter.rps)
+		// fill bucket with tokens
+		for i := 0; i < limiter.rps; i++ {
+			tokens <- struct{}{}
+		}
+		limiter.tokens[id] = tokens
 
-		// check if id has been seen before
-		tokens, ok := limiter.tokens[id]
-		if !ok {
-			tokens = make(chan struct{}, limiter.rps)
-			// fill bucket with tokens
-			for i := 0; i < limiter.rps; i++ {
-				tokens <- struct{}{}
-			}
-			limiter.tokens[id] = tokens
+		go fillTokenBucket(tokens, limiter.rps)
+	}
+	return tokens
+}
 
-			go fillTokenBucket(tokens, limiter.rps)
-		}
+// RateLimit only holds the lock of limiter while it finds the bucket, so slow handlers, like the ones that
+// hash passwords, do not hold up the other requests sharing the limiter
+func RateLimit(handler http.HandlerFunc, limiter *Limiter) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens := limiter.bucket(limiter.getId(r))
 
 		select {
 		// there are tokens in the bucket
@@ -47,7 +53,7 @@ func RateLimit(handler http.HandlerFunc, limiter *Limiter) http.HandlerFunc {
 			handler(w, r)
 		// the bucket is empty
 		default:
-			http.Error(w, "Rate Limit Exceeded", http.StatusTooManyRequests)
+			writeError(w, http.StatusTooManyRequests, codeRateLimited, "Rate Limit Exceeded")
 		}
 	})
 }
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// an empty body, or one without an amount, reverses everything that is left of the transaction
+type reverseTransactionRequest struct {
+	Amount json.Number `json:"amount"`
+}
+
+func (app *App) ReverseTransaction() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		transactionId, err := pathId(r, "transactionId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid transaction id")
+			return
+		}
+
+		if err := app.Policy.Transaction(principal(r), auth.Write, transactionId); err != nil {
+			dbError(w, err, "Could not reverse transaction")
+			return
+		}
+
+		var request reverseTransactionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode reversal data")
+			return
+		}
+
+		var amount *db.Money
+		if request.Amount != "" {
+			original, err := app.Db.GetTransaction(transactionId)
+			if err != nil {
+				dbError(w, err, "Could not reverse transaction")
+				return
+			}
+
+			parsed, err := db.ParseMoney(request.Amount.String(), original.Amount.Currency)
+			if err != nil {
+				dbError(w, err, "Could not read amount")
+				return
+			}
+			amount = &parsed
+		}
+
+		reversal, err := app.Db.ReverseTransaction(transactionId, amount)
+		if err != nil {
+			dbError(w, err, "Could not reverse transaction")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(reversal); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode transaction data")
+			return
+		}
+
+		log.Printf("reversed transaction %d with transaction %d", transactionId, reversal.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "transaction"), db.ScopeTransactionsWrite), "ip")
+}
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+type setUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetUserRole makes a user a customer, support staff or admin; only admins can change roles
+func (app *App) SetUserRole() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userId, err := pathId(r, "userId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid user id")
+			return
+		}
+
+		if err := app.Policy.Admin(principal(r)); err != nil {
+			dbError(w, err, "Could not change role")
+			return
+		}
+
+		var request setUserRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode role")
+			return
+		}
+
+		user, err := app.Db.SetUserRole(userId, request.Role)
+		if err != nil {
+			dbError(w, err, "Could not change role")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
+			return
+		}
+
+		log.Printf("user %d is now %s", user.ID, user.Role)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "user"), db.ScopeUsersWrite), "ip")
+}
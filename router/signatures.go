@@ -0,0 +1,155 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+const (
+	signatureHeader          = "X-Signature"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureNonceHeader     = "X-Signature-Nonce"
+)
+
+const (
+	codeInvalidSignature = "invalid_signature"
+	codeReplayedRequest  = "replayed_request"
+)
+
+// noncePattern is what the nonce of a signed request has to look like; it has to be long enough to be random
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+var errNonceStoreFull = errors.New("nonce store is full")
+
+type usedNonce struct {
+	key     string
+	expires time.Time
+}
+
+// NonceStore remembers the nonces of signed requests for as long as their timestamp could be accepted,
+// so a request cannot be replayed. It holds at most capacity nonces; when it is full, new ones are refused
+// rather than forgetting nonces that could still be replayed
+type NonceStore struct {
+	nonces   map[string]bool
+	order    []usedNonce
+	capacity int
+	ttl      time.Duration
+	mutex    sync.Mutex
+}
+
+func NewNonceStore(capacity int, ttl time.Duration) *NonceStore {
+	return &NonceStore{
+		nonces:   make(map[string]bool),
+		capacity: capacity,
+		ttl:      ttl,
+	}
+}
+
+// Use remembers key until ttl after now and tells whether it was new
+func (store *NonceStore) Use(key string, now time.Time) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// every nonce is kept for the same time, so the oldest ones expire first
+	for len(store.order) > 0 && !now.Before(store.order[0].expires) {
+		delete(store.nonces, store.order[0].key)
+		store.order = store.order[1:]
+	}
+
+	if store.nonces[key] {
+		return false, nil
+	}
+	if len(store.order) >= store.capacity {
+		return false, errNonceStoreFull
+	}
+	store.nonces[key] = true
+	store.order = append(store.order, usedNonce{key: key, expires: now.Add(store.ttl)})
+	return true, nil
+}
+
+// Signed requires the requests of API clients to handler to be signed with the signing secret of the client,
+// with a timestamp of at most auth.SignatureMaxSkew ago and a nonce that was not used before. Users log in
+// themselves and share no secret with the server, so their requests are not signed. It needs the principal,
+// so it goes inside Authenticate
+func (app *App) Signed(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := principal(r)
+		if principal.ClientID == "" {
+			handler(w, r)
+			return
+		}
+
+		signature := r.Header.Get(signatureHeader)
+		timestamp := r.Header.Get(signatureTimestampHeader)
+		nonce := r.Header.Get(signatureNonceHeader)
+		if signature == "" || timestamp == "" || nonce == "" {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, fmt.Sprintf("This request has to be signed, with the %s, %s and %s headers", signatureHeader, signatureTimestampHeader, signatureNonceHeader))
+			return
+		}
+
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, "Invalid "+signatureTimestampHeader+": must be a Unix time in seconds")
+			return
+		}
+		now := time.Now()
+		if skew := now.Sub(time.Unix(seconds, 0)); skew > auth.SignatureMaxSkew || skew < -auth.SignatureMaxSkew {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, fmt.Sprintf("%s is more than %s away from the time of the server", signatureTimestampHeader, auth.SignatureMaxSkew))
+			return
+		}
+		if !noncePattern.MatchString(nonce) {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, "Invalid "+signatureNonceHeader+": must be 16 to 128 letters, digits, _ or -")
+			return
+		}
+
+		client, err := app.Db.GetAPIClient(principal.ClientID)
+		if err != nil {
+			var notFound *db.APIClientNotFoundError
+			if errors.As(err, &notFound) {
+				writeError(w, http.StatusUnauthorized, codeInvalidSignature, "The API client was revoked")
+				return
+			}
+			internalError(w, err, "Could not check signature")
+			return
+		}
+		if client.SigningSecret == "" {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, "The API client has no signing secret, it has to be registered again")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if !auth.CheckSignature(client.SigningSecret, auth.StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body), signature) {
+			writeError(w, http.StatusUnauthorized, codeInvalidSignature, "Invalid signature")
+			return
+		}
+
+		// only signed requests use up a nonce, so no one else can use up the nonces of a client
+		fresh, err := app.Nonces.Use(client.ClientID+" "+nonce, now)
+		if err != nil {
+			writeError(w, http.StatusTooManyRequests, codeRateLimited, "Too many signed requests, try again later")
+			return
+		}
+		if !fresh {
+			writeError(w, http.StatusUnauthorized, codeReplayedRequest, signatureNonceHeader+" was already used")
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+type updateAccountRequest struct {
+	Product string `json:"product"`
+}
+
+func (app *App) DeleteUser() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userId, err := pathId(r, "userId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid user id")
+			return
+		}
+
+		if err := app.Policy.User(principal(r), auth.Write, fmt.Sprint(userId)); err != nil {
+			dbError(w, err, "Could not delete user")
+			return
+		}
+
+		user, err := app.Db.DeleteUser(userId)
+		if err != nil {
+			dbError(w, err, "Could not delete user")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
+			return
+		}
+
+		log.Printf("deleted user %d", user.ID)
+	}
+
+	return app.RateLimit(app.RateLimit(app.Authenticate(app.Audited(handler, "user"), db.ScopeUsersWrite), "ip"), "user")
+}
+
+func (app *App) UpdateAccount() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Write, accountId); err != nil {
+			dbError(w, err, "Could not update account")
+			return
+		}
+
+		var request updateAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode account data")
+			return
+		}
+		if request.Product == "" {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid product: must not be empty")
+			return
+		}
+
+		account, err := app.Db.UpdateAccount(accountId, request.Product)
+		if err != nil {
+			dbError(w, err, "Could not update account")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("updated account %d", account.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "account"), db.ScopeAccountsWrite), "ip")
+}
+
+func (app *App) DeleteAccount() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Write, accountId); err != nil {
+			dbError(w, err, "Could not delete account")
+			return
+		}
+
+		account, err := app.Db.DeleteAccount(accountId)
+		if err != nil {
+			dbError(w, err, "Could not delete account")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(account); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode account data")
+			return
+		}
+
+		log.Printf("deleted account %d", account.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "account"), db.ScopeAccountsWrite), "ip")
+}
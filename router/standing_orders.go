@@ -0,0 +1,290 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// dates are either RFC 3339 timestamps or plain dates, which run at midnight UTC
+type createStandingOrderRequest struct {
+	FromAccountID int         `json:"from_account_id"`
+	ToAccountID   int         `json:"to_account_id"`
+	Amount        json.Number `json:"amount"`
+	Currency      string      `json:"currency"`
+	Frequency     string      `json:"frequency"`
+	StartDate     string      `json:"start_date"`
+	EndDate       string      `json:"end_date"`
+	MaxExecutions *int        `json:"max_executions"`
+}
+
+// fields that are left out keep their current value
+type updateStandingOrderRequest struct {
+	Amount        json.Number `json:"amount"`
+	EndDate       string      `json:"end_date"`
+	MaxExecutions *int        `json:"max_executions"`
+}
+
+func parseDate(value string) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return date, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
+
+func (app *App) CreateStandingOrder() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var request createStandingOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode standing order data")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Write, request.FromAccountID); err != nil {
+			dbError(w, err, "Could not create standing order")
+			return
+		}
+
+		if request.Currency == "" {
+			fromAccount, err := app.Db.GetAccount(request.FromAccountID)
+			if err != nil {
+				dbError(w, err, "Could not create standing order")
+				return
+			}
+			request.Currency = fromAccount.Balance.Currency
+		}
+
+		amount, err := db.ParseMoney(request.Amount.String(), request.Currency)
+		if err != nil {
+			dbError(w, err, "Could not read amount")
+			return
+		}
+
+		order := db.StandingOrder{
+			FromAccountID: request.FromAccountID,
+			ToAccountID:   request.ToAccountID,
+			Amount:        amount,
+			Frequency:     request.Frequency,
+			MaxExecutions: request.MaxExecutions,
+		}
+
+		order.StartDate, err = parseDate(request.StartDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid start_date: "+err.Error())
+			return
+		}
+		if order.StartDate.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid start_date: must not be in the past")
+			return
+		}
+		if request.EndDate != "" {
+			endDate, err := parseDate(request.EndDate)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid end_date: "+err.Error())
+				return
+			}
+			order.EndDate = &endDate
+		}
+
+		order, err = app.Db.CreateStandingOrder(order)
+		if err != nil {
+			dbError(w, err, "Could not create standing order")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(order); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order data")
+			return
+		}
+
+		log.Printf("created new standing order: %d", order.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(app.Idempotent(handler)), "standing_order"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) GetStandingOrder() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := pathId(r, "orderId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid standing order id")
+			return
+		}
+
+		if err := app.Policy.StandingOrder(principal(r), auth.Read, orderId); err != nil {
+			dbError(w, err, "Could not read standing order")
+			return
+		}
+
+		order, err := app.Db.GetStandingOrder(orderId)
+		if err != nil {
+			dbError(w, err, "Could not read standing order data")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(order); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order data")
+			return
+		}
+
+		log.Printf("read standing order %d", order.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
+
+func (app *App) GetStandingOrders() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		userId := r.PathValue("userId")
+
+		if err := app.Policy.User(principal(r), auth.Read, userId); err != nil {
+			dbError(w, err, "Could not read standing order data")
+			return
+		}
+
+		orders, err := app.Db.GetStandingOrders(userId)
+		if err != nil {
+			internalError(w, err, "Could not read standing order data")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(orders); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order data")
+			return
+		}
+
+		log.Printf("read standing orders of user %s", userId)
+	}
+
+	return app.RateLimit(app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip"), "user")
+}
+
+func (app *App) UpdateStandingOrder() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := pathId(r, "orderId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid standing order id")
+			return
+		}
+
+		if err := app.Policy.StandingOrder(principal(r), auth.Write, orderId); err != nil {
+			dbError(w, err, "Could not update standing order")
+			return
+		}
+
+		var request updateStandingOrderRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "Could not decode standing order data")
+			return
+		}
+
+		order, err := app.Db.GetStandingOrder(orderId)
+		if err != nil {
+			dbError(w, err, "Could not update standing order")
+			return
+		}
+
+		if request.Amount != "" {
+			order.Amount, err = db.ParseMoney(request.Amount.String(), order.Amount.Currency)
+			if err != nil {
+				dbError(w, err, "Could not read amount")
+				return
+			}
+		}
+		if request.EndDate != "" {
+			endDate, err := parseDate(request.EndDate)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid end_date: "+err.Error())
+				return
+			}
+			order.EndDate = &endDate
+		}
+		if request.MaxExecutions != nil {
+			order.MaxExecutions = request.MaxExecutions
+		}
+
+		order, err = app.Db.UpdateStandingOrder(order)
+		if err != nil {
+			dbError(w, err, "Could not update standing order")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(order); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order data")
+			return
+		}
+
+		log.Printf("updated standing order %d", order.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(app.Signed(handler), "standing_order"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) CancelStandingOrder() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := pathId(r, "orderId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid standing order id")
+			return
+		}
+
+		if err := app.Policy.StandingOrder(principal(r), auth.Write, orderId); err != nil {
+			dbError(w, err, "Could not cancel standing order")
+			return
+		}
+
+		order, err := app.Db.CancelStandingOrder(orderId)
+		if err != nil {
+			dbError(w, err, "Could not cancel standing order")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(order); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order data")
+			return
+		}
+
+		log.Printf("cancelled standing order %d", order.ID)
+	}
+
+	return app.RateLimit(app.Authenticate(app.Audited(handler, "standing_order"), db.ScopeTransactionsWrite), "ip")
+}
+
+func (app *App) GetStandingOrderExecutions() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		orderId, err := pathId(r, "orderId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid standing order id")
+			return
+		}
+
+		if err := app.Policy.StandingOrder(principal(r), auth.Read, orderId); err != nil {
+			dbError(w, err, "Could not read standing order executions")
+			return
+		}
+
+		executions, err := app.Db.GetStandingOrderExecutions(orderId)
+		if err != nil {
+			dbError(w, err, "Could not read standing order executions")
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(executions); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode standing order executions")
+			return
+		}
+
+		log.Printf("read %d executions of standing order %d", len(executions), orderId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeTransactionsRead), "ip")
+}
@@ -0,0 +1,232 @@
+package router
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+const camtNamespace = "urn:iso:std:iso:20022:tech:xsd:camt.053.001.02"
+
+type camtAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type camtBalance struct {
+	Type        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        string     `xml:"Dt>Dt"`
+}
+
+type camtEntry struct {
+	Reference       string     `xml:"NtryRef"`
+	Amount          camtAmount `xml:"Amt"`
+	CreditDebit     string     `xml:"CdtDbtInd"`
+	Reversal        bool       `xml:"RvslInd,omitempty"`
+	Status          string     `xml:"Sts"`
+	BookingDate     string     `xml:"BookgDt>DtTm"`
+	ValueDate       string     `xml:"ValDt>Dt"`
+	ServicerRef     string     `xml:"AcctSvcrRef"`
+	TransactionCode string     `xml:"BkTxCd>Prtry>Cd"`
+	Information     string     `xml:"AddtlNtryInf"`
+}
+
+type camtStatement struct {
+	ID        string        `xml:"Id"`
+	Created   string        `xml:"CreDtTm"`
+	From      string        `xml:"FrToDt>FrDtTm"`
+	To        string        `xml:"FrToDt>ToDtTm"`
+	AccountID string        `xml:"Acct>Id>Othr>Id"`
+	Currency  string        `xml:"Acct>Ccy"`
+	Balances  []camtBalance `xml:"Bal"`
+	Entries   []camtEntry   `xml:"Ntry"`
+}
+
+type camtDocument struct {
+	XMLName   xml.Name      `xml:"Document"`
+	Namespace string        `xml:"xmlns,attr"`
+	MessageID string        `xml:"BkToCstmrStmt>GrpHdr>MsgId"`
+	Created   string        `xml:"BkToCstmrStmt>GrpHdr>CreDtTm"`
+	Statement camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+// creditDebit splits an amount into its absolute value and whether it is a credit, as statement formats
+// write amounts without sign
+func creditDebit(amount db.Money) (db.Money, bool) {
+	if amount.IsNegative() {
+		return db.NewMoney(-amount.Amount, amount.Currency), false
+	}
+	return amount, true
+}
+
+func camtCreditDebit(credit bool) string {
+	if credit {
+		return "CRDT"
+	}
+	return "DBIT"
+}
+
+func camtDateTime(date time.Time) string {
+	return date.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func newCamtBalance(balanceType string, balance db.Money, date time.Time) camtBalance {
+	amount, credit := creditDebit(balance)
+	return camtBalance{
+		Type:        balanceType,
+		Amount:      camtAmount{Currency: amount.Currency, Value: amount.Decimal()},
+		CreditDebit: camtCreditDebit(credit),
+		Date:        date.UTC().Format(time.DateOnly),
+	}
+}
+
+// writeStatementCamt053 writes an ISO 20022 camt.053.001.02 bank to customer statement, with the opening (OPBD)
+// and closing (CLBD) booked balances and one booked entry per transaction
+func writeStatementCamt053(w io.Writer, statement db.Statement, now time.Time) error {
+	document := camtDocument{
+		Namespace: camtNamespace,
+		MessageID: "STMT-" + statement.Reference(),
+		Created:   camtDateTime(now),
+		Statement: camtStatement{
+			ID:        statement.Reference(),
+			Created:   camtDateTime(now),
+			From:      camtDateTime(statement.From),
+			To:        camtDateTime(statement.To),
+			AccountID: fmt.Sprint(statement.AccountID),
+			Currency:  statement.Currency,
+			Balances: []camtBalance{
+				newCamtBalance("OPBD", statement.OpeningBalance, statement.From),
+				newCamtBalance("CLBD", statement.ClosingBalance, lastDay(statement)),
+			},
+		},
+	}
+
+	for _, transaction := range statement.Transactions {
+		amount, credit := creditDebit(transaction.BalanceChange())
+		document.Statement.Entries = append(document.Statement.Entries, camtEntry{
+			Reference:       fmt.Sprint(transaction.ID),
+			Amount:          camtAmount{Currency: amount.Currency, Value: amount.Decimal()},
+			CreditDebit:     camtCreditDebit(credit),
+			Reversal:        transaction.ReversalOf != nil,
+			Status:          "BOOK",
+			BookingDate:     camtDateTime(transaction.Timestamp),
+			ValueDate:       transaction.Timestamp.UTC().Format(time.DateOnly),
+			ServicerRef:     fmt.Sprint(transaction.ID),
+			TransactionCode: "TRANSFER",
+			Information:     statementDescription(transaction),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// swiftAmount writes an amount without sign and with a decimal comma, which MT940 always requires, e.g. "1600,"
+func swiftAmount(amount db.Money) string {
+	decimal := strings.Replace(amount.Decimal(), ".", ",", 1)
+	if !strings.Contains(decimal, ",") {
+		decimal += ","
+	}
+	return decimal
+}
+
+// swiftTransliterations spell letters outside the SWIFT character set with the letters they are based on
+var swiftTransliterations = func() map[rune]string {
+	letters := map[string]string{
+		"a": "àáâãäåāăą", "A": "ÀÁÂÃÄÅĀĂĄ", "c": "çćč", "C": "ÇĆČ", "d": "ďđ", "D": "ĎĐ",
+		"e": "èéêëēėęě", "E": "ÈÉÊËĒĖĘĚ", "g": "ğ", "G": "Ğ", "i": "ìíîïīįı", "I": "ÌÍÎÏĪĮİ",
+		"l": "ĺľł", "L": "ĹĽŁ", "n": "ñńňņ", "N": "ÑŃŇŅ", "o": "òóôõöøōő", "O": "ÒÓÔÕÖØŌŐ",
+		"r": "ŕř", "R": "ŔŘ", "s": "śšşș", "S": "ŚŠŞȘ", "t": "ťţț", "T": "ŤŢȚ",
+		"u": "ùúûüūůűų", "U": "ÙÚÛÜŪŮŰŲ", "y": "ýÿ", "Y": "ÝŸ", "z": "źżž", "Z": "ŹŻŽ",
+		"ss": "ß", "ae": "æ", "AE": "Æ", "oe": "œ", "OE": "Œ",
+	}
+	transliterations := map[rune]string{}
+	for spelling, runes := range letters {
+		for _, r := range runes {
+			transliterations[r] = spelling
+		}
+	}
+	return transliterations
+}()
+
+// swiftText fits a field into the SWIFT X character set, transliterating letters it lacks and replacing any other
+// character with a '.', and cuts it down to length characters, the most MT940 allows for it
+func swiftText(text string, length int) string {
+	var builder strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("/-?:().,'+ ", r):
+			builder.WriteRune(r)
+		case swiftTransliterations[r] != "":
+			builder.WriteString(swiftTransliterations[r])
+		default:
+			builder.WriteRune('.')
+		}
+	}
+
+	runes := []rune(builder.String())
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return string(runes)
+}
+
+func mt940Balance(tag string, balance db.Money, date time.Time) string {
+	amount, credit := creditDebit(balance)
+	mark := "D"
+	if credit {
+		mark = "C"
+	}
+	return fmt.Sprintf(":%s:%s%s%s%s", tag, mark, date.UTC().Format("060102"), amount.Currency, swiftAmount(amount))
+}
+
+// writeStatementMT940 writes a SWIFT MT940 customer statement: the opening (60F) and closing (62F) booked balances
+// around one statement line (61) per transaction, with its description (86); the transaction id is the bank reference
+func writeStatementMT940(w io.Writer, statement db.Statement) error {
+	lines := []string{
+		":20:" + swiftText(statement.Reference(), 16),
+		":25:" + swiftText(fmt.Sprint(statement.AccountID), 35),
+		":28C:1",
+		mt940Balance("60F", statement.OpeningBalance, statement.From),
+	}
+
+	for _, transaction := range statement.Transactions {
+		amount, credit := creditDebit(transaction.BalanceChange())
+		mark := "D"
+		if credit {
+			mark = "C"
+		}
+		// a reversal that credits the account reverses a debit (RD), one that debits it reverses a credit (RC)
+		if transaction.ReversalOf != nil {
+			mark = "RC"
+			if credit {
+				mark = "RD"
+			}
+		}
+
+		date := transaction.Timestamp.UTC()
+		lines = append(lines,
+			fmt.Sprintf(":61:%s%s%s%sNTRFNONREF//%s", date.Format("060102"), date.Format("0102"), mark, swiftAmount(amount), swiftText(fmt.Sprint(transaction.ID), 16)),
+			":86:"+swiftText(statementDescription(transaction), 65),
+		)
+	}
+
+	lines = append(lines, mt940Balance("62F", statement.ClosingBalance, lastDay(statement)), "-")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
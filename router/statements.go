@@ -0,0 +1,311 @@
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// statementTypes maps the statement formats to their content types
+var statementTypes = map[string]string{
+	"json": "application/json",
+	"csv":  "text/csv; charset=utf-8",
+	"ofx":  "application/x-ofx",
+	"qif":  "application/qif",
+	// camt.053 and MT940 are only used for statements of corporate accounts, and usually asked for by format
+	"camt053": "application/xml",
+	"mt940":   "text/plain; charset=utf-8",
+}
+
+// statementExtensions are the file extensions of the statement formats
+var statementExtensions = map[string]string{
+	"csv":     "csv",
+	"ofx":     "ofx",
+	"qif":     "qif",
+	"camt053": "xml",
+	"mt940":   "sta",
+}
+
+// acceptedStatementTypes maps the media types of the Accept header to statement formats
+var acceptedStatementTypes = map[string]string{
+	"*/*":               "json",
+	"application/*":     "json",
+	"application/json":  "json",
+	"text/csv":          "csv",
+	"application/x-ofx": "ofx",
+	"application/ofx":   "ofx",
+	"application/qif":   "qif",
+	"application/x-qif": "qif",
+	"application/xml":   "camt053",
+}
+
+// statementFormat picks the format of a statement from the format parameter or else the Accept header,
+// using the first media type that is supported; it returns false when none is
+func statementFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		_, ok := statementTypes[format]
+		return format, ok
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return "json", true
+	}
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		if format, ok := acceptedStatementTypes[strings.TrimSpace(mediaType)]; ok {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// statementPeriod reads the from (inclusive) and to (exclusive) parameters; without them, the statement
+// covers the current month up to now
+func statementPeriod(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+
+	if value := r.URL.Query().Get("from"); value != "" {
+		date, err := parseDate(value)
+		if err != nil {
+			return from, to, err
+		}
+		from = date
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		date, err := parseDate(value)
+		if err != nil {
+			return from, to, err
+		}
+		to = date
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+func statementDescription(transaction db.AccountTransaction) string {
+	if transaction.ReversalOf != nil {
+		return fmt.Sprintf("reversal of transaction %d", *transaction.ReversalOf)
+	}
+	if transaction.Direction == db.DirectionIncoming {
+		return fmt.Sprintf("transfer from account %d", transaction.FromAccountID)
+	}
+	return fmt.Sprintf("transfer to account %d", transaction.ToAccountID)
+}
+
+// lastDay is the last day of a statement, as its end is exclusive
+func lastDay(statement db.Statement) time.Time {
+	return statement.To.Add(-time.Nanosecond).UTC()
+}
+
+// writeStatementCSV writes one row per transaction, between rows for the opening and the closing balance
+func writeStatementCSV(w io.Writer, statement db.Statement) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{
+		{"date", "transaction_id", "description", "counterparty_account_id", "amount", "currency", "balance"},
+		{statement.From.UTC().Format(time.DateOnly), "", "opening balance", "", "", statement.Currency, statement.OpeningBalance.Decimal()},
+	}
+	for _, transaction := range statement.Transactions {
+		rows = append(rows, []string{
+			transaction.Timestamp.UTC().Format(time.DateOnly),
+			fmt.Sprint(transaction.ID),
+			statementDescription(transaction),
+			fmt.Sprint(transaction.CounterpartyID()),
+			transaction.BalanceChange().Decimal(),
+			statement.Currency,
+			transaction.RunningBalance.Decimal(),
+		})
+	}
+	rows = append(rows, []string{lastDay(statement).Format(time.DateOnly), "", "closing balance", "", "", statement.Currency, statement.ClosingBalance.Decimal()})
+
+	return writer.WriteAll(rows)
+}
+
+// ofxBankID identifies this bank in OFX documents
+const ofxBankID = "BANKAPI"
+
+const ofxHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+`
+
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	ID     string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+}
+
+type ofxStatementResponse struct {
+	TransactionUID string           `xml:"TRNUID"`
+	Status         ofxStatus        `xml:"STATUS"`
+	Currency       string           `xml:"STMTRS>CURDEF"`
+	BankID         string           `xml:"STMTRS>BANKACCTFROM>BANKID"`
+	AccountID      string           `xml:"STMTRS>BANKACCTFROM>ACCTID"`
+	AccountType    string           `xml:"STMTRS>BANKACCTFROM>ACCTTYPE"`
+	Start          string           `xml:"STMTRS>BANKTRANLIST>DTSTART"`
+	End            string           `xml:"STMTRS>BANKTRANLIST>DTEND"`
+	Transactions   []ofxTransaction `xml:"STMTRS>BANKTRANLIST>STMTTRN"`
+	LedgerBalance  string           `xml:"STMTRS>LEDGERBAL>BALAMT"`
+	LedgerDate     string           `xml:"STMTRS>LEDGERBAL>DTASOF"`
+}
+
+type ofxDocument struct {
+	XMLName    xml.Name             `xml:"OFX"`
+	Status     ofxStatus            `xml:"SIGNONMSGSRSV1>SONRS>STATUS"`
+	ServerDate string               `xml:"SIGNONMSGSRSV1>SONRS>DTSERVER"`
+	Language   string               `xml:"SIGNONMSGSRSV1>SONRS>LANGUAGE"`
+	Statement  ofxStatementResponse `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+func ofxDate(date time.Time) string {
+	return date.UTC().Format("20060102150405") + "[0:GMT]"
+}
+
+// writeStatementOFX writes an OFX 2.2 bank statement; OFX has no opening balance, only the closing ledger balance
+func writeStatementOFX(w io.Writer, statement db.Statement, now time.Time) error {
+	accountType := "CHECKING"
+	if statement.Product == "savings" {
+		accountType = "SAVINGS"
+	}
+
+	document := ofxDocument{
+		Status:     ofxStatus{Code: 0, Severity: "INFO"},
+		ServerDate: ofxDate(now),
+		Language:   "ENG",
+		Statement: ofxStatementResponse{
+			TransactionUID: statement.Reference(),
+			Status:         ofxStatus{Code: 0, Severity: "INFO"},
+			Currency:       statement.Currency,
+			BankID:         ofxBankID,
+			AccountID:      fmt.Sprint(statement.AccountID),
+			AccountType:    accountType,
+			Start:          ofxDate(statement.From),
+			End:            ofxDate(statement.To),
+			Transactions:   []ofxTransaction{},
+			LedgerBalance:  statement.ClosingBalance.Decimal(),
+			LedgerDate:     ofxDate(statement.To),
+		},
+	}
+	for _, transaction := range statement.Transactions {
+		transactionType := "CREDIT"
+		if transaction.Direction == db.DirectionOutgoing {
+			transactionType = "DEBIT"
+		}
+		document.Statement.Transactions = append(document.Statement.Transactions, ofxTransaction{
+			Type:   transactionType,
+			Posted: ofxDate(transaction.Timestamp),
+			Amount: transaction.BalanceChange().Decimal(),
+			ID:     fmt.Sprint(transaction.ID),
+			Name:   statementDescription(transaction),
+		})
+	}
+
+	if _, err := io.WriteString(w, ofxHeader); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writeStatementQIF writes a QIF bank register; QIF has no balances, only transactions
+func writeStatementQIF(w io.Writer, statement db.Statement) error {
+	var qif strings.Builder
+	qif.WriteString("!Type:Bank\n")
+	for _, transaction := range statement.Transactions {
+		fmt.Fprintf(&qif, "D%s\nT%s\nN%d\nP%s\n^\n",
+			transaction.Timestamp.UTC().Format("01/02/2006"), transaction.BalanceChange().Decimal(), transaction.ID, statementDescription(transaction))
+	}
+
+	_, err := io.WriteString(w, qif.String())
+	return err
+}
+
+func (app *App) GetStatement() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		accountId, err := pathId(r, "accountId")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "Invalid account id")
+			return
+		}
+
+		if err := app.Policy.Account(principal(r), auth.Read, accountId); err != nil {
+			dbError(w, err, "Could not create statement")
+			return
+		}
+
+		format, ok := statementFormat(r)
+		if !ok {
+			if format != "" {
+				writeError(w, http.StatusBadRequest, codeInvalidParameter, fmt.Sprintf("Unknown statement format %q", format))
+			} else {
+				writeError(w, http.StatusNotAcceptable, codeNotAcceptable, "Statements are available as JSON, CSV, OFX, QIF, camt.053 or MT940")
+			}
+			return
+		}
+
+		from, to, err := statementPeriod(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidParameter, "Invalid period: "+err.Error())
+			return
+		}
+
+		statement, err := app.Db.GetStatement(accountId, from, to)
+		if err != nil {
+			dbError(w, err, "Could not create statement")
+			return
+		}
+
+		w.Header().Set("Content-Type", statementTypes[format])
+		if format != "json" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.%s"`, statement.Reference(), statementExtensions[format]))
+		}
+
+		switch format {
+		case "csv":
+			err = writeStatementCSV(w, statement)
+		case "ofx":
+			err = writeStatementOFX(w, statement, time.Now())
+		case "qif":
+			err = writeStatementQIF(w, statement)
+		case "camt053":
+			err = writeStatementCamt053(w, statement, time.Now())
+		case "mt940":
+			err = writeStatementMT940(w, statement)
+		default:
+			err = json.NewEncoder(w).Encode(statement)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode statement")
+			return
+		}
+
+		log.Printf("created %s statement of account %d", format, accountId)
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeAccountsRead), "ip")
+}
@@ -0,0 +1,74 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// parseTransactionFilter reads the query parameters of the transaction history endpoints
+func parseTransactionFilter(r *http.Request) (db.TransactionFilter, error) {
+	query := r.URL.Query()
+	filter := db.TransactionFilter{
+		MinAmount: query.Get("min_amount"),
+		MaxAmount: query.Get("max_amount"),
+		Sort:      query.Get("sort"),
+		Cursor:    query.Get("cursor"),
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, err := parseDate(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: err.Error()}
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := parseDate(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: err.Error()}
+		}
+		filter.To = &to
+	}
+
+	if value := query.Get("counterparty"); value != "" {
+		accountId, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid counterparty account id %q", value)}
+		}
+		filter.Counterparty = &accountId
+	}
+
+	if value := query.Get("succeeded"); value != "" {
+		succeeded, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid succeeded value %q", value)}
+		}
+		filter.Succeeded = &succeeded
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid limit %q", value)}
+		}
+		filter.Limit = limit
+	}
+
+	return db.ValidateTransactionFilter(filter)
+}
+
+// setNextLink points the Link header to the next page, keeping every other query parameter
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.String()))
+}
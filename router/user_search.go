@@ -0,0 +1,70 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// parseUserFilter reads the query parameters of the user search endpoint
+func parseUserFilter(r *http.Request) (db.UserFilter, error) {
+	query := r.URL.Query()
+	filter := db.UserFilter{
+		Name:   query.Get("name"),
+		Email:  query.Get("email"),
+		Cursor: query.Get("cursor"),
+	}
+
+	if value := query.Get("account_id"); value != "" {
+		accountId, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid account id %q", value)}
+		}
+		filter.AccountID = &accountId
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, &db.InvalidFilterError{Reason: fmt.Sprintf("invalid limit %q", value)}
+		}
+		filter.Limit = limit
+	}
+
+	return db.ValidateUserFilter(filter)
+}
+
+func (app *App) SearchUsers() http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if err := app.Policy.Staff(principal(r)); err != nil {
+			dbError(w, err, "Could not search users")
+			return
+		}
+
+		filter, err := parseUserFilter(r)
+		if err != nil {
+			dbError(w, err, "Could not read filter")
+			return
+		}
+
+		page, err := app.Db.SearchUsers(filter)
+		if err != nil {
+			dbError(w, err, "Could not search users")
+			return
+		}
+
+		setNextLink(w, r, page.Next)
+		if err := json.NewEncoder(w).Encode(page.Users); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "Could not encode user data")
+			return
+		}
+
+		log.Printf("found %d users", len(page.Users))
+	}
+
+	return app.RateLimit(app.Authenticate(handler, db.ScopeUsersRead), "ip")
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// auditTargets collects the entities a change of a job affected, each once, in the kind:id form of
+// the audit log
+type auditTargets []string
+
+func (targets *auditTargets) add(kind string, id int) {
+	target := fmt.Sprintf("%s:%d", kind, id)
+	for _, existing := range *targets {
+		if existing == target {
+			return
+		}
+	}
+	*targets = append(*targets, target)
+}
+
+// audit records a change that job made in the audit log, with entity as its value after the change. Jobs
+// are not requests, so the bank is their actor and the name of the job is their route
+func audit(database db.DbInterface, job string, now time.Time, entity any, outcome string, targets auditTargets) error {
+	after, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+
+	actor := db.SystemUserID
+	_, err = database.CreateAuditEvent(db.AuditEvent{
+		Timestamp:   now.UTC(),
+		ActorUserID: &actor,
+		Route:       "SCHEDULER " + job,
+		Targets:     targets,
+		After:       after,
+		Outcome:     outcome,
+	})
+	if err != nil {
+		return fmt.Errorf("could not write audit event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// ExpireHolds releases holds that were neither captured nor voided before they expired
+func ExpireHolds(database db.DbInterface) Job {
+	return func(now time.Time) error {
+		expired, err := database.ExpireHolds(now)
+		if err != nil {
+			return err
+		}
+
+		for _, hold := range expired {
+			targets := auditTargets{}
+			targets.add("hold", hold.ID)
+			targets.add("account", hold.FromAccountID)
+			targets.add("account", hold.ToAccountID)
+			if err := audit(database, "hold expiry", now, hold, db.AuditSucceeded, targets); err != nil {
+				return err
+			}
+		}
+
+		if len(expired) > 0 {
+			log.Printf("expired %d holds", len(expired))
+		}
+		return nil
+	}
+}
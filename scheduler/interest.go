@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// Interest accrues the interest of every day that ended, and pays out what accrued in past months
+func Interest(database db.DbInterface) Job {
+	return func(now time.Time) error {
+		now = now.UTC()
+		yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+
+		accrued, err := database.AccrueInterest(yesterday)
+		if err != nil {
+			return err
+		}
+		if accrued > 0 {
+			log.Printf("accrued interest %d times", accrued)
+		}
+
+		transactions, err := database.PostInterest(now)
+		if err != nil {
+			return err
+		}
+		for _, transaction := range transactions {
+			log.Printf("paid interest to account %d: transaction %d", transaction.ToAccountID, transaction.ID)
+
+			targets := auditTargets{}
+			targets.add("transaction", transaction.ID)
+			targets.add("account", transaction.FromAccountID)
+			targets.add("account", transaction.ToAccountID)
+			if err := audit(database, "interest", now, transaction, db.AuditSucceeded, targets); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
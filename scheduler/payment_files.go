@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// PaymentFiles executes the payments of the files that were too large to be executed when they were received
+func PaymentFiles(database db.DbInterface) Job {
+	return func(now time.Time) error {
+		fileIds, err := database.GetPendingPaymentFiles()
+		if err != nil {
+			return err
+		}
+
+		for _, fileId := range fileIds {
+			file, err := database.ProcessPaymentFile(fileId)
+			if err != nil {
+				return err
+			}
+			log.Printf("executed payment file %d: %d succeeded, %d failed", file.ID, file.Succeeded, file.Failed)
+
+			targets := auditTargets{}
+			targets.add("payment_file", file.ID)
+			for _, line := range file.Lines {
+				if line.TransactionID != nil {
+					targets.add("transaction", *line.TransactionID)
+					targets.add("account", line.FromAccountID)
+					targets.add("account", line.ToAccountID)
+				}
+			}
+			if err := audit(database, "payment files", now, file, db.AuditSucceeded, targets); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+)
+
+// Job is one kind of background work, run with the time of the tick
+type Job func(now time.Time) error
+
+type namedJob struct {
+	name string
+	run  Job
+}
+
+// Scheduler runs its jobs one after the other on every tick, inside the server process
+type Scheduler struct {
+	interval time.Duration
+	jobs     []namedJob
+}
+
+func New(interval time.Duration) *Scheduler {
+	return &Scheduler{interval: interval}
+}
+
+func (scheduler *Scheduler) Add(name string, run Job) {
+	scheduler.jobs = append(scheduler.jobs, namedJob{name: name, run: run})
+}
+
+// RunOnce runs every job once; a failing job is logged and does not stop the others
+func (scheduler *Scheduler) RunOnce(now time.Time) {
+	for _, job := range scheduler.jobs {
+		if err := job.run(now); err != nil {
+			log.Printf("[ERROR] %s: %s", job.name, err.Error())
+		}
+	}
+}
+
+// Start runs the jobs right away and then on every tick, until stop is called
+func (scheduler *Scheduler) Start() (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(scheduler.interval)
+
+	go func() {
+		defer ticker.Stop()
+		scheduler.RunOnce(time.Now())
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				scheduler.RunOnce(now)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
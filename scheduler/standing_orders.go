@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"log"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+// StandingOrders makes every run that is due, so runs missed while the server was down are caught up in order
+func StandingOrders(database db.DbInterface) Job {
+	return func(now time.Time) error {
+		for {
+			orders, err := database.GetDueStandingOrders(now)
+			if err != nil {
+				return err
+			}
+			if len(orders) == 0 {
+				return nil
+			}
+
+			for _, order := range orders {
+				execution, err := database.RunStandingOrder(order.ID, now)
+				if err != nil {
+					return err
+				}
+
+				outcome := db.AuditSucceeded
+				if execution.Succeeded == 1 {
+					log.Printf("ran standing order %d: transaction %d", order.ID, *execution.TransactionID)
+				} else {
+					log.Printf("standing order %d failed: %s", order.ID, execution.Error)
+					outcome = db.AuditFailed
+				}
+
+				targets := auditTargets{}
+				targets.add("standing_order", order.ID)
+				if execution.TransactionID != nil {
+					targets.add("transaction", *execution.TransactionID)
+				}
+				targets.add("account", order.FromAccountID)
+				targets.add("account", order.ToAccountID)
+				if err := audit(database, "standing orders", now, execution, outcome, targets); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestFreezeAccount(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.FreezeAccount(), 0, "POST", "/accounts/2/freeze", "", "accountId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"frozen"}`)
+
+	rr = requestAs(app.FreezeAccount(), 0, "POST", "/accounts/2/freeze", "", "accountId", "2")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is frozen: cannot become frozen`)
+
+	// frozen accounts can receive money, but not send any
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 10}`)
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is frozen: cannot send money`)
+
+	rr = transactionRequest(&app, `{"from_account_id": 3, "to_account_id": 2, "amount": 10}`)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":3,"to_account_id":2,"amount":10,"currency":"EUR","to_amount":10,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 2, "to_account_id": 3, "amount": 10}`)
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is frozen: cannot send money`)
+
+	rr = requestAs(app.CloseAccount(), 0, "POST", "/accounts/2/close", `{"sweep_to_account_id": 3}`, "accountId", "2")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is frozen: only active accounts can be closed`)
+
+	rr = requestAs(app.UnfreezeAccount(), 0, "POST", "/accounts/2/unfreeze", "", "accountId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":210,"available_balance":210,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 10}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"from_account_id":2,"to_account_id":3,"amount":10,"currency":"EUR","to_amount":10,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+}
+
+func TestCloseAccount(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 2, "to_account_id": 0, "amount": 10, "frequency": "daily", "start_date": "2031-01-01"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = requestAs(app.CloseAccount(), 0, "POST", "/accounts/2/close", "", "accountId", "2")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is active: an account to sweep the balance to is required`)
+
+	rr = requestAs(app.CloseAccount(), 0, "POST", "/accounts/2/close", `{"sweep_to_account_id": 2}`, "accountId", "2")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is active: cannot sweep the balance into the account itself`)
+
+	rr = requestAs(app.CloseAccount(), 0, "POST", "/accounts/2/close", `{"sweep_to_account_id": 3}`, "accountId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"closed"}`)
+
+	rr = accountsOf(&app, "2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"closed"},{"id":3,"user_id":2,"balance":500,"available_balance":500,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+
+	// standing orders of the account are cancelled, and it cannot be used anymore
+	rr = requestAs(app.GetStandingOrder(), 0, "GET", "/standing-orders/0", "", "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":2,"to_account_id":0,"amount":10,"currency":"EUR","frequency":"daily","start_date":"2031-01-01T00:00:00Z","end_date":null,"max_executions":null,"executions":0,"next_run":null,"status":"cancelled"}`)
+
+	rr = transactionRequest(&app, `{"from_account_id": 3, "to_account_id": 2, "amount": 10}`)
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is closed: cannot receive money`)
+
+	rr = reverseRequest(&app, "3", ``)
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is closed: cannot receive money`)
+
+	rr = requestAs(app.UnfreezeAccount(), 0, "POST", "/accounts/2/unfreeze", "", "accountId", "2")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 2 is closed: cannot become active`)
+
+	// an account with active holds keeps them until they are captured or voided
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 3, "to_account_id": 0, "amount": 10}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = requestAs(app.CloseAccount(), 0, "POST", "/accounts/3/close", `{"sweep_to_account_id": 0}`, "accountId", "3")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 3 is active: cannot be closed with 1 active holds`)
+}
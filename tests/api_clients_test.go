@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type registeredClient struct {
+	ClientID      string   `json:"client_id"`
+	Scopes        []string `json:"scopes"`
+	APIKey        string   `json:"api_key"`
+	SigningSecret string   `json:"signing_secret"`
+}
+
+// registerClient registers an API client of the user with userId
+func registerClient(t *testing.T, app *router.App, userId int, body string) registeredClient {
+	t.Helper()
+	rr := requestAs(app.CreateAPIClient(), userId, "POST", "/clients", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("could not register API client: %s", rr.Body.String())
+	}
+	var client registeredClient
+	if err := json.Unmarshal(rr.Body.Bytes(), &client); err != nil {
+		t.Fatalf("could not decode API client: %s", rr.Body.String())
+	}
+	return client
+}
+
+// clientRequest calls handler with the header of an API client; name and id are a path value, if name is not empty
+func clientRequest(handler http.HandlerFunc, header string, value string, method string, name string, id string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/"+name+"/"+id, strings.NewReader(body))
+	if name != "" {
+		req.SetPathValue(name, id)
+	}
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set(header, value)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// tokenRequest asks the token endpoint for an access token, with HTTP Basic authentication if clientId is not empty
+func tokenRequest(handler http.HandlerFunc, clientId string, secret string, form url.Values) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "127.0.0.1:8080"
+	if clientId != "" {
+		req.SetBasicAuth(clientId, secret)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateAPIClient(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	client := registerClient(t, &app, 1, `{"name": "payroll", "scopes": ["accounts:read", "transactions:write"]}`)
+	if !strings.HasPrefix(client.ClientID, "client_") || !strings.HasPrefix(client.APIKey, "bk_") || client.SigningSecret == "" {
+		t.Errorf("unexpected credentials: %+v", client)
+	}
+
+	// the API key is only shown once
+	rr := requestAs(app.GetAPIClients(), 1, "GET", "/user/1/clients", "", "userId", "1")
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"client_id":"`+client.ClientID+`","user_id":1,"name":"payroll","scopes":["accounts:read","transactions:write"],"created_at":"2030-10-07T12:44:22+05:30"}]`)
+	rr = requestAs(app.GetAPIClients(), 1, "GET", "/user/2/clients", "", "userId", "2")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access user 2")
+
+	rr = requestAs(app.CreateAPIClient(), 1, "POST", "/clients", `{"name": "payroll", "scopes": ["accounts:delete"]}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_api_client", `invalid scopes: unknown scope "accounts:delete"`)
+	rr = requestAs(app.CreateAPIClient(), 1, "POST", "/clients", `{"name": " ", "scopes": ["accounts:read"]}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_api_client", "invalid name: must not be empty")
+	rr = requestAs(app.CreateAPIClient(), 1, "POST", "/clients", `{"name": "payroll", "scopes": []}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_api_client", "invalid scopes: must not be empty")
+
+	// clients cannot register clients with more scopes than they have
+	rr = clientRequest(app.CreateAPIClient(), "X-API-Key", client.APIKey, "POST", "", "", `{"name": "more", "scopes": ["users:write"]}`)
+	testError(t, rr, http.StatusForbidden, "insufficient_scope", "The API client needs the scope users:write")
+}
+
+func TestAPIKey(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+	client := registerClient(t, &app, 1, `{"name": "reporting", "scopes": ["accounts:read"]}`)
+
+	rr := clientRequest(app.GetAccount(), "X-API-Key", client.APIKey, "GET", "accountId", "1", "")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"user_id":1,"balance":900,"available_balance":900,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+
+	// a client may do what its user may do, within its scopes
+	rr = clientRequest(app.GetAccount(), "X-API-Key", client.APIKey, "GET", "accountId", "0", "")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access account 0")
+	rr = clientRequest(app.CreateTransaction(), "X-API-Key", client.APIKey, "POST", "", "", `{"from_account_id": 1, "to_account_id": 0, "amount": 10}`)
+	testError(t, rr, http.StatusForbidden, "insufficient_scope", "The API client needs the scope transactions:write")
+	if header := rr.Header().Get("WWW-Authenticate"); !strings.Contains(header, `scope="transactions:write"`) {
+		t.Errorf("unexpected WWW-Authenticate header: %s", header)
+	}
+
+	rr = clientRequest(app.GetAccount(), "X-API-Key", "bk_unknown", "GET", "accountId", "1", "")
+	testError(t, rr, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+
+	rr = requestAs(app.RevokeAPIClient(), 2, "DELETE", "/clients/"+client.ClientID, "", "clientId", client.ClientID)
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 2 cannot access user 1")
+	rr = requestAs(app.RevokeAPIClient(), 1, "DELETE", "/clients/"+client.ClientID, "", "clientId", client.ClientID)
+	if rr.Code != http.StatusOK {
+		t.Errorf("could not revoke API client: %s", rr.Body.String())
+	}
+	rr = clientRequest(app.GetAccount(), "X-API-Key", client.APIKey, "GET", "accountId", "1", "")
+	testError(t, rr, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+	rr = requestAs(app.RevokeAPIClient(), 1, "DELETE", "/clients/"+client.ClientID, "", "clientId", client.ClientID)
+	testError(t, rr, http.StatusNotFound, "api_client_not_found", "API client "+client.ClientID+" does not exist")
+}
+
+func TestRatesScope(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// a payments client of an admin cannot change rates, which needs a scope of its own
+	payments := registerClient(t, &app, 0, `{"name": "payments", "scopes": ["accounts:write", "transactions:write"]}`)
+	rr := clientRequest(app.SetExchangeRate(), "X-API-Key", payments.APIKey, "PUT", "", "", `{"rate": "1.0842"}`)
+	testError(t, rr, http.StatusForbidden, "insufficient_scope", "The API client needs the scope rates:write")
+	rr = clientRequest(app.SetAccountProduct(), "X-API-Key", payments.APIKey, "PUT", "product", "savings", `{"interest_rate": "0.03"}`)
+	testError(t, rr, http.StatusForbidden, "insufficient_scope", "The API client needs the scope rates:write")
+
+	rates := registerClient(t, &app, 0, `{"name": "treasury", "scopes": ["rates:write"]}`)
+	req, _ := http.NewRequest("PUT", "/exchange-rates/EUR/USD", strings.NewReader(`{"rate": "1.0842"}`))
+	req.SetPathValue("from", "EUR")
+	req.SetPathValue("to", "USD")
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set("X-API-Key", rates.APIKey)
+	rr = httptest.NewRecorder()
+	app.SetExchangeRate().ServeHTTP(rr, req)
+	testStatus(t, rr, http.StatusOK)
+}
+
+func TestClientCredentials(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+	client := registerClient(t, &app, 1, `{"name": "payroll", "scopes": ["accounts:read", "transactions:write"]}`)
+	grant := url.Values{"grant_type": {"client_credentials"}}
+
+	rr := tokenRequest(app.IssueClientToken(), client.ClientID, client.APIKey, grant)
+	var response struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("could not get an access token: %s", rr.Body.String())
+	}
+	if response.TokenType != "Bearer" || response.ExpiresIn != 900 || response.Scope != "accounts:read transactions:write" {
+		t.Errorf("unexpected token response: %s", rr.Body.String())
+	}
+	requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 0, "to_account_id": 1, "amount": 10}`)
+	rr = clientRequest(app.VoidHold(), "Authorization", "Bearer "+response.AccessToken, "POST", "holdId", "0", "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("client could not void a hold: %s", rr.Body.String())
+	}
+
+	// the credentials can also be in the form, and fewer scopes can be asked for
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {client.ClientID}, "client_secret": {client.APIKey}, "scope": {"accounts:read"}}
+	rr = tokenRequest(app.IssueClientToken(), "", "", form)
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Scope != "accounts:read" {
+		t.Fatalf("could not get an access token with fewer scopes: %s", rr.Body.String())
+	}
+	rr = clientRequest(app.CreateTransaction(), "Authorization", "Bearer "+response.AccessToken, "POST", "", "", `{"from_account_id": 1, "to_account_id": 0, "amount": 10}`)
+	testError(t, rr, http.StatusForbidden, "insufficient_scope", "The API client needs the scope transactions:write")
+
+	form.Set("scope", "accounts:read users:write")
+	rr = tokenRequest(app.IssueClientToken(), "", "", form)
+	testError(t, rr, http.StatusBadRequest, "invalid_scope", "The API client does not have the scope users:write")
+	rr = tokenRequest(app.IssueClientToken(), client.ClientID, "bk_wrong", grant)
+	testError(t, rr, http.StatusUnauthorized, "invalid_client", "Invalid client id or client secret")
+	if rr.Header().Get("WWW-Authenticate") != `Basic realm="bank-api"` {
+		t.Errorf("unexpected WWW-Authenticate header: %s", rr.Header().Get("WWW-Authenticate"))
+	}
+	rr = tokenRequest(app.IssueClientToken(), "client_unknown", client.APIKey, grant)
+	testError(t, rr, http.StatusUnauthorized, "invalid_client", "Invalid client id or client secret")
+	rr = tokenRequest(app.IssueClientToken(), client.ClientID, client.APIKey, url.Values{"grant_type": {"password"}})
+	testError(t, rr, http.StatusBadRequest, "unsupported_grant_type", `Unsupported grant type "password": only client_credentials is supported`)
+
+	// the tokens of a revoked client are refused, although they did not expire
+	requestAs(app.RevokeAPIClient(), 0, "DELETE", "/clients/"+client.ClientID, "", "clientId", client.ClientID)
+	rr = clientRequest(app.GetAccount(), "Authorization", "Bearer "+response.AccessToken, "GET", "accountId", "1", "")
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: the API client was revoked")
+	rr = tokenRequest(app.IssueClientToken(), client.ClientID, client.APIKey, grant)
+	testError(t, rr, http.StatusUnauthorized, "invalid_client", "Invalid client id or client secret")
+}
+
+func TestClientRateLimiting(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+	payroll := registerClient(t, &app, 1, `{"name": "payroll", "scopes": ["accounts:read"]}`)
+	reporting := registerClient(t, &app, 1, `{"name": "reporting", "scopes": ["accounts:read"]}`)
+
+	app.Limiters["ip"] = router.NewLimiter(1, func(r *http.Request) string { return r.RemoteAddr })
+	app.Limiters["client"] = router.NewLimiter(1, router.LimitedClient)
+	handler := app.GetAccount()
+
+	// every client has its own limit, which is not shared with the users at the same address
+	rr := clientRequest(handler, "X-API-Key", payroll.APIKey, "GET", "accountId", "1", "")
+	testStatus(t, rr, http.StatusOK)
+	rr = clientRequest(handler, "X-API-Key", payroll.APIKey, "GET", "accountId", "1", "")
+	testStatus(t, rr, http.StatusTooManyRequests)
+	rr = clientRequest(handler, "X-API-Key", reporting.APIKey, "GET", "accountId", "1", "")
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(handler, 1, "GET", "/accounts/1", "", "accountId", "1")
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(handler, 1, "GET", "/accounts/1", "", "accountId", "1")
+	testStatus(t, rr, http.StatusTooManyRequests)
+
+	// unknown keys cannot get a limit of their own
+	rr = clientRequest(handler, "X-API-Key", "bk_unknown", "GET", "accountId", "1", "")
+	testStatus(t, rr, http.StatusTooManyRequests)
+}
+
+func testStatus(t *testing.T, rr *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+	if rr.Code != expected {
+		t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, expected, rr.Body.String())
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CobilasEugen/bank-api/db"
+	"github.com/CobilasEugen/bank-api/scheduler"
+)
+
+// auditEvents searches the audit log as the admin with query
+func auditEvents(t *testing.T, handler http.HandlerFunc, query string) ([]db.AuditEvent, *httptest.ResponseRecorder) {
+	t.Helper()
+	rr := requestAs(handler, 0, "GET", "/audit-events"+query, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var events []db.AuditEvent
+	if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+		t.Fatalf("could not decode audit events: %s", err)
+	}
+	return events, rr
+}
+
+func TestAuditLog(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	rr := createUserRequest(&app, `{"name": "Dan", "email": "dan@example.com", "password": "correct horse battery"}`)
+	testStatus(t, rr, http.StatusOK)
+	rr = transactionRequest(&app, `{"from_account_id": 0, "to_account_id": 1, "amount": 10}`)
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"name": "Robert"}`, "userId", "1")
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.UpdateUser(), 1, "PATCH", "/user/2", `{"name": "Bob"}`, "userId", "2")
+	testStatus(t, rr, http.StatusForbidden)
+
+	events, _ := auditEvents(t, app.GetAuditEvents(), "")
+	if len(events) != 4 {
+		t.Fatalf("expected 4 audit events, got %d", len(events))
+	}
+
+	// newest first; the refused change is recorded too, without changing anything
+	refused := events[0]
+	if refused.Outcome != db.AuditFailed || refused.StatusCode != http.StatusForbidden || refused.ErrorCode != "forbidden" ||
+		*refused.ActorUserID != 1 || refused.Route != "PATCH /user/2" || refused.SourceIP != "127.0.0.1" || refused.After != nil {
+		t.Errorf("wrong event for refused change: %+v", refused)
+	}
+
+	update := events[1]
+	if update.Outcome != db.AuditSucceeded || *update.ActorUserID != 0 || strings.Join(update.Targets, " ") != "user:1" {
+		t.Errorf("wrong event for update: %+v", update)
+	}
+	if string(update.Before) != `{"id":1,"name":"Bob","role":"customer"}` || string(update.After) != `{"id":1,"name":"Robert","role":"customer"}` {
+		t.Errorf("wrong values for update: %s, %s", update.Before, update.After)
+	}
+	if update.RequestID == "" {
+		t.Errorf("update has no request id")
+	}
+
+	// transfers are found by the accounts they moved money between
+	transfer := events[2]
+	if transfer.Route != "POST /transaction" || strings.Join(transfer.Targets, " ") != "transaction:4 account:0 account:1" ||
+		transfer.Before != nil || !strings.Contains(string(transfer.After), `"amount":10,`) {
+		t.Errorf("wrong event for transfer: %+v, %s", transfer, transfer.After)
+	}
+
+	// users that register themselves have no actor, and their password is not recorded
+	registration := events[3]
+	if registration.ActorUserID != nil || strings.Join(registration.Targets, " ") != "user:3" || strings.Contains(string(registration.After), "password") {
+		t.Errorf("wrong event for registration: %+v, %s", registration, registration.After)
+	}
+
+	for _, test := range []struct {
+		query    string
+		expected int
+	}{
+		{"?target=account:1", 1},
+		{"?target=user:1", 1},
+		{"?actor_user_id=1", 1},
+		{"?outcome=failed", 1},
+		{"?route=PATCH", 2},
+		{"?request_id=" + update.RequestID, 1},
+		{"?from=2000-01-01&to=2000-01-02", 0},
+	} {
+		if events, _ := auditEvents(t, app.GetAuditEvents(), test.query); len(events) != test.expected {
+			t.Errorf("%s: expected %d audit events, got %d", test.query, test.expected, len(events))
+		}
+	}
+
+	events, rr = auditEvents(t, app.GetAuditEvents(), "?limit=3")
+	if len(events) != 3 || nextLink(rr) == "" {
+		t.Fatalf("expected a page of 3 events with a next link, got %d", len(events))
+	}
+	events, rr = auditEvents(t, app.GetAuditEvents(), strings.TrimPrefix(nextLink(rr), "/audit-events"))
+	if len(events) != 1 || events[0].ID != registration.ID || nextLink(rr) != "" {
+		t.Errorf("wrong last page: %+v", events)
+	}
+
+	rr = requestAs(app.GetAuditEvents(), 0, "GET", "/audit-events?outcome=maybe", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", "invalid filter: outcome must be succeeded or failed")
+	rr = requestAs(app.GetAuditEvents(), 0, "GET", "/audit-events?from=yesterday", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: invalid date "yesterday"`)
+
+	// only admins can read the audit log
+	rr = requestAs(app.GetAuditEvents(), 1, "GET", "/audit-events", "")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only admins can do this")
+}
+
+// unauditedDb is a database whose audit log cannot be written to
+type unauditedDb struct {
+	db.DbInterface
+}
+
+func (unauditedDb) CreateAuditEvent(event db.AuditEvent) (db.AuditEvent, error) {
+	return event, errors.New("disk I/O error")
+}
+
+func TestAuditLogWriteFails(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+	app.Db = unauditedDb{app.Db}
+
+	// the change was committed before the event could be written, so the client is told it was made
+	rr := requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"name": "Robert"}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Robert","role":"customer"}`)
+	rr = requestAs(app.GetUser(), 0, "GET", "/user/1", "", "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Robert","role":"customer"}`)
+
+	// a transfer gets its real outcome too, so the client has no reason to retry a payment that was made
+	rr = transactionRequest(&app, `{"from_account_id": 1, "to_account_id": 2, "amount": 100}`)
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/1", "", "accountId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"user_id":1,"balance":800,"available_balance":800,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+}
+
+func TestAuditLogScheduler(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 2, "to_account_id": 3, "amount": 80, "frequency": "monthly", "start_date": "2031-01-31", "max_executions": 3}`)
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 3, "to_account_id": 2, "amount": 10, "expires_at": "2031-01-01T00:00:00Z"}`)
+	testStatus(t, rr, http.StatusOK)
+
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("standing orders", scheduler.StandingOrders(app.Db))
+	tasks.Add("hold expiry", scheduler.ExpireHolds(app.Db))
+	tasks.RunOnce(time.Date(2031, 4, 1, 0, 0, 0, 0, time.UTC))
+
+	// what the jobs change is recorded with the bank as the actor
+	events, _ := auditEvents(t, app.GetAuditEvents(), "?actor_user_id=-1")
+	if len(events) != 4 {
+		t.Fatalf("expected 4 audit events of the scheduler, got %d", len(events))
+	}
+
+	expiry := events[0]
+	if expiry.Route != "SCHEDULER hold expiry" || expiry.Outcome != db.AuditSucceeded || strings.Join(expiry.Targets, " ") != "hold:0 account:3 account:2" ||
+		!strings.Contains(string(expiry.After), `"status":"expired"`) || !expiry.Timestamp.Equal(time.Date(2031, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong event for hold expiry: %+v, %s", expiry, expiry.After)
+	}
+
+	// the third run of the order has too little money, so its transfer failed
+	failed := events[1]
+	if failed.Route != "SCHEDULER standing orders" || failed.Outcome != db.AuditFailed ||
+		strings.Join(failed.Targets, " ") != "standing_order:0 transaction:6 account:2 account:3" || !strings.Contains(string(failed.After), `"error":"insufficient_funds"`) {
+		t.Errorf("wrong event for failed run: %+v, %s", failed, failed.After)
+	}
+	if run := events[3]; run.Outcome != db.AuditSucceeded || strings.Join(run.Targets, " ") != "standing_order:0 transaction:4 account:2 account:3" {
+		t.Errorf("wrong event for first run: %+v", run)
+	}
+}
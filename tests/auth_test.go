@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func authRequest(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/auth", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:8080"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// bearerRequest calls handler with the given Authorization header, if any
+func bearerRequest(handler http.HandlerFunc, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/auth/me", nil)
+	req.RemoteAddr = "127.0.0.1:8080"
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+type tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func readTokens(t *testing.T, rr *httptest.ResponseRecorder) tokens {
+	t.Helper()
+	var response tokens
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("could not decode tokens: %s", rr.Body.String())
+	}
+	if response.AccessToken == "" || response.RefreshToken == "" || response.TokenType != "Bearer" || response.ExpiresIn != 900 {
+		t.Errorf("handler returned unexpected tokens: %s", rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("tokens can be cached: Cache-Control is %q", rr.Header().Get("Cache-Control"))
+	}
+	return response
+}
+
+// newAuthApp is the mock app with a user, Dana, who can log in
+func newAuthApp(t *testing.T) router.App {
+	app := newMockApp()
+	rr := createUserRequest(&app, `{"name": "Dana", "email": "dana@example.com", "password": "correct horse battery"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Dana","role":"customer","email":"dana@example.com"}`)
+	return app
+}
+
+func TestLogin(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newAuthApp(t)
+
+	rr := authRequest(app.Login(), `{"email": " DANA@example.com", "password": "correct horse battery"}`)
+	response := readTokens(t, rr)
+
+	rr = bearerRequest(app.GetCurrentUser(), "Bearer "+response.AccessToken)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Dana","role":"customer","email":"dana@example.com"}`)
+
+	// wrong passwords and unknown users cannot be told apart
+	rr = authRequest(app.Login(), `{"email": "dana@example.com", "password": "wrong horse battery"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_credentials", "invalid email or password")
+	rr = authRequest(app.Login(), `{"email": "fox@example.com", "password": "correct horse battery"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_credentials", "invalid email or password")
+
+	// users without a password cannot log in
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"email": "bob@example.com"}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob","role":"customer","email":"bob@example.com"}`)
+	rr = authRequest(app.Login(), `{"email": "bob@example.com", "password": ""}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_credentials", "invalid email or password")
+}
+
+func TestRateLimitDoesNotSerializeHandlers(t *testing.T) {
+	limiter := router.NewLimiter(10, func(r *http.Request) string { return "127.0.0.1" })
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := router.RateLimit(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}, limiter)
+	fast := router.RateLimit(func(w http.ResponseWriter, r *http.Request) {}, limiter)
+
+	req, _ := http.NewRequest("POST", "/auth/login", nil)
+	go slow(httptest.NewRecorder(), req)
+	<-started
+	defer close(release)
+
+	// a login that is still hashing its password does not hold up the other requests of the address
+	done := make(chan struct{})
+	go func() {
+		fast(httptest.NewRecorder(), req)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("a slow handler blocked the other requests sharing its limiter")
+	}
+}
+
+func TestCreateUserPassword(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := createUserRequest(&app, `{"name": "Fox", "email": "fox@example.com", "password": "short"}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_user", "invalid password: must be at least 12 characters")
+	rr = createUserRequest(&app, `{"name": "Fox", "password": "a long enough password"}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_user", "invalid email: is required to log in with a password")
+
+	// the password is never returned, not even as a hash
+	rr = createUserRequest(&app, `{"name": "Fox", "email": "fox@example.com", "password": "a long enough password"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Fox","role":"customer","email":"fox@example.com"}`)
+}
+
+func TestRefreshToken(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newAuthApp(t)
+
+	first := readTokens(t, authRequest(app.Login(), `{"email": "dana@example.com", "password": "correct horse battery"}`))
+	second := readTokens(t, authRequest(app.Refresh(), `{"refresh_token": "`+first.RefreshToken+`"}`))
+	if second.RefreshToken == first.RefreshToken {
+		t.Errorf("refresh token was not rotated")
+	}
+	rr := bearerRequest(app.GetCurrentUser(), "Bearer "+second.AccessToken)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Dana","role":"customer","email":"dana@example.com"}`)
+
+	// using a replaced token again revokes every token of the user
+	rr = authRequest(app.Refresh(), `{"refresh_token": "`+first.RefreshToken+`"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token: was already used")
+	rr = authRequest(app.Refresh(), `{"refresh_token": "`+second.RefreshToken+`"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token: was revoked")
+
+	rr = authRequest(app.Refresh(), `{"refresh_token": "made-up"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token: does not exist")
+	rr = authRequest(app.Refresh(), `{}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token: is missing")
+}
+
+func TestLogout(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newAuthApp(t)
+
+	response := readTokens(t, authRequest(app.Login(), `{"email": "dana@example.com", "password": "correct horse battery"}`))
+	rr := authRequest(app.Logout(), `{"refresh_token": "`+response.RefreshToken+`"}`)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+
+	rr = authRequest(app.Refresh(), `{"refresh_token": "`+response.RefreshToken+`"}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_refresh_token", "invalid refresh token: was revoked")
+}
+
+func TestAuthenticate(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := bearerRequest(app.GetAccountProducts(), "")
+	testError(t, rr, http.StatusUnauthorized, "unauthenticated", "Authorization header with a bearer token is required")
+	if rr.Header().Get("WWW-Authenticate") != `Bearer realm="bank-api"` {
+		t.Errorf("unexpected WWW-Authenticate header %q", rr.Header().Get("WWW-Authenticate"))
+	}
+	rr = bearerRequest(app.GetAccountProducts(), "Basic YWxpY2U6c2VjcmV0")
+	testError(t, rr, http.StatusUnauthorized, "unauthenticated", "Authorization header with a bearer token is required")
+
+	rr = bearerRequest(app.GetAccountProducts(), "Bearer not.a.token")
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: unsupported token header")
+
+	expired, _ := testTokens.Issue(0, time.Now().Add(-auth.AccessTokenTTL))
+	rr = bearerRequest(app.GetAccountProducts(), "Bearer "+expired)
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: token has expired")
+
+	// tokens signed with another key, or changed after signing, are refused
+	otherKey, _ := auth.NewTokenSigner([]byte("a key that the server does not know of"))
+	forged, _ := otherKey.Issue(0, time.Now())
+	rr = bearerRequest(app.GetAccountProducts(), "Bearer "+forged)
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: invalid signature")
+
+	valid, _ := testTokens.Issue(1, time.Now())
+	parts := strings.Split(valid, ".")
+	other, _ := testTokens.Issue(2, time.Now())
+	tampered := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+	rr = bearerRequest(app.GetAccountProducts(), "Bearer "+tampered)
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: invalid signature")
+
+	// the tokens of deleted users stop working at once
+	rr = requestAs(app.DeleteUser(), 0, "DELETE", "/user/1", "", "userId", "1")
+	testError(t, rr, http.StatusConflict, "user_has_accounts", "user 1 still has 1 accounts, which have to be deleted first")
+	rr = requestAs(app.CreateUser(), 0, "POST", "/user", `{"name": "Eve"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Eve","role":"customer"}`)
+	rr = requestAs(app.DeleteUser(), 0, "DELETE", "/user/3", "", "userId", "3")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("could not delete user: %s", rr.Body.String())
+	}
+	deleted, _ := testTokens.Issue(3, time.Now())
+	rr = bearerRequest(app.GetAccountProducts(), "Bearer "+deleted)
+	testError(t, rr, http.StatusUnauthorized, "invalid_token", "Invalid access token: the user no longer exists")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/db"
+	"io"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func testAllowed(t *testing.T, err error, expected string) {
+	t.Helper()
+	if expected == "" && err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if expected != "" && (err == nil || err.Error() != expected) {
+		t.Errorf("unexpected error:\ngot : %v\nwant: %s", err, expected)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	mock, _ := db.NewMockDb()
+	policy := auth.NewPolicy(&mock)
+	admin := auth.Principal{UserID: 0, Role: db.RoleAdmin}
+	bob := auth.Principal{UserID: 1, Role: db.RoleCustomer}
+	charlie := auth.Principal{UserID: 2, Role: db.RoleCustomer}
+	support := auth.Principal{UserID: 2, Role: db.RoleSupport}
+
+	// customers use only what they own
+	testAllowed(t, policy.User(bob, auth.Write, "1"), "")
+	testAllowed(t, policy.User(bob, auth.Read, "2"), "forbidden: user 1 cannot access user 2")
+	testAllowed(t, policy.Account(bob, auth.Write, 1), "")
+	testAllowed(t, policy.Account(bob, auth.Read, 0), "forbidden: user 1 cannot access account 0")
+	testAllowed(t, policy.Account(bob, auth.Read, 9), "account 9 does not exist")
+
+	// transaction 0 went from Alice to Bob: both can read it, but only Bob can reverse it
+	testAllowed(t, policy.Transaction(bob, auth.Read, 0), "")
+	testAllowed(t, policy.Transaction(bob, auth.Write, 0), "")
+	testAllowed(t, policy.Transaction(charlie, auth.Read, 0), "forbidden: user 2 cannot access transaction 0")
+	testAllowed(t, policy.Transaction(auth.Principal{UserID: 0, Role: db.RoleCustomer}, auth.Write, 0), "forbidden: user 0 cannot access transaction 0")
+
+	// support staff read everything and change nothing
+	testAllowed(t, policy.Account(support, auth.Read, 0), "")
+	testAllowed(t, policy.Account(support, auth.Write, 2), "forbidden: support staff can only read")
+	testAllowed(t, policy.Staff(support), "")
+	testAllowed(t, policy.Admin(support), "forbidden: only admins can do this")
+
+	testAllowed(t, policy.Account(admin, auth.Write, 3), "")
+	testAllowed(t, policy.Staff(bob), "forbidden: only support staff and admins can do this")
+	testAllowed(t, policy.Account(auth.Principal{}, auth.Read, 0), "forbidden: no role")
+
+	// payment files may only pay from the accounts of the customer
+	instructions := []db.PaymentInstruction{
+		{Line: 2, FromAccountID: 1, ToAccountID: 2, Amount: "10"},
+		{Line: 3, FromAccountID: 9, ToAccountID: 2, Amount: "10"},
+		{Line: 4, Error: "invalid amount"},
+	}
+	testAllowed(t, policy.PaymentInstructions(bob, instructions), "")
+	instructions = append(instructions, db.PaymentInstruction{Line: 5, FromAccountID: 2, ToAccountID: 1, Amount: "10"})
+	testAllowed(t, policy.PaymentInstructions(bob, instructions), "forbidden: line 5: user 1 cannot access account 2")
+}
+
+func TestAuthorization(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// Bob can only see his own user and accounts
+	rr := requestAs(app.GetAccount(), 1, "GET", "/accounts/1", "", "accountId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"user_id":1,"balance":900,"available_balance":900,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+	rr = requestAs(app.GetAccount(), 1, "GET", "/accounts/0", "", "accountId", "0")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access account 0")
+	rr = requestAs(app.GetAccounts(), 1, "GET", "/account/2", "", "userId", "2")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access user 2")
+	rr = requestAs(app.SearchUsers(), 1, "GET", "/users", "")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only support staff and admins can do this")
+
+	// and can only send money from his own accounts
+	rr = requestAs(app.CreateTransaction(), 1, "POST", "/transaction", `{"from_account_id": 0, "to_account_id": 1, "amount": 10}`)
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access account 0")
+	rr = requestAs(app.CreateBatchTransfer(), 1, "POST", "/batch-transfers", `{"legs": [{"from_account_id": 1, "to_account_id": 2, "amount": 10}, {"from_account_id": 2, "to_account_id": 1, "amount": 10}]}`)
+	testError(t, rr, http.StatusForbidden, "forbidden", "leg 2: forbidden: user 1 cannot access account 2")
+	rr = requestAs(app.CreateTransaction(), 1, "POST", "/transaction", `{"from_account_id": 1, "to_account_id": 0, "amount": 10}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("customer could not send money from their account: %s", rr.Body.String())
+	}
+
+	// he can read the holds he places, but only the payee captures or voids them
+	rr = requestAs(app.CreateHold(), 1, "POST", "/holds", `{"from_account_id": 1, "to_account_id": 2, "amount": 10}`)
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.GetHold(), 1, "GET", "/holds/0", "", "holdId", "0")
+	testStatus(t, rr, http.StatusOK)
+	rr = requestAs(app.VoidHold(), 1, "POST", "/holds/0/void", "", "holdId", "0")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access hold 0")
+	rr = requestAs(app.CaptureHold(), 1, "POST", "/holds/0/capture", "", "holdId", "0")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: user 1 cannot access hold 0")
+	rr = requestAs(app.VoidHold(), 2, "POST", "/holds/0/void", "", "holdId", "0")
+	testStatus(t, rr, http.StatusOK)
+
+	// he can open accounts, but only admins pay an opening balance into them
+	rr = requestAs(app.CreateAccount(), 1, "POST", "/account", `{"user_id": 1, "balance": 1000}`)
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only admins can do this")
+	rr = requestAs(app.CreateAccount(), 1, "POST", "/account", `{"user_id": 1}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"user_id":1,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+
+	// rates and limits are set by admins
+	rr = requestAs(app.SetOverdraftLimit(), 1, "PUT", "/accounts/1/overdraft-limit", `{"limit": 100}`, "accountId", "1")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only admins can do this")
+	rr = requestAs(app.UnfreezeAccount(), 1, "POST", "/accounts/1/unfreeze", "", "accountId", "1")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only admins can do this")
+
+	// a new role applies to tokens that were already issued
+	rr = requestAs(app.SetUserRole(), 1, "PUT", "/user/1/role", `{"role": "admin"}`, "userId", "1")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: only admins can do this")
+	rr = requestAs(app.SetUserRole(), 0, "PUT", "/user/1/role", `{"role": "support"}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob","role":"support"}`)
+	rr = requestAs(app.GetAccount(), 1, "GET", "/accounts/0", "", "accountId", "0")
+	if rr.Code != http.StatusOK {
+		t.Errorf("support staff could not read an account: %s", rr.Body.String())
+	}
+	rr = requestAs(app.FreezeAccount(), 1, "POST", "/accounts/0/freeze", "", "accountId", "0")
+	testError(t, rr, http.StatusForbidden, "forbidden", "forbidden: support staff can only read")
+
+	rr = requestAs(app.SetUserRole(), 0, "PUT", "/user/1/role", `{"role": "owner"}`, "userId", "1")
+	testError(t, rr, http.StatusBadRequest, "invalid_user", "invalid role: must be customer, support or admin")
+	rr = requestAs(app.SetUserRole(), 0, "PUT", "/user/9/role", `{"role": "admin"}`, "userId", "9")
+	testError(t, rr, http.StatusNotFound, "user_not_found", "user 9 does not exist")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func batchTransferRequest(app *router.App, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/batch-transfers", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateBatchTransfer()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBatchTransfer(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// account 2 holds 200 and can only pay its second leg with what the first leg paid in
+	rr := batchTransferRequest(&app, `{"legs": [
+		{"from_account_id": 0, "to_account_id": 2, "amount": 150},
+		{"from_account_id": 2, "to_account_id": 1, "amount": 300},
+		{"from_account_id": 2, "to_account_id": 3, "amount": 50}
+	]}`)
+	testRequest(t, rr, http.StatusCreated, `{"id":0,"created_at":"2030-10-07T12:44:22+05:30","transactions":[`+
+		`{"id":4,"from_account_id":0,"to_account_id":2,"amount":150,"currency":"EUR","to_amount":150,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"batch_id":0},`+
+		`{"id":5,"from_account_id":2,"to_account_id":1,"amount":300,"currency":"EUR","to_amount":300,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"batch_id":0},`+
+		`{"id":6,"from_account_id":2,"to_account_id":3,"amount":50,"currency":"EUR","to_amount":50,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"batch_id":0}]}`)
+	if location := rr.Header().Get("Location"); location != "/batch-transfers/0" {
+		t.Errorf("handler returned wrong location: got %s want /batch-transfers/0", location)
+	}
+
+	req, _ := http.NewRequest("GET", "/batch-transfers/0", nil)
+	req.SetPathValue("batchId", "0")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetBatchTransfer()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"batch_id":0`) != 3 {
+		t.Errorf("batch transfer was not stored: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/2", "", "accountId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+}
+
+func TestFailedBatchTransfer(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// the last leg cannot be covered, so the legs before it are undone as well
+	rr := batchTransferRequest(&app, `{"legs": [
+		{"from_account_id": 0, "to_account_id": 2, "amount": 150},
+		{"from_account_id": 2, "to_account_id": 3, "amount": 400}
+	]}`)
+	testError(t, rr, http.StatusConflict, "insufficient_funds", `leg 2: account 2 has 350.00 EUR, which does not cover 400.00 EUR`)
+
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/0", "", "accountId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"user_id":0,"balance":400,"available_balance":400,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+	rr = requestAs(app.GetTransaction(), 0, "GET", "/transactions/4", "", "transactionId", "4")
+	testError(t, rr, http.StatusNotFound, "transaction_not_found", `transaction 4 does not exist`)
+
+	// a failed batch does not leave failed transactions behind
+	rr = batchTransferRequest(&app, `{"legs": [
+		{"from_account_id": 0, "to_account_id": 2, "amount": 150},
+		{"from_account_id": 2, "to_account_id": 9, "amount": 10}
+	]}`)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `leg 2: account 9 does not exist`)
+
+	rr = batchTransferRequest(&app, `{"legs": [{"from_account_id": 0, "to_account_id": 2, "amount": -1}]}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_amount", `leg 1: invalid amount -1.00: must be positive`)
+
+	// too many legs are refused before any of them is looked at
+	legs := strings.Repeat(`{"from_account_id": 9, "to_account_id": 2, "amount": 1},`, 101)
+	rr = batchTransferRequest(&app, `{"legs": [`+strings.TrimSuffix(legs, ",")+`]}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_batch_transfer", `invalid batch transfer: a batch transfer holds at most 100 legs`)
+
+	rr = batchTransferRequest(&app, `{"legs": []}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_batch_transfer", `invalid batch transfer: a batch transfer needs at least one leg`)
+
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/2", "", "accountId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+func TestExchangeRateConvert(t *testing.T) {
+	cases := []struct {
+		rate     db.ExchangeRate
+		amount   db.Money
+		expected db.Money
+	}{
+		{db.ExchangeRate{From: "EUR", To: "USD", Rate: "1.0842"}, db.NewMoney(10000, "EUR"), db.NewMoney(10842, "USD")},
+		// 0.01 EUR * 1.0845 = 0.010845 USD, rounded to 1 cent
+		{db.ExchangeRate{From: "EUR", To: "USD", Rate: "1.0845"}, db.NewMoney(1, "EUR"), db.NewMoney(1, "USD")},
+		// 1.00 EUR * 161.5 = 161.5 JPY, rounded half away from zero
+		{db.ExchangeRate{From: "EUR", To: "JPY", Rate: "161.5"}, db.NewMoney(100, "EUR"), db.NewMoney(162, "JPY")},
+		{db.ExchangeRate{From: "JPY", To: "EUR", Rate: "0.0062"}, db.NewMoney(1000, "JPY"), db.NewMoney(620, "EUR")},
+		{db.ExchangeRate{From: "EUR", To: "KWD", Rate: "0.3321"}, db.NewMoney(1, "EUR"), db.NewMoney(3, "KWD")},
+	}
+
+	for _, c := range cases {
+		converted, err := c.rate.Convert(c.amount)
+		if err != nil || converted != c.expected {
+			t.Errorf("converting %v at %s = %v, %v, want %v", c.amount, c.rate.Rate, converted, err, c.expected)
+		}
+	}
+
+	if _, err := (db.ExchangeRate{From: "EUR", To: "USD", Rate: "1.1"}).Convert(db.NewMoney(100, "USD")); err == nil {
+		t.Errorf("converting an amount in the wrong currency should have failed")
+	}
+}
+
+func TestCrossCurrencyTransaction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	post := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:8080"
+		signIn(req)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// account 4 is the bank's opening balance account
+	rr := post(app.CreateAccount(), `{"user_id": 1, "balance": 10, "currency": "USD"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"user_id":1,"balance":10,"available_balance":10,"overdraft_limit":0,"currency":"USD","product":"checking","status":"active"}`)
+
+	// without a rate the transfer cannot be converted
+	rr = post(app.CreateTransaction(), `{"from_account_id": 1, "to_account_id": 5, "amount": 100}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	rateReq, _ := http.NewRequest("PUT", "/exchange-rates/EUR/USD", strings.NewReader(`{"rate": "1.0842"}`))
+	rateReq.SetPathValue("from", "EUR")
+	rateReq.SetPathValue("to", "USD")
+	rateReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(rateReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.SetExchangeRate()).ServeHTTP(rr, rateReq)
+	testRequest(t, rr, http.StatusOK, `{"from":"EUR","to":"USD","rate":"1.0842","updated_at":"2030-10-07T12:44:22+05:30"}`)
+
+	rr = post(app.CreateTransaction(), `{"from_account_id": 1, "to_account_id": 5, "amount": 100}`)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":1,"to_account_id":5,"amount":100,"currency":"EUR","to_amount":108.42,"to_currency":"USD","exchange_rate":"1.0842","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+
+	// the amount must be in the currency of the outgoing account
+	rr = post(app.CreateTransaction(), `{"from_account_id": 1, "to_account_id": 5, "amount": 100, "currency": "USD"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	accReq, _ := http.NewRequest("GET", "/account/1", nil)
+	accReq.SetPathValue("userId", "1")
+	accReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccounts()).ServeHTTP(rr, accReq)
+	testRequest(t, rr, http.StatusOK, `[{"id":1,"user_id":1,"balance":800,"available_balance":800,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":5,"user_id":1,"balance":118.42,"available_balance":118.42,"overdraft_limit":0,"currency":"USD","product":"checking","status":"active"}]`)
+}
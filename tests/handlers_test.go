@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"github.com/CobilasEugen/bank-api/auth"
 	"github.com/CobilasEugen/bank-api/db"
 	"github.com/CobilasEugen/bank-api/router"
 	"fmt"
@@ -25,14 +27,53 @@ func newMockApp() router.App {
 		return fullAddress[:lastIndex] // only look at IP, remove port
 	})
 
+	loginLimiter := router.NewLimiter(5, func(r *http.Request) string {
+		fullAddress := r.RemoteAddr
+		lastIndex := strings.LastIndex(fullAddress, ":")
+		return fullAddress[:lastIndex]
+	})
+
 	app.Limiters = map[string]*router.Limiter{
-		"ip":   ipLimiter,
-		"user": userLimiter,
+		"ip":     ipLimiter,
+		"user":   userLimiter,
+		"login":  loginLimiter,
+		"client": router.NewLimiter(166, router.LimitedClient),
 	}
+	app.Tokens = testTokens
+	app.Policy = auth.NewPolicy(app.Db)
+	app.Nonces = router.NewNonceStore(100, 2*auth.SignatureMaxSkew)
 
 	return app
 }
 
+// testTokens signs the access tokens of the tests, with a key that is only used here
+var testTokens, _ = auth.NewTokenSigner([]byte("a key that is only used by the tests of bank-api"))
+
+// signIn authenticates a request as Alice, the user with id 0, who is an admin of the mock
+func signIn(req *http.Request) {
+	signInAs(req, 0)
+}
+
+// signInAs authenticates a request as the user with userId; Bob (1) and Charlie (2) are customers
+func signInAs(req *http.Request, userId int) {
+	token, _ := testTokens.Issue(userId, time.Now())
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// requestAs calls handler as the user with userId; pathValues are pairs of a name and a value, for the
+// path values the route of handler would have set
+func requestAs(handler http.HandlerFunc, userId int, method string, path string, body string, pathValues ...string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(pathValues); i += 2 {
+		req.SetPathValue(pathValues[i], pathValues[i+1])
+	}
+	req.RemoteAddr = "127.0.0.1:8080"
+	signInAs(req, userId)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
 func testRequest(t *testing.T, rr *httptest.ResponseRecorder, expectedCode int, expectedBody string) {
 	if rr.Code != expectedCode {
 		t.Errorf("handler returned wrong status code: got %v want %v",
@@ -45,6 +86,33 @@ func testRequest(t *testing.T, rr *httptest.ResponseRecorder, expectedCode int,
 	}
 }
 
+// testError checks that a request failed with the JSON error envelope, which carries the id of the X-Request-Id header
+func testError(t *testing.T, rr *httptest.ResponseRecorder, expectedStatus int, expectedCode string, expectedMessage string) {
+	t.Helper()
+	if rr.Code != expectedStatus {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, expectedStatus)
+	}
+
+	var body struct {
+		Error struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			RequestID string `json:"request_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Errorf("handler did not return an error envelope: %s", rr.Body.String())
+		return
+	}
+	if body.Error.Code != expectedCode || body.Error.Message != expectedMessage {
+		t.Errorf("handler returned unexpected error:\ngot : %s %s\nwant: %s %s\n",
+			body.Error.Code, body.Error.Message, expectedCode, expectedMessage)
+	}
+	if body.Error.RequestID == "" || body.Error.RequestID != rr.Header().Get("X-Request-Id") {
+		t.Errorf("error has request id %q, but the X-Request-Id header is %q", body.Error.RequestID, rr.Header().Get("X-Request-Id"))
+	}
+}
+
 func TestIpRateLimiting(t *testing.T) {
 	log.SetOutput(io.Discard)
 	app := newMockApp()
@@ -53,12 +121,13 @@ func TestIpRateLimiting(t *testing.T) {
 	userReq, _ := http.NewRequest("GET", "/user/1", nil)
 	userReq.SetPathValue("userId", "1")
 	userReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(userReq)
 
 	// make 5 requests with userId 1
 	for range 5 {
 		rr := httptest.NewRecorder()
 		userHandler.ServeHTTP(rr, userReq)
-		testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob"}`)
+		testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob","role":"customer"}`)
 	}
 
 	// make 161 requests that do not use the userId, but are from the same ip
@@ -68,17 +137,18 @@ func TestIpRateLimiting(t *testing.T) {
 		createReq, _ := http.NewRequest("POST", "/user/", reader)
 		createReq.Header.Set("Content-Type", "application/json")
 		createReq.RemoteAddr = "127.0.0.1:8080"
+		signIn(createReq)
 
 		rr := httptest.NewRecorder()
 		createHandler.ServeHTTP(rr, createReq)
 		log.Println(rr.Body.String())
-		testRequest(t, rr, http.StatusOK, `{"id":`+fmt.Sprint(i+3)+`,"name":"Dan"}`)
+		testRequest(t, rr, http.StatusOK, `{"id":`+fmt.Sprint(i+3)+`,"name":"Dan","role":"customer"}`)
 	}
 
 	// the 167th request fails
 	rr := httptest.NewRecorder()
 	userHandler.ServeHTTP(rr, userReq)
-	testRequest(t, rr, http.StatusTooManyRequests, `Rate Limit Exceeded`)
+	testError(t, rr, http.StatusTooManyRequests, "rate_limited", `Rate Limit Exceeded`)
 }
 
 func TestUserRateLimiting(t *testing.T) {
@@ -88,45 +158,48 @@ func TestUserRateLimiting(t *testing.T) {
 	userReq, _ := http.NewRequest("GET", "/user/2", nil)
 	userReq.SetPathValue("userId", "2")
 	userReq.RemoteAddr = "localhost:8080"
+	signIn(userReq)
 	accReq, _ := http.NewRequest("GET", "/account/2", nil)
 	accReq.SetPathValue("userId", "2")
 	accReq.RemoteAddr = "localhost:8080"
+	signIn(accReq)
 
 	// make 3 requests to one endpoint with userId 2
 	userHandler := http.HandlerFunc(app.GetUser())
 	for range 3 {
 		rr := httptest.NewRecorder()
 		userHandler.ServeHTTP(rr, userReq)
-		testRequest(t, rr, http.StatusOK, `{"id":2,"name":"Charlie"}`)
+		testRequest(t, rr, http.StatusOK, `{"id":2,"name":"Charlie","role":"customer"}`)
 	}
 	// make 2 requests to another endpoint with the same userId 2
 	accountHandler := http.HandlerFunc(app.GetAccounts())
 	for range 2 {
 		rr := httptest.NewRecorder()
 		accountHandler.ServeHTTP(rr, accReq)
-		testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200},{"id":3,"user_id":2,"balance":300}]`)
+		testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
 	}
 
 	// 6th request fails
 	rr := httptest.NewRecorder()
 	userHandler.ServeHTTP(rr, userReq)
-	testRequest(t, rr, http.StatusTooManyRequests, `Rate Limit Exceeded`)
+	testError(t, rr, http.StatusTooManyRequests, "rate_limited", `Rate Limit Exceeded`)
 
 	// request with other userId goes through
 	tranReq, _ := http.NewRequest("GET", "/transaction/in/1", nil)
 	tranReq.SetPathValue("userId", "1")
 	tranReq.RemoteAddr = "localhost:8080"
+	signIn(tranReq)
 
 	tranHandler := http.HandlerFunc(app.GetInTransactions())
 	rr = httptest.NewRecorder()
 	tranHandler.ServeHTTP(rr, tranReq)
-	testRequest(t, rr, http.StatusOK, `[{"id":0,"from_account_id":0,"to_account_id":1,"amount":600,"timestamp":"2030-10-07T12:44:22+05:30","succeeded":1},{"id":1,"from_account_id":0,"to_account_id":1,"amount":500,"timestamp":"2030-10-07T12:44:22+05:30","succeeded":0}]`)
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"from_account_id":0,"to_account_id":1,"amount":600,"currency":"EUR","to_amount":600,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1},{"id":1,"from_account_id":0,"to_account_id":1,"amount":500,"currency":"EUR","to_amount":500,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds"}]`)
 
 	// if we wait a bit, we can once again make requests with the initial userId
 	time.Sleep(time.Millisecond * 500)
 	rr = httptest.NewRecorder()
 	accountHandler.ServeHTTP(rr, accReq)
-	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200},{"id":3,"user_id":2,"balance":300}]`)
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
 }
 
 func TestFailedTransactionsRateLimiting(t *testing.T) {
@@ -145,19 +218,21 @@ func TestFailedTransactionsRateLimiting(t *testing.T) {
 	createReq, _ := http.NewRequest("POST", "/transaction/", reader)
 	createReq.Header.Set("Content-Type", "application/json")
 	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
 	rr := httptest.NewRecorder()
 	createHandler.ServeHTTP(rr, createReq)
-	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":0,"to_account_id":3,"amount":100,"timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":0,"to_account_id":3,"amount":100,"currency":"EUR","to_amount":100,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
 
 	// bad transaction leads to third failure
 	reader = strings.NewReader(`{
 		"from_account_id": 0,
 		"to_account_id": 3,
-		"amount": 300.0
+		"amount": 350.0
 	}`)
 	createReq, _ = http.NewRequest("POST", "/transaction/", reader)
 	createReq.Header.Set("Content-Type", "application/json")
 	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
 	rr = httptest.NewRecorder()
 	createHandler.ServeHTTP(rr, createReq)
 
@@ -170,7 +245,49 @@ func TestFailedTransactionsRateLimiting(t *testing.T) {
 	createReq, _ = http.NewRequest("POST", "/transaction/", reader)
 	createReq.Header.Set("Content-Type", "application/json")
 	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
 	rr = httptest.NewRecorder()
 	createHandler.ServeHTTP(rr, createReq)
-	testRequest(t, rr, http.StatusTooManyRequests, `Rate Limit Exceeded`)
+	testError(t, rr, http.StatusTooManyRequests, "failed_transactions_limit", `Limit of failed transactions per day (3) has been reached`)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// a request id chosen by the client is kept, so that it can be looked up
+	req, _ := http.NewRequest("GET", "/accounts/9", nil)
+	req.SetPathValue("accountId", "9")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	req.Header.Set("X-Request-Id", "support-ticket-42")
+	rr := httptest.NewRecorder()
+	app.GetAccount().ServeHTTP(rr, req)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+	if id := rr.Header().Get("X-Request-Id"); id != "support-ticket-42" {
+		t.Errorf("request id of the client was not used: %q", id)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("error has content type %q", contentType)
+	}
+
+	// anything else is replaced by a generated id
+	req.Header.Set("X-Request-Id", "no spaces, please")
+	rr = httptest.NewRecorder()
+	app.GetAccount().ServeHTTP(rr, req)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+	if id := rr.Header().Get("X-Request-Id"); len(id) != 32 {
+		t.Errorf("unexpected generated request id: %q", id)
+	}
+
+	// successful responses have a request id as well
+	req, _ = http.NewRequest("GET", "/accounts/1", nil)
+	req.SetPathValue("accountId", "1")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	app.GetAccount().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Request-Id") == "" {
+		t.Errorf("successful response has no request id: %d %q", rr.Code, rr.Header().Get("X-Request-Id"))
+	}
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"github.com/CobilasEugen/bank-api/scheduler"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func accountsOf(app *router.App, userId string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/account/"+userId, nil)
+	req.SetPathValue("userId", userId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccounts()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHoldCapture(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 2, "to_account_id": 3, "amount": 250}`)
+	testError(t, rr, http.StatusConflict, "insufficient_funds", `account 2 has 200.00 EUR, which does not cover 250.00 EUR`)
+
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 2, "to_account_id": 3, "amount": 150}`)
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":2,"to_account_id":3,"amount":150,"currency":"EUR","status":"active","captured_amount":null,"transaction_id":null,"created_at":"2030-10-07T12:44:22+05:30","expires_at":"2030-10-14T07:14:22Z"}`)
+
+	// the held money stays in the ledger balance, but cannot be spent
+	rr = accountsOf(&app, "2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200,"available_balance":50,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+
+	createReq, _ := http.NewRequest("POST", "/transaction", strings.NewReader(`{"from_account_id": 2, "to_account_id": 0, "amount": 100}`))
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, createReq)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":2,"to_account_id":0,"amount":100,"currency":"EUR","to_amount":100,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds"}`)
+
+	rr = requestAs(app.CaptureHold(), 0, "POST", "/holds/0/capture", `{"amount": 200}`, "holdId", "0")
+	testError(t, rr, http.StatusConflict, "hold_status_conflict", `cannot change hold 0: only 150.00 EUR is held`)
+
+	// capturing part of the hold releases the rest
+	rr = requestAs(app.CaptureHold(), 0, "POST", "/holds/0/capture", `{"amount": 120}`, "holdId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":2,"to_account_id":3,"amount":150,"currency":"EUR","status":"captured","captured_amount":120,"transaction_id":5,"created_at":"2030-10-07T12:44:22+05:30","expires_at":"2030-10-14T07:14:22Z"}`)
+
+	rr = accountsOf(&app, "2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":80,"available_balance":80,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":420,"available_balance":420,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+
+	rr = requestAs(app.CaptureHold(), 0, "POST", "/holds/0/capture", "", "holdId", "0")
+	testError(t, rr, http.StatusConflict, "hold_status_conflict", `cannot change hold 0: the hold is captured`)
+
+	rr = requestAs(app.VoidHold(), 0, "POST", "/holds/0/void", "", "holdId", "0")
+	testError(t, rr, http.StatusConflict, "hold_status_conflict", `cannot change hold 0: the hold is captured`)
+
+	rr = requestAs(app.GetHold(), 0, "GET", "/holds/3", "", "holdId", "3")
+	testError(t, rr, http.StatusNotFound, "hold_not_found", `hold 3 does not exist`)
+}
+
+func TestHoldVoidAndExpiry(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 3, "to_account_id": 2, "amount": 100}`)
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":3,"to_account_id":2,"amount":100,"currency":"EUR","status":"active","captured_amount":null,"transaction_id":null,"created_at":"2030-10-07T12:44:22+05:30","expires_at":"2030-10-14T07:14:22Z"}`)
+
+	rr = requestAs(app.VoidHold(), 0, "POST", "/holds/0/void", "", "holdId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":3,"to_account_id":2,"amount":100,"currency":"EUR","status":"voided","captured_amount":null,"transaction_id":null,"created_at":"2030-10-07T12:44:22+05:30","expires_at":"2030-10-14T07:14:22Z"}`)
+
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 3, "to_account_id": 2, "amount": 250, "expires_at": "2031-01-01T00:00:00Z"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":1,"from_account_id":3,"to_account_id":2,"amount":250,"currency":"EUR","status":"active","captured_amount":null,"transaction_id":null,"created_at":"2030-10-07T12:44:22+05:30","expires_at":"2031-01-01T00:00:00Z"}`)
+
+	rr = accountsOf(&app, "2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":50,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("hold expiry", scheduler.ExpireHolds(app.Db))
+	tasks.RunOnce(time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	rr = requestAs(app.CaptureHold(), 0, "POST", "/holds/1/capture", "", "holdId", "1")
+	testError(t, rr, http.StatusConflict, "hold_status_conflict", `cannot change hold 1: the hold is expired`)
+
+	rr = accountsOf(&app, "2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 3, "to_account_id": 2, "amount": 10, "expires_at": "2020-01-01T00:00:00Z"}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_parameter", `Invalid expires_at: must be in the future`)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentTransaction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	createHandler := http.HandlerFunc(app.CreateTransaction())
+	postAs := func(userId int, key string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/transaction", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		req.RemoteAddr = "127.0.0.1:8080"
+		signInAs(req, userId)
+		rr := httptest.NewRecorder()
+		createHandler.ServeHTTP(rr, req)
+		return rr
+	}
+	post := func(key string, body string) *httptest.ResponseRecorder {
+		return postAs(0, key, body)
+	}
+
+	expected := `{"id":4,"from_account_id":1,"to_account_id":2,"amount":100,"currency":"EUR","to_amount":100,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`
+	rr := post("retry-1", `{"from_account_id": 1, "to_account_id": 2, "amount": 100}`)
+	testRequest(t, rr, http.StatusOK, expected)
+
+	// the retry is replayed, even with different formatting, and does not move money again
+	rr = post("retry-1", `{"amount":100,"to_account_id":2,"from_account_id":1}`)
+	testRequest(t, rr, http.StatusOK, expected)
+	if rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replayed response is missing the Idempotent-Replayed header")
+	}
+
+	// the same key cannot be used for another request
+	rr = post("retry-1", `{"from_account_id": 1, "to_account_id": 2, "amount": 200}`)
+	testError(t, rr, http.StatusUnprocessableEntity, "idempotency_key_reused", `Idempotency-Key was already used for a different request`)
+
+	// client errors are stored and replayed as well
+	rr = post("retry-2", `{"from_account_id": 1, "to_account_id": 2, "amount": 0.001}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	replay := post("retry-2", `{"from_account_id": 1, "to_account_id": 2, "amount": 0.001}`)
+	testRequest(t, replay, http.StatusBadRequest, strings.TrimSpace(rr.Body.String()))
+	if replay.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("replayed response has the wrong Content-Type: %q", replay.Header().Get("Content-Type"))
+	}
+
+	// keys are scoped to who sent them, so Bob reusing the key of Alice makes a new transfer
+	rr = postAs(1, "retry-1", `{"from_account_id": 1, "to_account_id": 2, "amount": 100}`)
+	testRequest(t, rr, http.StatusOK, strings.Replace(expected, `"id":4`, `"id":5`, 1))
+	if rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("a key of another user was replayed")
+	}
+
+	accReq, _ := http.NewRequest("GET", "/account/1", nil)
+	accReq.SetPathValue("userId", "1")
+	accReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccounts()).ServeHTTP(rr, accReq)
+	testRequest(t, rr, http.StatusOK, `[{"id":1,"user_id":1,"balance":700,"available_balance":700,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+}
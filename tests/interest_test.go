@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"github.com/CobilasEugen/bank-api/scheduler"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func interestRequest(app *router.App, accountId string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/accounts/"+accountId+"/interest", nil)
+	req.SetPathValue("accountId", accountId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccruedInterest()).ServeHTTP(rr, req)
+	return rr
+}
+
+func runInterest(app *router.App, now string) {
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("interest", scheduler.Interest(app.Db))
+	at, _ := time.Parse(time.RFC3339, now)
+	tasks.RunOnce(at)
+}
+
+func TestAccountProducts(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	put := func(product string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/products/"+product, strings.NewReader(body))
+		req.SetPathValue("product", product)
+		req.RemoteAddr = "127.0.0.1:8080"
+		signIn(req)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.SetAccountProduct()).ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := put("savings", `{"interest_rate": -0.01}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_parameter", `Invalid account product: invalid interest rate "-0.01"`)
+
+	rr = put("deposit", `{"interest_rate": 0.035}`)
+	testRequest(t, rr, http.StatusOK, `{"name":"deposit","interest_rate":"0.035"}`)
+
+	req, _ := http.NewRequest("GET", "/products", nil)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccountProducts()).ServeHTTP(rr, req)
+	testRequest(t, rr, http.StatusOK, `[{"name":"checking","interest_rate":"0"},{"name":"savings","interest_rate":"0.02"},{"name":"deposit","interest_rate":"0.035"}]`)
+
+	req, _ = http.NewRequest("POST", "/account", strings.NewReader(`{"user_id": 0, "balance": 10, "product": "pension"}`))
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(rr, req)
+	testError(t, rr, http.StatusBadRequest, "product_not_found", `account product "pension" does not exist`)
+}
+
+func TestInterestAccrual(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// 2% a year on 3650 earns 0.20 a day; account 4 is the bank's opening balance account
+	req, _ := http.NewRequest("POST", "/account", strings.NewReader(`{"user_id": 0, "balance": 3650, "product": "savings"}`))
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(rr, req)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"user_id":0,"balance":3650,"available_balance":3650,"overdraft_limit":0,"currency":"EUR","product":"savings","status":"active"}`)
+
+	rr = interestRequest(&app, "9")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+
+	// the first run accrues the day before it; nothing is paid out during the month
+	runInterest(&app, "2030-10-30T06:00:00Z")
+	rr = interestRequest(&app, "5")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"product":"savings","interest_rate":"0.02","currency":"EUR","accrued_interest":"0.2","accruals":[{"id":0,"account_id":5,"date":"2030-10-29","balance":3650,"interest_rate":"0.02","amount":"0.2","transaction_id":null}]}`)
+
+	// running again on the same day changes nothing
+	runInterest(&app, "2030-10-30T18:00:00Z")
+	rr = interestRequest(&app, "5")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"product":"savings","interest_rate":"0.02","currency":"EUR","accrued_interest":"0.2","accruals":[{"id":0,"account_id":5,"date":"2030-10-29","balance":3650,"interest_rate":"0.02","amount":"0.2","transaction_id":null}]}`)
+
+	// missed days are caught up, and October's interest is paid out from the interest expense account
+	runInterest(&app, "2030-11-02T06:00:00Z")
+	rr = interestRequest(&app, "5")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"product":"savings","interest_rate":"0.02","currency":"EUR","accrued_interest":"0.2","accruals":[{"id":3,"account_id":5,"date":"2030-11-01","balance":3650,"interest_rate":"0.02","amount":"0.2","transaction_id":null}]}`)
+
+	rr = accountsOf(&app, "0")
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"user_id":0,"balance":400,"available_balance":400,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":5,"user_id":0,"balance":3650.6,"available_balance":3650.6,"overdraft_limit":0,"currency":"EUR","product":"savings","status":"active"}]`)
+
+	// account 6 is the interest expense account
+	req, _ = http.NewRequest("GET", "/accounts/6/postings", nil)
+	req.SetPathValue("accountId", "6")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetPostings()).ServeHTTP(rr, req)
+	testRequest(t, rr, http.StatusOK, `[{"id":10,"entry_id":5,"account_id":6,"amount":-0.6,"currency":"EUR","description":"interest","timestamp":"2030-10-07T12:44:22+05:30"}]`)
+}
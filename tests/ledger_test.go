@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLedgerPostings(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	reader := strings.NewReader(`{"from_account_id": 1, "to_account_id": 2, "amount": 12.5}`)
+	createReq, _ := http.NewRequest("POST", "/transaction/", reader)
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, createReq)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// the fixture balance is an opening entry, followed by the transfer
+	postingsReq, _ := http.NewRequest("GET", "/accounts/2/postings", nil)
+	postingsReq.SetPathValue("accountId", "2")
+	postingsReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(postingsReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetPostings()).ServeHTTP(rr, postingsReq)
+	testRequest(t, rr, http.StatusOK, `[{"id":5,"entry_id":2,"account_id":2,"amount":200,"currency":"EUR","description":"opening balance","timestamp":"2030-10-07T12:44:22+05:30"},`+
+		`{"id":9,"entry_id":4,"account_id":2,"amount":12.5,"currency":"EUR","description":"transfer","timestamp":"2030-10-07T12:44:22+05:30"}]`)
+
+	postingsReq, _ = http.NewRequest("GET", "/accounts/99/postings", nil)
+	postingsReq.SetPathValue("accountId", "99")
+	postingsReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(postingsReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetPostings()).ServeHTTP(rr, postingsReq)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 99 does not exist`)
+
+	verifyReq, _ := http.NewRequest("GET", "/ledger/verify", nil)
+	verifyReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(verifyReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.VerifyLedger()).ServeHTTP(rr, verifyReq)
+	testRequest(t, rr, http.StatusOK, `[]`)
+}
+
+func TestLedgerCrossCurrencyPostings(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rateReq, _ := http.NewRequest("PUT", "/exchange-rates/EUR/JPY", strings.NewReader(`{"rate": 161.5}`))
+	rateReq.SetPathValue("from", "EUR")
+	rateReq.SetPathValue("to", "JPY")
+	rateReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(rateReq)
+	http.HandlerFunc(app.SetExchangeRate()).ServeHTTP(httptest.NewRecorder(), rateReq)
+
+	accountReq, _ := http.NewRequest("POST", "/account/", strings.NewReader(`{"user_id": 0, "currency": "JPY"}`))
+	accountReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accountReq)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(rr, accountReq)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"user_id":0,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"JPY","product":"checking","status":"active"}`)
+
+	createReq, _ := http.NewRequest("POST", "/transaction/", strings.NewReader(`{"from_account_id": 0, "to_account_id": 5, "amount": 10}`))
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, createReq)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	// the exchange accounts 6 (EUR) and 7 (JPY) take the other side of each currency
+	for accountId, expected := range map[string]string{
+		"6": `[{"id":9,"entry_id":4,"account_id":6,"amount":10,"currency":"EUR","description":"transfer","timestamp":"2030-10-07T12:44:22+05:30"}]`,
+		"7": `[{"id":10,"entry_id":4,"account_id":7,"amount":-1615,"currency":"JPY","description":"transfer","timestamp":"2030-10-07T12:44:22+05:30"}]`,
+	} {
+		postingsReq, _ := http.NewRequest("GET", "/accounts/"+accountId+"/postings", nil)
+		postingsReq.SetPathValue("accountId", accountId)
+		postingsReq.RemoteAddr = "127.0.0.1:8080"
+		signIn(postingsReq)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(app.GetPostings()).ServeHTTP(rr, postingsReq)
+		testRequest(t, rr, http.StatusOK, expected)
+	}
+
+	verifyReq, _ := http.NewRequest("GET", "/ledger/verify", nil)
+	verifyReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(verifyReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.VerifyLedger()).ServeHTTP(rr, verifyReq)
+	testRequest(t, rr, http.StatusOK, `[]`)
+}
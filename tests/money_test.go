@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CobilasEugen/bank-api/db"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		value    string
+		currency string
+		expected int64
+	}{
+		{"12.34", "EUR", 1234},
+		{"12.3", "EUR", 1230},
+		{"12.300", "EUR", 1230},
+		{"-0.05", "EUR", -5},
+		{"1000", "JPY", 1000},
+		{"1.005", "KWD", 1005},
+	}
+
+	for _, c := range cases {
+		money, err := db.ParseMoney(c.value, c.currency)
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %s) returned error: %v", c.value, c.currency, err)
+			continue
+		}
+		if money.Amount != c.expected || money.Currency != c.currency {
+			t.Errorf("ParseMoney(%q, %s) = %v, want %d minor units", c.value, c.currency, money, c.expected)
+		}
+	}
+
+	for _, value := range []string{"12.345", "1.5e2", "abc", "", "."} {
+		if _, err := db.ParseMoney(value, "EUR"); err == nil {
+			t.Errorf("ParseMoney(%q, EUR) should have failed", value)
+		}
+	}
+	if _, err := db.ParseMoney("10.5", "JPY"); err == nil {
+		t.Errorf("ParseMoney(10.5, JPY) should have failed")
+	}
+	if _, err := db.ParseMoney("10", "XXX"); err == nil {
+		t.Errorf("ParseMoney(10, XXX) should have failed")
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	// 0.1 + 0.2 drifts to 0.30000000000000004, which is still exactly 30 cents
+	money, err := db.MoneyFromFloat(0.1+0.2, "EUR")
+	if err != nil || money.Amount != 30 {
+		t.Errorf("MoneyFromFloat(0.1+0.2) = %v, %v, want 30 minor units", money, err)
+	}
+
+	if _, err := db.MoneyFromFloat(10.005, "EUR"); err == nil {
+		t.Errorf("MoneyFromFloat(10.005, EUR) should have failed")
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	cases := map[string]db.Money{
+		"200":   db.NewMoney(20000, "EUR"),
+		"12.3":  db.NewMoney(1230, "EUR"),
+		"-0.05": db.NewMoney(-5, "EUR"),
+		"1000":  db.NewMoney(1000, "JPY"),
+	}
+
+	for expected, money := range cases {
+		encoded, err := json.Marshal(money)
+		if err != nil || string(encoded) != expected {
+			t.Errorf("json.Marshal(%v) = %s, %v, want %s", money, encoded, err, expected)
+		}
+	}
+}
+
+func TestTransactionAmountPrecision(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	createHandler := http.HandlerFunc(app.CreateTransaction())
+	reader := strings.NewReader(`{
+		"from_account_id": 1,
+		"to_account_id": 2,
+		"amount": 0.001
+	}`)
+	createReq, _ := http.NewRequest("POST", "/transaction/", reader)
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr := httptest.NewRecorder()
+	createHandler.ServeHTTP(rr, createReq)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	reader = strings.NewReader(`{
+		"from_account_id": 1,
+		"to_account_id": 2,
+		"amount": 0.1
+	}`)
+	for range 3 {
+		createReq, _ = http.NewRequest("POST", "/transaction/", reader)
+		createReq.RemoteAddr = "127.0.0.1:8080"
+		signIn(createReq)
+		rr = httptest.NewRecorder()
+		createHandler.ServeHTTP(rr, createReq)
+		reader.Seek(0, io.SeekStart)
+	}
+
+	accReq, _ := http.NewRequest("GET", "/account/2", nil)
+	accReq.SetPathValue("userId", "2")
+	accReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccounts()).ServeHTTP(rr, accReq)
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"user_id":2,"balance":200.3,"available_balance":200.3,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"},{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func overdraftRequest(app *router.App, accountId string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", "/accounts/"+accountId+"/overdraft-limit", strings.NewReader(body))
+	req.SetPathValue("accountId", accountId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.SetOverdraftLimit()).ServeHTTP(rr, req)
+	return rr
+}
+
+func transactionRequest(app *router.App, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/transaction", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestOverdraftLimit(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := overdraftRequest(&app, "2", `{"limit": -10}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_amount", `invalid amount -10.00: must not be negative`)
+
+	rr = overdraftRequest(&app, "9", `{"limit": 10}`)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+
+	rr = overdraftRequest(&app, "2", `{"limit": 100}`)
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":200,"available_balance":200,"overdraft_limit":100,"currency":"EUR","product":"checking","status":"active"}`)
+
+	// the balance may go below zero, down to the limit
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 250}`)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":2,"to_account_id":3,"amount":250,"currency":"EUR","to_amount":250,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 60}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"from_account_id":2,"to_account_id":3,"amount":60,"currency":"EUR","to_amount":60,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"overdraft_limit_exceeded"}`)
+
+	// holds can use the overdraft as well
+	rr = requestAs(app.CreateHold(), 0, "POST", "/holds", `{"from_account_id": 2, "to_account_id": 3, "amount": 60}`)
+	testError(t, rr, http.StatusConflict, "insufficient_funds", `account 2 has 50.00 EUR, which does not cover 60.00 EUR`)
+
+	// lowering the limit below what is owed is allowed, but nothing more can be spent
+	rr = overdraftRequest(&app, "2", `{"limit": 0}`)
+	testRequest(t, rr, http.StatusOK, `{"id":2,"user_id":2,"balance":-50,"available_balance":-50,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 1}`)
+	testRequest(t, rr, http.StatusOK, `{"id":6,"from_account_id":2,"to_account_id":3,"amount":1,"currency":"EUR","to_amount":1,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds"}`)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"github.com/CobilasEugen/bank-api/scheduler"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func uploadPaymentFile(app *router.App, contentType string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/payment-files", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreatePaymentFile()).ServeHTTP(rr, req)
+	return rr
+}
+
+func paymentFileRequest(app *router.App, fileId string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/payment-files/"+fileId, nil)
+	req.SetPathValue("fileId", fileId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.GetPaymentFile()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCSVPaymentFile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// account 2 holds 200, so its second payment fails
+	rr := uploadPaymentFile(&app, "text/csv", "from_account_id,to_account_id,amount,reference\n"+
+		"0,1,100.50,rent\n"+
+		"2,3,150,invoice 1\n"+
+		"2,0,100,invoice 2\n")
+	testRequest(t, rr, http.StatusCreated, `{"id":0,"format":"csv","status":"completed","created_at":"2030-10-07T12:44:22+05:30","pending":0,"succeeded":2,"failed":1,"lines":[`+
+		`{"line":2,"reference":"rent","from_account_id":0,"to_account_id":1,"amount":100.5,"currency":"EUR","status":"succeeded","transaction_id":4},`+
+		`{"line":3,"reference":"invoice 1","from_account_id":2,"to_account_id":3,"amount":150,"currency":"EUR","status":"succeeded","transaction_id":5},`+
+		`{"line":4,"reference":"invoice 2","from_account_id":2,"to_account_id":0,"amount":100,"currency":"EUR","status":"failed","transaction_id":6,"error":"insufficient_funds"}]}`)
+	if location := rr.Header().Get("Location"); location != "/payment-files/0" {
+		t.Errorf("handler returned wrong location: got %s want /payment-files/0", location)
+	}
+
+	rr = paymentFileRequest(&app, "0")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"succeeded":2,"failed":1`) {
+		t.Errorf("payment file was not stored: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = paymentFileRequest(&app, "1")
+	testError(t, rr, http.StatusNotFound, "payment_file_not_found", `payment file 1 does not exist`)
+}
+
+func TestPain001PaymentFile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := uploadPaymentFile(&app, "application/xml", `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr><MsgId>MSG-1</MsgId><NbOfTxs>2</NbOfTxs></GrpHdr>
+    <PmtInf>
+      <PmtInfId>PMT-1</PmtInfId>
+      <DbtrAcct><Id><Othr><Id>1</Id></Othr></Id></DbtrAcct>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-1</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="EUR">250.00</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>0</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId><EndToEndId>E2E-2</EndToEndId></PmtId>
+        <Amt><InstdAmt Ccy="EUR">50</InstdAmt></Amt>
+        <CdtrAcct><Id><Othr><Id>3</Id></Othr></Id></CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`)
+	testRequest(t, rr, http.StatusCreated, `{"id":0,"format":"pain.001","status":"completed","created_at":"2030-10-07T12:44:22+05:30","pending":0,"succeeded":2,"failed":0,"lines":[`+
+		`{"line":1,"reference":"E2E-1","from_account_id":1,"to_account_id":0,"amount":250,"currency":"EUR","status":"succeeded","transaction_id":4},`+
+		`{"line":2,"reference":"E2E-2","from_account_id":1,"to_account_id":3,"amount":50,"currency":"EUR","status":"succeeded","transaction_id":5}]}`)
+
+	// the group header has to match the transactions of the file
+	rr = uploadPaymentFile(&app, "application/xml", `<Document><CstmrCdtTrfInitn><GrpHdr><NbOfTxs>3</NbOfTxs></GrpHdr></CstmrCdtTrfInitn></Document>`)
+	testError(t, rr, http.StatusBadRequest, "invalid_payment_file", `invalid payment file: the group header announces 3 transactions, but the file holds 0`)
+}
+
+func TestRejectedPaymentFile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// a file with an invalid line is not executed at all, and the report names every invalid line
+	rr := uploadPaymentFile(&app, "text/csv", "from_account_id,to_account_id,amount,currency\n"+
+		"0,1,100,EUR\n"+
+		"0,9,100,EUR\n"+
+		"0,1,-5,EUR\n"+
+		"0,1,5,USD\n"+
+		"x,1,5,EUR\n")
+	testError(t, rr, http.StatusUnprocessableEntity, "invalid_payment_file", `invalid payment file: 4 of 5 lines are invalid`)
+	expected := `"details":{"lines":[` +
+		`{"line":3,"from_account_id":0,"to_account_id":9,"amount":0,"currency":"EUR","status":"rejected","error":"account 9 does not exist"},` +
+		`{"line":4,"from_account_id":0,"to_account_id":1,"amount":0,"currency":"EUR","status":"rejected","error":"invalid amount -5.00: must be positive"},` +
+		`{"line":5,"from_account_id":0,"to_account_id":1,"amount":0,"currency":"USD","status":"rejected","error":"expected an amount in EUR, got USD"},` +
+		`{"line":6,"from_account_id":0,"to_account_id":1,"amount":0,"currency":"EUR","status":"rejected","error":"invalid from_account_id \"x\""}]}`
+	if !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("handler returned unexpected rejected lines: %s", rr.Body.String())
+	}
+
+	rr = paymentFileRequest(&app, "0")
+	testError(t, rr, http.StatusNotFound, "payment_file_not_found", `payment file 0 does not exist`)
+
+	rr = uploadPaymentFile(&app, "text/csv", "from_account_id,amount\n0,100\n")
+	testError(t, rr, http.StatusBadRequest, "invalid_payment_file", `invalid payment file: the header has no to_account_id column`)
+
+	rr = uploadPaymentFile(&app, "text/csv", "from_account_id,to_account_id,amount\n")
+	testError(t, rr, http.StatusBadRequest, "invalid_payment_file", `invalid payment file: the file holds no payments`)
+}
+
+func TestPaymentFileFailuresAreNotLimited(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// account 2 holds 200, so three of the payments fail, which does not lock its owner out of transfers
+	rr := uploadPaymentFile(&app, "text/csv", "from_account_id,to_account_id,amount\n"+
+		"2,0,500\n"+
+		"2,0,500\n"+
+		"2,0,500\n")
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"succeeded":0,"failed":3`) {
+		t.Fatalf("payments should have failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = transactionRequest(&app, `{"from_account_id": 2, "to_account_id": 3, "amount": 50}`)
+	testStatus(t, rr, http.StatusOK)
+}
+
+func TestLargePaymentFile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// files with more than 100 payments are executed in the background
+	file := "from_account_id,to_account_id,amount\n"
+	for range 150 {
+		file += "1,0,1\n"
+	}
+	rr := uploadPaymentFile(&app, "text/csv", file)
+	if rr.Code != http.StatusAccepted || !strings.Contains(rr.Body.String(), `"status":"pending","created_at":"2030-10-07T12:44:22+05:30","pending":150`) {
+		t.Errorf("payment file was not accepted: %d %s", rr.Code, rr.Body.String())
+	}
+
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("payment files", scheduler.PaymentFiles(app.Db))
+	tasks.RunOnce(time.Now())
+
+	rr = paymentFileRequest(&app, "0")
+	if !strings.Contains(rr.Body.String(), `"status":"completed","created_at":"2030-10-07T12:44:22+05:30","pending":0,"succeeded":150,"failed":0`) {
+		t.Errorf("payment file was not executed: %s", rr.Body.String())
+	}
+
+	account, _ := app.Db.GetAccount(0)
+	if balance := account.Balance.Decimal(); balance != "550.00" {
+		t.Errorf("wrong balance after payment file: got %s want 550.00", balance)
+	}
+}
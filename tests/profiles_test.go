@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createUserRequest(app *router.App, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/user", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateUser()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateUserProfile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// profile fields are normalized
+	rr := createUserRequest(&app, `{
+		"name": "  Dana   Scully ",
+		"email": " Dana.Scully@FBI.gov ",
+		"phone": "001 (202) 555-0143",
+		"date_of_birth": "1964-02-23",
+		"address": {"line1": " 935 Pennsylvania Ave NW ", "city": "Washington", "postal_code": "20535", "country": "us"}
+	}`)
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Dana Scully","role":"customer","email":"dana.scully@fbi.gov","phone":"+12025550143","date_of_birth":"1964-02-23",`+
+		`"address":{"line1":"935 Pennsylvania Ave NW","city":"Washington","postal_code":"20535","country":"US"}}`)
+	rr = requestAs(app.GetUser(), 0, "GET", "/user/3", "", "userId", "3")
+	testRequest(t, rr, http.StatusOK, `{"id":3,"name":"Dana Scully","role":"customer","email":"dana.scully@fbi.gov","phone":"+12025550143","date_of_birth":"1964-02-23",`+
+		`"address":{"line1":"935 Pennsylvania Ave NW","city":"Washington","postal_code":"20535","country":"US"}}`)
+
+	// emails are unique, whatever their case
+	rr = createUserRequest(&app, `{"name": "Fox", "email": "DANA.SCULLY@fbi.gov"}`)
+	testError(t, rr, http.StatusConflict, "email_taken", `email dana.scully@fbi.gov is already used by another user`)
+
+	for body, expected := range map[string]string{
+		`{"name": " "}`:                                                             `invalid name: must not be empty`,
+		`{"name": "Fox", "email": "fox"}`:                                           `invalid email: "fox" is not an email address`,
+		`{"name": "Fox", "email": "Fox <f@x.org>"}`:                                 `invalid email: "fox <f@x.org>" is not an email address`,
+		`{"name": "Fox", "phone": "555-0143"}`:                                      `invalid phone: must be an international number with country code, e.g. +4930123456`,
+		`{"name": "Fox", "date_of_birth": "1961"}`:                                  `invalid date_of_birth: must be a date like 1990-12-31`,
+		`{"name": "Fox", "date_of_birth": "2999-01-01"}`:                            `invalid date_of_birth: must not be in the future`,
+		`{"name": "Fox", "address": {"line1": "x", "city": "y", "country": "USA"}}`: `invalid address: country must be an ISO 3166-1 alpha-2 code, e.g. DE`,
+		`{"name": "Fox", "address": {"city": "y", "country": "US"}}`:                `invalid address: line1 must not be empty`,
+	} {
+		rr = createUserRequest(&app, body)
+		testError(t, rr, http.StatusBadRequest, "invalid_user", expected)
+	}
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// only the given fields change
+	rr := requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"email": "bob@example.com", "address": {"line1": "1 Main St", "city": "Chisinau", "country": "md"}}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob","role":"customer","email":"bob@example.com","address":{"line1":"1 Main St","city":"Chisinau","country":"MD"}}`)
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"name": "Robert", "address": {}}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Robert","role":"customer","email":"bob@example.com"}`)
+	rr = requestAs(app.GetUser(), 0, "GET", "/user/1", "", "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Robert","role":"customer","email":"bob@example.com"}`)
+
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/2", `{"email": "Bob@Example.com"}`, "userId", "2")
+	testError(t, rr, http.StatusConflict, "email_taken", `email bob@example.com is already used by another user`)
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"name": " "}`, "userId", "1")
+	testError(t, rr, http.StatusBadRequest, "invalid_user", `invalid name: must not be empty`)
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/9", `{"name": "Dan"}`, "userId", "9")
+	testError(t, rr, http.StatusNotFound, "user_not_found", `user 9 does not exist`)
+
+	rr = requestAs(app.UpdateUser(), 0, "PATCH", "/user/1", `{"email": ""}`, "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Robert","role":"customer"}`)
+}
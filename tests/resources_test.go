@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetAccount(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.GetAccount(), 0, "GET", "/accounts/3", "", "accountId", "3")
+	testRequest(t, rr, http.StatusOK, `{"id":3,"user_id":2,"balance":300,"available_balance":300,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}`)
+
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/9", "", "accountId", "9")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+
+	rr = requestAs(app.GetAccount(), 0, "GET", "/accounts/first", "", "accountId", "first")
+	testError(t, rr, http.StatusBadRequest, "invalid_id", `Invalid account id`)
+}
+
+func TestGetTransaction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.GetTransaction(), 0, "GET", "/transactions/2", "", "transactionId", "2")
+	testRequest(t, rr, http.StatusOK, `{"id":2,"from_account_id":0,"to_account_id":2,"amount":500,"currency":"EUR","to_amount":500,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds"}`)
+
+	rr = requestAs(app.GetTransaction(), 0, "GET", "/transactions/9", "", "transactionId", "9")
+	testError(t, rr, http.StatusNotFound, "transaction_not_found", `transaction 9 does not exist`)
+}
+
+func TestAccountTransactions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// account 4 is the bank's opening balance account
+	req, _ := http.NewRequest("POST", "/account", strings.NewReader(`{"user_id": 0, "balance": 100}`))
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, body := range []string{
+		`{"from_account_id": 0, "to_account_id": 5, "amount": 50}`,
+		`{"from_account_id": 5, "to_account_id": 1, "amount": 30}`,
+		`{"from_account_id": 5, "to_account_id": 1, "amount": 500}`,
+	} {
+		transactionRequest(&app, body)
+	}
+
+	// the failed transaction leaves the balance as it was
+	rr := requestAs(app.GetAccountTransactions(), 0, "GET", "/accounts/5/transactions", "", "accountId", "5")
+	testRequest(t, rr, http.StatusOK, `[{"id":4,"from_account_id":0,"to_account_id":5,"amount":50,"currency":"EUR","to_amount":50,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"direction":"incoming","running_balance":150},{"id":5,"from_account_id":5,"to_account_id":1,"amount":30,"currency":"EUR","to_amount":30,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"direction":"outgoing","running_balance":120},{"id":6,"from_account_id":5,"to_account_id":1,"amount":500,"currency":"EUR","to_amount":500,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds","direction":"outgoing","running_balance":120}]`)
+
+	rr = requestAs(app.GetAccountTransactions(), 0, "GET", "/accounts/9/transactions", "", "accountId", "9")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+}
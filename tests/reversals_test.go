@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func reverseRequest(app interface{ ReverseTransaction() http.HandlerFunc }, transactionId string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/transaction/"+transactionId+"/reverse", strings.NewReader(body))
+	req.SetPathValue("transactionId", transactionId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.ReverseTransaction()).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestReverseTransaction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	createReq, _ := http.NewRequest("POST", "/transaction", strings.NewReader(`{"from_account_id": 1, "to_account_id": 2, "amount": 100}`))
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, createReq)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	rr = reverseRequest(&app, "4", `{"amount": 30}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"from_account_id":2,"to_account_id":1,"amount":30,"currency":"EUR","to_amount":30,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"reversal_of":4}`)
+
+	rr = reverseRequest(&app, "4", `{"amount": 80}`)
+	testError(t, rr, http.StatusConflict, "reversal_not_allowed", `cannot reverse transaction 4: only 70.00 EUR is left to reverse`)
+
+	// without an amount, the rest of the transaction is reversed
+	rr = reverseRequest(&app, "4", ``)
+	testRequest(t, rr, http.StatusOK, `{"id":6,"from_account_id":2,"to_account_id":1,"amount":70,"currency":"EUR","to_amount":70,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"reversal_of":4}`)
+
+	rr = reverseRequest(&app, "4", ``)
+	testError(t, rr, http.StatusConflict, "reversal_not_allowed", `cannot reverse transaction 4: the transaction was already fully reversed`)
+
+	rr = reverseRequest(&app, "5", ``)
+	testError(t, rr, http.StatusConflict, "reversal_not_allowed", `cannot reverse transaction 5: the transaction is itself a reversal`)
+
+	rr = reverseRequest(&app, "1", ``)
+	testError(t, rr, http.StatusConflict, "reversal_not_allowed", `cannot reverse transaction 1: the transaction did not succeed`)
+
+	rr = reverseRequest(&app, "42", ``)
+	testError(t, rr, http.StatusNotFound, "transaction_not_found", `transaction 42 does not exist`)
+
+	accReq, _ := http.NewRequest("GET", "/account/1", nil)
+	accReq.SetPathValue("userId", "1")
+	accReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetAccounts()).ServeHTTP(rr, accReq)
+	testRequest(t, rr, http.StatusOK, `[{"id":1,"user_id":1,"balance":900,"available_balance":900,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"active"}]`)
+}
+
+func TestReverseCrossCurrencyTransaction(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rateReq, _ := http.NewRequest("PUT", "/exchange-rates/EUR/USD", strings.NewReader(`{"rate": "1.0842"}`))
+	rateReq.SetPathValue("from", "EUR")
+	rateReq.SetPathValue("to", "USD")
+	rateReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(rateReq)
+	http.HandlerFunc(app.SetExchangeRate()).ServeHTTP(httptest.NewRecorder(), rateReq)
+
+	accountReq, _ := http.NewRequest("POST", "/account", strings.NewReader(`{"user_id": 2, "currency": "USD"}`))
+	accountReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(accountReq)
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(httptest.NewRecorder(), accountReq)
+
+	createReq, _ := http.NewRequest("POST", "/transaction", strings.NewReader(`{"from_account_id": 1, "to_account_id": 5, "amount": 0.05}`))
+	createReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(createReq)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.CreateTransaction()).ServeHTTP(rr, createReq)
+	testRequest(t, rr, http.StatusOK, `{"id":4,"from_account_id":1,"to_account_id":5,"amount":0.05,"currency":"EUR","to_amount":0.05,"to_currency":"USD","exchange_rate":"1.0842","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1}`)
+
+	// each partial reversal converts at the original rate, and together they never take back more than was received
+	rr = reverseRequest(&app, "4", `{"amount": 0.03}`)
+	testRequest(t, rr, http.StatusOK, `{"id":5,"from_account_id":5,"to_account_id":1,"amount":0.03,"currency":"USD","to_amount":0.03,"to_currency":"EUR","exchange_rate":"0.9223390518","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"reversal_of":4}`)
+	rr = reverseRequest(&app, "4", ``)
+	testRequest(t, rr, http.StatusOK, `{"id":6,"from_account_id":5,"to_account_id":1,"amount":0.02,"currency":"USD","to_amount":0.02,"to_currency":"EUR","exchange_rate":"0.9223390518","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"reversal_of":4}`)
+
+	verifyReq, _ := http.NewRequest("GET", "/ledger/verify", nil)
+	verifyReq.RemoteAddr = "127.0.0.1:8080"
+	signIn(verifyReq)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.VerifyLedger()).ServeHTTP(rr, verifyReq)
+	testRequest(t, rr, http.StatusOK, `[]`)
+}
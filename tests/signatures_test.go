@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/CobilasEugen/bank-api/auth"
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest calls handler as an API client with a request signed at timestamp; signedBody is the
+// body the signature is made for, which is also sent unless body is given
+func signedRequest(handler http.HandlerFunc, client registeredClient, timestamp time.Time, nonce string, signedBody string, body ...string) *httptest.ResponseRecorder {
+	sent := signedBody
+	if len(body) > 0 {
+		sent = body[0]
+	}
+	req, _ := http.NewRequest("POST", "/transaction", strings.NewReader(sent))
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set("X-API-Key", client.APIKey)
+
+	unix := fmt.Sprint(timestamp.Unix())
+	req.Header.Set("X-Signature-Timestamp", unix)
+	req.Header.Set("X-Signature-Nonce", nonce)
+	req.Header.Set("X-Signature", auth.SignRequest(client.SigningSecret, auth.StringToSign("POST", "/transaction", unix, nonce, []byte(signedBody))))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSignedRequests(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+	client := registerClient(t, &app, 1, `{"name": "payroll", "scopes": ["transactions:write"]}`)
+	handler := app.CreateTransaction()
+	body := `{"from_account_id": 1, "to_account_id": 0, "amount": 10}`
+
+	rr := clientRequest(handler, "X-API-Key", client.APIKey, "POST", "", "", body)
+	testError(t, rr, http.StatusUnauthorized, "invalid_signature", "This request has to be signed, with the X-Signature, X-Signature-Timestamp and X-Signature-Nonce headers")
+
+	rr = signedRequest(handler, client, time.Now(), "nonce-0123456789abcdef", body)
+	testStatus(t, rr, http.StatusOK)
+
+	// a request cannot be sent again, or changed
+	rr = signedRequest(handler, client, time.Now(), "nonce-0123456789abcdef", body)
+	testError(t, rr, http.StatusUnauthorized, "replayed_request", "X-Signature-Nonce was already used")
+	rr = signedRequest(handler, client, time.Now(), "nonce-1123456789abcdef", body, `{"from_account_id": 1, "to_account_id": 0, "amount": 1000}`)
+	testError(t, rr, http.StatusUnauthorized, "invalid_signature", "Invalid signature")
+	rr = signedRequest(handler, client, time.Now().Add(-6*time.Minute), "nonce-2123456789abcdef", body)
+	testError(t, rr, http.StatusUnauthorized, "invalid_signature", "X-Signature-Timestamp is more than 5m0s away from the time of the server")
+	rr = signedRequest(handler, client, time.Now(), "short", body)
+	testError(t, rr, http.StatusUnauthorized, "invalid_signature", "Invalid X-Signature-Nonce: must be 16 to 128 letters, digits, _ or -")
+
+	// a signature that was refused does not use up the nonce
+	rr = signedRequest(handler, client, time.Now(), "nonce-1123456789abcdef", body)
+	testStatus(t, rr, http.StatusOK)
+
+	// users share no secret with the server and do not sign their requests
+	rr = requestAs(handler, 1, "POST", "/transaction", body)
+	testStatus(t, rr, http.StatusOK)
+}
+
+func TestSignedRoutes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+	client := registerClient(t, &app, 1, `{"name": "payroll", "scopes": ["accounts:write", "transactions:write"]}`)
+
+	// every route that moves or reserves money needs a signature, so none of them is a way around another
+	for name, handler := range map[string]http.HandlerFunc{
+		"payment file":          app.CreatePaymentFile(),
+		"hold":                  app.CreateHold(),
+		"standing order":        app.CreateStandingOrder(),
+		"standing order change": app.UpdateStandingOrder(),
+		"account closure":       app.CloseAccount(),
+	} {
+		rr := clientRequest(handler, "X-API-Key", client.APIKey, "POST", "", "", "")
+		if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), `"invalid_signature"`) {
+			t.Errorf("%s: expected an unsigned request to be refused, got %d: %s", name, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	store := router.NewNonceStore(2, time.Minute)
+	now := time.Now()
+
+	for _, test := range []struct {
+		key      string
+		at       time.Time
+		expected bool
+		full     bool
+	}{
+		{"a", now, true, false},
+		{"b", now, true, false},
+		{"a", now.Add(time.Second), false, false},
+		{"c", now.Add(time.Second), false, true},
+		// a and b expired, so there is room again
+		{"c", now.Add(time.Minute), true, false},
+		{"a", now.Add(time.Minute), true, false},
+		{"c", now.Add(time.Minute), false, false},
+	} {
+		fresh, err := store.Use(test.key, test.at)
+		if fresh != test.expected || (err != nil) != test.full {
+			t.Errorf("Use(%s) at %s: got %v, %v", test.key, test.at.Sub(now), fresh, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateAccount(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.UpdateAccount(), 0, "PATCH", "/accounts/0", `{"product": "savings"}`, "accountId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"user_id":0,"balance":400,"available_balance":400,"overdraft_limit":0,"currency":"EUR","product":"savings","status":"active"}`)
+
+	rr = requestAs(app.UpdateAccount(), 0, "PATCH", "/accounts/0", `{"product": "gold"}`, "accountId", "0")
+	testError(t, rr, http.StatusBadRequest, "product_not_found", `account product "gold" does not exist`)
+	rr = requestAs(app.UpdateAccount(), 0, "PATCH", "/accounts/9", `{"product": "savings"}`, "accountId", "9")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+}
+
+func TestDeleteAccountAndUser(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// accounts that hold money cannot be deleted, and neither can users with accounts
+	rr := requestAs(app.DeleteAccount(), 0, "DELETE", "/accounts/1", "", "accountId", "1")
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `account 1 is active: cannot be deleted with a balance of 900.00 EUR`)
+	rr = requestAs(app.DeleteUser(), 0, "DELETE", "/user/1", "", "userId", "1")
+	testError(t, rr, http.StatusConflict, "user_has_accounts", `user 1 still has 1 accounts, which have to be deleted first`)
+
+	rr = batchTransferRequest(&app, `{"legs": [{"from_account_id": 1, "to_account_id": 0, "amount": 900}]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("could not empty account 1: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = requestAs(app.DeleteAccount(), 0, "DELETE", "/accounts/1", "", "accountId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"user_id":1,"balance":0,"available_balance":0,"overdraft_limit":0,"currency":"EUR","product":"checking","status":"closed","deleted_at":"2030-10-07T12:44:22+05:30"}`)
+	rr = requestAs(app.DeleteAccount(), 0, "DELETE", "/accounts/1", "", "accountId", "1")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 1 does not exist`)
+	rr = requestAs(app.UpdateAccount(), 0, "PATCH", "/accounts/1", `{"product": "savings"}`, "accountId", "1")
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 1 does not exist`)
+
+	// deleted accounts are hidden, cannot receive money, and keep their transactions
+	rr = requestAs(app.GetAccounts(), 0, "GET", "/account/1", "", "userId", "1")
+	testRequest(t, rr, http.StatusOK, `[]`)
+	rr = batchTransferRequest(&app, `{"legs": [{"from_account_id": 0, "to_account_id": 1, "amount": 10}]}`)
+	testError(t, rr, http.StatusConflict, "account_status_conflict", `leg 1: account 1 is closed: cannot receive money`)
+	rr = historyRequest(&app, "/transaction/out/1")
+	testRequest(t, rr, http.StatusOK, `[{"id":4,"from_account_id":1,"to_account_id":0,"amount":900,"currency":"EUR","to_amount":900,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"batch_id":0}]`)
+
+	rr = requestAs(app.DeleteUser(), 0, "DELETE", "/user/1", "", "userId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"name":"Bob","role":"customer","deleted_at":"2030-10-07T12:44:22+05:30"}`)
+	rr = requestAs(app.GetUser(), 0, "GET", "/user/1", "", "userId", "1")
+	testError(t, rr, http.StatusNotFound, "user_not_found", `user 1 does not exist`)
+	rr = requestAs(app.DeleteUser(), 0, "DELETE", "/user/1", "", "userId", "1")
+	testError(t, rr, http.StatusNotFound, "user_not_found", `user 1 does not exist`)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/CobilasEugen/bank-api/db"
+	_ "github.com/mattn/go-sqlite3"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newSQLiteDb opens an empty database in a temporary directory, so the SQL the mock stands in for is tested too
+func newSQLiteDb(t *testing.T) (*db.SQLiteDb, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bank.db")
+	sqlite, err := db.OpenSQLiteDb(path)
+	if err != nil {
+		t.Fatalf("could not open database: %s", err)
+	}
+	t.Cleanup(func() { _ = sqlite.Close() })
+	return &sqlite, path
+}
+
+// sqliteAccounts creates a user with an account for each of balances, in euros
+func sqliteAccounts(t *testing.T, sqlite *db.SQLiteDb, name string, balances ...int64) []db.Account {
+	t.Helper()
+	user, err := sqlite.CreateUser(db.User{Name: name})
+	if err != nil {
+		t.Fatalf("could not create user: %s", err)
+	}
+	accounts := []db.Account{}
+	for _, balance := range balances {
+		account, err := sqlite.CreateAccount(user.ID, db.NewMoney(balance, db.DefaultCurrency), db.DefaultProduct)
+		if err != nil {
+			t.Fatalf("could not create account: %s", err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+func testBalance(t *testing.T, sqlite *db.SQLiteDb, accountId int, balance string, available string) {
+	t.Helper()
+	account, err := sqlite.GetAccount(accountId)
+	if err != nil {
+		t.Fatalf("could not get account %d: %s", accountId, err)
+	}
+	if account.Balance.String() != balance || account.AvailableBalance.String() != available {
+		t.Errorf("account %d: got balance %s, available %s, want %s, %s", accountId, account.Balance, account.AvailableBalance, balance, available)
+	}
+}
+
+func testLedgerBalances(t *testing.T, sqlite *db.SQLiteDb) {
+	t.Helper()
+	discrepancies, err := sqlite.VerifyLedger()
+	if err != nil {
+		t.Fatalf("could not verify ledger: %s", err)
+	}
+	if len(discrepancies) != 0 {
+		t.Errorf("ledger does not balance: %+v", discrepancies)
+	}
+}
+
+func TestSQLiteLedger(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	alice := sqliteAccounts(t, sqlite, "Alice", 10000)
+	bob := sqliteAccounts(t, sqlite, "Bob", 0)
+
+	transaction, err := sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(1250, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 1 {
+		t.Fatalf("transfer failed: %+v, %v", transaction, err)
+	}
+	// more than the balance fails, and moves nothing
+	transaction, err = sqlite.CreateTransaction(bob[0].ID, alice[0].ID, db.NewMoney(5000, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 0 || transaction.FailureReason != db.FailureInsufficientFunds {
+		t.Fatalf("transfer should have failed: %+v, %v", transaction, err)
+	}
+
+	testBalance(t, sqlite, alice[0].ID, "87.50 EUR", "87.50 EUR")
+	testBalance(t, sqlite, bob[0].ID, "12.50 EUR", "12.50 EUR")
+
+	// the opening balance is a deposit from the bank, followed by the transfer
+	postings, err := sqlite.GetPostings(alice[0].ID)
+	if err != nil {
+		t.Fatalf("could not get postings: %s", err)
+	}
+	if len(postings) != 2 || postings[0].Description != "opening balance" || postings[0].Amount.String() != "100.00 EUR" ||
+		postings[1].Description != "transfer" || postings[1].Amount.String() != "-12.50 EUR" || postings[1].EntryID == postings[0].EntryID {
+		t.Errorf("wrong postings: %+v", postings)
+	}
+	postings, err = sqlite.GetPostings(bob[0].ID)
+	if err != nil || len(postings) != 1 || postings[0].Amount.String() != "12.50 EUR" {
+		t.Errorf("wrong postings: %+v, %v", postings, err)
+	}
+	testLedgerBalances(t, sqlite)
+
+	_, err = sqlite.GetPostings(99)
+	var notFound *db.AccountNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("expected AccountNotFoundError, got %v", err)
+	}
+}
+
+func TestSQLiteBatchTransferUnknownAccount(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	alice := sqliteAccounts(t, sqlite, "Alice", 10000, 0)
+
+	_, err := sqlite.CreateBatchTransfer([]db.TransferLeg{
+		{FromAccountID: alice[0].ID, ToAccountID: alice[1].ID, Amount: db.NewMoney(100, db.DefaultCurrency)},
+		{FromAccountID: 99, ToAccountID: alice[1].ID, Amount: db.NewMoney(100, db.DefaultCurrency)},
+	})
+	var notFound *db.AccountNotFoundError
+	if !errors.As(err, &notFound) || err.Error() != "leg 2: account 99 does not exist" {
+		t.Fatalf("expected AccountNotFoundError for leg 2, got %v", err)
+	}
+	testBalance(t, sqlite, alice[0].ID, "100.00 EUR", "100.00 EUR")
+}
+
+func TestSQLiteFailedTransactionsLimit(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	alice := sqliteAccounts(t, sqlite, "Alice", 1000)
+	bob := sqliteAccounts(t, sqlite, "Bob", 0)
+
+	// a payment file and a standing order that the account cannot cover fail three times
+	file, err := sqlite.CreatePaymentFile("csv", []db.PaymentInstruction{
+		{Line: 2, FromAccountID: alice[0].ID, ToAccountID: bob[0].ID, Amount: "50"},
+		{Line: 3, FromAccountID: alice[0].ID, ToAccountID: bob[0].ID, Amount: "50"},
+	})
+	if err != nil {
+		t.Fatalf("could not create payment file: %s", err)
+	}
+	file, err = sqlite.ProcessPaymentFile(file.ID)
+	if err != nil || file.Failed != 2 {
+		t.Fatalf("payment lines should have failed: %+v, %v", file, err)
+	}
+	start := time.Now().Add(-time.Hour)
+	order, err := sqlite.CreateStandingOrder(db.StandingOrder{FromAccountID: alice[0].ID, ToAccountID: bob[0].ID, Amount: db.NewMoney(5000, db.DefaultCurrency), Frequency: "once", StartDate: start})
+	if err != nil {
+		t.Fatalf("could not create standing order: %s", err)
+	}
+	execution, err := sqlite.RunStandingOrder(order.ID, time.Now())
+	if err != nil || execution.Succeeded != 0 {
+		t.Fatalf("standing order run should have failed: %+v, %v", execution, err)
+	}
+
+	// none of them count towards the limit of the customer
+	transaction, err := sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(5000, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 0 {
+		t.Fatalf("transfer should have failed on its own: %+v, %v", transaction, err)
+	}
+	transaction, err = sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(5000, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 0 {
+		t.Fatalf("transfer should have failed on its own: %+v, %v", transaction, err)
+	}
+	transaction, err = sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(5000, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 0 {
+		t.Fatalf("transfer should have failed on its own: %+v, %v", transaction, err)
+	}
+
+	// three failures the customer made do
+	_, err = sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(100, db.DefaultCurrency))
+	var limit *db.FailedTransactionsLimitError
+	if !errors.As(err, &limit) {
+		t.Errorf("expected FailedTransactionsLimitError, got %v", err)
+	}
+}
+
+func TestSQLiteHolds(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	alice := sqliteAccounts(t, sqlite, "Alice", 10000)
+	bob := sqliteAccounts(t, sqlite, "Bob", 0)
+
+	hold, err := sqlite.CreateHold(db.Hold{FromAccountID: alice[0].ID, ToAccountID: bob[0].ID, Amount: db.NewMoney(6000, db.DefaultCurrency)})
+	if err != nil {
+		t.Fatalf("could not create hold: %s", err)
+	}
+	testBalance(t, sqlite, alice[0].ID, "100.00 EUR", "40.00 EUR")
+
+	// held money cannot be spent
+	transaction, err := sqlite.CreateTransaction(alice[0].ID, bob[0].ID, db.NewMoney(5000, db.DefaultCurrency))
+	if err != nil || transaction.Succeeded != 0 {
+		t.Fatalf("transfer of held money should have failed: %+v, %v", transaction, err)
+	}
+
+	captured := db.NewMoney(2500, db.DefaultCurrency)
+	hold, err = sqlite.CaptureHold(hold.ID, &captured)
+	if err != nil || hold.Status != db.HoldCaptured || hold.TransactionID == nil {
+		t.Fatalf("could not capture hold: %+v, %v", hold, err)
+	}
+	testBalance(t, sqlite, alice[0].ID, "75.00 EUR", "75.00 EUR")
+	testBalance(t, sqlite, bob[0].ID, "25.00 EUR", "25.00 EUR")
+	testLedgerBalances(t, sqlite)
+
+	// expired holds release their money, and are returned so they can be audited
+	hold, err = sqlite.CreateHold(db.Hold{FromAccountID: alice[0].ID, ToAccountID: bob[0].ID, Amount: db.NewMoney(1000, db.DefaultCurrency), ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("could not create hold: %s", err)
+	}
+	testBalance(t, sqlite, alice[0].ID, "75.00 EUR", "65.00 EUR")
+	expired, err := sqlite.ExpireHolds(time.Now().Add(2 * time.Hour))
+	if err != nil || len(expired) != 1 || expired[0].ID != hold.ID || expired[0].Status != db.HoldExpired {
+		t.Fatalf("wrong expired holds: %+v, %v", expired, err)
+	}
+	testBalance(t, sqlite, alice[0].ID, "75.00 EUR", "75.00 EUR")
+}
+
+func TestSQLiteInterest(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	user, _ := sqlite.CreateUser(db.User{Name: "Alice"})
+	// 2% a year on 3650 earns 0.20 a day
+	savings, err := sqlite.CreateAccount(user.ID, db.NewMoney(365000, db.DefaultCurrency), "savings")
+	if err != nil {
+		t.Fatalf("could not create account: %s", err)
+	}
+
+	for _, day := range []string{"2030-10-29", "2030-10-29", "2030-11-01"} {
+		through, _ := time.Parse(time.DateOnly, day)
+		if _, err := sqlite.AccrueInterest(through); err != nil {
+			t.Fatalf("could not accrue interest: %s", err)
+		}
+	}
+	interest, err := sqlite.GetAccruedInterest(savings.ID)
+	if err != nil || interest.Amount != "0.8" || len(interest.Accruals) != 4 {
+		t.Fatalf("wrong accrued interest: %+v, %v", interest, err)
+	}
+
+	// October is paid out at the start of November, and only once
+	now, _ := time.Parse(time.RFC3339, "2030-11-02T06:00:00Z")
+	for expected := 1; expected >= 0; expected-- {
+		transactions, err := sqlite.PostInterest(now)
+		if err != nil || len(transactions) != expected {
+			t.Fatalf("expected %d interest payouts, got %+v, %v", expected, transactions, err)
+		}
+	}
+	interest, err = sqlite.GetAccruedInterest(savings.ID)
+	if err != nil || interest.Amount != "0.2" {
+		t.Errorf("wrong accrued interest after payout: %+v, %v", interest, err)
+	}
+	testBalance(t, sqlite, savings.ID, "3650.60 EUR", "3650.60 EUR")
+	testLedgerBalances(t, sqlite)
+}
+
+func TestSQLiteUniqueEmails(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	alice, err := sqlite.CreateUser(db.User{Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("could not create user: %s", err)
+	}
+
+	var taken *db.EmailTakenError
+	if _, err := sqlite.CreateUser(db.User{Name: "Alicia", Email: "Alice@Example.com"}); !errors.As(err, &taken) {
+		t.Fatalf("expected EmailTakenError, got %v", err)
+	}
+
+	// users without an email do not collide, and the email of a deleted user can be used again
+	for _, name := range []string{"Bob", "Charlie"} {
+		if _, err := sqlite.CreateUser(db.User{Name: name}); err != nil {
+			t.Fatalf("could not create user without email: %s", err)
+		}
+	}
+	if _, err := sqlite.DeleteUser(alice.ID); err != nil {
+		t.Fatalf("could not delete user: %s", err)
+	}
+	if _, err := sqlite.CreateUser(db.User{Name: "Alicia", Email: "alice@example.com"}); err != nil {
+		t.Errorf("could not reuse the email of a deleted user: %s", err)
+	}
+}
+
+func TestSQLiteAuditLogIsAppendOnly(t *testing.T) {
+	sqlite, path := newSQLiteDb(t)
+	event, err := sqlite.CreateAuditEvent(db.AuditEvent{
+		Timestamp: time.Now().UTC(), Route: "POST /account", RequestID: "request-1", SourceIP: "127.0.0.1",
+		Targets: []string{"account:1", "user:1"}, After: []byte(`{"id":1}`), Outcome: db.AuditSucceeded, StatusCode: 200,
+	})
+	if err != nil {
+		t.Fatalf("could not create audit event: %s", err)
+	}
+
+	client, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("could not open database: %s", err)
+	}
+	defer client.Close()
+	for _, statement := range []string{
+		"UPDATE audit_events SET outcome = 'failed'",
+		"DELETE FROM audit_events",
+		"UPDATE audit_targets SET target = 'account:2'",
+		"DELETE FROM audit_targets",
+	} {
+		if _, err := client.Exec(statement); err == nil {
+			t.Errorf("%s: expected the audit log to refuse it", statement)
+		}
+	}
+
+	page, err := sqlite.SearchAuditEvents(db.AuditFilter{Target: "user:1"})
+	if err != nil || len(page.Events) != 1 || page.Events[0].ID != event.ID || page.Events[0].Outcome != db.AuditSucceeded ||
+		len(page.Events[0].Targets) != 2 || string(page.Events[0].After) != `{"id":1}` {
+		t.Errorf("wrong audit events: %+v, %v", page.Events, err)
+	}
+}
+
+func TestSQLiteIdempotencyKeys(t *testing.T) {
+	sqlite, _ := newSQLiteDb(t)
+	key := db.IdempotencyKey{Principal: "user:1", Route: "POST /transaction", Key: "retry-1"}
+	if _, created, err := sqlite.ReserveIdempotencyKey(key, "fingerprint"); err != nil || !created {
+		t.Fatalf("could not reserve key: %v", err)
+	}
+	if err := sqlite.CompleteIdempotencyKey(key, 200, "application/json", []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("could not complete key: %s", err)
+	}
+
+	record, created, err := sqlite.ReserveIdempotencyKey(key, "fingerprint")
+	if err != nil || created || record.StatusCode != 200 || record.ContentType != "application/json" || string(record.Body) != `{"id":1}` {
+		t.Errorf("wrong stored response: %+v, %v", record, err)
+	}
+
+	// the same key sent by someone else, or to another route, is a different key
+	for _, other := range []db.IdempotencyKey{
+		{Principal: "user:2", Route: key.Route, Key: key.Key},
+		{Principal: "client:reports", Route: key.Route, Key: key.Key},
+		{Principal: key.Principal, Route: "POST /hold", Key: key.Key},
+	} {
+		if _, created, err := sqlite.ReserveIdempotencyKey(other, "fingerprint"); err != nil || !created {
+			t.Errorf("%+v: expected a new reservation, got %v", other, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"github.com/CobilasEugen/bank-api/scheduler"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runScheduler(app *router.App, now string) {
+	tasks := scheduler.New(time.Minute)
+	tasks.Add("standing orders", scheduler.StandingOrders(app.Db))
+	at, _ := time.Parse(time.RFC3339, now)
+	tasks.RunOnce(at)
+}
+
+func TestStandingOrderExecutions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	// account 2 holds 200, so the third run fails
+	rr := requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{
+		"from_account_id": 2,
+		"to_account_id": 3,
+		"amount": 80,
+		"frequency": "monthly",
+		"start_date": "2031-01-31",
+		"max_executions": 3
+	}`)
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":2,"to_account_id":3,"amount":80,"currency":"EUR","frequency":"monthly","start_date":"2031-01-31T00:00:00Z","end_date":null,"max_executions":3,"executions":0,"next_run":"2031-01-31T00:00:00Z","status":"active"}`)
+
+	// nothing is due yet
+	runScheduler(&app, "2031-01-30T00:00:00Z")
+	rr = requestAs(app.GetStandingOrderExecutions(), 0, "GET", "/standing-orders/0/executions", "", "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `[]`)
+
+	// missed runs are caught up, and monthly runs fall on the last day of shorter months
+	runScheduler(&app, "2031-04-01T00:00:00Z")
+	rr = requestAs(app.GetStandingOrderExecutions(), 0, "GET", "/standing-orders/0/executions", "", "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"standing_order_id":0,"scheduled_for":"2031-01-31T00:00:00Z","executed_at":"2031-04-01T00:00:00Z","transaction_id":4,"succeeded":1},`+
+		`{"id":1,"standing_order_id":0,"scheduled_for":"2031-02-28T00:00:00Z","executed_at":"2031-04-01T00:00:00Z","transaction_id":5,"succeeded":1},`+
+		`{"id":2,"standing_order_id":0,"scheduled_for":"2031-03-31T00:00:00Z","executed_at":"2031-04-01T00:00:00Z","transaction_id":6,"succeeded":0,"error":"insufficient_funds"}]`)
+
+	rr = requestAs(app.GetStandingOrder(), 0, "GET", "/standing-orders/0", "", "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":2,"to_account_id":3,"amount":80,"currency":"EUR","frequency":"monthly","start_date":"2031-01-31T00:00:00Z","end_date":null,"max_executions":3,"executions":3,"next_run":null,"status":"completed"}`)
+
+	rr = requestAs(app.CancelStandingOrder(), 0, "DELETE", "/standing-orders/0", "", "orderId", "0")
+	testError(t, rr, http.StatusBadRequest, "invalid_standing_order", `invalid standing order: only active orders can be cancelled`)
+}
+
+func TestStandingOrderChanges(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newMockApp()
+
+	rr := requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 1, "to_account_id": 0, "amount": 10, "frequency": "hourly", "start_date": "2031-01-01"}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_standing_order", `invalid standing order: unknown frequency "hourly"`)
+
+	rr = requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 1, "to_account_id": 0, "amount": 10, "frequency": "weekly", "start_date": "2020-01-01"}`)
+	testError(t, rr, http.StatusBadRequest, "invalid_parameter", `Invalid start_date: must not be in the past`)
+
+	rr = requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 1, "to_account_id": 0, "amount": 10, "frequency": "weekly", "start_date": "2031-01-01T09:00:00Z"}`)
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":1,"to_account_id":0,"amount":10,"currency":"EUR","frequency":"weekly","start_date":"2031-01-01T09:00:00Z","end_date":null,"max_executions":null,"executions":0,"next_run":"2031-01-01T09:00:00Z","status":"active"}`)
+
+	// an end date before the next run completes the order
+	rr = requestAs(app.UpdateStandingOrder(), 0, "PATCH", "/standing-orders/0", `{"amount": 12.5, "end_date": "2031-01-08"}`, "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":1,"to_account_id":0,"amount":12.5,"currency":"EUR","frequency":"weekly","start_date":"2031-01-01T09:00:00Z","end_date":"2031-01-08T00:00:00Z","max_executions":null,"executions":0,"next_run":"2031-01-01T09:00:00Z","status":"active"}`)
+
+	runScheduler(&app, "2031-02-01T00:00:00Z")
+	rr = requestAs(app.GetStandingOrder(), 0, "GET", "/standing-orders/0", "", "orderId", "0")
+	testRequest(t, rr, http.StatusOK, `{"id":0,"from_account_id":1,"to_account_id":0,"amount":12.5,"currency":"EUR","frequency":"weekly","start_date":"2031-01-01T09:00:00Z","end_date":"2031-01-08T00:00:00Z","max_executions":null,"executions":1,"next_run":null,"status":"completed"}`)
+
+	rr = requestAs(app.CreateStandingOrder(), 0, "POST", "/standing-orders", `{"from_account_id": 1, "to_account_id": 0, "amount": 10, "frequency": "daily", "start_date": "2031-01-01"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	rr = requestAs(app.CancelStandingOrder(), 0, "DELETE", "/standing-orders/1", "", "orderId", "1")
+	testRequest(t, rr, http.StatusOK, `{"id":1,"from_account_id":1,"to_account_id":0,"amount":10,"currency":"EUR","frequency":"daily","start_date":"2031-01-01T00:00:00Z","end_date":null,"max_executions":null,"executions":0,"next_run":null,"status":"cancelled"}`)
+
+	req, _ := http.NewRequest("GET", "/user/1/standing-orders", nil)
+	req.SetPathValue("userId", "1")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetStandingOrders()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"from_account_id":1`) != 2 {
+		t.Errorf("unexpected standing orders of user 1: %s", rr.Body.String())
+	}
+
+	rr = requestAs(app.GetStandingOrder(), 0, "GET", "/standing-orders/7", "", "orderId", "7")
+	testError(t, rr, http.StatusNotFound, "standing_order_not_found", `standing order 7 does not exist`)
+}
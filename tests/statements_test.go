@@ -0,0 +1,311 @@
+package main
+
+import (
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func statementRequest(app *router.App, query string, accept string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/accounts/5/statement?"+query, nil)
+	req.SetPathValue("accountId", "5")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.GetStatement()).ServeHTTP(rr, req)
+	return rr
+}
+
+// newStatementApp adds account 5 with 100 EUR, which receives 50 and sends 30 in October 2030;
+// another transfer of 500 fails
+func newStatementApp() router.App {
+	app := newMockApp()
+	req, _ := http.NewRequest("POST", "/account", strings.NewReader(`{"user_id": 0, "balance": 100}`))
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	http.HandlerFunc(app.CreateAccount()).ServeHTTP(httptest.NewRecorder(), req)
+
+	for _, body := range []string{
+		`{"from_account_id": 0, "to_account_id": 5, "amount": 50}`,
+		`{"from_account_id": 5, "to_account_id": 1, "amount": 30}`,
+		`{"from_account_id": 5, "to_account_id": 1, "amount": 500}`,
+	} {
+		transactionRequest(&app, body)
+	}
+	return app
+}
+
+func TestStatementFormats(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newStatementApp()
+	period := "from=2030-10-01&to=2030-11-01"
+
+	rr := statementRequest(&app, period, "")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"currency":"EUR","product":"checking","from":"2030-10-01T00:00:00Z","to":"2030-11-01T00:00:00Z","opening_balance":100,"closing_balance":120,"transactions":[{"id":4,"from_account_id":0,"to_account_id":5,"amount":50,"currency":"EUR","to_amount":50,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"direction":"incoming","running_balance":150},{"id":5,"from_account_id":5,"to_account_id":1,"amount":30,"currency":"EUR","to_amount":30,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":1,"direction":"outgoing","running_balance":120}]}`)
+
+	rr = statementRequest(&app, period+"&format=csv", "")
+	testRequest(t, rr, http.StatusOK, `date,transaction_id,description,counterparty_account_id,amount,currency,balance
+2030-10-01,,opening balance,,,EUR,100.00
+2030-10-07,4,transfer from account 0,0,50.00,EUR,150.00
+2030-10-07,5,transfer to account 1,1,-30.00,EUR,120.00
+2030-10-31,,closing balance,,,EUR,120.00`)
+	if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="statement-5-20301001.csv"` {
+		t.Errorf("unexpected Content-Disposition: %s", disposition)
+	}
+
+	// the first supported type of the Accept header is used
+	rr = statementRequest(&app, period, "application/pdf, application/qif;q=0.9, text/csv;q=0.8")
+	testRequest(t, rr, http.StatusOK, `!Type:Bank
+D10/07/2030
+T50.00
+N4
+Ptransfer from account 0
+^
+D10/07/2030
+T-30.00
+N5
+Ptransfer to account 1
+^`)
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/qif" {
+		t.Errorf("unexpected Content-Type: %s", contentType)
+	}
+
+	rr = statementRequest(&app, period, "application/x-ofx")
+	body := regexp.MustCompile(`<DTSERVER>\d+\[0:GMT\]</DTSERVER>`).ReplaceAllString(rr.Body.String(), "<DTSERVER></DTSERVER>")
+	rr.Body.Reset()
+	rr.Body.WriteString(body)
+	testRequest(t, rr, http.StatusOK, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <SIGNONMSGSRSV1>
+    <SONRS>
+      <STATUS>
+        <CODE>0</CODE>
+        <SEVERITY>INFO</SEVERITY>
+      </STATUS>
+      <DTSERVER></DTSERVER>
+      <LANGUAGE>ENG</LANGUAGE>
+    </SONRS>
+  </SIGNONMSGSRSV1>
+  <BANKMSGSRSV1>
+    <STMTTRNRS>
+      <TRNUID>5-20301001</TRNUID>
+      <STATUS>
+        <CODE>0</CODE>
+        <SEVERITY>INFO</SEVERITY>
+      </STATUS>
+      <STMTRS>
+        <CURDEF>EUR</CURDEF>
+        <BANKACCTFROM>
+          <BANKID>BANKAPI</BANKID>
+          <ACCTID>5</ACCTID>
+          <ACCTTYPE>CHECKING</ACCTTYPE>
+        </BANKACCTFROM>
+        <BANKTRANLIST>
+          <DTSTART>20301001000000[0:GMT]</DTSTART>
+          <DTEND>20301101000000[0:GMT]</DTEND>
+          <STMTTRN>
+            <TRNTYPE>CREDIT</TRNTYPE>
+            <DTPOSTED>20301007071422[0:GMT]</DTPOSTED>
+            <TRNAMT>50.00</TRNAMT>
+            <FITID>4</FITID>
+            <NAME>transfer from account 0</NAME>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20301007071422[0:GMT]</DTPOSTED>
+            <TRNAMT>-30.00</TRNAMT>
+            <FITID>5</FITID>
+            <NAME>transfer to account 1</NAME>
+          </STMTTRN>
+        </BANKTRANLIST>
+        <LEDGERBAL>
+          <BALAMT>120.00</BALAMT>
+          <DTASOF>20301101000000[0:GMT]</DTASOF>
+        </LEDGERBAL>
+      </STMTRS>
+    </STMTTRNRS>
+  </BANKMSGSRSV1>
+</OFX>`)
+}
+
+func TestStatementPeriods(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newStatementApp()
+
+	// before and after the transactions the balance does not change
+	rr := statementRequest(&app, "from=2030-09-01&to=2030-10-01", "")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"currency":"EUR","product":"checking","from":"2030-09-01T00:00:00Z","to":"2030-10-01T00:00:00Z","opening_balance":100,"closing_balance":100,"transactions":[]}`)
+
+	rr = statementRequest(&app, "from=2030-11-01&to=2030-12-01", "")
+	testRequest(t, rr, http.StatusOK, `{"account_id":5,"currency":"EUR","product":"checking","from":"2030-11-01T00:00:00Z","to":"2030-12-01T00:00:00Z","opening_balance":120,"closing_balance":120,"transactions":[]}`)
+
+	rr = statementRequest(&app, "from=2030-11-01&to=2030-10-01", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_parameter", `Invalid period: from must be before to`)
+
+	rr = statementRequest(&app, "from=2030-11-01&to=2030-12-01&format=pdf", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_parameter", `Unknown statement format "pdf"`)
+
+	rr = statementRequest(&app, "from=2030-11-01&to=2030-12-01", "application/pdf")
+	testError(t, rr, http.StatusNotAcceptable, "not_acceptable", `Statements are available as JSON, CSV, OFX, QIF, camt.053 or MT940`)
+
+	req, _ := http.NewRequest("GET", "/accounts/9/statement", nil)
+	req.SetPathValue("accountId", "9")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(app.GetStatement()).ServeHTTP(rr, req)
+	testError(t, rr, http.StatusNotFound, "account_not_found", `account 9 does not exist`)
+}
+
+func TestStatementExports(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newStatementApp()
+	period := "from=2030-10-01&to=2030-11-01"
+
+	// the outgoing transfer is reversed, which is an incoming transaction marked as a reversal
+	req, _ := http.NewRequest("POST", "/transaction/5/reverse", strings.NewReader(`{}`))
+	req.SetPathValue("transactionId", "5")
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	http.HandlerFunc(app.ReverseTransaction()).ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := statementRequest(&app, period+"&format=mt940", "")
+	testRequest(t, rr, http.StatusOK, strings.Join([]string{
+		":20:5-20301001",
+		":25:5",
+		":28C:1",
+		":60F:C301001EUR100,00",
+		":61:3010071007C50,00NTRFNONREF//4",
+		":86:transfer from account 0",
+		":61:3010071007D30,00NTRFNONREF//5",
+		":86:transfer to account 1",
+		":61:3010071007RD30,00NTRFNONREF//7",
+		":86:reversal of transaction 5",
+		":62F:C301031EUR150,00",
+		"-",
+	}, "\r\n"))
+	if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename="statement-5-20301001.sta"` {
+		t.Errorf("unexpected Content-Disposition: %s", disposition)
+	}
+
+	rr = statementRequest(&app, period, "application/xml")
+	body := regexp.MustCompile(`<CreDtTm>[^<]+</CreDtTm>`).ReplaceAllString(rr.Body.String(), "<CreDtTm></CreDtTm>")
+	rr.Body.Reset()
+	rr.Body.WriteString(body)
+	testRequest(t, rr, http.StatusOK, `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <GrpHdr>
+      <MsgId>STMT-5-20301001</MsgId>
+      <CreDtTm></CreDtTm>
+    </GrpHdr>
+    <Stmt>
+      <Id>5-20301001</Id>
+      <CreDtTm></CreDtTm>
+      <FrToDt>
+        <FrDtTm>2030-10-01T00:00:00Z</FrDtTm>
+        <ToDtTm>2030-11-01T00:00:00Z</ToDtTm>
+      </FrToDt>
+      <Acct>
+        <Id>
+          <Othr>
+            <Id>5</Id>
+          </Othr>
+        </Id>
+        <Ccy>EUR</Ccy>
+      </Acct>
+      <Bal>
+        <Tp>
+          <CdOrPrtry>
+            <Cd>OPBD</Cd>
+          </CdOrPrtry>
+        </Tp>
+        <Amt Ccy="EUR">100.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt>
+          <Dt>2030-10-01</Dt>
+        </Dt>
+      </Bal>
+      <Bal>
+        <Tp>
+          <CdOrPrtry>
+            <Cd>CLBD</Cd>
+          </CdOrPrtry>
+        </Tp>
+        <Amt Ccy="EUR">150.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Dt>
+          <Dt>2030-10-31</Dt>
+        </Dt>
+      </Bal>
+      <Ntry>
+        <NtryRef>4</NtryRef>
+        <Amt Ccy="EUR">50.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt>
+          <DtTm>2030-10-07T07:14:22Z</DtTm>
+        </BookgDt>
+        <ValDt>
+          <Dt>2030-10-07</Dt>
+        </ValDt>
+        <AcctSvcrRef>4</AcctSvcrRef>
+        <BkTxCd>
+          <Prtry>
+            <Cd>TRANSFER</Cd>
+          </Prtry>
+        </BkTxCd>
+        <AddtlNtryInf>transfer from account 0</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <NtryRef>5</NtryRef>
+        <Amt Ccy="EUR">30.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt>
+          <DtTm>2030-10-07T07:14:22Z</DtTm>
+        </BookgDt>
+        <ValDt>
+          <Dt>2030-10-07</Dt>
+        </ValDt>
+        <AcctSvcrRef>5</AcctSvcrRef>
+        <BkTxCd>
+          <Prtry>
+            <Cd>TRANSFER</Cd>
+          </Prtry>
+        </BkTxCd>
+        <AddtlNtryInf>transfer to account 1</AddtlNtryInf>
+      </Ntry>
+      <Ntry>
+        <NtryRef>7</NtryRef>
+        <Amt Ccy="EUR">30.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <RvslInd>true</RvslInd>
+        <Sts>BOOK</Sts>
+        <BookgDt>
+          <DtTm>2030-10-07T07:14:22Z</DtTm>
+        </BookgDt>
+        <ValDt>
+          <Dt>2030-10-07</Dt>
+        </ValDt>
+        <AcctSvcrRef>7</AcctSvcrRef>
+        <BkTxCd>
+          <Prtry>
+            <Cd>TRANSFER</Cd>
+          </Prtry>
+        </BkTxCd>
+        <AddtlNtryInf>reversal of transaction 5</AddtlNtryInf>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>`)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/CobilasEugen/bank-api/router"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newHistoryApp lifts the per user rate limit, which these tests would run into
+func newHistoryApp() router.App {
+	app := newMockApp()
+	app.Limiters["user"] = router.NewLimiter(1000, func(r *http.Request) string { return r.PathValue("userId") })
+	return app
+}
+
+func historyRequest(app *router.App, url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	userId := strings.Split(strings.Split(url, "?")[0], "/")[3]
+	req.SetPathValue("userId", userId)
+	req.RemoteAddr = "127.0.0.1:8080"
+	signIn(req)
+	rr := httptest.NewRecorder()
+
+	handler := app.GetOutTransactions()
+	if strings.HasPrefix(url, "/transaction/in/") {
+		handler = app.GetInTransactions()
+	}
+	http.HandlerFunc(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+// transactionIds lists the ids of the transactions in a response, to keep expectations short
+func transactionIds(t *testing.T, rr *httptest.ResponseRecorder) string {
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body.String())
+	}
+
+	var transactions []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &transactions); err != nil {
+		t.Fatalf("could not decode transactions: %s", err)
+	}
+	ids := []string{}
+	for _, transaction := range transactions {
+		ids = append(ids, fmt.Sprint(transaction.ID))
+	}
+	return strings.Join(ids, ",")
+}
+
+// nextLink returns the url of the next page from the Link header
+func nextLink(rr *httptest.ResponseRecorder) string {
+	link := rr.Header().Get("Link")
+	if link == "" {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+}
+
+func TestTransactionHistoryPagination(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	// user 0 sent transactions 0 (600 to account 1), 1 (500 to account 1, failed) and 2 (500 to account 2, failed)
+	rr := historyRequest(&app, "/transaction/out/0?limit=2")
+	if ids := transactionIds(t, rr); ids != "0,1" {
+		t.Errorf("unexpected first page: %s", ids)
+	}
+	next := nextLink(rr)
+	if !strings.HasPrefix(next, "/transaction/out/0?cursor=") || !strings.HasSuffix(next, "&limit=2") {
+		t.Fatalf("unexpected next link: %q", next)
+	}
+
+	rr = historyRequest(&app, next)
+	if ids := transactionIds(t, rr); ids != "2" {
+		t.Errorf("unexpected second page: %s", ids)
+	}
+	if link := rr.Header().Get("Link"); link != "" {
+		t.Errorf("the last page links to another one: %s", link)
+	}
+
+	// equal amounts are ordered by id
+	rr = historyRequest(&app, "/transaction/out/0?sort=-amount&limit=2")
+	if ids := transactionIds(t, rr); ids != "0,2" {
+		t.Errorf("unexpected first page: %s", ids)
+	}
+	rr = historyRequest(&app, nextLink(rr))
+	if ids := transactionIds(t, rr); ids != "1" {
+		t.Errorf("unexpected second page: %s", ids)
+	}
+
+	// a cursor only works with the sort order it was created for
+	rr = historyRequest(&app, "/transaction/out/0?limit=2")
+	rr = historyRequest(&app, strings.Replace(nextLink(rr), "?", "?sort=amount&", 1))
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: the cursor belongs to another sort order`)
+
+	rr = historyRequest(&app, "/transaction/out/0?cursor=nope")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: invalid cursor`)
+}
+
+func TestTransactionHistoryFilters(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	for _, test := range []struct {
+		url string
+		ids string
+	}{
+		{"/transaction/out/0?succeeded=false", "1,2"},
+		{"/transaction/out/0?succeeded=true", "0"},
+		{"/transaction/out/0?counterparty=1&succeeded=false", "1"},
+		{"/transaction/out/0?min_amount=550", "0"},
+		{"/transaction/out/0?max_amount=500.009", "1,2"},
+		{"/transaction/out/0?min_amount=500&max_amount=500", "1,2"},
+		{"/transaction/out/0?from=2030-10-07T07:14:22Z", "0,1,2"},
+		{"/transaction/out/0?from=2030-10-08", ""},
+		{"/transaction/out/0?to=2030-10-07T07:14:22Z", ""},
+		{"/transaction/out/0?sort=-timestamp", "2,1,0"},
+		{"/transaction/in/2?sort=amount", "3,2"},
+		{"/transaction/in/2?counterparty=0", "2"},
+	} {
+		rr := historyRequest(&app, test.url)
+		if ids := transactionIds(t, rr); ids != test.ids {
+			t.Errorf("%s: got transactions %q want %q", test.url, ids, test.ids)
+		}
+	}
+
+	rr := historyRequest(&app, "/transaction/out/0?counterparty=2")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"from_account_id":0,"to_account_id":2,"amount":500,"currency":"EUR","to_amount":500,"to_currency":"EUR","exchange_rate":"1","timestamp":"2030-10-07T12:44:22+05:30","succeeded":0,"failure_reason":"insufficient_funds"}]`)
+
+	for url, message := range map[string]string{
+		"/transaction/out/0?sort=size":                     `invalid filter: unknown sort order "size"`,
+		"/transaction/out/0?limit=5000":                    `invalid filter: limit must be between 1 and 1000`,
+		"/transaction/out/0?limit=none":                    `invalid filter: invalid limit "none"`,
+		"/transaction/out/0?min_amount=1/3":                `invalid filter: invalid amount "1/3"`,
+		"/transaction/out/0?min_amount=10&max_amount=5":    `invalid filter: min_amount must not be larger than max_amount`,
+		"/transaction/out/0?from=yesterday":                `invalid filter: invalid date "yesterday"`,
+		"/transaction/out/0?from=2030-10-08&to=2030-10-07": `invalid filter: from must be before to`,
+		"/transaction/out/0?succeeded=maybe":               `invalid filter: invalid succeeded value "maybe"`,
+		"/transaction/out/0?counterparty=bank":             `invalid filter: invalid counterparty account id "bank"`,
+	} {
+		rr := historyRequest(&app, url)
+		testError(t, rr, http.StatusBadRequest, "invalid_filter", message)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestSearchUsers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	app := newHistoryApp()
+
+	createUserRequest(&app, `{"name": "Alicia", "email": "alicia@example.com"}`)
+	createUserRequest(&app, `{"name": "Dan", "email": "dan@example.com"}`)
+
+	rr := requestAs(app.SearchUsers(), 0, "GET", "/users?name=ali", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"name":"Alice","role":"admin"},{"id":3,"name":"Alicia","role":"customer","email":"alicia@example.com"}]`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?email=DAN@example.com", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":4,"name":"Dan","role":"customer","email":"dan@example.com"}]`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?account_id=3", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"name":"Charlie","role":"customer"}]`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?name=ali&account_id=3", "")
+	testRequest(t, rr, http.StatusOK, `[]`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?name=%25", "")
+	testRequest(t, rr, http.StatusOK, `[]`)
+
+	// every user, two per page
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?limit=2", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":0,"name":"Alice","role":"admin"},{"id":1,"name":"Bob","role":"customer"}]`)
+	if link := rr.Header().Get("Link"); link != `</users?cursor=dXNlcnM6MQ&limit=2>; rel="next"` {
+		t.Fatalf("handler returned wrong link: %s", link)
+	}
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?cursor=dXNlcnM6MQ&limit=2", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":2,"name":"Charlie","role":"customer"},{"id":3,"name":"Alicia","role":"customer","email":"alicia@example.com"}]`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?cursor=dXNlcnM6Mw&limit=2", "")
+	testRequest(t, rr, http.StatusOK, `[{"id":4,"name":"Dan","role":"customer","email":"dan@example.com"}]`)
+	if link := rr.Header().Get("Link"); link != "" {
+		t.Errorf("last page has a link: %s", link)
+	}
+
+	// deleted users are not found
+	requestAs(app.DeleteUser(), 0, "DELETE", "/user/4", "", "userId", "4")
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?email=dan@example.com", "")
+	testRequest(t, rr, http.StatusOK, `[]`)
+
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?limit=501", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: limit must be between 1 and 500`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?account_id=x", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: invalid account id "x"`)
+	rr = requestAs(app.SearchUsers(), 0, "GET", "/users?cursor=x", "")
+	testError(t, rr, http.StatusBadRequest, "invalid_filter", `invalid filter: invalid cursor`)
+}